@@ -11,45 +11,53 @@ import (
 	"log"
 
 	"github.com/gmlewis/go-lunatic/lunatic"
+	"github.com/gmlewis/go-lunatic/lunatic/message"
+	"github.com/gmlewis/go-lunatic/lunatic/process"
+)
+
+const (
+	parentTag = 1
+	helloTag  = 2
+)
+
+var (
+	child     = lunatic.RegisterFunc(childProcess)
+	parentBox = message.NewMailbox[uint64](parentTag, nil)
+	helloBox  = message.NewMailbox[string](helloTag, nil)
 )
 
 //go:wasm-module monitor
-func main() { // mailbox any) {
-	args, err := lunatic.Args()
+func main() {
+	pid, err := lunatic.SpawnFunc(child)
 	must(err)
-	if len(args) != 1 {
-		log.Fatalf("expected mailbox name, but args=%+v", args)
+	must(process.Monitor(uint64(pid)))
+	must(parentBox.Send(uint64(pid), process.ProcessID()))
+
+	for {
+		msg, err := message.Receive(nil, nil)
+		must(err)
+
+		switch m := msg.(type) {
+		case *message.DataMessage:
+			var s string
+			must(message.DecodeData(&s))
+			log.Printf("%v", s)
+		case *message.ProcessDiedSignal:
+			log.Printf("Process %v died", m.ProcessID)
+			log.Printf("Done.")
+			return
+		}
 	}
-	log.Printf("args=%+v", args)
-
-	// mailboxName := args[0]
-
-	/*
-	   let mailbox = mailbox.monitorable();
-
-	   let process = Process::spawn(mailbox.this(), child_process);
-	   mailbox.monitor(process);
-
-	   loop {
-	       match mailbox.receive() {
-	           MessageSignal::Message(msg) => {
-	               println!("{msg}");
-	           }
-	           MessageSignal::Signal(ProcessDiedSignal(id)) => {
-	               println!("Process {id} died");
-	               break;
-	           }
-	       }
-	   }
-	*/
-
-	log.Printf("Done.")
 }
 
-func childProcess(parent, mailbox any) {
-	log.Printf("childProcess: parent=%[1]T=%[1]v, mailbox=%[2]T=%[2]v", parent, mailbox)
-	// parent.send("Hello".to_string());
-	// lunatic::sleep(Duration::from_secs(3));
+func childProcess() {
+	parent, err := parentBox.Receive()
+	must(err)
+	must(helloBox.Send(parent, "Hello"))
+	process.SleepMS(3000)
+	// Exit with a failure so that emulated monitors, which are
+	// built on links, also notice.
+	panic("child process failed")
 }
 
 func must(err error) {
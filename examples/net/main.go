@@ -15,18 +15,11 @@ const uri = "google.com:80"
 
 //go:wasm-module net
 func main() {
-	dnsIterID, err := networking.Resolve(uri, nil)
+	infos, err := networking.LookupHost(uri, 0)
 	must(err)
 
-	var count int
-	for {
-		dnsInfo, err := networking.ResolveNext(dnsIterID)
-		must(err)
-		if dnsInfo == nil {
-			break
-		}
-		count++
-		fmt.Printf("'%v' %v: dns address type %v: %v port %v\n", uri, count, dnsInfo.AddrType, dnsInfo.IP, dnsInfo.Port)
+	for i, dnsInfo := range infos {
+		fmt.Printf("'%v' %v: dns address type %v: %v\n", uri, i+1, dnsInfo.AddrType, dnsInfo.TCPAddr())
 	}
 
 	log.Printf("Done.")
@@ -10,14 +10,16 @@ import (
 	"github.com/gmlewis/go-lunatic/lunatic"
 )
 
+var child = lunatic.RegisterFunc(func() {
+	log.Printf("[subprocess] 👋 from spawned process!")
+})
+
 //go:wasm-module simple-process
 func main() {
 	log.Printf("[main process] Hello from the main process!")
 	log.Printf("[main process] Spawning a child...")
 
-	_, err := lunatic.SpawnFunc(func() {
-		log.Printf("[subprocess] 👋 from spawned process!")
-	})
+	_, err := lunatic.SpawnFunc(child)
 	must(err)
 }
 
@@ -6,6 +6,10 @@ package main
 
 import (
 	"log"
+
+	"github.com/gmlewis/go-lunatic/lunatic"
+	"github.com/gmlewis/go-lunatic/lunatic/message"
+	"github.com/gmlewis/go-lunatic/lunatic/process"
 )
 
 type SomeData[T any] struct {
@@ -13,31 +17,38 @@ type SomeData[T any] struct {
 	Value T
 }
 
+var (
+	mailbox   = message.NewMailbox[SomeData[int]](0, nil)
+	localData = SomeData[int]{Key: "localData", Value: 54321}
+
+	child = lunatic.RegisterFunc(func() {
+		log.Printf("[subprocess] 👋 from spawned process!")
+		log.Printf("[subprocess] receiving some data...")
+		data, err := mailbox.Receive()
+		must(err)
+		log.Printf("%#v", data)
+		log.Printf("[subprocess] data within the closure:")
+		log.Printf("%#v", localData)
+	})
+)
+
 //go:wasm-module spawn
 func main() {
 	log.Printf("[main process] Hello from the main process!")
 	log.Printf("[main process] Spawning a child...")
 
-	// TODO: complete this
-	/*
-		mailbox := process.CreateMailbox()
-		localData := SomeData[int]{Key: "localData", Value: 54321}
-
-		child, err := process.SpawnFunc(func() {
-			log.Printf("[subprocess] 👋 from spawned process!")
-			log.Printf("[subprocess] receiving some data...")
-			log.Printf(process.Receive(mailbox))
-			log.Printf("[subprocess] data within the closure:")
-			log.Printf("%#v", localData)
-		})
-		if err != nil {
-			log.Fatal(err)
-		}
-
-		log.Printf("[main process] sending some data...")
-
-		data := SomeData[int]{Key: "dataKey", Value: 42}
-		process.Send(child, data, mailbox)
-		process.SleepMS(100)
-	*/
+	pid, err := lunatic.SpawnFunc(child)
+	must(err)
+
+	log.Printf("[main process] sending some data...")
+
+	data := SomeData[int]{Key: "dataKey", Value: 42}
+	must(mailbox.Send(uint64(pid), data))
+	process.SleepMS(100)
+}
+
+func must(err error) {
+	if err != nil {
+		log.Fatal(err)
+	}
 }
@@ -0,0 +1,236 @@
+// -*- compile-command: "GOOS=wasip1 GOARCH=wasm go test ./..."; -*-
+
+// Package abstractprocess provides a GenServer-style framework for writing
+// stateful server processes, modeled after `AbstractProcess` in lunatic-rs.
+//
+// A server is a type implementing AbstractProcess. Its methods are called
+// from a receive loop running in a dedicated lunatic process:
+//
+//	type Counter struct{ n int }
+//
+//	func (c *Counter) Init(start int) error    { c.n = start; return nil }
+//	func (c *Counter) HandleCall(req Get) int  { return c.n }
+//	func (c *Counter) HandleCast(msg Inc)      { c.n += int(msg) }
+//	func (c *Counter) Terminate()              {}
+//
+//	var counter = abstractprocess.New(func() abstractprocess.AbstractProcess[int, Get, int, Inc] {
+//		return &Counter{}
+//	})
+//
+//	func main() {
+//		ref, err := counter.StartLink(1, 1)
+//		...
+//		ref.Cast(Inc(2))
+//		n, err := ref.Call(Get{})
+//	}
+//
+// Like all functions spawned with `lunatic.SpawnFunc`, servers must be
+// created with New during package initialization.
+package abstractprocess
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gmlewis/go-lunatic/lunatic"
+	"github.com/gmlewis/go-lunatic/lunatic/message"
+	"github.com/gmlewis/go-lunatic/lunatic/process"
+)
+
+// Tags of the messages exchanged between a ProcessRef and its server.
+const (
+	initTag     int64 = 0x4150_0001
+	callTag     int64 = 0x4150_0002
+	castTag     int64 = 0x4150_0003
+	shutdownTag int64 = 0x4150_0004
+)
+
+// DefaultInitTimeout is the default time that Start and StartLink wait
+// for the Init method of a new server to return.
+const DefaultInitTimeout = 5 * time.Second
+
+// AbstractProcess is implemented by the state of a server process.
+//
+// Arg is the type of the argument passed to Init, Call and Reply are the
+// types of synchronous requests and their replies, and Cast is the type of
+// asynchronous messages.
+type AbstractProcess[Arg, Call, Reply, Cast any] interface {
+	// Init is called once when the server process starts.
+	// If it returns an error, the server process exits and Start
+	// or StartLink return the error.
+	Init(arg Arg) error
+	// HandleCall handles a request sent with ProcessRef.Call and returns the reply.
+	HandleCall(req Call) Reply
+	// HandleCast handles a message sent with ProcessRef.Cast.
+	HandleCast(msg Cast)
+	// Terminate is called when the server is stopped with ProcessRef.Shutdown.
+	Terminate()
+}
+
+// Server starts server processes for an AbstractProcess implementation.
+//
+// Server processes trap link deaths: they ignore callers that fail during
+// a call and still die when another linked process fails, e.g. the
+// process that started them with StartLink. Messages with other tags than
+// the ones used by ProcessRef are dropped.
+type Server[Arg, Call, Reply, Cast any] struct {
+	// InitTimeout is the time that Start and StartLink wait for Init to return.
+	InitTimeout time.Duration
+
+	newState func() AbstractProcess[Arg, Call, Reply, Cast]
+	entry    func()
+}
+
+// New returns a Server whose processes get their state from `newState`.
+//
+// New registers the entry point of the server processes with
+// `lunatic.RegisterFunc`, so it must only be called during package
+// initialization.
+func New[Arg, Call, Reply, Cast any](newState func() AbstractProcess[Arg, Call, Reply, Cast]) *Server[Arg, Call, Reply, Cast] {
+	s := &Server[Arg, Call, Reply, Cast]{
+		InitTimeout: DefaultInitTimeout,
+		newState:    newState,
+	}
+	s.entry = lunatic.RegisterFunc(s.run)
+	return s
+}
+
+// Start spawns a new server process and waits for its Init method to return.
+func (s *Server[Arg, Call, Reply, Cast]) Start(arg Arg) (*ProcessRef[Call, Reply, Cast], error) {
+	return s.start(0, arg)
+}
+
+// StartLink is like Start but also links the server process to the current
+// process with `tag` as the link-tag. See `process.Link`.
+func (s *Server[Arg, Call, Reply, Cast]) StartLink(arg Arg, tag int64) (*ProcessRef[Call, Reply, Cast], error) {
+	return s.start(tag, arg)
+}
+
+func (s *Server[Arg, Call, Reply, Cast]) start(tag int64, arg Arg) (*ProcessRef[Call, Reply, Cast], error) {
+	pid, err := lunatic.SpawnLinkFunc(tag, s.entry)
+	if err != nil {
+		return nil, err
+	}
+	id := uint64(pid)
+
+	initErr, err := message.Request[string](id, initTag, arg, s.InitTimeout)
+	if err != nil {
+		// Don't leave a process behind that might still start. Unlink it
+		// first, so that killing it doesn't kill the current process.
+		if tag != 0 {
+			process.Unlink(id)
+		}
+		process.Kill(id)
+		return nil, fmt.Errorf("abstractprocess: init: %w", err)
+	}
+	if initErr != "" {
+		return nil, fmt.Errorf("abstractprocess: init: %v", initErr)
+	}
+	return &ProcessRef[Call, Reply, Cast]{id: id}, nil
+}
+
+// run is the entry point of a server process.
+func (s *Server[Arg, Call, Reply, Cast]) run() {
+	state := s.newState()
+	// Callers are linked to the server during calls, see `message.Request`.
+	// Trap link deaths so that a failing caller doesn't take the server down.
+	process.DieWhenLinkDies(false)
+
+	init, err := message.ReceiveRequest[Arg](initTag)
+	if err != nil {
+		panic(fmt.Sprintf("abstractprocess: init: %v", err))
+	}
+	if err := state.Init(init.Body); err != nil {
+		init.Reply(err.Error())
+		return
+	}
+	if err := init.Reply(""); err != nil {
+		panic(fmt.Sprintf("abstractprocess: init: %v", err))
+	}
+
+	for {
+		msg, err := message.Receive(nil, nil)
+		if err != nil {
+			panic(fmt.Sprintf("abstractprocess: receive: %v", err))
+		}
+		if sig, ok := msg.(*message.LinkDiedSignal); ok && !process.IsWatchTag(sig.Tag) {
+			// Die with the other links, like without trapping.
+			panic(fmt.Sprintf("abstractprocess: linked process with link-tag %v died", sig.Tag))
+		}
+		data, ok := msg.(*message.DataMessage)
+		if !ok {
+			continue
+		}
+
+		switch data.Tag {
+		case callTag:
+			call, err := message.DecodeRequest[Call]()
+			if err != nil {
+				panic(fmt.Sprintf("abstractprocess: call: %v", err))
+			}
+			if err := call.Reply(state.HandleCall(call.Body)); err != nil {
+				panic(fmt.Sprintf("abstractprocess: call: %v", err))
+			}
+		case castTag:
+			var msg Cast
+			if err := message.DecodeData(&msg); err != nil {
+				panic(fmt.Sprintf("abstractprocess: cast: %v", err))
+			}
+			state.HandleCast(msg)
+		case shutdownTag:
+			call, err := message.DecodeRequest[struct{}]()
+			if err != nil {
+				panic(fmt.Sprintf("abstractprocess: shutdown: %v", err))
+			}
+			state.Terminate()
+			call.Reply(struct{}{})
+			return
+		}
+	}
+}
+
+// ProcessRef is a handle to a running server process.
+type ProcessRef[Call, Reply, Cast any] struct {
+	id uint64
+}
+
+// ID returns the process ID of the server.
+func (p *ProcessRef[Call, Reply, Cast]) ID() uint64 { return p.id }
+
+// Call sends `req` to the server and waits for the reply of its HandleCall method.
+//
+// Returns:
+// * nil on success with the reply.
+// * *message.RequestError wrapping message.ProcessDied if the server is not running.
+func (p *ProcessRef[Call, Reply, Cast]) Call(req Call) (Reply, error) {
+	return message.Request[Reply](p.id, callTag, req, 0)
+}
+
+// CallTimeout is like Call but gives up after `timeout`, returning a
+// *message.RequestError wrapping message.CallTimedOut.
+func (p *ProcessRef[Call, Reply, Cast]) CallTimeout(req Call, timeout time.Duration) (Reply, error) {
+	return message.Request[Reply](p.id, callTag, req, timeout)
+}
+
+// Cast sends `msg` to the HandleCast method of the server without waiting.
+//
+// There are no guarantees that the message will be received.
+func (p *ProcessRef[Call, Reply, Cast]) Cast(msg Cast) error {
+	message.CreateData(castTag, 0)
+	if err := message.EncodeData(msg, nil); err != nil {
+		return err
+	}
+	return message.Send(p.id)
+}
+
+// Shutdown stops the server after its Terminate method returns.
+//
+// If `timeout` is greater than 0, Shutdown gives up waiting after `timeout`.
+func (p *ProcessRef[Call, Reply, Cast]) Shutdown(timeout time.Duration) error {
+	_, err := message.Request[struct{}](p.id, shutdownTag, struct{}{}, timeout)
+	if errors.Is(err, message.ProcessDied) {
+		return nil // already stopped.
+	}
+	return err
+}
@@ -0,0 +1,138 @@
+// -*- compile-command: "go test ./..."; -*-
+
+package abstractprocess_test
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gmlewis/go-lunatic/lunatic"
+	"github.com/gmlewis/go-lunatic/lunatic/abstractprocess"
+	"github.com/gmlewis/go-lunatic/lunatic/message"
+	"github.com/gmlewis/go-lunatic/lunatic/process"
+)
+
+type get struct{}
+
+type counter struct{ n int }
+
+func (c *counter) Init(start int) error {
+	if start < 0 {
+		return errors.New("negative start")
+	}
+	if start == slowStart {
+		process.SleepMS(1000)
+	}
+	c.n = start
+	return nil
+}
+
+func (c *counter) HandleCall(get) int {
+	if c.n == slowCall {
+		process.SleepMS(50)
+	}
+	return c.n
+}
+func (c *counter) HandleCast(inc int) { c.n += inc }
+func (c *counter) Terminate()         {}
+
+const (
+	// slowStart makes Init take longer than the InitTimeout of slowServer.
+	slowStart = 1 << 20
+	// slowCall makes HandleCall take 50ms.
+	slowCall = 1 << 21
+)
+
+var slowServer = abstractprocess.New(func() abstractprocess.AbstractProcess[int, get, int, int] {
+	return &counter{}
+})
+
+func init() {
+	slowServer.InitTimeout = 10 * time.Millisecond
+}
+
+var server = abstractprocess.New(func() abstractprocess.AbstractProcess[int, get, int, int] {
+	return &counter{}
+})
+
+// ref is the server used by the caller and parent processes.
+var ref atomic.Pointer[abstractprocess.ProcessRef[get, int, int]]
+
+var caller = lunatic.RegisterFunc(func() {
+	ref.Load().Call(get{})
+})
+
+var parent = lunatic.RegisterFunc(func() {
+	r, err := server.StartLink(1, 1)
+	if err != nil {
+		panic(err)
+	}
+	ref.Store(r)
+	panic("parent")
+})
+
+func TestServer(t *testing.T) {
+	ref, err := server.Start(10)
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+
+	if err := ref.Cast(5); err != nil {
+		t.Fatalf("Cast: %v", err)
+	}
+	if n, err := ref.Call(get{}); err != nil || n != 15 {
+		t.Errorf("Call = %v, %v, want 15", n, err)
+	}
+
+	if err := ref.Shutdown(0); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	if _, err := ref.Call(get{}); !errors.Is(err, message.ProcessDied) {
+		t.Errorf("Call after Shutdown = %v, want ProcessDied", err)
+	}
+}
+
+func TestInitError(t *testing.T) {
+	if _, err := server.Start(-1); err == nil {
+		t.Error("Start with a failing Init: want error")
+	}
+}
+
+func TestInitTimeout(t *testing.T) {
+	// The server process is killed without killing the current process.
+	if _, err := slowServer.StartLink(slowStart, 1); !errors.Is(err, message.CallTimedOut) {
+		t.Errorf("StartLink with a slow Init = %v, want CallTimedOut", err)
+	}
+}
+
+func TestCallerKilled(t *testing.T) {
+	r, err := server.Start(slowCall)
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer r.Shutdown(0)
+	ref.Store(r)
+
+	pid, err := lunatic.SpawnFunc(caller)
+	if err != nil {
+		t.Fatalf("SpawnFunc: %v", err)
+	}
+	process.SleepMS(20)
+	process.Kill(uint64(pid))
+
+	if n, err := r.CallTimeout(get{}, time.Second); err != nil || n != slowCall {
+		t.Errorf("Call after the caller was killed = %v, %v, want %v", n, err, slowCall)
+	}
+}
+
+func TestParentFailed(t *testing.T) {
+	if _, err := lunatic.SpawnFunc(parent); err != nil {
+		t.Fatalf("SpawnFunc: %v", err)
+	}
+	process.SleepMS(50)
+	if _, err := ref.Load().CallTimeout(get{}, time.Second); !errors.Is(err, message.ProcessDied) {
+		t.Errorf("Call after the parent failed = %v, want ProcessDied", err)
+	}
+}
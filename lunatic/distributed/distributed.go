@@ -4,6 +4,7 @@
 package distributed
 
 import (
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"math"
@@ -25,14 +26,9 @@ type size = uint32
 func mkptr[T any](v *T) ptr { return unsafe.Pointer(v) }
 
 // NodesCount returns the number of registered nodes.
-//
-//go:wasmimport lunatic::distributed nodes_count
-//go:noescape
-func NodesCount() uint32
-
-//go:wasmimport lunatic::distributed get_nodes
-//go:noescape
-func get_nodes(buf ptr, bufLen size) uint32
+func NodesCount() uint32 {
+	return nodes_count()
+}
 
 // GetNodes copies node IDs into the `ids` slice which must have
 // enough capacity to hold the results.
@@ -48,28 +44,21 @@ func GetNodes(ids []uint64) (err error) {
 		}
 	}()
 
-	n = get_nodes(mkptr(&ids[0]), size(uintptr(len(ids))*unsafe.Sizeof(uint64(0))))
+	n = get_nodes(mkptr(&ids[0]), size(len(ids)))
 	sh := (*reflect.SliceHeader)(unsafe.Pointer(&ids))
 	sh.Len = int(n) // override the slice's length to the returned results.
 	return nil
 }
 
 // NodeID returns the ID of the node that the current process is running on.
-//
-//go:wasmimport lunatic::distributed node_id
-//go:noescape
-func NodeID() uint64
+func NodeID() uint64 {
+	return node_id()
+}
 
 // ModuleID returns the ID of the module that the current process is spawned from.
-//
-//go:wasmimport lunatic::distributed module_id
-//go:noescape
-func ModuleID() uint64
-
-//go:wasmimport lunatic::distributed spawn
-//go:noescape
-func spawn(nodeID uint64, configID int64, moduleID uint64,
-	funcStrPtr ptr, funcStrLen size, paramsPtr ptr, paramsLen size, idPtr ptr) uint32
+func ModuleID() uint64 {
+	return module_id()
+}
 
 // Spawn spawns a new process using the passed-in function inside a module
 // as the entry point. The process is spawned on a node with ID `nodeID`.
@@ -97,55 +86,53 @@ func Spawn(nodeID uint64, configID int64, moduleID uint64, funcStr string, param
 		}
 	}()
 
-	paramsBytes := make([]byte, 18*len(params))
-	copyBytes := func(index int, v uint64) {
-		src := unsafe.Slice((*byte)(unsafe.Pointer(&v)), 17)
-		for i := 0; i < 17; i++ {
-			paramsBytes[index*18+i] = src[i]
-		}
-	}
-
+	// Each param is encoded as a value type byte followed by a
+	// 128-bit little-endian value.
+	paramsBytes := make([]byte, 17*len(params))
 	for i, param := range params {
-		i32func := func(v uint64) {
-			paramsBytes[i*18] = 0x7F // i32
-			copyBytes(i, v)
-		}
-		i64func := func(v uint64) {
-			paramsBytes[i*18] = 0x7E // i64
-			copyBytes(i, v)
-		}
-
+		var v uint64
+		valueType := byte(0x7F) // i32
 		switch t := param.(type) {
 		case int8:
-			i32func(uint64(t))
+			v = uint64(t)
 		case int16:
-			i32func(uint64(t))
+			v = uint64(t)
 		case int:
-			i32func(uint64(t))
+			v = uint64(t)
 		case int32:
-			i32func(uint64(t))
+			v = uint64(t)
 		case uint8:
-			i32func(uint64(t))
+			v = uint64(t)
 		case uint16:
-			i32func(uint64(t))
+			v = uint64(t)
 		case uint:
-			i32func(uint64(t))
+			v = uint64(t)
 		case uint32:
-			i32func(uint64(t))
+			v = uint64(t)
 		case int64:
-			i64func(uint64(t))
+			v, valueType = uint64(t), 0x7E // i64
 		case uint64:
-			i64func(uint64(t))
+			v, valueType = t, 0x7E
 		case uintptr:
-			i64func(uint64(t))
+			v, valueType = uint64(t), 0x7E
 		// case i128, u128:  // https://github.com/golang/go/issues/9455#issuecomment-74165846
 		default:
 			return id, fmt.Errorf("distributed.spawn params[%v] = %T, expected integer", i, param)
 		}
+		paramsBytes[i*17] = valueType
+		binary.LittleEndian.PutUint64(paramsBytes[i*17+1:], v)
 	}
 
-	errno := spawn(nodeID, configID, moduleID, mkptr(&funcStr), size(len(funcStr)),
-		mkptr(&paramsBytes[0]), size(len(paramsBytes)), mkptr(&id))
+	funcStrBytes := []byte(funcStr)
+	var paramsBytesPtr ptr
+	if len(paramsBytes) > 0 {
+		paramsBytesPtr = mkptr(&paramsBytes[0])
+	}
+
+	var processID uint64
+	errno := spawn(nodeID, configID, moduleID, mkptr(&funcStrBytes[0]), size(len(funcStr)),
+		paramsBytesPtr, size(len(paramsBytes)), mkptr(&processID))
+	id = uint32(processID)
 	switch errno {
 	case 0:
 		return id, nil
@@ -160,10 +147,6 @@ func Spawn(nodeID uint64, configID int64, moduleID uint64, funcStr string, param
 	}
 }
 
-//go:wasmimport lunatic::distributed send
-//go:noescape
-func send(nodeID, processID uint64) uint32
-
 // Send sends the message in scratch area to a process running on a node with ID `nodeID`.
 //
 // There are no guarantees that the message will be received.
@@ -199,10 +182,6 @@ func Send(nodeID, processID uint64) (err error) {
 	}
 }
 
-//go:wasmimport lunatic::distributed send_receive_skip_search
-//go:noescape
-func send_receive_skip_search(nodeID, processID uint64, waitOnTag int64, timeoutDuration uint64) uint32
-
 // SendReceiveSkipSearch sends the message to a process on a node with ID `nodeID` and waits for a reply,
 // but doesn't look through existing messages in the mailbox queue while waiting.
 // This is an optimization that only makes sense with tagged messages.
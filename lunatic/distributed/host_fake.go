@@ -0,0 +1,65 @@
+// -*- compile-command: "go test ./..."; -*-
+
+//go:build !wasm
+
+package distributed
+
+import (
+	"unsafe"
+
+	"github.com/gmlewis/go-lunatic/lunatic/internal/fakehost"
+)
+
+// The fake host is a single node running a single module.
+
+func nodes_count() uint32 { return 1 }
+
+func get_nodes(buf ptr, bufLen size) uint32 {
+	if bufLen == 0 {
+		return 0
+	}
+	unsafe.Slice((*uint64)(buf), bufLen)[0] = fakehost.NodeID
+	return 1
+}
+
+func node_id() uint64   { return fakehost.NodeID }
+func module_id() uint64 { return 1 }
+
+func spawn(nodeID uint64, configID int64, moduleID uint64,
+	funcStrPtr ptr, funcStrLen size, paramsPtr ptr, paramsLen size, idPtr ptr) uint32 {
+	if nodeID != fakehost.NodeID {
+		return 1
+	}
+	if moduleID != module_id() {
+		return 2
+	}
+	if configID != 0 {
+		fakehost.Resource[*fakehost.Config](fakehost.Current(), uint64(configID))
+	}
+
+	params := fakehost.DecodeParams(fakehost.Bytes(paramsPtr, paramsLen))
+	p, err := fakehost.Spawn(0, fakehost.String(funcStrPtr, funcStrLen), params)
+	if err != nil {
+		panic(err)
+	}
+	*(*uint64)(idPtr) = p.ID
+	return 0
+}
+
+func send(nodeID, processID uint64) uint32 {
+	if nodeID != fakehost.NodeID {
+		return 2
+	}
+	if _, ok := fakehost.Lookup(processID); !ok {
+		return 1
+	}
+	fakehost.Current().Send(processID)
+	return 0
+}
+
+func send_receive_skip_search(nodeID, processID uint64, waitOnTag int64, timeoutDuration uint64) uint32 {
+	if status := send(nodeID, processID); status != 0 {
+		return status
+	}
+	return fakehost.Current().Receive([]int64{waitOnTag}, fakehost.Timeout(timeoutDuration))
+}
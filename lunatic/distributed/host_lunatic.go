@@ -0,0 +1,34 @@
+// -*- compile-command: "GOOS=wasip1 GOARCH=wasm go test ./..."; -*-
+
+//go:build wasm
+
+package distributed
+
+//go:wasmimport lunatic::distributed nodes_count
+//go:noescape
+func nodes_count() uint32
+
+//go:wasmimport lunatic::distributed get_nodes
+//go:noescape
+func get_nodes(buf ptr, bufLen size) uint32
+
+//go:wasmimport lunatic::distributed node_id
+//go:noescape
+func node_id() uint64
+
+//go:wasmimport lunatic::distributed module_id
+//go:noescape
+func module_id() uint64
+
+//go:wasmimport lunatic::distributed spawn
+//go:noescape
+func spawn(nodeID uint64, configID int64, moduleID uint64,
+	funcStrPtr ptr, funcStrLen size, paramsPtr ptr, paramsLen size, idPtr ptr) uint32
+
+//go:wasmimport lunatic::distributed send
+//go:noescape
+func send(nodeID, processID uint64) uint32
+
+//go:wasmimport lunatic::distributed send_receive_skip_search
+//go:noescape
+func send_receive_skip_search(nodeID, processID uint64, waitOnTag int64, timeoutDuration uint64) uint32
@@ -5,6 +5,8 @@ package error
 
 import (
 	"fmt"
+	"runtime"
+	"sync"
 	"unsafe"
 )
 
@@ -13,27 +15,21 @@ type ptr = unsafe.Pointer
 func mkptr[T any](v *T) ptr { return unsafe.Pointer(v) }
 
 // StringSize returns the size of the string representation of the error `errorID`.
-//
-//go:wasmimport lunatic::error string_size
-//go:noescape
-func StringSize(errorID uint64) uint32
-
-//go:wasmimport lunatic::error to_string
-//go:noescape
-func to_string(errorID uint64, errorStrPtr ptr)
+func StringSize(errorID uint64) uint32 {
+	return string_size(errorID)
+}
 
 // ToString returns the string representation of the error.
 func ToString(errorID uint64) string {
 	n := StringSize(errorID)
-	buf := make([]byte, 0, n)
+	if n == 0 {
+		return ""
+	}
+	buf := make([]byte, n)
 	to_string(errorID, mkptr(&buf[0]))
 	return string(buf)
 }
 
-//go:wasmimport lunatic::error drop
-//go:noescape
-func drop(errorID uint64)
-
 // Drop drops the error resource.
 //
 // Errors:
@@ -48,3 +44,55 @@ func Drop(errorID uint64) (err error) {
 	drop(errorID)
 	return nil
 }
+
+// Error is a Go error for a lunatic error resource returned by a host call.
+//
+// The error message is read with ToString and the resource is dropped the
+// first time the message is needed. If it is never needed, the resource
+// is dropped when the Error is garbage collected.
+type Error struct {
+	// Op is the name of the host call that failed, e.g. "networking.tcp_read".
+	Op string
+	// ID is the ID of the error resource. It is only valid until the
+	// message was read.
+	ID uint64
+
+	once sync.Once
+	msg  string
+}
+
+// New returns an Error for the error resource `errorID` returned by `op`.
+func New(op string, errorID uint64) *Error {
+	e := &Error{Op: op, ID: errorID}
+	setFinalizer(e)
+	return e
+}
+
+// Error returns the operation and the message of the error.
+func (e *Error) Error() string {
+	return e.Op + ": " + e.Message()
+}
+
+// Message returns the message of the error resource.
+func (e *Error) Message() string {
+	e.once.Do(func() {
+		runtime.SetFinalizer(e, nil)
+		e.msg = e.read()
+	})
+	return e.msg
+}
+
+func (e *Error) read() (msg string) {
+	defer func() {
+		if r := recover(); r != nil {
+			msg = fmt.Sprintf("error %v: %v", e.ID, r)
+		}
+	}()
+	defer Drop(e.ID)
+
+	return ToString(e.ID)
+}
+
+func (e *Error) release() {
+	Drop(e.ID)
+}
@@ -0,0 +1,77 @@
+// -*- compile-command: "go test ./..."; -*-
+
+package error_test
+
+import (
+	"runtime"
+	"testing"
+	"time"
+
+	lerror "github.com/gmlewis/go-lunatic/lunatic/error"
+	"github.com/gmlewis/go-lunatic/lunatic/internal/fakehost"
+	"github.com/gmlewis/go-lunatic/lunatic/process"
+)
+
+func TestToString(t *testing.T) {
+	// The fake host cannot compile modules and returns an error resource.
+	id, err := process.CompileModule("\x00asm")
+	if err == nil {
+		t.Fatal("CompileModule: want error")
+	}
+
+	if got, want := lerror.ToString(uint64(id)), fakehost.CompileModuleError.Error(); got != want {
+		t.Errorf("ToString = %q, want %q", got, want)
+	}
+	if err := lerror.Drop(uint64(id)); err != nil {
+		t.Fatalf("Drop: %v", err)
+	}
+	if err := lerror.Drop(uint64(id)); err == nil {
+		t.Error("second Drop: want error")
+	}
+}
+
+func TestError(t *testing.T) {
+	id, err := process.CompileModule("\x00asm")
+	if err == nil {
+		t.Fatal("CompileModule: want error")
+	}
+
+	e := lerror.New("process.compile_module", uint64(id))
+	want := "process.compile_module: " + fakehost.CompileModuleError.Error()
+	if got := e.Error(); got != want {
+		t.Errorf("Error = %q, want %q", got, want)
+	}
+	// The resource was dropped when the message was read.
+	if err := lerror.Drop(uint64(id)); err == nil {
+		t.Error("Drop after Error: want error")
+	}
+	if got := e.Error(); got != want {
+		t.Errorf("second Error = %q, want %q", got, want)
+	}
+}
+
+// hasResource reports whether the current process still has the
+// resource with `id`.
+func hasResource(id uint64) (ok bool) {
+	defer func() { recover() }()
+	fakehost.Resource[error](fakehost.Current(), id)
+	return true
+}
+
+func TestErrorFinalizer(t *testing.T) {
+	id, err := process.CompileModule("\x00asm")
+	if err == nil {
+		t.Fatal("CompileModule: want error")
+	}
+
+	// The finalizer drops the resource from the current process, although
+	// it runs in another goroutine.
+	lerror.New("process.compile_module", uint64(id))
+	for i := 0; i < 100 && hasResource(uint64(id)); i++ {
+		runtime.GC()
+		time.Sleep(time.Millisecond)
+	}
+	if hasResource(uint64(id)) {
+		t.Error("the finalizer did not drop the resource")
+	}
+}
@@ -0,0 +1,34 @@
+// -*- compile-command: "go test ./..."; -*-
+
+//go:build !wasm
+
+package error
+
+import (
+	"runtime"
+	"unsafe"
+
+	"github.com/gmlewis/go-lunatic/lunatic/internal/fakehost"
+)
+
+func string_size(errorID uint64) uint32 {
+	return uint32(len(fakehost.Resource[error](fakehost.Current(), errorID).Error()))
+}
+
+func to_string(errorID uint64, errorStrPtr ptr) {
+	s := fakehost.Resource[error](fakehost.Current(), errorID).Error()
+	copy(unsafe.Slice((*byte)(errorStrPtr), len(s)), s)
+}
+
+func drop(errorID uint64) {
+	fakehost.TakeResource[error](fakehost.Current(), errorID)
+}
+
+// setFinalizer drops the error resource of `e` when it is garbage collected.
+// Finalizers run in a goroutine of their own, which the fake host would see
+// as a new process, so the resource is dropped from the process that
+// created `e`.
+func setFinalizer(e *Error) {
+	p := fakehost.Current()
+	runtime.SetFinalizer(e, func(e *Error) { p.DropResource(e.ID) })
+}
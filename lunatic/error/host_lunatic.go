@@ -0,0 +1,24 @@
+// -*- compile-command: "GOOS=wasip1 GOARCH=wasm go test ./..."; -*-
+
+//go:build wasm
+
+package error
+
+import "runtime"
+
+//go:wasmimport lunatic::error string_size
+//go:noescape
+func string_size(errorID uint64) uint32
+
+//go:wasmimport lunatic::error to_string
+//go:noescape
+func to_string(errorID uint64, errorStrPtr ptr)
+
+//go:wasmimport lunatic::error drop
+//go:noescape
+func drop(errorID uint64)
+
+// setFinalizer drops the error resource of `e` when it is garbage collected.
+func setFinalizer(e *Error) {
+	runtime.SetFinalizer(e, (*Error).release)
+}
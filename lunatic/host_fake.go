@@ -0,0 +1,44 @@
+// -*- compile-command: "go test ./..."; -*-
+
+//go:build !wasm
+
+package lunatic
+
+import (
+	"os"
+	"unsafe"
+
+	"github.com/gmlewis/go-lunatic/lunatic/internal/fakehost"
+)
+
+func init() {
+	fakehost.RegisterEntry(bootstrapFuncName, func(params []uint64) {
+		bootstrap(int32(params[0]))
+	})
+}
+
+// args_sizes_get and args_get return the arguments of the test binary.
+// Like on wasm, the pointers in argv are 32 bits wide, which is enough
+// for Args since it only uses their offsets into argvBuf.
+func args_sizes_get(argc, argvBufLen unsafe.Pointer) errno {
+	var n int
+	for _, arg := range os.Args {
+		n += len(arg) + 1
+	}
+	*(*size)(argc) = size(len(os.Args))
+	*(*size)(argvBufLen) = size(n)
+	return 0
+}
+
+func args_get(argv, argvBuf unsafe.Pointer) errno {
+	ptrs := unsafe.Slice((*uintptr32)(argv), len(os.Args))
+	var offset uintptr
+	for i, arg := range os.Args {
+		buf := unsafe.Slice((*byte)(unsafe.Add(argvBuf, offset)), len(arg)+1)
+		copy(buf, arg)
+		buf[len(arg)] = 0
+		ptrs[i] = uintptr32(uintptr(argvBuf) + offset)
+		offset += uintptr(len(arg) + 1)
+	}
+	return 0
+}
@@ -0,0 +1,218 @@
+// -*- compile-command: "GOOS=wasip1 GOARCH=wasm go test ./..."; -*-
+
+package http
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// bufferSize is the size of the response body that is buffered before the
+// headers are written. Shorter responses get a Content-Length header.
+const bufferSize = 4 << 10
+
+// response is the http.ResponseWriter of a connection process.
+type response struct {
+	req    *http.Request
+	conn   *bufio.Writer
+	header http.Header
+
+	status      int
+	wroteHeader bool
+	// buf holds the body until the headers are committed.
+	buf       []byte
+	committed bool
+	// body receives the body once the headers are committed.
+	body    io.Writer
+	chunked io.WriteCloser
+	// contentLength is the declared length of the body or -1.
+	contentLength int64
+	written       int64
+	// closeAfter is set if the connection must be closed after the response.
+	closeAfter bool
+}
+
+var _ http.Flusher = (*response)(nil)
+
+func newResponse(req *http.Request, conn *bufio.Writer) *response {
+	return &response{
+		req:           req,
+		conn:          conn,
+		header:        http.Header{},
+		contentLength: -1,
+		closeAfter:    req.Close,
+	}
+}
+
+// Header returns the response headers.
+func (w *response) Header() http.Header { return w.header }
+
+// WriteHeader sets the status code of the response.
+// Only the first call has an effect.
+func (w *response) WriteHeader(code int) {
+	if w.wroteHeader {
+		return
+	}
+	if code < 100 || code > 999 {
+		panic(fmt.Sprintf("http: invalid WriteHeader code %v", code))
+	}
+	w.wroteHeader = true
+	w.status = code
+	if cl := w.header.Get("Content-Length"); cl != "" {
+		if n, err := strconv.ParseInt(cl, 10, 64); err == nil && n >= 0 {
+			w.contentLength = n
+		} else {
+			w.header.Del("Content-Length")
+		}
+	}
+}
+
+// Write writes `b` to the response body.
+//
+// Returns:
+// * nil on success.
+// * http.ErrBodyNotAllowed if the status does not permit a body.
+// * http.ErrContentLength if more than the declared Content-Length is written.
+// * error if writing to the connection fails.
+func (w *response) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if !bodyAllowed(w.status) {
+		return 0, http.ErrBodyNotAllowed
+	}
+	if w.contentLength >= 0 && w.written+int64(len(b)) > w.contentLength {
+		return 0, http.ErrContentLength
+	}
+	w.written += int64(len(b))
+
+	if !w.committed {
+		if len(w.buf)+len(b) <= bufferSize {
+			w.buf = append(w.buf, b...)
+			return len(b), nil
+		}
+		if err := w.commit(false); err != nil {
+			return 0, err
+		}
+	}
+	return w.body.Write(b)
+}
+
+// Flush writes the headers and the buffered body to the client.
+// Responses without a Content-Length are sent chunked from then on.
+func (w *response) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if !w.committed && w.commit(false) != nil {
+		return
+	}
+	w.conn.Flush()
+}
+
+// commit writes the status line, the headers and the buffered body.
+// If `final` is set, the handler has returned and the length of the body
+// is known.
+func (w *response) commit(final bool) error {
+	w.committed = true
+	h := w.header
+	isHEAD := w.req.Method == http.MethodHead
+
+	switch {
+	case !bodyAllowed(w.status):
+		h.Del("Content-Length")
+		h.Del("Transfer-Encoding")
+	case w.contentLength >= 0:
+		h.Del("Transfer-Encoding")
+	case final && !(isHEAD && len(w.buf) == 0):
+		w.contentLength = int64(len(w.buf))
+		h.Set("Content-Length", strconv.Itoa(len(w.buf)))
+	case isHEAD:
+	case w.req.ProtoAtLeast(1, 1):
+		h.Set("Transfer-Encoding", "chunked")
+		w.chunked = httputil.NewChunkedWriter(w.conn)
+	default:
+		w.closeAfter = true
+	}
+
+	if bodyAllowed(w.status) && len(w.buf) > 0 && !hasHeader(h, "Content-Type") {
+		h.Set("Content-Type", http.DetectContentType(w.buf))
+	}
+	if !hasHeader(h, "Date") {
+		h.Set("Date", time.Now().UTC().Format(http.TimeFormat))
+	}
+	if strings.EqualFold(h.Get("Connection"), "close") {
+		w.closeAfter = true
+	}
+	switch {
+	case w.closeAfter:
+		h.Set("Connection", "close")
+	case !w.req.ProtoAtLeast(1, 1):
+		h.Set("Connection", "keep-alive")
+	}
+
+	fmt.Fprintf(w.conn, "HTTP/%d.%d %03d %s\r\n", w.req.ProtoMajor, w.req.ProtoMinor, w.status, http.StatusText(w.status))
+	if err := h.Write(w.conn); err != nil {
+		return err
+	}
+	if _, err := w.conn.WriteString("\r\n"); err != nil {
+		return err
+	}
+
+	switch {
+	case isHEAD:
+		w.body = io.Discard
+	case w.chunked != nil:
+		w.body = w.chunked
+	default:
+		w.body = w.conn
+	}
+	buf := w.buf
+	w.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	_, err := w.body.Write(buf)
+	return err
+}
+
+// finish completes the response after the handler has returned.
+func (w *response) finish() error {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if !w.committed {
+		if err := w.commit(true); err != nil {
+			return err
+		}
+	}
+	if w.chunked != nil {
+		if err := w.chunked.Close(); err != nil {
+			return err
+		}
+		if _, err := w.conn.WriteString("\r\n"); err != nil {
+			return err
+		}
+	}
+	if w.contentLength >= 0 && w.written != w.contentLength && w.req.Method != http.MethodHead {
+		// The client would wait for the missing bytes.
+		w.closeAfter = true
+	}
+	return w.conn.Flush()
+}
+
+// bodyAllowed reports whether a response with `status` may have a body.
+func bodyAllowed(status int) bool {
+	return (status < 100 || status > 199) && status != http.StatusNoContent && status != http.StatusNotModified
+}
+
+func hasHeader(h http.Header, key string) bool {
+	_, ok := h[http.CanonicalHeaderKey(key)]
+	return ok
+}
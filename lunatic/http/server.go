@@ -0,0 +1,304 @@
+// -*- compile-command: "GOOS=wasip1 GOARCH=wasm go test ./..."; -*-
+
+// Package http serves standard `net/http` handlers with lunatic processes
+// and sends HTTP requests over lunatic TCP streams.
+//
+// A Server accepts connections on a lunatic TCP listener and moves every
+// accepted stream into a freshly spawned process, which reads the requests
+// of the connection and passes them to the Server's http.Handler.
+// A handler that panics only takes down the process of its connection:
+//
+//	var server = lhttp.NewServer(http.HandlerFunc(hello))
+//
+//	func main() {
+//		log.Fatal(server.ListenAndServe(":8080"))
+//	}
+//
+// Like all functions spawned with `lunatic.SpawnFunc`, servers must be
+// created with NewServer during package initialization.
+//
+// The connection processes speak HTTP/1.0 and HTTP/1.1 with keep-alive.
+// Responses that fit into the response buffer get a Content-Length header;
+// larger or flushed responses use chunked encoding, or are delimited by
+// closing the connection for HTTP/1.0 clients. Hijacking, trailers and
+// HTTP/2 are not supported.
+//
+// On the client side, Transport is an http.RoundTripper that keeps idle
+// connections in a pool process shared by all processes of a module.
+package http
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gmlewis/go-lunatic/lunatic"
+	"github.com/gmlewis/go-lunatic/lunatic/message"
+	"github.com/gmlewis/go-lunatic/lunatic/networking"
+	"github.com/gmlewis/go-lunatic/lunatic/process"
+)
+
+// connTag is the tag of the message that hands a connection to its process.
+const connTag int64 = 0x4854_0001
+
+// maxDrainBytes is the size of the unread request body that is discarded
+// to keep a connection alive; larger leftovers close the connection.
+const maxDrainBytes = 256 << 10
+
+// Server serves HTTP requests with one lunatic process per connection.
+//
+// The timeouts and limits are passed to the connection processes along with
+// their connections, so they may be changed at any time before Serve.
+// The Handler is not; it is set by NewServer in every process.
+type Server struct {
+	// ReadTimeout limits the time to read a request, including its body.
+	// 0 means no timeout.
+	ReadTimeout time.Duration
+	// WriteTimeout limits the time to write a response, measured from the
+	// end of the request headers. 0 means no timeout.
+	WriteTimeout time.Duration
+	// IdleTimeout limits the time to wait for the next request of a
+	// keep-alive connection. If 0, ReadTimeout is used.
+	IdleTimeout time.Duration
+	// MaxHeaderBytes limits the size of the request headers.
+	// If 0, http.DefaultMaxHeaderBytes is used.
+	MaxHeaderBytes int
+
+	handler http.Handler
+	conns   *message.Mailbox[connMessage]
+	entry   func()
+}
+
+// connMessage hands an accepted connection to its process with the
+// settings of the Server, which the process can't read from its own copy
+// of the Server.
+type connMessage struct {
+	Stream message.TCPStream
+	Config connConfig
+}
+
+// connConfig are the settings of the Server used to serve a connection.
+type connConfig struct {
+	ReadTimeout    time.Duration
+	WriteTimeout   time.Duration
+	IdleTimeout    time.Duration
+	MaxHeaderBytes int
+}
+
+func (s *Server) config() connConfig {
+	return connConfig{
+		ReadTimeout:    s.ReadTimeout,
+		WriteTimeout:   s.WriteTimeout,
+		IdleTimeout:    s.IdleTimeout,
+		MaxHeaderBytes: s.MaxHeaderBytes,
+	}
+}
+
+// NewServer returns a Server passing all requests to `handler`.
+// If `handler` is nil, http.DefaultServeMux is used.
+//
+// NewServer registers the entry point of the connection processes with
+// `lunatic.RegisterFunc`, so it must only be called during package
+// initialization.
+func NewServer(handler http.Handler) *Server {
+	if handler == nil {
+		handler = http.DefaultServeMux
+	}
+	s := &Server{
+		handler: handler,
+		conns:   message.NewMailbox[connMessage](connTag, message.NewResourceCodec(nil)),
+	}
+	s.entry = lunatic.RegisterFunc(s.run)
+	return s
+}
+
+// ListenAndServe listens on the TCP `address` of the form "host:port"
+// and calls Serve.
+func (s *Server) ListenAndServe(address string) error {
+	l, err := networking.ListenTCP(address)
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+	return s.Serve(l)
+}
+
+// Serve accepts connections on `l` and spawns a process serving each of them.
+// A connection whose process can't be spawned is logged and dropped.
+// It only returns on errors.
+//
+// Returns:
+// * error if accepting a connection fails, e.g. because `l` is closed.
+func (s *Server) Serve(l *networking.TCPListener) error {
+	for {
+		c, err := l.AcceptTCP()
+		if err != nil {
+			return err
+		}
+		if err := s.spawn(c); err != nil {
+			log.Printf("http: serve connection from %v: %v", c.RemoteAddr(), err)
+		}
+	}
+}
+
+// spawn moves `c` into a new connection process.
+// If it fails, `c` is closed or was dropped with the message.
+func (s *Server) spawn(c *networking.TCPConn) error {
+	pid, err := lunatic.SpawnFunc(s.entry)
+	if err != nil {
+		c.Close()
+		return fmt.Errorf("spawn connection process: %w", err)
+	}
+	err = s.conns.Send(uint64(pid), connMessage{
+		Stream: message.TCPStream(c.StreamID()),
+		Config: s.config(),
+	})
+	if err != nil {
+		// The stream was moved into the message, so it is not closed.
+		process.Kill(uint64(pid))
+		return fmt.Errorf("send connection: %w", err)
+	}
+	return nil
+}
+
+// run is the entry point of a connection process.
+func (s *Server) run() {
+	msg, err := s.conns.Receive()
+	if err != nil {
+		panic(fmt.Sprintf("http: receive connection: %v", err))
+	}
+	s.serveConn(networking.NewTCPConn(uint64(msg.Stream)), msg.Config)
+}
+
+// ServeConn serves the requests of `c` in the current process until the
+// client or the handler closes the connection, then closes `c`.
+//
+// A panic in the handler is not recovered and terminates the process.
+func (s *Server) ServeConn(c net.Conn) {
+	s.serveConn(c, s.config())
+}
+
+// serveConn implements ServeConn with the settings `cfg`.
+func (s *Server) serveConn(c net.Conn, cfg connConfig) {
+	defer c.Close()
+
+	lr := &limitReader{r: c}
+	br := bufio.NewReader(lr)
+	bw := bufio.NewWriterSize(c, bufferSize)
+	ctx := context.WithValue(context.Background(), http.LocalAddrContextKey, c.LocalAddr())
+	remoteAddr := c.RemoteAddr().String()
+
+	for first := true; ; first = false {
+		if !first {
+			if d := cfg.idleTimeout(); d > 0 {
+				c.SetReadDeadline(time.Now().Add(d))
+			}
+			if _, err := br.Peek(1); err != nil {
+				return
+			}
+		}
+		if cfg.ReadTimeout > 0 {
+			c.SetReadDeadline(time.Now().Add(cfg.ReadTimeout))
+		} else {
+			c.SetReadDeadline(time.Time{})
+		}
+
+		lr.n = int64(cfg.maxHeaderBytes()) + 4096 // bufio.Reader slack
+		req, err := http.ReadRequest(br)
+		tooLarge := lr.n <= 0
+		lr.n = math.MaxInt64
+		if err != nil {
+			switch {
+			case tooLarge:
+				writeError(bw, http.StatusRequestHeaderFieldsTooLarge)
+			case !isTimeout(err) && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF):
+				writeError(bw, http.StatusBadRequest)
+			}
+			return
+		}
+		if cfg.WriteTimeout > 0 {
+			c.SetWriteDeadline(time.Now().Add(cfg.WriteTimeout))
+		}
+
+		req.RemoteAddr = remoteAddr
+		req = req.WithContext(ctx)
+		if expect := req.Header.Get("Expect"); expect != "" {
+			if !strings.EqualFold(expect, "100-continue") {
+				writeError(bw, http.StatusExpectationFailed)
+				return
+			}
+			if req.ProtoAtLeast(1, 1) && req.ContentLength != 0 {
+				bw.WriteString("HTTP/1.1 100 Continue\r\n\r\n")
+				if err := bw.Flush(); err != nil {
+					return
+				}
+			}
+			req.Header.Del("Expect")
+		}
+
+		w := newResponse(req, bw)
+		s.handler.ServeHTTP(w, req)
+		if err := w.finish(); err != nil || w.closeAfter {
+			return
+		}
+		if n, _ := io.CopyN(io.Discard, req.Body, maxDrainBytes+1); n > maxDrainBytes {
+			return
+		}
+		req.Body.Close()
+	}
+}
+
+func (cfg connConfig) idleTimeout() time.Duration {
+	if cfg.IdleTimeout > 0 {
+		return cfg.IdleTimeout
+	}
+	return cfg.ReadTimeout
+}
+
+func (cfg connConfig) maxHeaderBytes() int {
+	if cfg.MaxHeaderBytes > 0 {
+		return cfg.MaxHeaderBytes
+	}
+	return http.DefaultMaxHeaderBytes
+}
+
+// limitReader is like io.LimitedReader but its limit can be changed
+// while a bufio.Reader is reading from it.
+type limitReader struct {
+	r io.Reader
+	n int64
+}
+
+func (l *limitReader) Read(b []byte) (int, error) {
+	if l.n <= 0 {
+		return 0, io.EOF
+	}
+	if int64(len(b)) > l.n {
+		b = b[:l.n]
+	}
+	n, err := l.r.Read(b)
+	l.n -= int64(n)
+	return n, err
+}
+
+// writeError writes a minimal response with `code` for a request
+// that could not be handled and asks the client to close the connection.
+func writeError(w *bufio.Writer, code int) {
+	text := http.StatusText(code)
+	fmt.Fprintf(w, "HTTP/1.1 %03d %s\r\nContent-Type: text/plain; charset=utf-8\r\nConnection: close\r\nContent-Length: %d\r\n\r\n%s",
+		code, text, len(text), text)
+	w.Flush()
+}
+
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
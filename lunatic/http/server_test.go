@@ -0,0 +1,210 @@
+// -*- compile-command: "go test ./..."; -*-
+
+package http_test
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gmlewis/go-lunatic/lunatic"
+	lhttp "github.com/gmlewis/go-lunatic/lunatic/http"
+	"github.com/gmlewis/go-lunatic/lunatic/message"
+	"github.com/gmlewis/go-lunatic/lunatic/networking"
+	"github.com/gmlewis/go-lunatic/lunatic/process"
+)
+
+const addrTag int64 = 1
+
+var server = lhttp.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("X-Process", fmt.Sprint(process.ProcessID()))
+	switch r.URL.Path {
+	case "/hello":
+		fmt.Fprintf(w, "hello, %v", r.URL.Query().Get("name"))
+	case "/stream":
+		for i := 0; i < 3; i++ {
+			fmt.Fprintf(w, "%v;", i)
+			w.(http.Flusher).Flush()
+		}
+	case "/big":
+		w.Write([]byte(strings.Repeat("x", 10000)))
+	case "/echo":
+		io.Copy(w, r.Body)
+	case "/panic":
+		panic("boom")
+	default:
+		http.NotFound(w, r)
+	}
+}))
+
+func init() {
+	// The connection processes get the settings with the connection.
+	server.MaxHeaderBytes = 4096
+}
+
+// parent is the process that the acceptor reports its address to.
+var parent uint64
+
+// acceptor listens on a free port and serves connections with server.
+var acceptor = lunatic.RegisterFunc(func() {
+	l, err := networking.ListenTCP("127.0.0.1:0")
+	if err != nil {
+		panic(err)
+	}
+	message.NewMailbox[string](addrTag, nil).Send(parent, l.Addr().String())
+	server.Serve(l)
+})
+
+// serve starts an acceptor process and returns the URL of the server.
+// The acceptor keeps running until the test binary exits.
+func serve(t *testing.T) string {
+	t.Helper()
+	parent = process.ProcessID()
+	if _, err := lunatic.SpawnFunc(acceptor); err != nil {
+		t.Fatalf("SpawnFunc: %v", err)
+	}
+	addr, err := message.NewMailbox[string](addrTag, nil).ReceiveTimeout(5 * time.Second)
+	if err != nil {
+		t.Fatalf("Receive: %v", err)
+	}
+	return "http://" + addr
+}
+
+func get(t *testing.T, client *http.Client, url string) (*http.Response, string) {
+	t.Helper()
+	resp, err := client.Get(url)
+	if err != nil {
+		t.Fatalf("Get(%v): %v", url, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("Get(%v): %v", url, err)
+	}
+	return resp, string(body)
+}
+
+func TestServer(t *testing.T) {
+	url := serve(t)
+	client := &http.Client{Transport: &http.Transport{}}
+	defer client.CloseIdleConnections()
+
+	resp, body := get(t, client, url+"/hello?name=lunatic")
+	if body != "hello, lunatic" || resp.ContentLength != int64(len(body)) {
+		t.Errorf("hello = %q with length %v, want hello, lunatic", body, resp.ContentLength)
+	}
+	if got := resp.Header.Get("Content-Type"); !strings.HasPrefix(got, "text/plain") {
+		t.Errorf("Content-Type = %q, want text/plain", got)
+	}
+
+	// Requests of a keep-alive connection are served by the same process.
+	resp2, _ := get(t, client, url+"/hello")
+	if p1, p2 := resp.Header.Get("X-Process"), resp2.Header.Get("X-Process"); p1 != p2 {
+		t.Errorf("keep-alive requests served by processes %v and %v, want the same", p1, p2)
+	}
+	other := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+	resp3, _ := get(t, other, url+"/hello")
+	if p1, p3 := resp.Header.Get("X-Process"), resp3.Header.Get("X-Process"); p1 == p3 {
+		t.Errorf("connections served by the same process %v, want different ones", p1)
+	}
+
+	resp, body = get(t, client, url+"/stream")
+	if body != "0;1;2;" || len(resp.TransferEncoding) == 0 {
+		t.Errorf("stream = %q with encoding %v, want chunked 0;1;2;", body, resp.TransferEncoding)
+	}
+	resp, body = get(t, client, url+"/big")
+	if len(body) != 10000 || resp.ContentLength != -1 {
+		t.Errorf("big = %v bytes with length %v, want 10000 chunked", len(body), resp.ContentLength)
+	}
+	resp, _ = get(t, client, url+"/missing")
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("missing = %v, want 404", resp.Status)
+	}
+
+	resp, err := client.Post(url+"/echo", "text/plain", strings.NewReader("ping"))
+	if err != nil {
+		t.Fatalf("Post: %v", err)
+	}
+	body2, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body2) != "ping" {
+		t.Errorf("echo = %q, want ping", body2)
+	}
+}
+
+func TestServerPanic(t *testing.T) {
+	url := serve(t)
+	client := &http.Client{Transport: &http.Transport{}}
+	defer client.CloseIdleConnections()
+
+	if resp, err := client.Get(url + "/panic"); err == nil {
+		resp.Body.Close()
+		t.Fatalf("panic = %v, want error", resp.Status)
+	}
+	// The panic only took down the process of its connection.
+	if _, body := get(t, client, url+"/hello?name=again"); body != "hello, again" {
+		t.Errorf("hello after panic = %q, want hello, again", body)
+	}
+}
+
+func TestServerHTTP10(t *testing.T) {
+	url := serve(t)
+	c, err := net.Dial("tcp", strings.TrimPrefix(url, "http://"))
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer c.Close()
+
+	// Without a Content-Length, the body is delimited by closing the connection.
+	fmt.Fprint(c, "GET /big HTTP/1.0\r\n\r\n")
+	r := bufio.NewReader(c)
+	resp, err := http.ReadResponse(r, nil)
+	if err != nil {
+		t.Fatalf("ReadResponse: %v", err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil || len(body) != 10000 || !resp.Close {
+		t.Errorf("big = %v bytes, %v, close %v, want 10000 bytes and close", len(body), err, resp.Close)
+	}
+}
+
+func TestServerBadRequest(t *testing.T) {
+	url := serve(t)
+	c, err := net.Dial("tcp", strings.TrimPrefix(url, "http://"))
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer c.Close()
+
+	fmt.Fprint(c, "nonsense\r\n\r\n")
+	resp, err := http.ReadResponse(bufio.NewReader(c), nil)
+	if err != nil {
+		t.Fatalf("ReadResponse: %v", err)
+	}
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("status = %v, want 400", resp.Status)
+	}
+}
+
+func TestServerMaxHeaderBytes(t *testing.T) {
+	url := serve(t)
+	c, err := net.Dial("tcp", strings.TrimPrefix(url, "http://"))
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer c.Close()
+
+	fmt.Fprintf(c, "GET /hello HTTP/1.1\r\nHost: x\r\nX-Big: %v\r\n\r\n", strings.Repeat("x", 20000))
+	resp, err := http.ReadResponse(bufio.NewReader(c), nil)
+	if err != nil {
+		t.Fatalf("ReadResponse: %v", err)
+	}
+	if resp.StatusCode != http.StatusRequestHeaderFieldsTooLarge {
+		t.Errorf("status = %v, want 431", resp.Status)
+	}
+}
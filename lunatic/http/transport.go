@@ -0,0 +1,452 @@
+// -*- compile-command: "GOOS=wasip1 GOARCH=wasm go test ./..."; -*-
+
+package http
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gmlewis/go-lunatic/lunatic"
+	"github.com/gmlewis/go-lunatic/lunatic/message"
+	"github.com/gmlewis/go-lunatic/lunatic/networking"
+	"github.com/gmlewis/go-lunatic/lunatic/process"
+	"github.com/gmlewis/go-lunatic/lunatic/registry"
+)
+
+// Tags of the messages exchanged between a Transport and its pool process.
+const (
+	getConnTag int64 = 0x4854_0002
+	putConnTag int64 = 0x4854_0003
+)
+
+// poolTimeout limits the time to wait for an idle connection from the pool
+// process. A new connection is dialed if the pool fails to answer in time.
+const poolTimeout = 5 * time.Second
+
+// DefaultMaxIdleConnsPerHost is the default number of idle connections
+// that the pool process of a Transport keeps per host.
+const DefaultMaxIdleConnsPerHost = 2
+
+// DefaultTransport is the Transport used by DefaultClient.
+var DefaultTransport = NewTransport("default")
+
+// DefaultClient is an http.Client using DefaultTransport.
+var DefaultClient = &http.Client{Transport: DefaultTransport}
+
+// Transport is an http.RoundTripper that sends HTTP/1.1 requests over
+// lunatic TCP streams, or TLS streams for "https" URLs, since the transport
+// of `net/http` can't dial under lunatic.
+//
+// Idle keep-alive connections are held by a pool process that is shared by
+// all processes using a Transport with the same name. A process sending a
+// request takes a connection out of the pool, or dials a new one, and moves
+// it back into the pool with `message.PushTCPStream` or
+// `message.PushTLSStream` once it has read the whole response body, so
+// connections are reused across processes.
+//
+// The pool process is registered in the lunatic registry. It is spawned by
+// Start or by the first request of any process if it is not running.
+// A Transport that is not created with NewTransport has no pool process and
+// can only be used with DisableKeepAlives.
+//
+// Requests are bound by the deadline of their context, but canceling the
+// context does not interrupt a request that is in progress.
+type Transport struct {
+	// DialTimeout limits the time to resolve and connect to a host.
+	// 0 means no timeout.
+	DialTimeout time.Duration
+	// ResponseHeaderTimeout limits the time to wait for the response headers
+	// after the request has been written. 0 means no timeout.
+	ResponseHeaderTimeout time.Duration
+	// DisableKeepAlives closes every connection after a single request.
+	DisableKeepAlives bool
+	// MaxIdleConnsPerHost limits the number of idle connections that the pool
+	// keeps per host. If 0, DefaultMaxIdleConnsPerHost is used.
+	MaxIdleConnsPerHost int
+	// IdleConnTimeout is the time after which the pool drops an idle
+	// connection. 0 means no limit.
+	IdleConnTimeout time.Duration
+	// TLSRootCerts are PEM-encoded root certificates trusted for "https"
+	// URLs in addition to those of the host. See `networking.DialTLS`.
+	TLSRootCerts []byte
+
+	name  string
+	entry func()
+}
+
+var _ http.RoundTripper = (*Transport)(nil)
+
+// poolStreams holds a stream moved into or out of the pool, which is either
+// a TCP stream or, for "https" URLs, a TLS stream.
+type poolStreams struct {
+	TCP []message.TCPStream
+	TLS []message.TLSStream
+}
+
+// putConn moves a connection into the pool.
+type putConn struct {
+	Key             string
+	Streams         poolStreams
+	MaxIdle         int
+	IdleConnTimeout time.Duration
+}
+
+// NewTransport returns a Transport whose pool process is registered under
+// `name`. Transports with the same name share their idle connections.
+//
+// NewTransport registers the entry point of the pool process with
+// `lunatic.RegisterFunc`, so it must only be called during package
+// initialization.
+func NewTransport(name string) *Transport {
+	t := &Transport{name: "lunatic/http.Transport/" + name}
+	t.entry = lunatic.RegisterFunc(t.runPool)
+	return t
+}
+
+// Start spawns the pool process unless it is already running. Requests
+// start the pool themselves, so calling Start is only needed to report
+// spawn errors early.
+func (t *Transport) Start() error {
+	_, err := t.pool()
+	return err
+}
+
+// pool returns the ID of the pool process, spawning it if needed.
+func (t *Transport) pool() (uint64, error) {
+	return registry.GetOrSpawn(t.name, func() (uint64, error) {
+		id, err := lunatic.SpawnFunc(t.entry)
+		if err != nil {
+			return 0, fmt.Errorf("http: spawn pool process: %w", err)
+		}
+		return uint64(id), nil
+	})
+}
+
+// RoundTrip sends `req` and returns its response.
+// The "http" and "https" schemes are supported.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL == nil {
+		closeBody(req)
+		return nil, errors.New("http: nil Request.URL")
+	}
+	var key string
+	switch req.URL.Scheme {
+	case "http":
+		key = hostPort(req.URL.Host, "80")
+	case "https":
+		key = "https://" + hostPort(req.URL.Host, "443")
+	default:
+		closeBody(req)
+		return nil, fmt.Errorf("http: unsupported protocol scheme %q", req.URL.Scheme)
+	}
+	if req.URL.Host == "" {
+		closeBody(req)
+		return nil, errors.New("http: no Host in request URL")
+	}
+
+	// A pooled connection may have been closed by the server in the meantime.
+	// Requests without a body are retried once on a new connection then.
+	for retry := 0; ; retry++ {
+		c, reused, err := t.getConn(key)
+		if err != nil {
+			closeBody(req)
+			return nil, err
+		}
+		resp, err := t.roundTrip(c, key, req)
+		if err == nil {
+			return resp, nil
+		}
+		c.Close()
+		if !reused || retry > 0 || req.Body != nil && req.Body != http.NoBody {
+			closeBody(req)
+			return nil, err
+		}
+	}
+}
+
+// roundTrip sends `req` over `c` and reads the response headers.
+func (t *Transport) roundTrip(c net.Conn, key string, req *http.Request) (*http.Response, error) {
+	deadline, _ := req.Context().Deadline()
+	c.SetDeadline(deadline)
+
+	bw := bufio.NewWriter(c)
+	if err := req.Write(bw); err != nil {
+		return nil, err
+	}
+	if err := bw.Flush(); err != nil {
+		return nil, err
+	}
+
+	if t.ResponseHeaderTimeout > 0 {
+		if d := time.Now().Add(t.ResponseHeaderTimeout); deadline.IsZero() || d.Before(deadline) {
+			c.SetReadDeadline(d)
+		}
+	}
+	br := bufio.NewReader(c)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		return nil, err
+	}
+	c.SetReadDeadline(deadline)
+
+	keepAlive := !t.DisableKeepAlives && !req.Close && !resp.Close
+	body := &bodyEOFSignal{body: resp.Body, done: func(eof bool) {
+		if eof && keepAlive && br.Buffered() == 0 {
+			t.putConn(key, c)
+			return
+		}
+		c.Close()
+	}}
+	if resp.Body == http.NoBody || req.Method == http.MethodHead {
+		body.finish(true)
+		resp.Body = http.NoBody
+		return resp, nil
+	}
+	resp.Body = body
+	return resp, nil
+}
+
+// getConn takes an idle connection to `key` out of the pool or dials one.
+// If the pool process fails, the connection is dialed as well.
+func (t *Transport) getConn(key string) (c net.Conn, reused bool, err error) {
+	if !t.DisableKeepAlives {
+		if pid, err := t.pool(); err == nil {
+			// The pool replies with at most one idle stream. If the reply
+			// comes after poolTimeout, message.Request drops it together
+			// with the stream.
+			idle, err := message.Request[poolStreams](pid, getConnTag, key, poolTimeout)
+			switch {
+			case err != nil:
+			case len(idle.TCP) > 0:
+				return networking.NewTCPConn(uint64(idle.TCP[0])), true, nil
+			case len(idle.TLS) > 0:
+				return networking.NewTLSConn(uint64(idle.TLS[0])), true, nil
+			}
+		}
+	}
+
+	if address, ok := strings.CutPrefix(key, "https://"); ok {
+		c, err = networking.DialTLS(address, t.DialTimeout, t.TLSRootCerts)
+	} else {
+		c, err = networking.DialTCP(key, t.DialTimeout)
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return c, false, nil
+}
+
+// putConn moves `c` into the pool or closes it if that fails.
+func (t *Transport) putConn(key string, c net.Conn) {
+	c.SetDeadline(time.Time{})
+	pid, err := t.pool()
+	if err != nil {
+		c.Close()
+		return
+	}
+	msg := putConn{
+		Key:             key,
+		MaxIdle:         t.MaxIdleConnsPerHost,
+		IdleConnTimeout: t.IdleConnTimeout,
+	}
+	switch c := c.(type) {
+	case *networking.TCPConn:
+		msg.Streams.TCP = []message.TCPStream{message.TCPStream(c.StreamID())}
+	case *networking.TLSConn:
+		msg.Streams.TLS = []message.TLSStream{message.TLSStream(c.StreamID())}
+	default:
+		c.Close()
+		return
+	}
+	if msg.MaxIdle <= 0 {
+		msg.MaxIdle = DefaultMaxIdleConnsPerHost
+	}
+	message.CreateData(putConnTag, 0)
+	if err := message.EncodeData(msg, message.NewResourceCodec(nil)); err != nil {
+		c.Close()
+		return
+	}
+	message.Send(pid)
+}
+
+// pooledConn is an idle connection held by the pool process.
+type pooledConn struct {
+	streamID uint64
+	tls      bool
+	expires  time.Time
+}
+
+// drop drops the stream of `c`.
+func (c pooledConn) drop() {
+	if c.tls {
+		networking.DropTLSStream(c.streamID)
+	} else {
+		networking.DropTCPStream(c.streamID)
+	}
+}
+
+// runPool is the entry point of the pool process.
+func (t *Transport) runPool() {
+	// Callers are linked to the pool while they wait for a connection, see
+	// `message.Request`. The pool has no links of its own, so it traps link
+	// deaths and ignores them, to survive callers that fail meanwhile.
+	process.DieWhenLinkDies(false)
+
+	idle := map[string][]pooledConn{}
+	for {
+		var timeoutMillis *uint64
+		if next := nextExpiry(idle); !next.IsZero() {
+			millis := uint64(max(time.Until(next).Milliseconds(), 0)) + 1
+			timeoutMillis = &millis
+		}
+
+		msg, err := message.Receive(nil, timeoutMillis)
+		if errors.Is(err, message.CallTimedOut) {
+			dropExpired(idle)
+			continue
+		}
+		if err != nil {
+			panic(fmt.Sprintf("http: pool receive: %v", err))
+		}
+		data, ok := msg.(*message.DataMessage)
+		if !ok {
+			continue
+		}
+
+		switch data.Tag {
+		case getConnTag:
+			call, err := message.DecodeRequest[string]()
+			if err != nil {
+				continue
+			}
+			dropExpired(idle)
+			var reply poolStreams
+			if conns := idle[call.Body]; len(conns) > 0 {
+				last := conns[len(conns)-1]
+				idle[call.Body] = conns[:len(conns)-1]
+				if last.tls {
+					reply.TLS = []message.TLSStream{message.TLSStream(last.streamID)}
+				} else {
+					reply.TCP = []message.TCPStream{message.TCPStream(last.streamID)}
+				}
+			}
+			message.CreateData(call.ReplyTag, 0)
+			if err := message.EncodeData(reply, message.NewResourceCodec(nil)); err == nil {
+				message.Send(call.ReplyTo)
+			}
+		case putConnTag:
+			var put putConn
+			if err := message.DecodeData(&put); err != nil {
+				continue
+			}
+			var conn pooledConn
+			switch {
+			case len(put.Streams.TCP) == 1:
+				conn.streamID = uint64(put.Streams.TCP[0])
+			case len(put.Streams.TLS) == 1:
+				conn.streamID, conn.tls = uint64(put.Streams.TLS[0]), true
+			default:
+				continue
+			}
+			if put.IdleConnTimeout > 0 {
+				conn.expires = time.Now().Add(put.IdleConnTimeout)
+			}
+			conns := append(idle[put.Key], conn)
+			for len(conns) > put.MaxIdle {
+				conns[0].drop()
+				conns = conns[1:]
+			}
+			idle[put.Key] = conns
+		}
+	}
+}
+
+// nextExpiry returns the earliest expiry of the connections in `idle`
+// or the zero time if none expires.
+func nextExpiry(idle map[string][]pooledConn) time.Time {
+	var next time.Time
+	for _, conns := range idle {
+		for _, c := range conns {
+			if !c.expires.IsZero() && (next.IsZero() || c.expires.Before(next)) {
+				next = c.expires
+			}
+		}
+	}
+	return next
+}
+
+// dropExpired drops the connections in `idle` that have expired.
+func dropExpired(idle map[string][]pooledConn) {
+	now := time.Now()
+	for key, conns := range idle {
+		kept := conns[:0]
+		for _, c := range conns {
+			if !c.expires.IsZero() && !now.Before(c.expires) {
+				c.drop()
+				continue
+			}
+			kept = append(kept, c)
+		}
+		if len(kept) == 0 {
+			delete(idle, key)
+		} else {
+			idle[key] = kept
+		}
+	}
+}
+
+// bodyEOFSignal calls `done` once the response body is read to the end
+// or closed.
+type bodyEOFSignal struct {
+	body io.ReadCloser
+	done func(eof bool)
+	// finished is set once done has been called.
+	finished bool
+}
+
+func (b *bodyEOFSignal) Read(p []byte) (int, error) {
+	if b.finished {
+		return 0, io.EOF
+	}
+	n, err := b.body.Read(p)
+	if err == io.EOF {
+		b.finish(true)
+	} else if err != nil {
+		b.finish(false)
+	}
+	return n, err
+}
+
+func (b *bodyEOFSignal) Close() error {
+	if b.finished {
+		return nil
+	}
+	b.finish(false)
+	return nil
+}
+
+func (b *bodyEOFSignal) finish(eof bool) {
+	b.finished = true
+	b.body.Close()
+	b.done(eof)
+}
+
+// hostPort returns `host` with `defaultPort` appended if it has no port.
+func hostPort(host, defaultPort string) string {
+	if _, _, err := net.SplitHostPort(host); err == nil {
+		return host
+	}
+	return net.JoinHostPort(strings.Trim(host, "[]"), defaultPort)
+}
+
+func closeBody(req *http.Request) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+}
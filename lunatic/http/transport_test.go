@@ -0,0 +1,124 @@
+// -*- compile-command: "go test ./..."; -*-
+
+package http_test
+
+import (
+	"encoding/pem"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gmlewis/go-lunatic/lunatic"
+	lhttp "github.com/gmlewis/go-lunatic/lunatic/http"
+	"github.com/gmlewis/go-lunatic/lunatic/message"
+)
+
+var (
+	transport    = lhttp.NewTransport("test")
+	tlsTransport = lhttp.NewTransport("tls")
+)
+
+// fetcher gets the URL it receives with transport and replies with
+// the process that served it.
+var fetcher = lunatic.RegisterFunc(func() {
+	call, err := message.ReceiveRequest[string](1)
+	if err != nil {
+		panic(err)
+	}
+	resp, err := (&http.Client{Transport: transport}).Get(call.Body)
+	if err != nil {
+		call.Reply("error: " + err.Error())
+		return
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	call.Reply(resp.Header.Get("X-Process"))
+})
+
+func TestTransport(t *testing.T) {
+	url := serve(t)
+	if err := transport.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	client := &http.Client{Transport: transport}
+
+	resp, body := get(t, client, url+"/hello?name=client")
+	if body != "hello, client" {
+		t.Errorf("hello = %q, want hello, client", body)
+	}
+	// The connection went back to the pool, so the next request is sent
+	// over it and served by the same server process.
+	resp2, _ := get(t, client, url+"/stream")
+	server1, server2 := resp.Header.Get("X-Process"), resp2.Header.Get("X-Process")
+	if server1 != server2 {
+		t.Errorf("requests served by processes %v and %v, want the same", server1, server2)
+	}
+
+	// Other processes share the pool.
+	pid, err := lunatic.SpawnFunc(fetcher)
+	if err != nil {
+		t.Fatalf("SpawnFunc: %v", err)
+	}
+	server3, err := message.Request[string](uint64(pid), 1, url+"/big", 5*time.Second)
+	if err != nil || server3 != server1 {
+		t.Errorf("request from another process served by %q, %v, want %v", server3, err, server1)
+	}
+
+	resp, err = client.Post(url+"/echo", "text/plain", strings.NewReader("ping"))
+	if err != nil {
+		t.Fatalf("Post: %v", err)
+	}
+	echo, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(echo) != "ping" {
+		t.Errorf("echo = %q, want ping", echo)
+	}
+
+	resp, body = get(t, client, url+"/missing")
+	if resp.StatusCode != http.StatusNotFound || !strings.Contains(body, "not found") {
+		t.Errorf("missing = %v %q, want 404", resp.Status, body)
+	}
+}
+
+func TestTransportErrors(t *testing.T) {
+	client := &http.Client{Transport: &lhttp.Transport{DisableKeepAlives: true}}
+	if _, err := client.Get("ftp://127.0.0.1/"); err == nil || !strings.Contains(err.Error(), "unsupported protocol scheme") {
+		t.Errorf("Get ftp = %v, want unsupported protocol scheme", err)
+	}
+	if _, err := client.Get("http://127.0.0.1:1/"); err == nil {
+		t.Error("Get from a closed port: want error")
+	}
+}
+
+func TestTransportTLS(t *testing.T) {
+	// The server runs in plain goroutines, since the TLS handshake blocks
+	// until both sides take part.
+	var conns atomic.Int32
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "secure "+r.URL.Path)
+	}))
+	srv.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			conns.Add(1)
+		}
+	}
+	srv.StartTLS()
+	defer srv.Close()
+
+	tlsTransport.TLSRootCerts = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	client := &http.Client{Transport: tlsTransport}
+	for _, path := range []string{"/a", "/b"} {
+		if _, body := get(t, client, srv.URL+path); body != "secure "+path {
+			t.Errorf("body = %q, want secure %v", body, path)
+		}
+	}
+	// The TLS connection was pooled and reused.
+	if n := conns.Load(); n != 1 {
+		t.Errorf("server saw %v connections, want 1", n)
+	}
+}
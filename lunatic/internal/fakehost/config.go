@@ -0,0 +1,31 @@
+// -*- compile-command: "go test ./..."; -*-
+
+package fakehost
+
+import "errors"
+
+// Config is a process configuration resource.
+// The fake host stores it but does not enforce it.
+type Config struct {
+	MaxMemory         uint64
+	MaxFuel           uint64
+	CanCompileModules bool
+	CanCreateConfigs  bool
+	CanSpawnProcesses bool
+	Args              []string
+	Env               []string
+	PreopenedDirs     []string
+}
+
+// CompileModuleError is returned when a process compiles a module,
+// since the fake host cannot run WebAssembly.
+var CompileModuleError = errors.New("fakehost: WebAssembly modules are not supported")
+
+// AddError stores `err` in the resources of `p` and returns its ID.
+// Error resources are read with the lunatic::error functions.
+func (p *Process) AddError(err error) uint64 {
+	return p.AddResource(err)
+}
+
+// Version is the lunatic version reported by the fake host.
+var Version = [3]uint32{0, 13, 2}
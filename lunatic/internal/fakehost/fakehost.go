@@ -0,0 +1,367 @@
+// -*- compile-command: "go test ./..."; -*-
+
+// Package fakehost is a pure Go implementation of the lunatic host
+// functions that is used when the bindings are not built for wasm,
+// so that they can be tested with a plain `go test`.
+//
+// Every goroutine that calls into the fake host is treated as a lunatic
+// process: the first call from an unknown goroutine (such as a test)
+// creates a new process for it, and spawned processes run in goroutines of
+// their own. A process ends when its goroutine returns or panics.
+//
+// The fake host is not a sandbox. All processes share the same address
+// space and package-level variables, and goroutines started by a process
+// are seen as separate processes.
+package fakehost
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"runtime"
+	"strconv"
+	"sync"
+	"time"
+	"unsafe"
+)
+
+var (
+	mu        sync.Mutex
+	processes = map[uint64]*Process{} // process ID => process
+	byGID     = map[uint64]*Process{} // goroutine ID => process
+	lastPID   uint64
+	entries   = map[string]func(params []uint64){}
+)
+
+// Process is the state of a fake lunatic process.
+type Process struct {
+	ID uint64
+
+	mu        sync.Mutex
+	notify    chan struct{} // signaled when a message is delivered
+	killedCh  chan struct{} // closed when the process is killed
+	mailbox   []*Message
+	scratch   *Message
+	readPos   int
+	links     map[uint64]int64 // linked process ID => link-tag
+	dieOnLink bool
+	killed    bool
+	done      bool
+
+	resources    map[uint64]any
+	lastResource uint64
+}
+
+func newProcess() *Process {
+	mu.Lock()
+	defer mu.Unlock()
+	lastPID++
+	p := &Process{
+		ID:        lastPID,
+		notify:    make(chan struct{}, 1),
+		killedCh:  make(chan struct{}),
+		links:     map[uint64]int64{},
+		dieOnLink: true,
+		resources: map[uint64]any{},
+	}
+	processes[p.ID] = p
+	return p
+}
+
+// goroutineID returns the ID of the calling goroutine.
+func goroutineID() uint64 {
+	buf := make([]byte, 64)
+	buf = buf[:runtime.Stack(buf, false)]
+	buf = bytes.TrimPrefix(buf, []byte("goroutine "))
+	buf = buf[:bytes.IndexByte(buf, ' ')]
+	id, err := strconv.ParseUint(string(buf), 10, 64)
+	if err != nil {
+		panic(fmt.Sprintf("fakehost: cannot parse goroutine ID: %v", err))
+	}
+	return id
+}
+
+// Current returns the process of the calling goroutine, creating it if needed.
+// If the process was killed, the calling goroutine exits.
+func Current() *Process {
+	gid := goroutineID()
+	mu.Lock()
+	p, ok := byGID[gid]
+	mu.Unlock()
+	if !ok {
+		p = newProcess()
+		mu.Lock()
+		byGID[gid] = p
+		mu.Unlock()
+	}
+
+	p.mu.Lock()
+	killed := p.killed
+	p.mu.Unlock()
+	if killed {
+		runtime.Goexit()
+	}
+	return p
+}
+
+// Lookup returns the running process with `id`.
+func Lookup(id uint64) (*Process, bool) {
+	mu.Lock()
+	defer mu.Unlock()
+	p, ok := processes[id]
+	return p, ok
+}
+
+// RegisterEntry makes `fn` available to Spawn as the function `name`.
+func RegisterEntry(name string, fn func(params []uint64)) {
+	mu.Lock()
+	defer mu.Unlock()
+	entries[name] = fn
+}
+
+// Spawn starts a new process running the entry function `name` with
+// `params` in a new goroutine. If `link` is not 0, the new process is
+// linked to the current one with `link` as the link-tag.
+func Spawn(link int64, name string, params []uint64) (*Process, error) {
+	mu.Lock()
+	fn, ok := entries[name]
+	mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("fakehost: function %q does not exist", name)
+	}
+
+	parent := Current()
+	child := newProcess()
+	if link != 0 {
+		parent.Link(link, child)
+	}
+
+	started := make(chan struct{})
+	go func() {
+		mu.Lock()
+		byGID[goroutineID()] = child
+		mu.Unlock()
+		close(started)
+
+		failed := true
+		defer func() {
+			recover()
+			mu.Lock()
+			delete(byGID, goroutineID())
+			mu.Unlock()
+			child.exit(failed)
+		}()
+		fn(params)
+		failed = false
+	}()
+	<-started
+	return child, nil
+}
+
+// Link links `p` and `other` so that each gets notified with `tag`
+// when the other fails.
+func (p *Process) Link(tag int64, other *Process) {
+	p.mu.Lock()
+	p.links[other.ID] = tag
+	p.mu.Unlock()
+	other.mu.Lock()
+	other.links[p.ID] = tag
+	other.mu.Unlock()
+}
+
+// Unlink removes the link between `p` and `other`.
+func (p *Process) Unlink(other *Process) {
+	p.mu.Lock()
+	delete(p.links, other.ID)
+	p.mu.Unlock()
+	other.mu.Lock()
+	delete(other.links, p.ID)
+	other.mu.Unlock()
+}
+
+// SetDieWhenLinkDies defines whether `p` dies when a linked process fails
+// or receives a LinkDied message instead.
+func (p *Process) SetDieWhenLinkDies(die bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.dieOnLink = die
+}
+
+// Kill marks `p` as killed. Its goroutine exits the next time it calls
+// into the fake host or immediately if it is waiting for a message.
+// Its resources are closed right away, like lunatic
+// drops them, so that e.g. a blocked read of the process returns.
+func (p *Process) Kill() {
+	p.mu.Lock()
+	if p.killed {
+		p.mu.Unlock()
+		return
+	}
+	p.killed = true
+	close(p.killedCh)
+	resources := p.resources
+	p.resources = map[uint64]any{}
+	p.mu.Unlock()
+
+	for _, r := range resources {
+		if c, ok := r.(io.Closer); ok {
+			c.Close()
+		}
+	}
+}
+
+// Exit ends the current process as if its goroutine returned, notifying
+// linked processes if `failed` is true. It is used by tests that run in
+// the main test goroutine.
+func Exit(failed bool) {
+	p := Current()
+	mu.Lock()
+	delete(byGID, goroutineID())
+	mu.Unlock()
+	p.exit(failed)
+}
+
+func (p *Process) exit(failed bool) {
+	p.mu.Lock()
+	if p.done {
+		p.mu.Unlock()
+		return
+	}
+	p.done = true
+	failed = failed || p.killed
+	links := p.links
+	p.links = map[uint64]int64{}
+	resources := p.resources
+	p.resources = map[uint64]any{}
+	messages := append(p.mailbox, p.scratch)
+	p.mailbox, p.scratch = nil, nil
+	p.mu.Unlock()
+
+	for _, r := range resources {
+		if c, ok := r.(io.Closer); ok {
+			c.Close()
+		}
+	}
+	for _, msg := range messages {
+		msg.drop()
+	}
+
+	mu.Lock()
+	delete(processes, p.ID)
+	mu.Unlock()
+	releaseRegistry(p.ID)
+
+	if !failed {
+		for id := range links {
+			if other, ok := Lookup(id); ok {
+				other.mu.Lock()
+				delete(other.links, p.ID)
+				other.mu.Unlock()
+			}
+		}
+		return
+	}
+
+	for id, tag := range links {
+		other, ok := Lookup(id)
+		if !ok {
+			continue
+		}
+		other.mu.Lock()
+		delete(other.links, p.ID)
+		die := other.dieOnLink
+		other.mu.Unlock()
+		if die {
+			other.Kill()
+			continue
+		}
+		other.Deliver(&Message{Kind: LinkDied, Tag: tag})
+	}
+}
+
+// wake signals a goroutine waiting on the process' mailbox.
+func (p *Process) wake() {
+	select {
+	case p.notify <- struct{}{}:
+	default:
+	}
+}
+
+// AddResource stores `v` in the resources of `p` and returns its ID.
+func (p *Process) AddResource(v any) uint64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.lastResource++
+	p.resources[p.lastResource] = v
+	return p.lastResource
+}
+
+// Resource returns the resource with `id` if it has type T.
+// It panics otherwise, like the host traps on invalid resource IDs.
+func Resource[T any](p *Process, id uint64) T {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	v, ok := p.resources[id].(T)
+	if !ok {
+		panic(fmt.Sprintf("fakehost: process %v: %T resource %v not found", p.ID, v, id))
+	}
+	return v
+}
+
+// TakeResource removes the resource with `id` from `p` and returns it.
+// It panics if the resource does not exist or does not have type T.
+func TakeResource[T any](p *Process, id uint64) T {
+	v := Resource[T](p, id)
+	p.mu.Lock()
+	delete(p.resources, id)
+	p.mu.Unlock()
+	return v
+}
+
+// DropResource removes the resource with `id` from `p` if it still exists.
+// Unlike TakeResource, it can be called from any goroutine, e.g. a finalizer.
+func (p *Process) DropResource(id uint64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.resources, id)
+}
+
+// Sleep suspends the current process for `d`, exiting early if it is killed.
+func Sleep(d time.Duration) {
+	p := Current()
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-p.killedCh:
+		runtime.Goexit()
+	}
+}
+
+// Bytes returns the guest memory at `p` of length `n`.
+func Bytes(p unsafe.Pointer, n uint32) []byte {
+	if n == 0 {
+		return nil
+	}
+	return unsafe.Slice((*byte)(p), n)
+}
+
+// String returns a copy of the guest memory at `p` of length `n` as a string.
+func String(p unsafe.Pointer, n uint32) string {
+	return string(Bytes(p, n))
+}
+
+// DecodeParams decodes the params of a spawn call. Each param is a value
+// type byte followed by a 128-bit little-endian value, of which only the
+// low 64 bits are kept.
+func DecodeParams(b []byte) []uint64 {
+	if len(b)%17 != 0 {
+		panic("fakehost: params array has the wrong format")
+	}
+	params := make([]uint64, len(b)/17)
+	for i := range params {
+		params[i] = binary.LittleEndian.Uint64(b[i*17+1:])
+	}
+	return params
+}
@@ -0,0 +1,167 @@
+// -*- compile-command: "go test ./..."; -*-
+
+package fakehost
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// NodeID is the ID of the only node of the fake host.
+const NodeID = 1
+
+var (
+	registryMu sync.Mutex
+	registry   = map[string][2]uint64{} // name => node ID, process ID
+	// registryHolder is the ID of the process that holds registryMu after
+	// RegistryGetOrPutLater found no process, or 0.
+	registryHolder atomic.Uint64
+)
+
+// lockRegistry locks the registry unless the current process holds it.
+// It reports whether the current process holds it.
+func lockRegistry() (held bool) {
+	if registryHolder.Load() == Current().ID {
+		return true
+	}
+	registryMu.Lock()
+	return false
+}
+
+// unlockRegistry unlocks the registry and releases it from its holder.
+func unlockRegistry() {
+	registryHolder.Store(0)
+	registryMu.Unlock()
+}
+
+// releaseRegistry unlocks the registry if the process `id` holds it.
+func releaseRegistry(id uint64) {
+	if registryHolder.CompareAndSwap(id, 0) {
+		registryMu.Unlock()
+	}
+}
+
+// RegistryPut registers the process `processID` on `nodeID` under `name`.
+func RegistryPut(name string, nodeID, processID uint64) {
+	lockRegistry()
+	defer unlockRegistry()
+	registry[name] = [2]uint64{nodeID, processID}
+}
+
+// RegistryGet looks up the process registered under `name`.
+func RegistryGet(name string) (nodeID, processID uint64, ok bool) {
+	if !lockRegistry() {
+		defer unlockRegistry()
+	}
+	v, ok := registry[name]
+	return v[0], v[1], ok
+}
+
+// RegistryGetOrPutLater is like RegistryGet, but if no process is
+// registered under `name`, the current process holds the registry until it
+// calls RegistryPut or RegistryRemove, or exits, so all other processes
+// wait for it.
+func RegistryGetOrPutLater(name string) (nodeID, processID uint64, ok bool) {
+	held := lockRegistry()
+	v, ok := registry[name]
+	switch {
+	case !ok && !held:
+		registryHolder.Store(Current().ID)
+	case ok && !held:
+		registryMu.Unlock()
+	}
+	return v[0], v[1], ok
+}
+
+// RegistryRemove removes `name` from the registry.
+func RegistryRemove(name string) {
+	lockRegistry()
+	defer unlockRegistry()
+	delete(registry, name)
+}
+
+var (
+	timersMu  sync.Mutex
+	timers    = map[uint64]*time.Timer{}
+	lastTimer uint64
+)
+
+// SendAfter sends the message in the scratch area of `p` to the process
+// `id` after `delay` and returns the ID of the timer.
+func (p *Process) SendAfter(id uint64, delay time.Duration) uint64 {
+	msg := p.Scratch()
+	p.mu.Lock()
+	p.scratch = nil
+	p.mu.Unlock()
+
+	timersMu.Lock()
+	defer timersMu.Unlock()
+	lastTimer++
+	timerID := lastTimer
+	timers[timerID] = time.AfterFunc(delay, func() {
+		timersMu.Lock()
+		delete(timers, timerID)
+		timersMu.Unlock()
+		if to, ok := Lookup(id); ok {
+			to.Deliver(msg)
+		}
+	})
+	return timerID
+}
+
+// CancelTimer stops the timer `timerID` and reports whether it was pending.
+func CancelTimer(timerID uint64) bool {
+	timersMu.Lock()
+	defer timersMu.Unlock()
+	t, ok := timers[timerID]
+	if !ok {
+		return false
+	}
+	delete(timers, timerID)
+	return t.Stop()
+}
+
+// Metric is the last state of a metric recorded by the fake host.
+type Metric struct {
+	Counter   uint64
+	Gauge     float64
+	Histogram []float64
+}
+
+var (
+	metricsMu sync.Mutex
+	metrics   = map[string]*Metric{}
+)
+
+// UpdateMetric calls `fn` with the metric `name`, creating it if needed.
+func UpdateMetric(name string, fn func(m *Metric)) {
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+	m, ok := metrics[name]
+	if !ok {
+		m = &Metric{}
+		metrics[name] = m
+	}
+	fn(m)
+}
+
+// Metrics returns a copy of all the recorded metrics.
+func Metrics() map[string]Metric {
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+	out := make(map[string]Metric, len(metrics))
+	for name, m := range metrics {
+		c := *m
+		c.Histogram = append([]float64(nil), m.Histogram...)
+		out[name] = c
+	}
+	return out
+}
+
+// ResetMetrics forgets all the recorded metrics.
+func ResetMetrics() {
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+	metrics = map[string]*Metric{}
+}
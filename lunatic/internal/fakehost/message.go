@@ -0,0 +1,207 @@
+// -*- compile-command: "go test ./..."; -*-
+
+package fakehost
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+	"time"
+)
+
+// Kinds of messages.
+const (
+	DataMessage = iota
+	LinkDied
+	ProcessDied
+)
+
+// Status codes returned by the host.
+const (
+	StatusOK       = 0
+	StatusTimedOut = 9027
+)
+
+// Message is a message in a mailbox or in the scratch area.
+type Message struct {
+	Kind      int
+	Tag       int64
+	Data      []byte
+	Resources []any
+}
+
+// drop closes the resources of `msg` that were not taken out of it,
+// like the host does when a message is dropped.
+func (msg *Message) drop() {
+	if msg == nil {
+		return
+	}
+	for _, r := range msg.Resources {
+		if c, ok := r.(io.Closer); ok {
+			c.Close()
+		}
+	}
+}
+
+// Deliver puts `msg` into the mailbox of `p`.
+func (p *Process) Deliver(msg *Message) {
+	p.mu.Lock()
+	if p.done {
+		p.mu.Unlock()
+		msg.drop()
+		return
+	}
+	p.mailbox = append(p.mailbox, msg)
+	p.mu.Unlock()
+	p.wake()
+}
+
+// CreateData puts a new data message into the scratch area of `p`.
+func (p *Process) CreateData(tag int64, capacity uint64) {
+	p.mu.Lock()
+	old := p.scratch
+	p.scratch = &Message{Kind: DataMessage, Tag: tag, Data: make([]byte, 0, min(capacity, 1<<20))}
+	p.readPos = 0
+	p.mu.Unlock()
+	old.drop()
+}
+
+// Scratch returns the data message in the scratch area.
+// It panics if there is none, like the host traps.
+func (p *Process) Scratch() *Message {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.scratch == nil || p.scratch.Kind != DataMessage {
+		panic(fmt.Sprintf("fakehost: process %v: no data message in scratch area", p.ID))
+	}
+	return p.scratch
+}
+
+// WriteData appends `data` to the message in the scratch area.
+func (p *Process) WriteData(data []byte) int {
+	msg := p.Scratch()
+	msg.Data = append(msg.Data, data...)
+	return len(data)
+}
+
+// ReadData reads from the message in the scratch area into `buf`.
+func (p *Process) ReadData(buf []byte) int {
+	msg := p.Scratch()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	n := copy(buf, msg.Data[min(p.readPos, len(msg.Data)):])
+	p.readPos += n
+	return n
+}
+
+// SeekData moves the reading head of the message in the scratch area.
+func (p *Process) SeekData(index uint64) {
+	p.Scratch()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.readPos = int(index)
+}
+
+// Tag returns the tag of the message in the scratch area.
+func (p *Process) Tag() int64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.scratch == nil {
+		panic(fmt.Sprintf("fakehost: process %v: no message in scratch area", p.ID))
+	}
+	return p.scratch.Tag
+}
+
+// PushResource moves the resource with `id` of `p` into the message in
+// the scratch area and returns its index.
+func (p *Process) PushResource(id uint64) uint64 {
+	msg := p.Scratch()
+	r := TakeResource[any](p, id)
+	msg.Resources = append(msg.Resources, r)
+	return uint64(len(msg.Resources) - 1)
+}
+
+// TakeMessageResource moves the resource at `index` of the message in the
+// scratch area into the resources of `p` and returns its new ID.
+func (p *Process) TakeMessageResource(index uint64) uint64 {
+	msg := p.Scratch()
+	if index >= uint64(len(msg.Resources)) || msg.Resources[index] == nil {
+		panic(fmt.Sprintf("fakehost: process %v: no resource at index %v", p.ID, index))
+	}
+	r := msg.Resources[index]
+	msg.Resources[index] = nil
+	return p.AddResource(r)
+}
+
+// Send sends the message in the scratch area of `p` to the process with `id`.
+// Messages to processes that don't exist are dropped.
+func (p *Process) Send(id uint64) {
+	msg := p.Scratch()
+	p.mu.Lock()
+	p.scratch = nil
+	p.mu.Unlock()
+
+	if to, ok := Lookup(id); ok {
+		to.Deliver(msg)
+	} else {
+		msg.drop()
+	}
+}
+
+// Receive waits for the next message matching any of `tags`, or any message
+// if `tags` is empty, and puts it into the scratch area.
+// A negative `timeout` waits forever.
+// It returns StatusTimedOut on timeout or the kind of the message.
+func (p *Process) Receive(tags []int64, timeout time.Duration) uint32 {
+	var timer <-chan time.Time
+	if timeout >= 0 {
+		t := time.NewTimer(timeout)
+		defer t.Stop()
+		timer = t.C
+	}
+
+	for {
+		p.mu.Lock()
+		for i, msg := range p.mailbox {
+			if matches(msg, tags) {
+				p.mailbox = append(p.mailbox[:i:i], p.mailbox[i+1:]...)
+				old := p.scratch
+				p.scratch = msg
+				p.readPos = 0
+				p.mu.Unlock()
+				old.drop()
+				return uint32(msg.Kind)
+			}
+		}
+		p.mu.Unlock()
+
+		select {
+		case <-p.notify:
+		case <-timer:
+			return StatusTimedOut
+		case <-p.killedCh:
+			runtime.Goexit()
+		}
+	}
+}
+
+func matches(msg *Message, tags []int64) bool {
+	if len(tags) == 0 {
+		return true
+	}
+	for _, tag := range tags {
+		if msg.Tag == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// Timeout converts a host timeout in milliseconds into a duration,
+// where math.MaxUint64 means no timeout and is returned as -1.
+func Timeout(millis uint64) time.Duration {
+	if millis > uint64(1<<63-1)/uint64(time.Millisecond) {
+		return -1
+	}
+	return time.Duration(millis) * time.Millisecond
+}
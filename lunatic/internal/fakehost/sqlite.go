@@ -0,0 +1,1227 @@
+// -*- compile-command: "go test ./..."; -*-
+
+package fakehost
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// The in-memory SQLite shim understands a small subset of SQL that is
+// enough to exercise the bindings:
+//
+//   - CREATE TABLE [IF NOT EXISTS] t (col [type] [PRIMARY KEY], ...)
+//   - DROP TABLE [IF EXISTS] t
+//   - INSERT INTO t [(col, ...)] VALUES (expr, ...)[, (expr, ...)]
+//   - SELECT * | expr, ... [FROM t] [WHERE cond] [ORDER BY col [ASC|DESC], ...] [LIMIT n]
+//   - UPDATE t SET col = expr, ... [WHERE cond]
+//   - DELETE FROM t [WHERE cond]
+//   - BEGIN, COMMIT, END, ROLLBACK, SAVEPOINT s, RELEASE s, ROLLBACK TO s
+//
+// Expressions are literals, `?`, `?NNN` and `:name` parameters, column
+// names, COUNT(*), MIN(col), MAX(col) and last_insert_rowid(). Conditions are comparisons
+// (=, ==, !=, <>, <, <=, >, >=, IS [NOT] NULL) joined with AND.
+// An INTEGER PRIMARY KEY column is assigned automatically when NULL.
+// The tables are listed in sqlite_master, whose changes are discarded.
+// Databases with the same path share their tables, except ":memory:".
+
+// SQLiteStatus codes returned by sqlite3_step.
+const (
+	SQLiteRow  = 100
+	SQLiteDone = 101
+)
+
+// Value is a SQLite value: nil, int64, float64, string or []byte.
+type Value = any
+
+var (
+	databasesMu sync.Mutex
+	databases   = map[string]*SQLiteDB{}
+)
+
+// SQLiteDB is an in-memory database.
+type SQLiteDB struct {
+	mu        sync.Mutex
+	tables    map[string]*sqliteTable
+	snapshots []sqliteSnapshot // open transaction and savepoints
+}
+
+type sqliteSnapshot struct {
+	name   string // "" for a BEGIN transaction
+	tables map[string]*sqliteTable
+}
+
+type sqliteTable struct {
+	columns []string
+	pk      int   // index of the INTEGER PRIMARY KEY column or -1
+	rowID   int64 // last rowid of a table without INTEGER PRIMARY KEY
+	rows    [][]Value
+}
+
+func (t *sqliteTable) clone() *sqliteTable {
+	c := &sqliteTable{columns: t.columns, pk: t.pk, rowID: t.rowID, rows: make([][]Value, len(t.rows))}
+	for i, row := range t.rows {
+		c.rows[i] = append([]Value(nil), row...)
+	}
+	return c
+}
+
+func (t *sqliteTable) column(name string) int {
+	for i, c := range t.columns {
+		if strings.EqualFold(c, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+// SQLiteConn is an open connection to a SQLiteDB.
+type SQLiteConn struct {
+	DB           *SQLiteDB
+	Changes      uint32
+	LastInsertID int64
+	LastError    string
+}
+
+// OpenSQLite opens the database at `path`.
+func OpenSQLite(path string) *SQLiteConn {
+	databasesMu.Lock()
+	defer databasesMu.Unlock()
+	db, ok := databases[path]
+	if !ok || path == ":memory:" {
+		db = &SQLiteDB{tables: map[string]*sqliteTable{}}
+		if path != ":memory:" {
+			databases[path] = db
+		}
+	}
+	return &SQLiteConn{DB: db}
+}
+
+// ResetSQLite forgets all databases.
+func ResetSQLite() {
+	databasesMu.Lock()
+	defer databasesMu.Unlock()
+	databases = map[string]*SQLiteDB{}
+}
+
+// Execute runs all the statements in `sql`, stopping at the first error,
+// which is also stored in LastError.
+func (c *SQLiteConn) Execute(sql string) error {
+	stmts, err := ParseSQL(sql)
+	if err != nil {
+		c.LastError = err.Error()
+		return err
+	}
+	for _, st := range stmts {
+		if _, _, err := c.Run(st, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Run executes the parsed statement `st` with the bound parameters `params`,
+// keyed by 1-based position (int) or by name including its prefix (string).
+// It returns the result columns and rows.
+func (c *SQLiteConn) Run(st *SQLStatement, params map[any]Value) (columns []string, rows [][]Value, err error) {
+	c.DB.mu.Lock()
+	defer c.DB.mu.Unlock()
+
+	r := &sqliteRun{db: c.DB, conn: c, params: params}
+	columns, rows, changes, err := r.exec(st)
+	if err != nil {
+		c.LastError = err.Error()
+		return nil, nil, err
+	}
+	if st.kind == "INSERT" || st.kind == "UPDATE" || st.kind == "DELETE" {
+		c.Changes = uint32(changes)
+	}
+	return columns, rows, nil
+}
+
+// SQLStatement is a parsed SQL statement.
+type SQLStatement struct {
+	kind   string
+	tokens []sqlToken
+}
+
+// ParamCount returns the number of parameters of the statement.
+func (st *SQLStatement) ParamCount() int {
+	var n, pos int
+	for _, t := range st.tokens {
+		if t.kind != tokParam {
+			continue
+		}
+		switch {
+		case t.text == "?":
+			pos++
+			n = max(n, pos)
+		case t.text[0] == '?':
+			i, _ := strconv.Atoi(t.text[1:])
+			pos = i
+			n = max(n, i)
+		default:
+			n++
+		}
+	}
+	return n
+}
+
+// ParamName returns the name of the 1-based parameter `i`, or "" if it is positional.
+func (st *SQLStatement) ParamName(i int) string {
+	var n int
+	for _, t := range st.tokens {
+		if t.kind == tokParam && t.text[0] == ':' {
+			n++
+			if n == i {
+				return t.text
+			}
+		}
+	}
+	return ""
+}
+
+// ParseSQL splits `sql` into statements and parses them.
+func ParseSQL(sql string) ([]*SQLStatement, error) {
+	tokens, err := tokenize(sql)
+	if err != nil {
+		return nil, err
+	}
+
+	var stmts []*SQLStatement
+	var cur []sqlToken
+	for _, t := range append(tokens, sqlToken{kind: tokPunct, text: ";"}) {
+		if t.kind == tokPunct && t.text == ";" {
+			if len(cur) > 0 {
+				stmts = append(stmts, &SQLStatement{kind: strings.ToUpper(cur[0].text), tokens: cur})
+				cur = nil
+			}
+			continue
+		}
+		cur = append(cur, t)
+	}
+	for _, st := range stmts {
+		switch st.kind {
+		case "CREATE", "DROP", "INSERT", "SELECT", "UPDATE", "DELETE",
+			"BEGIN", "COMMIT", "END", "ROLLBACK", "SAVEPOINT", "RELEASE":
+		default:
+			return nil, fmt.Errorf("near %q: syntax error", st.tokens[0].text)
+		}
+	}
+	return stmts, nil
+}
+
+const (
+	tokIdent = iota
+	tokNumber
+	tokString
+	tokBlob
+	tokParam
+	tokPunct
+)
+
+type sqlToken struct {
+	kind int
+	text string
+}
+
+func tokenize(sql string) ([]sqlToken, error) {
+	var tokens []sqlToken
+	for i := 0; i < len(sql); {
+		c := sql[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '-' && strings.HasPrefix(sql[i:], "--"):
+			for i < len(sql) && sql[i] != '\n' {
+				i++
+			}
+		case (c == 'x' || c == 'X') && i+1 < len(sql) && sql[i+1] == '\'':
+			j := strings.IndexByte(sql[i+2:], '\'')
+			if j < 0 {
+				return nil, errors.New("unrecognized token: blob literal")
+			}
+			tokens = append(tokens, sqlToken{kind: tokBlob, text: sql[i+2 : i+2+j]})
+			i += j + 3
+		case isIdentStart(c):
+			j := i
+			for j < len(sql) && (isIdentStart(sql[j]) || isDigit(sql[j])) {
+				j++
+			}
+			tokens = append(tokens, sqlToken{kind: tokIdent, text: sql[i:j]})
+			i = j
+		case c == '"' || c == '`':
+			var sb strings.Builder
+			j := i + 1
+			for {
+				if j >= len(sql) {
+					return nil, errors.New("unrecognized token: quoted identifier")
+				}
+				if sql[j] == c {
+					if j+1 < len(sql) && sql[j+1] == c {
+						sb.WriteByte(c)
+						j += 2
+						continue
+					}
+					break
+				}
+				sb.WriteByte(sql[j])
+				j++
+			}
+			tokens = append(tokens, sqlToken{kind: tokIdent, text: sb.String()})
+			i = j + 1
+		case isDigit(c) || (c == '.' && i+1 < len(sql) && isDigit(sql[i+1])):
+			j := i
+			for j < len(sql) && (isDigit(sql[j]) || sql[j] == '.' || sql[j] == 'e' || sql[j] == 'E') {
+				j++
+			}
+			tokens = append(tokens, sqlToken{kind: tokNumber, text: sql[i:j]})
+			i = j
+		case c == '\'':
+			var sb strings.Builder
+			j := i + 1
+			for {
+				if j >= len(sql) {
+					return nil, errors.New("unrecognized token: string literal")
+				}
+				if sql[j] == '\'' {
+					if j+1 < len(sql) && sql[j+1] == '\'' {
+						sb.WriteByte('\'')
+						j += 2
+						continue
+					}
+					break
+				}
+				sb.WriteByte(sql[j])
+				j++
+			}
+			tokens = append(tokens, sqlToken{kind: tokString, text: sb.String()})
+			i = j + 1
+		case c == '?' || c == ':' || c == '@' || c == '$':
+			j := i + 1
+			for j < len(sql) && (isIdentStart(sql[j]) || isDigit(sql[j])) {
+				j++
+			}
+			tokens = append(tokens, sqlToken{kind: tokParam, text: sql[i:j]})
+			i = j
+		case strings.ContainsRune("<>!=", rune(c)) && i+1 < len(sql) && strings.ContainsRune("<>=", rune(sql[i+1])):
+			tokens = append(tokens, sqlToken{kind: tokPunct, text: sql[i : i+2]})
+			i += 2
+		case strings.ContainsRune("(),;=*<>-+", rune(c)):
+			tokens = append(tokens, sqlToken{kind: tokPunct, text: sql[i : i+1]})
+			i++
+		default:
+			return nil, fmt.Errorf("unrecognized token: %q", c)
+		}
+	}
+	return tokens, nil
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isDigit(c byte) bool { return c >= '0' && c <= '9' }
+
+// sqliteRun executes a single statement.
+type sqliteRun struct {
+	db     *SQLiteDB
+	conn   *SQLiteConn
+	params map[any]Value
+	tokens []sqlToken
+	pos    int
+	param  int // last positional parameter
+}
+
+func (r *sqliteRun) peek() sqlToken {
+	if r.pos >= len(r.tokens) {
+		return sqlToken{kind: tokPunct}
+	}
+	return r.tokens[r.pos]
+}
+
+func (r *sqliteRun) next() sqlToken {
+	t := r.peek()
+	r.pos++
+	return t
+}
+
+// accept consumes the next token if it is the keyword or punctuation `s`.
+func (r *sqliteRun) accept(s string) bool {
+	t := r.peek()
+	if (t.kind == tokIdent || t.kind == tokPunct) && strings.EqualFold(t.text, s) {
+		r.pos++
+		return true
+	}
+	return false
+}
+
+func (r *sqliteRun) expect(s string) error {
+	if !r.accept(s) {
+		return r.syntaxError()
+	}
+	return nil
+}
+
+func (r *sqliteRun) syntaxError() error {
+	if r.pos >= len(r.tokens) {
+		return errors.New("incomplete input")
+	}
+	return fmt.Errorf("near %q: syntax error", r.tokens[r.pos].text)
+}
+
+func (r *sqliteRun) ident() (string, error) {
+	t := r.next()
+	if t.kind != tokIdent {
+		r.pos--
+		return "", r.syntaxError()
+	}
+	return t.text, nil
+}
+
+func (r *sqliteRun) table(name string) (*sqliteTable, error) {
+	if strings.EqualFold(name, "sqlite_master") {
+		return r.master(), nil
+	}
+	for n, t := range r.db.tables {
+		if strings.EqualFold(n, name) {
+			return t, nil
+		}
+	}
+	return nil, fmt.Errorf("no such table: %v", name)
+}
+
+// master returns the read-only sqlite_master table listing the tables.
+func (r *sqliteRun) master() *sqliteTable {
+	t := &sqliteTable{columns: []string{"type", "name", "tbl_name"}, pk: -1}
+	for name := range r.db.tables {
+		t.rows = append(t.rows, []Value{"table", name, name})
+	}
+	sort.Slice(t.rows, func(i, j int) bool { return t.rows[i][1].(string) < t.rows[j][1].(string) })
+	return t
+}
+
+func (r *sqliteRun) exec(st *SQLStatement) (columns []string, rows [][]Value, changes int, err error) {
+	r.tokens = st.tokens
+	r.next()
+
+	switch st.kind {
+	case "CREATE":
+		err = r.create()
+	case "DROP":
+		err = r.drop()
+	case "INSERT":
+		changes, err = r.insert()
+	case "SELECT":
+		columns, rows, err = r.selectRows()
+	case "UPDATE":
+		changes, err = r.update()
+	case "DELETE":
+		changes, err = r.delete()
+	default:
+		err = r.transaction(st.kind)
+	}
+	if err == nil && r.pos < len(r.tokens) {
+		err = r.syntaxError()
+	}
+	return columns, rows, changes, err
+}
+
+func (r *sqliteRun) create() error {
+	if err := r.expect("TABLE"); err != nil {
+		return err
+	}
+	ifNotExists := r.accept("IF")
+	if ifNotExists {
+		if err := r.expect("NOT"); err != nil {
+			return err
+		}
+		if err := r.expect("EXISTS"); err != nil {
+			return err
+		}
+	}
+	name, err := r.ident()
+	if err != nil {
+		return err
+	}
+	if _, err := r.table(name); err == nil {
+		if ifNotExists {
+			r.pos = len(r.tokens)
+			return nil
+		}
+		return fmt.Errorf("table %v already exists", name)
+	}
+	if err := r.expect("("); err != nil {
+		return err
+	}
+
+	t := &sqliteTable{pk: -1}
+	for {
+		col, err := r.ident()
+		if err != nil {
+			return err
+		}
+		var def []string
+		for depth := 0; ; {
+			tok := r.peek()
+			if r.pos >= len(r.tokens) {
+				return r.syntaxError()
+			}
+			if depth == 0 && tok.kind == tokPunct && (tok.text == "," || tok.text == ")") {
+				break
+			}
+			if tok.text == "(" {
+				depth++
+			} else if tok.text == ")" {
+				depth--
+			}
+			def = append(def, strings.ToUpper(tok.text))
+			r.pos++
+		}
+		switch strings.ToUpper(col) {
+		case "PRIMARY", "UNIQUE", "CHECK", "FOREIGN", "CONSTRAINT":
+			// table constraint
+		default:
+			d := strings.Join(def, " ")
+			if strings.HasPrefix(d, "INTEGER") && strings.Contains(d, "PRIMARY KEY") {
+				t.pk = len(t.columns)
+			}
+			t.columns = append(t.columns, col)
+		}
+		if r.accept(")") {
+			break
+		}
+		if err := r.expect(","); err != nil {
+			return err
+		}
+	}
+	r.db.tables[name] = t
+	return nil
+}
+
+func (r *sqliteRun) drop() error {
+	if err := r.expect("TABLE"); err != nil {
+		return err
+	}
+	ifExists := r.accept("IF")
+	if ifExists {
+		if err := r.expect("EXISTS"); err != nil {
+			return err
+		}
+	}
+	name, err := r.ident()
+	if err != nil {
+		return err
+	}
+	for n := range r.db.tables {
+		if strings.EqualFold(n, name) {
+			delete(r.db.tables, n)
+			return nil
+		}
+	}
+	if ifExists {
+		return nil
+	}
+	return fmt.Errorf("no such table: %v", name)
+}
+
+func (r *sqliteRun) insert() (int, error) {
+	if err := r.expect("INTO"); err != nil {
+		return 0, err
+	}
+	name, err := r.ident()
+	if err != nil {
+		return 0, err
+	}
+	t, err := r.table(name)
+	if err != nil {
+		return 0, err
+	}
+
+	cols := make([]int, len(t.columns))
+	for i := range cols {
+		cols[i] = i
+	}
+	if r.accept("(") {
+		cols = cols[:0]
+		for {
+			col, err := r.ident()
+			if err != nil {
+				return 0, err
+			}
+			i := t.column(col)
+			if i < 0 {
+				return 0, fmt.Errorf("table %v has no column named %v", name, col)
+			}
+			cols = append(cols, i)
+			if r.accept(")") {
+				break
+			}
+			if err := r.expect(","); err != nil {
+				return 0, err
+			}
+		}
+	}
+	if err := r.expect("VALUES"); err != nil {
+		return 0, err
+	}
+
+	var n int
+	for {
+		if err := r.expect("("); err != nil {
+			return n, err
+		}
+		row := make([]Value, len(t.columns))
+		for i := 0; ; i++ {
+			v, err := r.expr(nil, nil)
+			if err != nil {
+				return n, err
+			}
+			if i >= len(cols) {
+				return n, fmt.Errorf("table %v has %v columns but more values were supplied", name, len(cols))
+			}
+			row[cols[i]] = v
+			if r.accept(")") {
+				if i+1 != len(cols) {
+					return n, fmt.Errorf("%v values for %v columns", i+1, len(cols))
+				}
+				break
+			}
+			if err := r.expect(","); err != nil {
+				return n, err
+			}
+		}
+		var rowID int64
+		if t.pk >= 0 {
+			if row[t.pk] == nil {
+				var maxID int64
+				for _, other := range t.rows {
+					if id, ok := other[t.pk].(int64); ok && id > maxID {
+						maxID = id
+					}
+				}
+				row[t.pk] = maxID + 1
+			}
+			for _, other := range t.rows {
+				if compare(other[t.pk], row[t.pk]) == 0 {
+					return n, fmt.Errorf("UNIQUE constraint failed: %v.%v", name, t.columns[t.pk])
+				}
+			}
+			rowID, _ = row[t.pk].(int64)
+		} else {
+			t.rowID++
+			rowID = t.rowID
+		}
+		t.rows = append(t.rows, row)
+		r.conn.LastInsertID = rowID
+		n++
+		if !r.accept(",") {
+			return n, nil
+		}
+	}
+}
+
+// expr parses and evaluates an expression for the row `row` of `t`,
+// which may both be nil.
+func (r *sqliteRun) expr(t *sqliteTable, row []Value) (Value, error) {
+	tok := r.next()
+	switch tok.kind {
+	case tokNumber:
+		if i, err := strconv.ParseInt(tok.text, 10, 64); err == nil {
+			return i, nil
+		}
+		f, err := strconv.ParseFloat(tok.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("malformed number %q", tok.text)
+		}
+		return f, nil
+	case tokString:
+		return tok.text, nil
+	case tokBlob:
+		var b []byte
+		if _, err := fmt.Sscanf(tok.text, "%x", &b); err != nil && tok.text != "" {
+			return nil, fmt.Errorf("malformed blob literal %q", tok.text)
+		}
+		return b, nil
+	case tokParam:
+		return r.paramValue(tok.text)
+	case tokPunct:
+		if tok.text == "-" {
+			v, err := r.expr(t, row)
+			switch n := v.(type) {
+			case int64:
+				return -n, err
+			case float64:
+				return -n, err
+			}
+			return nil, r.syntaxError()
+		}
+	case tokIdent:
+		switch strings.ToUpper(tok.text) {
+		case "NULL":
+			return nil, nil
+		case "TRUE":
+			return int64(1), nil
+		case "FALSE":
+			return int64(0), nil
+		case "LAST_INSERT_ROWID":
+			if r.accept("(") {
+				if err := r.expect(")"); err != nil {
+					return nil, err
+				}
+				return r.conn.LastInsertID, nil
+			}
+		}
+		if t != nil {
+			if i := t.column(tok.text); i >= 0 {
+				return row[i], nil
+			}
+		}
+		return nil, fmt.Errorf("no such column: %v", tok.text)
+	}
+	r.pos--
+	return nil, r.syntaxError()
+}
+
+func (r *sqliteRun) paramValue(name string) (Value, error) {
+	var key any = name
+	switch {
+	case name == "?":
+		r.param++
+		key = r.param
+	case name[0] == '?':
+		i, err := strconv.Atoi(name[1:])
+		if err != nil {
+			return nil, fmt.Errorf("malformed parameter %q", name)
+		}
+		r.param = i
+		key = i
+	}
+	return r.params[key], nil
+}
+
+// condition parses a WHERE clause and returns the predicate.
+// The parameters are evaluated once for each row, so the parser
+// is rewound for every call.
+func (r *sqliteRun) condition(t *sqliteTable) (func(row []Value) (bool, error), error) {
+	if !r.accept("WHERE") {
+		return func([]Value) (bool, error) { return true, nil }, nil
+	}
+
+	start, param := r.pos, r.param
+	end := start
+	for end < len(r.tokens) {
+		tok := r.tokens[end]
+		if tok.kind == tokIdent && (strings.EqualFold(tok.text, "ORDER") || strings.EqualFold(tok.text, "LIMIT")) {
+			break
+		}
+		end++
+	}
+
+	pred := func(row []Value) (bool, error) {
+		r.pos, r.param = start, param
+		defer func() { r.pos = end }()
+		for {
+			left, err := r.expr(t, row)
+			if err != nil {
+				return false, err
+			}
+			var ok bool
+			if r.accept("IS") {
+				not := r.accept("NOT")
+				if err := r.expect("NULL"); err != nil {
+					return false, err
+				}
+				ok = (left == nil) != not
+			} else {
+				op := r.next()
+				right, err := r.expr(t, row)
+				if err != nil {
+					return false, err
+				}
+				if left == nil || right == nil {
+					ok = false
+				} else {
+					c := compare(left, right)
+					switch op.text {
+					case "=", "==":
+						ok = c == 0
+					case "!=", "<>":
+						ok = c != 0
+					case "<":
+						ok = c < 0
+					case "<=":
+						ok = c <= 0
+					case ">":
+						ok = c > 0
+					case ">=":
+						ok = c >= 0
+					default:
+						r.pos--
+						return false, r.syntaxError()
+					}
+				}
+			}
+			if !ok {
+				return false, nil
+			}
+			if r.pos >= end {
+				return true, nil
+			}
+			if err := r.expect("AND"); err != nil {
+				return false, err
+			}
+		}
+	}
+
+	// Validate the clause once, even if the table is empty.
+	if _, err := pred(make([]Value, len(t.columns))); err != nil {
+		return nil, err
+	}
+	return pred, nil
+}
+
+// compare orders SQLite values: NULL < numbers < text < blobs.
+func compare(a, b Value) int {
+	rank := func(v Value) int {
+		switch v.(type) {
+		case nil:
+			return 0
+		case int64, float64:
+			return 1
+		case string:
+			return 2
+		default:
+			return 3
+		}
+	}
+	if ra, rb := rank(a), rank(b); ra != rb {
+		return ra - rb
+	}
+	switch a := a.(type) {
+	case nil:
+		return 0
+	case int64:
+		if b, ok := b.(int64); ok {
+			return cmpOrdered(a, b)
+		}
+		return cmpOrdered(float64(a), b.(float64))
+	case float64:
+		if b, ok := b.(int64); ok {
+			return cmpOrdered(a, float64(b))
+		}
+		return cmpOrdered(a, b.(float64))
+	case string:
+		return strings.Compare(a, b.(string))
+	default:
+		return bytes.Compare(a.([]byte), b.([]byte))
+	}
+}
+
+func cmpOrdered[T int64 | float64](a, b T) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func (r *sqliteRun) selectRows() ([]string, [][]Value, error) {
+	// The result columns are parsed after FROM is known, so skip them first.
+	exprStart := r.pos
+	depth := 0
+	for r.pos < len(r.tokens) {
+		tok := r.peek()
+		if depth == 0 && tok.kind == tokIdent && strings.EqualFold(tok.text, "FROM") {
+			break
+		}
+		if tok.text == "(" {
+			depth++
+		} else if tok.text == ")" {
+			depth--
+		}
+		r.pos++
+	}
+	exprEnd := r.pos
+
+	t := &sqliteTable{rows: [][]Value{nil}}
+	if r.accept("FROM") {
+		name, err := r.ident()
+		if err != nil {
+			return nil, nil, err
+		}
+		if t, err = r.table(name); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// The parameters of the result columns come before those of the WHERE clause.
+	afterFrom, param := r.pos, r.param
+	type resultCol struct {
+		name  string
+		start int
+		agg   string
+	}
+	var cols []resultCol
+	r.pos = exprStart
+	for r.pos < exprEnd {
+		start := r.pos
+		switch {
+		case r.accept("*"):
+			for _, c := range t.columns {
+				cols = append(cols, resultCol{name: c, start: -1})
+			}
+		case (strings.EqualFold(r.peek().text, "COUNT") || strings.EqualFold(r.peek().text, "MIN") ||
+			strings.EqualFold(r.peek().text, "MAX")) && r.pos+1 < exprEnd && r.tokens[r.pos+1].text == "(":
+			agg := strings.ToUpper(r.next().text)
+			r.next()
+			for r.pos < exprEnd && !r.accept(")") {
+				r.pos++
+			}
+			cols = append(cols, resultCol{name: tokensText(r.tokens[start:r.pos]), start: start, agg: agg})
+		default:
+			if _, err := r.expr(t, make([]Value, len(t.columns))); err != nil {
+				return nil, nil, err
+			}
+			cols = append(cols, resultCol{name: tokensText(r.tokens[start:r.pos]), start: start})
+		}
+		if r.accept("AS") {
+			alias, err := r.ident()
+			if err != nil {
+				return nil, nil, err
+			}
+			cols[len(cols)-1].name = alias
+		}
+		if r.pos < exprEnd {
+			if err := r.expect(","); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+	colParam := r.param
+	r.pos = afterFrom
+	r.param = max(param, colParam)
+
+	pred, err := r.condition(t)
+	if err != nil {
+		return nil, nil, err
+	}
+	var matched [][]Value
+	for _, row := range t.rows {
+		if row == nil {
+			row = []Value{}
+		}
+		ok, err := pred(row)
+		if err != nil {
+			return nil, nil, err
+		}
+		if ok {
+			matched = append(matched, row)
+		}
+	}
+
+	if r.accept("ORDER") {
+		if err := r.expect("BY"); err != nil {
+			return nil, nil, err
+		}
+		type key struct {
+			col  int
+			desc bool
+		}
+		var keys []key
+		for {
+			name, err := r.ident()
+			if err != nil {
+				return nil, nil, err
+			}
+			i := t.column(name)
+			if i < 0 {
+				return nil, nil, fmt.Errorf("no such column: %v", name)
+			}
+			k := key{col: i}
+			if r.accept("DESC") {
+				k.desc = true
+			} else {
+				r.accept("ASC")
+			}
+			keys = append(keys, k)
+			if !r.accept(",") {
+				break
+			}
+		}
+		sort.SliceStable(matched, func(a, b int) bool {
+			for _, k := range keys {
+				c := compare(matched[a][k.col], matched[b][k.col])
+				if k.desc {
+					c = -c
+				}
+				if c != 0 {
+					return c < 0
+				}
+			}
+			return false
+		})
+	}
+
+	limit := -1
+	if r.accept("LIMIT") {
+		v, err := r.expr(nil, nil)
+		if err != nil {
+			return nil, nil, err
+		}
+		n, ok := v.(int64)
+		if !ok {
+			return nil, nil, errors.New("datatype mismatch")
+		}
+		limit = int(n)
+	}
+	end := r.pos
+
+	names := make([]string, len(cols))
+	for i, c := range cols {
+		names[i] = c.name
+	}
+
+	var aggregate bool
+	for _, c := range cols {
+		aggregate = aggregate || c.agg != ""
+	}
+	if aggregate {
+		row := make([]Value, len(cols))
+		for i, c := range cols {
+			switch c.agg {
+			case "COUNT":
+				row[i] = int64(len(matched))
+			case "MIN", "MAX":
+				r.pos = c.start + 2
+				col, err := r.ident()
+				if err != nil {
+					return nil, nil, err
+				}
+				ci := t.column(col)
+				if ci < 0 {
+					return nil, nil, fmt.Errorf("no such column: %v", col)
+				}
+				for _, m := range matched {
+					v := m[ci]
+					if v == nil {
+						continue
+					}
+					if row[i] == nil || (c.agg == "MIN") == (compare(v, row[i]) < 0) {
+						row[i] = v
+					}
+				}
+			}
+		}
+		r.pos = end
+		return names, [][]Value{row}, nil
+	}
+
+	var rows [][]Value
+	for _, m := range matched {
+		if limit >= 0 && len(rows) >= limit {
+			break
+		}
+		out := make([]Value, 0, len(cols))
+		r.param = param
+		for _, c := range cols {
+			if c.start < 0 {
+				out = append(out, m[t.column(c.name)])
+				continue
+			}
+			r.pos = c.start
+			v, err := r.expr(t, m)
+			if err != nil {
+				return nil, nil, err
+			}
+			out = append(out, v)
+		}
+		rows = append(rows, out)
+	}
+	r.pos = end
+	return names, rows, nil
+}
+
+func tokensText(tokens []sqlToken) string {
+	var parts []string
+	for _, t := range tokens {
+		parts = append(parts, t.text)
+	}
+	return strings.Join(parts, "")
+}
+
+func (r *sqliteRun) update() (int, error) {
+	name, err := r.ident()
+	if err != nil {
+		return 0, err
+	}
+	t, err := r.table(name)
+	if err != nil {
+		return 0, err
+	}
+	if err := r.expect("SET"); err != nil {
+		return 0, err
+	}
+
+	type assignment struct {
+		col   int
+		value Value
+	}
+	var sets []assignment
+	for {
+		col, err := r.ident()
+		if err != nil {
+			return 0, err
+		}
+		i := t.column(col)
+		if i < 0 {
+			return 0, fmt.Errorf("no such column: %v", col)
+		}
+		if err := r.expect("="); err != nil {
+			return 0, err
+		}
+		v, err := r.expr(nil, nil)
+		if err != nil {
+			return 0, err
+		}
+		sets = append(sets, assignment{col: i, value: v})
+		if !r.accept(",") {
+			break
+		}
+	}
+
+	pred, err := r.condition(t)
+	if err != nil {
+		return 0, err
+	}
+	var n int
+	for _, row := range t.rows {
+		ok, err := pred(row)
+		if err != nil {
+			return n, err
+		}
+		if !ok {
+			continue
+		}
+		for _, s := range sets {
+			row[s.col] = s.value
+		}
+		n++
+	}
+	return n, nil
+}
+
+func (r *sqliteRun) delete() (int, error) {
+	if err := r.expect("FROM"); err != nil {
+		return 0, err
+	}
+	name, err := r.ident()
+	if err != nil {
+		return 0, err
+	}
+	t, err := r.table(name)
+	if err != nil {
+		return 0, err
+	}
+	pred, err := r.condition(t)
+	if err != nil {
+		return 0, err
+	}
+
+	kept := t.rows[:0:0]
+	for _, row := range t.rows {
+		ok, err := pred(row)
+		if err != nil {
+			return 0, err
+		}
+		if !ok {
+			kept = append(kept, row)
+		}
+	}
+	n := len(t.rows) - len(kept)
+	t.rows = kept
+	return n, nil
+}
+
+func (r *sqliteRun) snapshot() map[string]*sqliteTable {
+	tables := make(map[string]*sqliteTable, len(r.db.tables))
+	for name, t := range r.db.tables {
+		tables[name] = t.clone()
+	}
+	return tables
+}
+
+func (r *sqliteRun) transaction(kind string) error {
+	db := r.db
+	switch kind {
+	case "BEGIN":
+		for r.accept("DEFERRED") || r.accept("IMMEDIATE") || r.accept("EXCLUSIVE") || r.accept("TRANSACTION") {
+		}
+		if len(db.snapshots) > 0 {
+			return errors.New("cannot start a transaction within a transaction")
+		}
+		db.snapshots = append(db.snapshots, sqliteSnapshot{tables: r.snapshot()})
+	case "COMMIT", "END":
+		r.accept("TRANSACTION")
+		if len(db.snapshots) == 0 {
+			return errors.New("cannot commit - no transaction is active")
+		}
+		db.snapshots = nil
+	case "SAVEPOINT":
+		name, err := r.ident()
+		if err != nil {
+			return err
+		}
+		db.snapshots = append(db.snapshots, sqliteSnapshot{name: name, tables: r.snapshot()})
+	case "RELEASE":
+		r.accept("SAVEPOINT")
+		name, err := r.ident()
+		if err != nil {
+			return err
+		}
+		i := db.savepoint(name)
+		if i < 0 {
+			return fmt.Errorf("no such savepoint: %v", name)
+		}
+		db.snapshots = db.snapshots[:i]
+	case "ROLLBACK":
+		r.accept("TRANSACTION")
+		if r.accept("TO") {
+			r.accept("SAVEPOINT")
+			name, err := r.ident()
+			if err != nil {
+				return err
+			}
+			i := db.savepoint(name)
+			if i < 0 {
+				return fmt.Errorf("no such savepoint: %v", name)
+			}
+			db.tables = db.snapshots[i].tables
+			db.snapshots = db.snapshots[:i+1]
+			db.snapshots[i].tables = r.snapshot()
+			return nil
+		}
+		if len(db.snapshots) == 0 {
+			return errors.New("cannot rollback - no transaction is active")
+		}
+		db.tables = db.snapshots[0].tables
+		db.snapshots = nil
+	}
+	return nil
+}
+
+func (db *SQLiteDB) savepoint(name string) int {
+	for i := len(db.snapshots) - 1; i >= 0; i-- {
+		if strings.EqualFold(db.snapshots[i].name, name) {
+			return i
+		}
+	}
+	return -1
+}
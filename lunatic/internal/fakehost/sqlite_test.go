@@ -0,0 +1,121 @@
+// -*- compile-command: "go test ./..."; -*-
+
+package fakehost
+
+import (
+	"reflect"
+	"testing"
+)
+
+func query(t *testing.T, c *SQLiteConn, sql string, params map[any]Value) [][]Value {
+	t.Helper()
+	stmts, err := ParseSQL(sql)
+	if err != nil {
+		t.Fatalf("ParseSQL(%q): %v", sql, err)
+	}
+	_, rows, err := c.Run(stmts[0], params)
+	if err != nil {
+		t.Fatalf("Run(%q): %v", sql, err)
+	}
+	return rows
+}
+
+func newTestDB(t *testing.T) *SQLiteConn {
+	t.Helper()
+	c := OpenSQLite(":memory:")
+	if err := c.Execute(`
+		CREATE TABLE t (id INTEGER PRIMARY KEY, name TEXT, score REAL);
+		INSERT INTO t (name, score) VALUES ('a', 1.5), ('b', NULL), ('c', -2);
+	`); err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	return c
+}
+
+func TestSelect(t *testing.T) {
+	c := newTestDB(t)
+
+	tests := []struct {
+		sql    string
+		params map[any]Value
+		want   [][]Value
+	}{
+		{"SELECT * FROM t WHERE id = 1", nil, [][]Value{{int64(1), "a", 1.5}}},
+		{"SELECT name FROM t WHERE score IS NULL", nil, [][]Value{{"b"}}},
+		{"SELECT name FROM t WHERE score > ? ORDER BY name DESC", map[any]Value{1: int64(-5)}, [][]Value{{"c"}, {"a"}}},
+		{"SELECT id FROM t WHERE name = :name", map[any]Value{":name": "c"}, [][]Value{{int64(3)}}},
+		{"SELECT id, name FROM t ORDER BY id LIMIT 2", nil, [][]Value{{int64(1), "a"}, {int64(2), "b"}}},
+		{"SELECT COUNT(*), MAX(score) FROM t", nil, [][]Value{{int64(3), 1.5}}},
+		{"SELECT 1, 'x', ?", map[any]Value{1: []byte("y")}, [][]Value{{int64(1), "x", []byte("y")}}},
+		{"SELECT last_insert_rowid()", nil, [][]Value{{int64(3)}}},
+		{"SELECT name FROM sqlite_master WHERE type = 'table'", nil, [][]Value{{"t"}}},
+		{`SELECT "name" FROM "t" WHERE id = 1`, nil, [][]Value{{"a"}}},
+	}
+	for _, tt := range tests {
+		if got := query(t, c, tt.sql, tt.params); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%v = %v, want %v", tt.sql, got, tt.want)
+		}
+	}
+}
+
+func TestErrors(t *testing.T) {
+	c := newTestDB(t)
+	for _, sql := range []string{
+		"SELECT * FROM missing",
+		"SELECT missing FROM t",
+		"INSERT INTO t (id) VALUES (1)",
+		"CREATE TABLE t (x)",
+		"SELEC 1",
+		"COMMIT",
+	} {
+		if err := c.Execute(sql); err == nil {
+			t.Errorf("Execute(%q): want error", sql)
+		} else if c.LastError != err.Error() {
+			t.Errorf("LastError = %q, want %q", c.LastError, err)
+		}
+	}
+}
+
+func TestTransactions(t *testing.T) {
+	c := newTestDB(t)
+	count := func() int64 {
+		return query(t, c, "SELECT COUNT(*) FROM t", nil)[0][0].(int64)
+	}
+
+	if err := c.Execute("BEGIN; DELETE FROM t; ROLLBACK"); err != nil {
+		t.Fatal(err)
+	}
+	if n := count(); n != 3 {
+		t.Errorf("count after ROLLBACK = %v, want 3", n)
+	}
+
+	if err := c.Execute(`
+		BEGIN;
+		DELETE FROM t WHERE id = 1;
+		SAVEPOINT s1;
+		DELETE FROM t WHERE id = 2;
+		ROLLBACK TO s1;
+		RELEASE s1;
+		COMMIT;
+	`); err != nil {
+		t.Fatal(err)
+	}
+	if n := count(); n != 2 {
+		t.Errorf("count after COMMIT = %v, want 2", n)
+	}
+	if c.Changes != 1 {
+		t.Errorf("Changes = %v, want 1", c.Changes)
+	}
+}
+
+func TestSharedDatabase(t *testing.T) {
+	defer ResetSQLite()
+	a := OpenSQLite("shared.db")
+	if err := a.Execute("CREATE TABLE kv (k, v); INSERT INTO kv VALUES ('x', 1)"); err != nil {
+		t.Fatal(err)
+	}
+	b := OpenSQLite("shared.db")
+	if got := query(t, b, "SELECT v FROM kv WHERE k = 'x'", nil); !reflect.DeepEqual(got, [][]Value{{int64(1)}}) {
+		t.Errorf("SELECT from second connection = %v", got)
+	}
+}
@@ -0,0 +1,224 @@
+// -*- compile-command: "GOOS=wasip1 GOARCH=wasm go test ./..."; -*-
+
+package message
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+var (
+	UnknownCodec = errors.New("unknown codec")
+)
+
+// Codec serializes Go values into the raw data buffer of a message
+// and deserializes them back on the receiving side.
+//
+// Every encoded message buffer starts with the one-byte ID of the codec
+// that produced it, so that the receiver can decode messages regardless
+// of which codec the sender chose. IDs 0-31 are reserved for the codecs
+// bundled with this package and IDs must not have ResourceCodecFlag set.
+type Codec interface {
+	ID() byte
+	Encode(v any) ([]byte, error)
+	Decode(data []byte, v any) error
+}
+
+// IDs of the bundled codecs.
+const (
+	GobCodecID     byte = 1
+	JSONCodecID    byte = 2
+	MsgpackCodecID byte = 3
+	ProtoCodecID   byte = 4
+)
+
+// DefaultCodec is the codec used by a Mailbox when none is specified.
+var DefaultCodec Codec = GobCodec{}
+
+var (
+	codecsMu sync.RWMutex
+	codecs   = map[byte]Codec{
+		GobCodecID:     GobCodec{},
+		JSONCodecID:    JSONCodec{},
+		MsgpackCodecID: MsgpackCodec{},
+		ProtoCodecID:   ProtoCodec{},
+	}
+)
+
+// RegisterCodec makes `c` available to receivers by its ID.
+// It replaces any codec previously registered with the same ID.
+//
+// Custom codecs must be registered in every process that decodes
+// their messages, typically from an `init` function.
+// RegisterCodec panics if the codec ID has ResourceCodecFlag set.
+func RegisterCodec(c Codec) {
+	if c.ID()&ResourceCodecFlag != 0 {
+		panic(fmt.Sprintf("message.RegisterCodec: codec ID %v has ResourceCodecFlag set", c.ID()))
+	}
+
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	codecs[c.ID()] = c
+}
+
+// CodecByID returns the codec registered with `id`.
+//
+// Returns:
+// * nil on success with the codec.
+// * UnknownCodec if no codec is registered with `id`.
+//
+// If `id` has ResourceCodecFlag set, a ResourceCodec wrapping the
+// registered codec is returned.
+func CodecByID(id byte) (Codec, error) {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	c, ok := codecs[id&^ResourceCodecFlag]
+	if !ok {
+		return nil, fmt.Errorf("%w: id %v", UnknownCodec, id)
+	}
+	if id&ResourceCodecFlag != 0 {
+		return ResourceCodec{Codec: c}, nil
+	}
+	return c, nil
+}
+
+// EncodeData serializes `v` with codec `c` and writes it, prefixed
+// with the codec ID, into the message in the scratch area.
+//
+// A new message must first be created with `CreateData`.
+// If `c` is nil, DefaultCodec is used.
+func EncodeData(v any, c Codec) error {
+	if c == nil {
+		c = DefaultCodec
+	}
+
+	buf, err := c.Encode(v)
+	if err != nil {
+		return fmt.Errorf("message.EncodeData: %w", err)
+	}
+	if _, err := WriteData([]byte{c.ID()}); err != nil {
+		return err
+	}
+	_, err = WriteData(buf)
+	return err
+}
+
+// DecodeData reads the whole buffer of the message in the scratch area
+// and deserializes it into `v`, which must be a pointer, using the codec
+// that the sender used.
+//
+// Returns:
+// * nil on success.
+// * UnknownCodec if the sender's codec is not registered in this process.
+// * error if the message could not be read or deserialized.
+func DecodeData(v any) error {
+	buf, err := readAll()
+	if err != nil {
+		return err
+	}
+	if len(buf) == 0 {
+		return errors.New("message.DecodeData: empty message")
+	}
+
+	c, err := CodecByID(buf[0])
+	if err != nil {
+		return fmt.Errorf("message.DecodeData: %w", err)
+	}
+	if err := c.Decode(buf[1:], v); err != nil {
+		return fmt.Errorf("message.DecodeData: %w", err)
+	}
+	return nil
+}
+
+// readAll reads the whole buffer of the message in the scratch area.
+func readAll() ([]byte, error) {
+	n, err := DataSize()
+	if err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, n)
+	if _, err := ReadData(buf); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// GobCodec is a Codec using encoding/gob.
+type GobCodec struct{}
+
+// ID returns GobCodecID.
+func (GobCodec) ID() byte { return GobCodecID }
+
+// Encode encodes `v` using encoding/gob.
+func (GobCodec) Encode(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Decode decodes `data` into `v` using encoding/gob. `v` must be a pointer.
+func (GobCodec) Decode(data []byte, v any) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+// JSONCodec is a Codec using encoding/json.
+// It is the easiest format to share with processes not written in Go.
+type JSONCodec struct{}
+
+// ID returns JSONCodecID.
+func (JSONCodec) ID() byte { return JSONCodecID }
+
+// Encode encodes `v` using encoding/json.
+func (JSONCodec) Encode(v any) ([]byte, error) { return json.Marshal(v) }
+
+// Decode decodes `data` into `v` using encoding/json. `v` must be a pointer.
+func (JSONCodec) Decode(data []byte, v any) error { return json.Unmarshal(data, v) }
+
+// ProtoMessage is implemented by types that serialize themselves to the
+// protobuf wire format, such as those generated by gogo/protobuf or vtprotobuf.
+type ProtoMessage interface {
+	Marshal() ([]byte, error)
+	Unmarshal(data []byte) error
+}
+
+// ProtoCodec is a Codec for values implementing ProtoMessage.
+type ProtoCodec struct{}
+
+// ID returns ProtoCodecID.
+func (ProtoCodec) ID() byte { return ProtoCodecID }
+
+// Encode encodes `v`, which must implement ProtoMessage.
+func (ProtoCodec) Encode(v any) ([]byte, error) {
+	m, ok := v.(interface{ Marshal() ([]byte, error) })
+	if !ok {
+		return nil, fmt.Errorf("message.ProtoCodec: %T does not implement ProtoMessage", v)
+	}
+	return m.Marshal()
+}
+
+// Decode decodes `data` into `v`, which must implement ProtoMessage
+// or be a pointer to a pointer implementing ProtoMessage, as is the
+// case for a `Mailbox[*T]`.
+func (ProtoCodec) Decode(data []byte, v any) error {
+	m, ok := v.(interface{ Unmarshal([]byte) error })
+	if !ok {
+		if rv := reflect.ValueOf(v); rv.Kind() == reflect.Pointer && rv.Elem().Kind() == reflect.Pointer {
+			elem := reflect.New(rv.Elem().Type().Elem())
+			if m, ok = elem.Interface().(interface{ Unmarshal([]byte) error }); ok {
+				rv.Elem().Set(elem)
+			}
+		}
+	}
+	if !ok {
+		return fmt.Errorf("message.ProtoCodec: %T does not implement ProtoMessage", v)
+	}
+	return m.Unmarshal(data)
+}
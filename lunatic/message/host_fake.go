@@ -0,0 +1,79 @@
+// -*- compile-command: "go test ./..."; -*-
+
+//go:build !wasm
+
+package message
+
+import (
+	"encoding/binary"
+
+	"github.com/gmlewis/go-lunatic/lunatic/internal/fakehost"
+)
+
+func create_data(tag int64, bufferCapacity uint64) {
+	fakehost.Current().CreateData(tag, bufferCapacity)
+}
+
+func write_data(dataPtr ptr, dataLen size) uint32 {
+	return uint32(fakehost.Current().WriteData(fakehost.Bytes(dataPtr, dataLen)))
+}
+
+func read_data(dataPtr ptr, dataLen size) uint32 {
+	return uint32(fakehost.Current().ReadData(fakehost.Bytes(dataPtr, dataLen)))
+}
+
+func seek_data(index uint64) {
+	fakehost.Current().SeekData(index)
+}
+
+func get_tag() int64 {
+	return fakehost.Current().Tag()
+}
+
+func data_size() uint64 {
+	return uint64(len(fakehost.Current().Scratch().Data))
+}
+
+func push_tcp_stream(streamID uint64) uint64 {
+	return fakehost.Current().PushResource(streamID)
+}
+
+func take_tcp_stream(index uint64) uint64 {
+	return fakehost.Current().TakeMessageResource(index)
+}
+
+func push_tls_stream(streamID uint64) uint64 {
+	return fakehost.Current().PushResource(streamID)
+}
+
+func take_tls_stream(index uint64) uint64 {
+	return fakehost.Current().TakeMessageResource(index)
+}
+
+func push_udp_socket(socketID uint64) uint64 {
+	return fakehost.Current().PushResource(socketID)
+}
+
+func take_udp_socket(index uint64) uint64 {
+	return fakehost.Current().TakeMessageResource(index)
+}
+
+func send(processID uint64) uint32 {
+	fakehost.Current().Send(processID)
+	return 0
+}
+
+func send_receive_skip_search(processID uint64, waitOnTag int64, timeoutDuration uint64) uint32 {
+	p := fakehost.Current()
+	p.Send(processID)
+	return p.Receive([]int64{waitOnTag}, fakehost.Timeout(timeoutDuration))
+}
+
+func receive(tagPtr ptr, tagLen size, timeoutDuration uint64) uint32 {
+	buf := fakehost.Bytes(tagPtr, tagLen*8)
+	tags := make([]int64, tagLen)
+	for i := range tags {
+		tags[i] = int64(binary.LittleEndian.Uint64(buf[i*8:]))
+	}
+	return fakehost.Current().Receive(tags, fakehost.Timeout(timeoutDuration))
+}
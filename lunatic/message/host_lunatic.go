@@ -0,0 +1,65 @@
+// -*- compile-command: "GOOS=wasip1 GOARCH=wasm go test ./..."; -*-
+
+//go:build wasm
+
+package message
+
+//go:wasmimport lunatic::message create_data
+//go:noescape
+func create_data(tag int64, bufferCapacity uint64)
+
+//go:wasmimport lunatic::message write_data
+//go:noescape
+func write_data(dataPtr ptr, dataLen size) uint32
+
+//go:wasmimport lunatic::message read_data
+//go:noescape
+func read_data(dataPtr ptr, dataLen size) uint32
+
+//go:wasmimport lunatic::message seek_data
+//go:noescape
+func seek_data(index uint64)
+
+//go:wasmimport lunatic::message get_tag
+//go:noescape
+func get_tag() int64
+
+//go:wasmimport lunatic::message data_size
+//go:noescape
+func data_size() uint64
+
+//go:wasmimport lunatic::message push_tcp_stream
+//go:noescape
+func push_tcp_stream(streamID uint64) uint64
+
+//go:wasmimport lunatic::message take_tcp_stream
+//go:noescape
+func take_tcp_stream(index uint64) uint64
+
+//go:wasmimport lunatic::message push_tls_stream
+//go:noescape
+func push_tls_stream(streamID uint64) uint64
+
+//go:wasmimport lunatic::message take_tls_stream
+//go:noescape
+func take_tls_stream(index uint64) uint64
+
+//go:wasmimport lunatic::message push_udp_socket
+//go:noescape
+func push_udp_socket(socketID uint64) uint64
+
+//go:wasmimport lunatic::message take_udp_socket
+//go:noescape
+func take_udp_socket(index uint64) uint64
+
+//go:wasmimport lunatic::message send
+//go:noescape
+func send(processID uint64) uint32
+
+//go:wasmimport lunatic::message send_receive_skip_search
+//go:noescape
+func send_receive_skip_search(processID uint64, waitOnTag int64, timeoutDuration uint64) uint32
+
+//go:wasmimport lunatic::message receive
+//go:noescape
+func receive(tagPtr ptr, tagLen size, timeoutDuration uint64) uint32
@@ -0,0 +1,99 @@
+// -*- compile-command: "GOOS=wasip1 GOARCH=wasm go test ./..."; -*-
+
+package message
+
+import (
+	"fmt"
+	"time"
+)
+
+// Mailbox is a typed view of the current process' mailbox.
+// It is modeled after the `Mailbox<T>` type of lunatic-rs.
+//
+// A Mailbox handles the framing of the data messages it sends and receives:
+// values are serialized with the Mailbox's Codec into the message buffer
+// and all messages are sent and received with the Mailbox's tag.
+// Received messages are decoded with whichever codec the sender used,
+// so the sender and the receiver don't need to agree on a codec.
+type Mailbox[T any] struct {
+	tag   int64
+	codec Codec
+}
+
+// NewMailbox returns a Mailbox for values of type `T`.
+//
+// If `tag` is not 0, only messages with this tag are received and all sent
+// messages are tagged with it. A tag of 0 matches all messages.
+//
+// `codec` is used to serialize the values sent through the Mailbox.
+// If `codec` is nil, DefaultCodec is used.
+func NewMailbox[T any](tag int64, codec Codec) *Mailbox[T] {
+	if codec == nil {
+		codec = DefaultCodec
+	}
+	return &Mailbox[T]{tag: tag, codec: codec}
+}
+
+// Tag returns the tag of the Mailbox.
+func (m *Mailbox[T]) Tag() int64 { return m.tag }
+
+// Codec returns the codec of the Mailbox.
+func (m *Mailbox[T]) Codec() Codec { return m.codec }
+
+// Send serializes `v` with the Mailbox's codec and sends it to the
+// process with `processID`.
+//
+// There are no guarantees that the message will be received.
+func (m *Mailbox[T]) Send(processID uint64, v T) error {
+	return m.SendWith(processID, v, m.codec)
+}
+
+// SendWith is like Send but serializes `v` with `codec` instead of the
+// Mailbox's codec.
+func (m *Mailbox[T]) SendWith(processID uint64, v T, codec Codec) error {
+	CreateData(m.tag, 0)
+	if err := EncodeData(v, codec); err != nil {
+		return err
+	}
+	return Send(processID)
+}
+
+// Receive blocks until the next message for this Mailbox arrives and
+// returns its deserialized value.
+//
+// Returns:
+// * nil on success with the received value.
+// * LinkDied if a link died and the current process does not die with it.
+// * ProcessDied if a monitored process died.
+// * error if the message could not be deserialized.
+func (m *Mailbox[T]) Receive() (T, error) {
+	return m.receive(nil)
+}
+
+// ReceiveTimeout is like Receive but returns CallTimedOut if no message
+// arrives within `d`.
+func (m *Mailbox[T]) ReceiveTimeout(d time.Duration) (T, error) {
+	timeoutMillis := uint64(d.Milliseconds())
+	return m.receive(&timeoutMillis)
+}
+
+func (m *Mailbox[T]) receive(timeoutMillis *uint64) (v T, err error) {
+	var tags []int64
+	if m.tag != 0 {
+		tags = []int64{m.tag}
+	}
+
+	msg, err := Receive(tags, timeoutMillis)
+	if err != nil {
+		return v, err
+	}
+	switch sig := msg.(type) {
+	case *LinkDiedSignal:
+		return v, fmt.Errorf("%w: link tag %v", LinkDied, sig.Tag)
+	case *ProcessDiedSignal:
+		return v, fmt.Errorf("%w: process %v", ProcessDied, sig.ProcessID)
+	}
+
+	err = DecodeData(&v)
+	return v, err
+}
@@ -70,13 +70,20 @@
 // library and turning resources into indexes is a way of serializing. The same is true for
 // deserializing them on the receiving side, when an index needs to be turned into an actual
 // resource ID.
+//
+// ResourceCodec implements this scheme for Go values containing TCPStream,
+// TLSStream or UDPSocket resources.
 package message
 
 import (
 	"errors"
 	"fmt"
 	"math"
+	"slices"
+	"sync"
 	"unsafe"
+
+	"github.com/gmlewis/go-lunatic/lunatic/process"
 )
 
 var (
@@ -94,14 +101,9 @@ func mkptr[T any](v *T) ptr { return unsafe.Pointer(v) }
 //
 // This message is intended to be modified by other functions in this namespace.
 // Once `message.Send` is called, it will be sent to another process.
-//
-//go:wasmimport lunatic::message create_data
-//go:noescape
-func CreateData(tag int64, bufferCapacity uint64)
-
-//go:wasmimport lunatic::message write_data
-//go:noescape
-func write_data(dataPtr ptr, dataLen size) uint32
+func CreateData(tag int64, bufferCapacity uint64) {
+	create_data(tag, bufferCapacity)
+}
 
 // WriteData writes some data into the message buffer and returns how much
 // data is written in bytes.
@@ -116,14 +118,14 @@ func WriteData(data []byte) (n uint32, err error) {
 		}
 	}()
 
+	if len(data) == 0 {
+		return 0, nil
+	}
+
 	n = write_data(mkptr(&data[0]), size(len(data)))
 	return n, nil
 }
 
-//go:wasmimport lunatic::message read_data
-//go:noescape
-func read_data(dataPtr ptr, dataLen size) uint32
-
 // ReadData reads some data from the message buffer and returns
 // how many bytes were read.
 //
@@ -137,14 +139,14 @@ func ReadData(buf []byte) (n uint32, err error) {
 		}
 	}()
 
+	if len(buf) == 0 {
+		return 0, nil
+	}
+
 	n = read_data(mkptr(&buf[0]), size(len(buf)))
 	return n, nil
 }
 
-//go:wasmimport lunatic::message seek_data
-//go:noescape
-func seek_data(index uint64)
-
 // SeekData moves reading head of the internal message buffer.
 // This is useful if you wish to read a bit of a message, decide that
 // something else will handle it, `SeekData(0)` to reset the read
@@ -163,10 +165,6 @@ func SeekData(index uint64) (err error) {
 	return nil
 }
 
-//go:wasmimport lunatic::message get_tag
-//go:noescape
-func get_tag() int64
-
 // GetTag returns the mssage tag or 0 if no tag was set.
 //
 // Returns:
@@ -183,10 +181,6 @@ func GetTag() (tag int64, err error) {
 	return tag, nil
 }
 
-//go:wasmimport lunatic::message data_size
-//go:noescape
-func data_size() uint64
-
 // DataSize returns the size in bytes of the message buffer.
 //
 // Returns:
@@ -203,10 +197,6 @@ func DataSize() (n uint64, err error) {
 	return n, nil
 }
 
-//go:wasmimport lunatic::message push_tcp_stream
-//go:noescape
-func push_tcp_stream(streamID uint64) uint64
-
 // PushTCPStream adds a TCP stream resource to the message that is currently
 // in the scratch area and returns the new location of it.
 // This will remove the TCP stream from the current process' resources.
@@ -225,10 +215,6 @@ func PushTCPStream(streamID uint64) (index uint64, err error) {
 	return index, nil
 }
 
-//go:wasmimport lunatic::message take_tcp_stream
-//go:noescape
-func take_tcp_stream(index uint64) uint64
-
 // TakeTCPStream takes the TCP stream from the message that is currently in the scratch
 // area by index, puts it into the process' resources and returns the resource ID.
 //
@@ -246,9 +232,40 @@ func TakeTCPStream(index uint64) (resourceID uint64, err error) {
 	return resourceID, nil
 }
 
-//go:wasmimport lunatic::message push_udp_socket
-//go:noescape
-func push_udp_socket(socketID uint64) uint64
+// PushTLSStream adds a TLS stream resource to the message that is currently
+// in the scratch area and returns the new location of it.
+// This will remove the TLS stream from the current process' resources.
+//
+// Returns:
+// * nil if success with stream index.
+// * error if there is no data message within the scratch area.
+func PushTLSStream(streamID uint64) (index uint64, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("message.push_tls_stream error: %v", r)
+		}
+	}()
+
+	index = push_tls_stream(streamID)
+	return index, nil
+}
+
+// TakeTLSStream takes the TLS stream from the message that is currently in the scratch
+// area by index, puts it into the process' resources and returns the resource ID.
+//
+// Returns:
+// * nil if success with resource ID.
+// * error if there is no data message within the scratch area.
+func TakeTLSStream(index uint64) (resourceID uint64, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("message.take_tls_stream error: %v", r)
+		}
+	}()
+
+	resourceID = take_tls_stream(index)
+	return resourceID, nil
+}
 
 // PushUDPSocket adds a UDP socket resource to the message that is currently in the scratch
 // area and returns the new location of it.
@@ -268,10 +285,6 @@ func PushUDPSocket(socketID uint64) (index uint64, err error) {
 	return index, nil
 }
 
-//go:wasmimport lunatic::message take_udp_socket
-//go:noescape
-func take_udp_socket(index uint64) uint64
-
 // TakeUDPSocket takes the UDP socket from the message that is currently in the scratch
 // area by index, puts it into the process' resources and returns the resourceID.
 //
@@ -289,10 +302,6 @@ func TakeUDPSocket(index uint64) (resourceID uint64, err error) {
 	return resourceID, nil
 }
 
-//go:wasmimport lunatic::message send
-//go:noescape
-func send(processID uint64) uint32
-
 // Send sends the message to a process.
 //
 // There are no guarantees that the message will be received.
@@ -314,10 +323,6 @@ func Send(processID uint64) (err error) {
 	return nil
 }
 
-//go:wasmimport lunatic::message send_receive_skip_search
-//go:noescape
-func send_receive_skip_search(processID uint64, waitOnTag int64, timeoutDuration uint64) uint32
-
 // SendReceiveSkipSearch sends the message to a process and waits for a reply, but doesn't
 // look through existing messages in the mailbox queue while waiting.
 // This is an optimization that only makes sense with tagged messages.
@@ -362,9 +367,76 @@ func SendReceiveSkipSearch(processID uint64, waitOnTag int64, timeoutMillis *uin
 	}
 }
 
-//go:wasmimport lunatic::message receive
-//go:noescape
-func receive(tagPtr ptr, tagLen size, timeoutDuration uint64) uint32
+// Message is a message received with Receive. It is either a *DataMessage,
+// a *LinkDiedSignal or a *ProcessDiedSignal.
+type Message interface {
+	isMessage()
+}
+
+// DataMessage is a data message that was received and is now in the
+// scratch area. Functions like `message.ReadData()` or `message.DecodeData()`
+// can be used to extract data out of it.
+type DataMessage struct {
+	Tag int64
+}
+
+func (*DataMessage) isMessage() {}
+
+// LinkDiedSignal is a `LinkDied` signal that was turned into a message
+// because the process called `process.DieWhenLinkDies(false)`.
+// Tag is the link-tag that was used when linking to the process that died.
+type LinkDiedSignal struct {
+	Tag int64
+}
+
+func (*LinkDiedSignal) isMessage() {}
+
+// ProcessDiedSignal notifies about the death of a process monitored
+// with `process.Monitor`.
+type ProcessDiedSignal struct {
+	ProcessID uint64
+}
+
+func (*ProcessDiedSignal) isMessage() {}
+
+// pendingSignals are signals to return from Receive before the mailbox,
+// e.g. the ProcessDied signal of a process that was both linked and monitored,
+// which the host reports with a single LinkDied signal. They are keyed by
+// process ID since all processes share the package state under the fake host.
+var (
+	pendingMu      sync.Mutex
+	pendingSignals = map[uint64][]Message{}
+)
+
+// pushSignal queues `msg` to be returned by Receive.
+func pushSignal(msg Message) {
+	pendingMu.Lock()
+	defer pendingMu.Unlock()
+	id := process.ProcessID()
+	pendingSignals[id] = append(pendingSignals[id], msg)
+}
+
+// popSignal takes the first queued signal matching `tags` out of the queue.
+// ProcessDied signals only match if `tags` is empty.
+func popSignal(tags []int64) (Message, bool) {
+	pendingMu.Lock()
+	defer pendingMu.Unlock()
+	id := process.ProcessID()
+	signals := pendingSignals[id]
+	for i, msg := range signals {
+		if sig, ok := msg.(*LinkDiedSignal); len(tags) > 0 && (!ok || !slices.Contains(tags, sig.Tag)) {
+			continue
+		}
+		signals = append(signals[:i:i], signals[i+1:]...)
+		if len(signals) == 0 {
+			delete(pendingSignals, id)
+		} else {
+			pendingSignals[id] = signals
+		}
+		return msg, true
+	}
+	return nil, false
+}
 
 // Receive takes the next message out of the queue or blocks until the next message is
 // received if the queue is empty.
@@ -375,18 +447,53 @@ func receive(tagPtr ptr, tagLen size, timeoutDuration uint64) uint32
 // If `timeoutMillis` is not nil, the function will return on timeout expiration with
 // the error `CallTimedOut`.
 //
-// Once the message is successfully received, functions like `message.ReadData()` can
+// Once a *DataMessage is successfully received, functions like `message.ReadData()` can
 // be used to extract data out of it.
 //
+// Replies to requests of `Request` that timed out are dropped when they
+// arrive.
+//
+// While the process monitors other processes (see `process.Monitor`), the host
+// turns the deaths of all links into signals. A signal of a link made with
+// `process.Link` or `process.Spawn` then makes the process panic in Receive
+// unless it called `process.DieWhenLinkDies(false)`, like the host would
+// have killed it.
+//
 // Returns:
-// * nil if a data message arrived.
-// * LinkDied if the link died.
-// * ProcessDied if the process died.
+// * nil with a *DataMessage if a data message arrived.
+// * nil with a *LinkDiedSignal if a link died.
+// * nil with a *ProcessDiedSignal if a monitored process died.
 // * CallTimedOut if the call timed out.
 //
 // Errors:
 // * If there were buffer problems.
-func Receive(tags []int64, timeoutMillis *uint64) (err error) {
+func Receive(tags []int64, timeoutMillis *uint64) (msg Message, err error) {
+	if msg, ok := popSignal(tags); ok {
+		return msg, nil
+	}
+
+	msg, err = receiveMessage(tags, timeoutMillis)
+	for err == nil && len(tags) == 0 && isLateData(msg) {
+		msg, err = receiveMessage(tags, timeoutMillis)
+	}
+	sig, ok := msg.(*LinkDiedSignal)
+	if err != nil || !ok {
+		return msg, err
+	}
+
+	processID, linked, monitored := process.LinkDied(sig.Tag)
+	switch {
+	case linked && !process.TrapsLinks():
+		panic(fmt.Sprintf("message.Receive: linked process %v with link-tag %v died", processID, sig.Tag))
+	case linked && monitored:
+		pushSignal(&ProcessDiedSignal{ProcessID: processID})
+	case monitored:
+		return &ProcessDiedSignal{ProcessID: processID}, nil
+	}
+	return sig, nil
+}
+
+func receiveMessage(tags []int64, timeoutMillis *uint64) (msg Message, err error) {
 	defer func() {
 		if r := recover(); r != nil {
 			err = fmt.Errorf("message.receive error: %v", r)
@@ -398,17 +505,22 @@ func Receive(tags []int64, timeoutMillis *uint64) (err error) {
 		td = *timeoutMillis
 	}
 
-	errno := receive(mkptr(&tags[0]), size(uintptr(len(tags))*unsafe.Sizeof(int64(0))), td)
+	var tagsPtr ptr
+	if len(tags) > 0 {
+		tagsPtr = mkptr(&tags[0])
+	}
+
+	errno := receive(tagsPtr, size(len(tags)), td)
 	switch errno {
 	case 0:
-		return nil
+		return &DataMessage{Tag: get_tag()}, nil
 	case 1:
-		return LinkDied
+		return &LinkDiedSignal{Tag: get_tag()}, nil
 	case 2:
-		return ProcessDied
+		return nil, ProcessDied
 	case 9027:
-		return CallTimedOut
+		return nil, CallTimedOut
 	default:
-		return fmt.Errorf("message.receive unknown error %v", errno)
+		return nil, fmt.Errorf("message.receive unknown error %v", errno)
 	}
 }
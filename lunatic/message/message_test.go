@@ -0,0 +1,400 @@
+// -*- compile-command: "go test ./..."; -*-
+
+package message_test
+
+import (
+	"errors"
+	"io"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gmlewis/go-lunatic/lunatic"
+	"github.com/gmlewis/go-lunatic/lunatic/message"
+	"github.com/gmlewis/go-lunatic/lunatic/networking"
+	"github.com/gmlewis/go-lunatic/lunatic/process"
+)
+
+type point struct {
+	X, Y  int
+	Label string
+	Tags  []string
+}
+
+func TestCodecs(t *testing.T) {
+	want := point{X: 1, Y: -2, Label: "p", Tags: []string{"a", "b"}}
+	for _, c := range []message.Codec{message.GobCodec{}, message.JSONCodec{}, message.MsgpackCodec{}} {
+		message.CreateData(1, 0)
+		if err := message.EncodeData(want, c); err != nil {
+			t.Fatalf("%T: EncodeData: %v", c, err)
+		}
+		if err := message.Send(process.ProcessID()); err != nil {
+			t.Fatalf("%T: Send: %v", c, err)
+		}
+		if _, err := message.Receive([]int64{1}, nil); err != nil {
+			t.Fatalf("%T: Receive: %v", c, err)
+		}
+
+		var got point
+		if err := message.DecodeData(&got); err != nil {
+			t.Fatalf("%T: DecodeData: %v", c, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%T: got %+v, want %+v", c, got, want)
+		}
+	}
+}
+
+type Base struct {
+	ID   int
+	Name string
+}
+
+type event struct {
+	Base
+	Name  string // hides Base.Name
+	At    time.Time
+	Until *time.Time
+	Addr  net.IP
+}
+
+func TestMsgpack(t *testing.T) {
+	var c message.MsgpackCodec
+	until := time.Unix(1<<35, 5) // needs the 96-bit timestamp format.
+	want := event{
+		Base:  Base{ID: 7, Name: "hidden"},
+		Name:  "launch",
+		At:    time.Date(2024, 1, 2, 3, 4, 5, 6, time.UTC),
+		Until: &until,
+		Addr:  net.ParseIP("10.0.0.1"),
+	}
+	data, err := c.Encode(want)
+	if err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	var got event
+	if err := c.Decode(data, &got); err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if got.ID != 7 || got.Base.Name != "" || got.Name != "launch" || !got.At.Equal(want.At) ||
+		got.Until == nil || !got.Until.Equal(until) || !got.Addr.Equal(want.Addr) {
+		t.Errorf("Decode = %+v, want %+v", got, want)
+	}
+
+	var m map[string]any
+	if err := c.Decode(data, &m); err != nil {
+		t.Fatalf("Decode into a map: %v", err)
+	}
+	if _, ok := m["ID"]; !ok {
+		t.Errorf("embedded fields are not promoted: %v", m)
+	}
+
+	// Data in unexported fields must not be lost silently.
+	if _, err := c.Encode(struct{ v []int }{v: []int{1}}); err == nil {
+		t.Error("Encode of a struct without exported fields: want error")
+	}
+}
+
+func TestMsgpackExt(t *testing.T) {
+	var c message.MsgpackCodec
+	sec := []byte{0, 0, 0, 0, 0x65, 0x93, 0x7d, 0x85} // 1704164741
+	want := time.Unix(1704164741, 0)
+	for _, tt := range []struct {
+		name string
+		data []byte
+		err  string
+	}{
+		{"fixext4", append([]byte{0xd6, 0xff}, sec[4:]...), ""},
+		{"fixext8", append([]byte{0xd7, 0xff}, sec...), ""},
+		{"ext8", append([]byte{0xc7, 12, 0xff, 0, 0, 0, 0}, sec...), ""},
+		{"ext16", append([]byte{0xc8, 0, 12, 0xff, 0, 0, 0, 0}, sec...), ""},
+		{"ext32", append([]byte{0xc9, 0, 0, 0, 12, 0xff, 0, 0, 0, 0}, sec...), ""},
+		{"fixext1", []byte{0xd4, 1, 0}, "unsupported extension type 1"},
+		{"fixext2", []byte{0xd5, 2, 0, 0}, "unsupported extension type 2"},
+		{"fixext16", append([]byte{0xd8, 3}, make([]byte, 16)...), "unsupported extension type 3"},
+		{"fixext16 timestamp", append([]byte{0xd8, 0xff}, make([]byte, 16)...), "invalid timestamp"},
+		{"short ext32", []byte{0xc9, 0, 0, 1, 0, 5, 0}, "msgpack"},
+	} {
+		var got any
+		err := c.Decode(tt.data, &got)
+		switch {
+		case tt.err == "" && err != nil:
+			t.Errorf("%v: Decode: %v", tt.name, err)
+		case tt.err == "" && !got.(time.Time).Equal(want):
+			t.Errorf("%v: Decode = %v, want %v", tt.name, got, want)
+		case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+			t.Errorf("%v: Decode = %v, %v, want error %q", tt.name, got, err, tt.err)
+		}
+	}
+}
+
+func TestDecodeUnknownCodec(t *testing.T) {
+	message.CreateData(1, 0)
+	message.WriteData([]byte{0x7f, 1, 2, 3})
+	message.Send(process.ProcessID())
+	if _, err := message.Receive([]int64{1}, nil); err != nil {
+		t.Fatalf("Receive: %v", err)
+	}
+
+	var v any
+	if err := message.DecodeData(&v); !errors.Is(err, message.UnknownCodec) {
+		t.Errorf("DecodeData = %v, want UnknownCodec", err)
+	}
+}
+
+func TestMailbox(t *testing.T) {
+	ints := message.NewMailbox[int](2, nil)
+	strs := message.NewMailbox[string](3, message.JSONCodec{})
+	self := process.ProcessID()
+
+	if err := ints.Send(self, 42); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if err := strs.Send(self, "hello"); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	// Messages are received by tag, not in order.
+	if s, err := strs.Receive(); err != nil || s != "hello" {
+		t.Errorf("strs.Receive = %q, %v, want hello", s, err)
+	}
+	if n, err := ints.Receive(); err != nil || n != 42 {
+		t.Errorf("ints.Receive = %v, %v, want 42", n, err)
+	}
+	if _, err := ints.ReceiveTimeout(10 * time.Millisecond); !errors.Is(err, message.CallTimedOut) {
+		t.Errorf("ReceiveTimeout = %v, want CallTimedOut", err)
+	}
+}
+
+const (
+	addTag    int64 = 10
+	sleepTag  int64 = 11
+	failTag   int64 = 12
+	slowTag   int64 = 13
+	streamTag int64 = 14
+)
+
+var adder = lunatic.RegisterFunc(func() {
+	for {
+		call, err := message.ReceiveRequest[[]int](addTag)
+		if err != nil {
+			panic(err)
+		}
+		var sum int
+		for _, n := range call.Body {
+			sum += n
+		}
+		call.Reply(sum)
+	}
+})
+
+var sleeper = lunatic.RegisterFunc(func() {
+	message.ReceiveRequest[struct{}](sleepTag)
+	process.SleepMS(10_000)
+})
+
+var failer = lunatic.RegisterFunc(func() {
+	message.ReceiveRequest[struct{}](failTag)
+	panic("failer")
+})
+
+// slowServer traps link deaths and replies to each request after 50ms.
+var slowServer = lunatic.RegisterFunc(func() {
+	process.DieWhenLinkDies(false)
+	for {
+		call, err := message.ReceiveRequest[int](slowTag)
+		if err != nil {
+			panic(err)
+		}
+		process.SleepMS(50)
+		call.Reply(call.Body)
+	}
+})
+
+// slowServerID is the process called by slowCaller.
+var slowServerID uint64
+
+var slowCaller = lunatic.RegisterFunc(func() {
+	message.Request[int](slowServerID, slowTag, 1, 0)
+})
+
+func TestRequest(t *testing.T) {
+	pid, err := lunatic.SpawnFunc(adder)
+	if err != nil {
+		t.Fatalf("SpawnFunc: %v", err)
+	}
+	defer process.Kill(uint64(pid))
+
+	for i := 1; i <= 3; i++ {
+		sum, err := message.Request[int](uint64(pid), addTag, []int{i, i, i}, time.Second)
+		if err != nil {
+			t.Fatalf("Request: %v", err)
+		}
+		if sum != 3*i {
+			t.Errorf("Request = %v, want %v", sum, 3*i)
+		}
+	}
+}
+
+func TestRequestErrors(t *testing.T) {
+	pid, err := lunatic.SpawnFunc(sleeper)
+	if err != nil {
+		t.Fatalf("SpawnFunc: %v", err)
+	}
+	defer process.Kill(uint64(pid))
+
+	_, err = message.Request[struct{}](uint64(pid), sleepTag, struct{}{}, 10*time.Millisecond)
+	var reqErr *message.RequestError
+	if !errors.As(err, &reqErr) || !errors.Is(err, message.CallTimedOut) {
+		t.Errorf("Request = %v, want RequestError wrapping CallTimedOut", err)
+	}
+
+	_, err = message.Request[int](1<<40, addTag, []int{1}, time.Second)
+	if !errors.Is(err, message.ProcessDied) {
+		t.Errorf("Request to unknown process = %v, want ProcessDied", err)
+	}
+}
+
+func TestRequestProcessDied(t *testing.T) {
+	pid, err := lunatic.SpawnFunc(failer)
+	if err != nil {
+		t.Fatalf("SpawnFunc: %v", err)
+	}
+
+	// Without a timeout, the death of the callee ends the call.
+	_, err = message.Request[struct{}](uint64(pid), failTag, struct{}{}, 0)
+	if !errors.Is(err, message.ProcessDied) {
+		t.Errorf("Request = %v, want ProcessDied", err)
+	}
+	// The link made for the call doesn't kill the caller later on.
+	if _, err := message.Request[int](uint64(pid), addTag, []int{1}, time.Second); !errors.Is(err, message.ProcessDied) {
+		t.Errorf("Request to dead process = %v, want ProcessDied", err)
+	}
+}
+
+func TestRequestMonitored(t *testing.T) {
+	pid, err := lunatic.SpawnFunc(failer)
+	if err != nil {
+		t.Fatalf("SpawnFunc: %v", err)
+	}
+	if err := process.Monitor(uint64(pid)); err != nil {
+		t.Fatalf("Monitor: %v", err)
+	}
+
+	_, err = message.Request[struct{}](uint64(pid), failTag, struct{}{}, 0)
+	if !errors.Is(err, message.ProcessDied) {
+		t.Errorf("Request = %v, want ProcessDied", err)
+	}
+	// The signal of the monitor is still received.
+	timeout := uint64(1000)
+	msg, err := message.Receive(nil, &timeout)
+	if sig, ok := msg.(*message.ProcessDiedSignal); !ok || sig.ProcessID != uint64(pid) {
+		t.Errorf("Receive = %#v, %v, want ProcessDiedSignal", msg, err)
+	}
+}
+
+func TestRequestLateReply(t *testing.T) {
+	pid, err := lunatic.SpawnFunc(slowServer)
+	if err != nil {
+		t.Fatalf("SpawnFunc: %v", err)
+	}
+	defer process.Kill(uint64(pid))
+
+	// A timeout below a millisecond still times out.
+	_, err = message.Request[int](uint64(pid), slowTag, 1, time.Nanosecond)
+	if !errors.Is(err, message.CallTimedOut) {
+		t.Fatalf("Request = %v, want CallTimedOut", err)
+	}
+	// The reply that arrives later is dropped by the next request.
+	process.SleepMS(100)
+	if n, err := message.Request[int](uint64(pid), slowTag, 2, time.Second); err != nil || n != 2 {
+		t.Errorf("Request = %v, %v, want 2", n, err)
+	}
+	timeout := uint64(10)
+	if msg, err := message.Receive(nil, &timeout); !errors.Is(err, message.CallTimedOut) {
+		t.Errorf("Receive = %#v, %v, want CallTimedOut", msg, err)
+	}
+}
+
+// streamReply is the reply of streamServer.
+type streamReply struct {
+	Stream message.TCPStream
+}
+
+// streamAddr is the address that streamServer connects to.
+var streamAddr string
+
+// streamServer connects to streamAddr and replies with the stream after 50ms.
+var streamServer = lunatic.RegisterFunc(func() {
+	call, err := message.ReceiveRequest[struct{}](streamTag)
+	if err != nil {
+		panic(err)
+	}
+	c, err := networking.DialTCP(streamAddr, time.Second)
+	if err != nil {
+		panic(err)
+	}
+	process.SleepMS(50)
+	message.CreateData(call.ReplyTag, 0)
+	if err := message.EncodeData(streamReply{message.TCPStream(c.StreamID())}, message.NewResourceCodec(nil)); err != nil {
+		panic(err)
+	}
+	message.Send(call.ReplyTo)
+})
+
+func TestRequestLateReplyResource(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	defer l.Close()
+	streamAddr = l.Addr().String()
+	pid, err := lunatic.SpawnFunc(streamServer)
+	if err != nil {
+		t.Fatalf("SpawnFunc: %v", err)
+	}
+
+	_, err = message.Request[streamReply](uint64(pid), streamTag, struct{}{}, 10*time.Millisecond)
+	if !errors.Is(err, message.CallTimedOut) {
+		t.Fatalf("Request = %v, want CallTimedOut", err)
+	}
+	c, err := l.Accept()
+	if err != nil {
+		t.Fatalf("Accept: %v", err)
+	}
+	defer c.Close()
+
+	// Dropping the late reply closes the stream in it.
+	process.SleepMS(100)
+	timeout := uint64(10)
+	if msg, err := message.Receive(nil, &timeout); !errors.Is(err, message.CallTimedOut) {
+		t.Errorf("Receive = %#v, %v, want CallTimedOut", msg, err)
+	}
+	c.SetReadDeadline(time.Now().Add(time.Second))
+	if n, err := c.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("Read = %v, %v, want EOF", n, err)
+	}
+}
+
+func TestRequestCallerKilled(t *testing.T) {
+	pid, err := lunatic.SpawnFunc(slowServer)
+	if err != nil {
+		t.Fatalf("SpawnFunc: %v", err)
+	}
+	defer process.Kill(uint64(pid))
+	slowServerID = uint64(pid)
+
+	caller, err := lunatic.SpawnFunc(slowCaller)
+	if err != nil {
+		t.Fatalf("SpawnFunc: %v", err)
+	}
+	process.SleepMS(20)
+	process.Kill(uint64(caller))
+
+	// The server traps the death of the caller linked for the call.
+	if n, err := message.Request[int](uint64(pid), slowTag, 3, time.Second); err != nil || n != 3 {
+		t.Errorf("Request after the caller was killed = %v, %v, want 3", n, err)
+	}
+}
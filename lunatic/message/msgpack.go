@@ -0,0 +1,850 @@
+// -*- compile-command: "GOOS=wasip1 GOARCH=wasm go test ./..."; -*-
+
+package message
+
+import (
+	"encoding"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"time"
+)
+
+var (
+	errShortBuffer = errors.New("msgpack: unexpected end of data")
+)
+
+// timestampExt is the extension type of MessagePack timestamps.
+const timestampExt = -1
+
+var (
+	timeType            = reflect.TypeOf(time.Time{})
+	binaryMarshalerType = reflect.TypeOf((*encoding.BinaryMarshaler)(nil)).Elem()
+	textMarshalerType   = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// MsgpackCodec is a compact binary Codec using the MessagePack format.
+// See: https://github.com/msgpack/msgpack/blob/master/spec.md
+//
+// Structs are encoded as maps keyed by field name. The key can be changed
+// with a `msgpack:"name"` struct tag, a tag of `msgpack:"-"` skips the field
+// and `msgpack:",omitempty"` skips it if it has its zero value.
+// Unexported fields are ignored and the fields of embedded structs without
+// a tag are promoted, like with encoding/json. A struct that has fields
+// but none that can be encoded is an error, since it would lose its data.
+//
+// time.Time values are encoded with the timestamp extension type. Other
+// types implementing encoding.BinaryMarshaler are encoded as binary data
+// and those implementing encoding.TextMarshaler as strings; they are
+// decoded with the corresponding unmarshaler.
+//
+// When decoding into an interface value, integers become int64 (or uint64
+// if they don't fit), floats become float64, strings become string,
+// binary data becomes []byte, arrays become []any and maps become
+// map[string]any (or map[any]any if a key is not a string).
+type MsgpackCodec struct{}
+
+// ID returns MsgpackCodecID.
+func (MsgpackCodec) ID() byte { return MsgpackCodecID }
+
+// Encode encodes `v` using MessagePack.
+func (MsgpackCodec) Encode(v any) ([]byte, error) {
+	e := &msgpackEncoder{}
+	if err := e.encode(reflect.ValueOf(v)); err != nil {
+		return nil, err
+	}
+	return e.buf, nil
+}
+
+// Decode decodes MessagePack `data` into `v`, which must be a non-nil pointer.
+func (MsgpackCodec) Decode(data []byte, v any) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return fmt.Errorf("msgpack: Decode(non-pointer %T)", v)
+	}
+
+	d := &msgpackDecoder{buf: data}
+	if err := d.decode(rv.Elem()); err != nil {
+		return err
+	}
+	if len(d.buf) != 0 {
+		return fmt.Errorf("msgpack: %v trailing bytes", len(d.buf))
+	}
+	return nil
+}
+
+type msgpackEncoder struct {
+	buf []byte
+}
+
+func (e *msgpackEncoder) encode(v reflect.Value) error {
+	if !v.IsValid() {
+		e.buf = append(e.buf, 0xc0)
+		return nil
+	}
+	if ok, err := e.encodeMarshaler(v); ok {
+		return err
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			e.buf = append(e.buf, 0xc3)
+		} else {
+			e.buf = append(e.buf, 0xc2)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		e.encodeInt(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		e.encodeUint(v.Uint())
+	case reflect.Float32:
+		e.buf = append(e.buf, 0xca)
+		e.buf = binary.BigEndian.AppendUint32(e.buf, math.Float32bits(float32(v.Float())))
+	case reflect.Float64:
+		e.buf = append(e.buf, 0xcb)
+		e.buf = binary.BigEndian.AppendUint64(e.buf, math.Float64bits(v.Float()))
+	case reflect.String:
+		e.encodeString(v.String())
+	case reflect.Slice:
+		if v.IsNil() {
+			e.buf = append(e.buf, 0xc0)
+			return nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			e.encodeBytes(v.Bytes())
+			return nil
+		}
+		return e.encodeArray(v)
+	case reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			b := make([]byte, v.Len())
+			reflect.Copy(reflect.ValueOf(b), v)
+			e.encodeBytes(b)
+			return nil
+		}
+		return e.encodeArray(v)
+	case reflect.Map:
+		if v.IsNil() {
+			e.buf = append(e.buf, 0xc0)
+			return nil
+		}
+		e.encodeLen(v.Len(), 0x80, 0xde, 0xdf)
+		iter := v.MapRange()
+		for iter.Next() {
+			if err := e.encode(iter.Key()); err != nil {
+				return err
+			}
+			if err := e.encode(iter.Value()); err != nil {
+				return err
+			}
+		}
+	case reflect.Struct:
+		fields := msgpackFields(v.Type())
+		if len(fields) == 0 && v.NumField() > 0 {
+			return fmt.Errorf("msgpack: unsupported type %v: no exported fields", v.Type())
+		}
+		values := make([]reflect.Value, len(fields))
+		var n int
+		for i, f := range fields {
+			fv, ok := fieldByIndex(v, f.index, false)
+			if !ok || f.omitEmpty && fv.IsZero() {
+				continue
+			}
+			values[i] = fv
+			n++
+		}
+		e.encodeLen(n, 0x80, 0xde, 0xdf)
+		for i, f := range fields {
+			if !values[i].IsValid() {
+				continue
+			}
+			e.encodeString(f.name)
+			if err := e.encode(values[i]); err != nil {
+				return err
+			}
+		}
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			e.buf = append(e.buf, 0xc0)
+			return nil
+		}
+		return e.encode(v.Elem())
+	default:
+		return fmt.Errorf("msgpack: unsupported type %v", v.Type())
+	}
+	return nil
+}
+
+// encodeMarshaler encodes `v` if it is a time.Time or implements
+// encoding.BinaryMarshaler or encoding.TextMarshaler and reports
+// whether it did.
+func (e *msgpackEncoder) encodeMarshaler(v reflect.Value) (bool, error) {
+	// Pointers and interfaces are encoded by their element, so that
+	// e.g. a *time.Time is also encoded as a timestamp.
+	if v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		return false, nil
+	}
+	if v.Type() == timeType {
+		e.encodeTime(v.Interface().(time.Time))
+		return true, nil
+	}
+	m := v
+	if !m.Type().Implements(binaryMarshalerType) && !m.Type().Implements(textMarshalerType) {
+		if !m.CanAddr() {
+			return false, nil
+		}
+		m = m.Addr()
+	}
+	switch t := m.Interface().(type) {
+	case encoding.BinaryMarshaler:
+		b, err := t.MarshalBinary()
+		if err != nil {
+			return true, fmt.Errorf("msgpack: %v: %w", v.Type(), err)
+		}
+		e.encodeBytes(b)
+		return true, nil
+	case encoding.TextMarshaler:
+		b, err := t.MarshalText()
+		if err != nil {
+			return true, fmt.Errorf("msgpack: %v: %w", v.Type(), err)
+		}
+		e.encodeString(string(b))
+		return true, nil
+	}
+	return false, nil
+}
+
+// encodeTime writes `t` in the smallest timestamp format that holds it.
+func (e *msgpackEncoder) encodeTime(t time.Time) {
+	sec, nsec := t.Unix(), uint64(t.Nanosecond())
+	switch {
+	case sec >= 0 && sec <= math.MaxUint32 && nsec == 0:
+		e.buf = append(e.buf, 0xd6, 0xff)
+		e.buf = binary.BigEndian.AppendUint32(e.buf, uint32(sec))
+	case sec >= 0 && sec < 1<<34:
+		e.buf = append(e.buf, 0xd7, 0xff)
+		e.buf = binary.BigEndian.AppendUint64(e.buf, nsec<<34|uint64(sec))
+	default:
+		e.buf = append(e.buf, 0xc7, 12, 0xff)
+		e.buf = binary.BigEndian.AppendUint32(e.buf, uint32(nsec))
+		e.buf = binary.BigEndian.AppendUint64(e.buf, uint64(sec))
+	}
+}
+
+func (e *msgpackEncoder) encodeInt(n int64) {
+	switch {
+	case n >= 0:
+		e.encodeUint(uint64(n))
+	case n >= -32:
+		e.buf = append(e.buf, byte(n))
+	case n >= math.MinInt8:
+		e.buf = append(e.buf, 0xd0, byte(n))
+	case n >= math.MinInt16:
+		e.buf = append(e.buf, 0xd1)
+		e.buf = binary.BigEndian.AppendUint16(e.buf, uint16(n))
+	case n >= math.MinInt32:
+		e.buf = append(e.buf, 0xd2)
+		e.buf = binary.BigEndian.AppendUint32(e.buf, uint32(n))
+	default:
+		e.buf = append(e.buf, 0xd3)
+		e.buf = binary.BigEndian.AppendUint64(e.buf, uint64(n))
+	}
+}
+
+func (e *msgpackEncoder) encodeUint(n uint64) {
+	switch {
+	case n <= 0x7f:
+		e.buf = append(e.buf, byte(n))
+	case n <= math.MaxUint8:
+		e.buf = append(e.buf, 0xcc, byte(n))
+	case n <= math.MaxUint16:
+		e.buf = append(e.buf, 0xcd)
+		e.buf = binary.BigEndian.AppendUint16(e.buf, uint16(n))
+	case n <= math.MaxUint32:
+		e.buf = append(e.buf, 0xce)
+		e.buf = binary.BigEndian.AppendUint32(e.buf, uint32(n))
+	default:
+		e.buf = append(e.buf, 0xcf)
+		e.buf = binary.BigEndian.AppendUint64(e.buf, n)
+	}
+}
+
+func (e *msgpackEncoder) encodeString(s string) {
+	switch n := len(s); {
+	case n < 32:
+		e.buf = append(e.buf, 0xa0|byte(n))
+	case n <= math.MaxUint8:
+		e.buf = append(e.buf, 0xd9, byte(n))
+	case n <= math.MaxUint16:
+		e.buf = append(e.buf, 0xda)
+		e.buf = binary.BigEndian.AppendUint16(e.buf, uint16(n))
+	default:
+		e.buf = append(e.buf, 0xdb)
+		e.buf = binary.BigEndian.AppendUint32(e.buf, uint32(n))
+	}
+	e.buf = append(e.buf, s...)
+}
+
+func (e *msgpackEncoder) encodeBytes(b []byte) {
+	switch n := len(b); {
+	case n <= math.MaxUint8:
+		e.buf = append(e.buf, 0xc4, byte(n))
+	case n <= math.MaxUint16:
+		e.buf = append(e.buf, 0xc5)
+		e.buf = binary.BigEndian.AppendUint16(e.buf, uint16(n))
+	default:
+		e.buf = append(e.buf, 0xc6)
+		e.buf = binary.BigEndian.AppendUint32(e.buf, uint32(n))
+	}
+	e.buf = append(e.buf, b...)
+}
+
+func (e *msgpackEncoder) encodeArray(v reflect.Value) error {
+	e.encodeLen(v.Len(), 0x90, 0xdc, 0xdd)
+	for i := 0; i < v.Len(); i++ {
+		if err := e.encode(v.Index(i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// encodeLen writes an array or map header using the fix, 16-bit
+// or 32-bit form depending on `n`.
+func (e *msgpackEncoder) encodeLen(n int, fix, b16, b32 byte) {
+	switch {
+	case n < 16:
+		e.buf = append(e.buf, fix|byte(n))
+	case n <= math.MaxUint16:
+		e.buf = append(e.buf, b16)
+		e.buf = binary.BigEndian.AppendUint16(e.buf, uint16(n))
+	default:
+		e.buf = append(e.buf, b32)
+		e.buf = binary.BigEndian.AppendUint32(e.buf, uint32(n))
+	}
+}
+
+type msgpackField struct {
+	name      string
+	index     []int
+	omitEmpty bool
+}
+
+// msgpackFields returns the fields of the struct type `t`, including the
+// promoted fields of embedded structs. A field hides the fields with the
+// same name that are embedded more deeply.
+func msgpackFields(t reflect.Type) []msgpackField {
+	fields := appendFields(nil, t, nil)
+	depth := map[string]int{}
+	for _, f := range fields {
+		if d, ok := depth[f.name]; !ok || len(f.index) < d {
+			depth[f.name] = len(f.index)
+		}
+	}
+	visible := fields[:0]
+	for _, f := range fields {
+		if len(f.index) == depth[f.name] {
+			visible = append(visible, f)
+			depth[f.name] = -1 // the first field of a name wins.
+		}
+	}
+	return visible
+}
+
+func appendFields(fields []msgpackField, t reflect.Type, index []int) []msgpackField {
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		name, opts, _ := strings.Cut(sf.Tag.Get("msgpack"), ",")
+		if name == "-" {
+			continue
+		}
+		fi := append(append([]int(nil), index...), i)
+		if sf.Anonymous && name == "" {
+			et := sf.Type
+			if et.Kind() == reflect.Pointer {
+				et = et.Elem()
+			}
+			if et.Kind() == reflect.Struct && et != timeType &&
+				!reflect.PointerTo(et).Implements(binaryMarshalerType) &&
+				!reflect.PointerTo(et).Implements(textMarshalerType) {
+				fields = appendFields(fields, et, fi)
+				continue
+			}
+		}
+		if !sf.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = sf.Name
+		}
+		fields = append(fields, msgpackField{name: name, index: fi, omitEmpty: opts == "omitempty"})
+	}
+	return fields
+}
+
+// fieldByIndex returns the field of `v` with the index sequence `index`.
+// A nil embedded pointer is allocated if `alloc` is set and otherwise
+// reported as a missing field.
+func fieldByIndex(v reflect.Value, index []int, alloc bool) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				if !alloc || !v.CanSet() {
+					return reflect.Value{}, false
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
+
+type msgpackDecoder struct {
+	buf []byte
+}
+
+func (d *msgpackDecoder) next(n int) ([]byte, error) {
+	if len(d.buf) < n {
+		return nil, errShortBuffer
+	}
+	b := d.buf[:n]
+	d.buf = d.buf[n:]
+	return b, nil
+}
+
+func (d *msgpackDecoder) readN(size int) (uint64, error) {
+	b, err := d.next(size)
+	if err != nil {
+		return 0, err
+	}
+	switch size {
+	case 1:
+		return uint64(b[0]), nil
+	case 2:
+		return uint64(binary.BigEndian.Uint16(b)), nil
+	case 4:
+		return uint64(binary.BigEndian.Uint32(b)), nil
+	default:
+		return binary.BigEndian.Uint64(b), nil
+	}
+}
+
+// decodeAny decodes the next value into its natural Go representation.
+func (d *msgpackDecoder) decodeAny() (any, error) {
+	b, err := d.next(1)
+	if err != nil {
+		return nil, err
+	}
+	c := b[0]
+
+	switch {
+	case c <= 0x7f:
+		return int64(c), nil
+	case c >= 0xe0:
+		return int64(int8(c)), nil
+	case c&0xe0 == 0xa0:
+		return d.readString(int(c & 0x1f))
+	case c&0xf0 == 0x90:
+		return d.readArray(int(c & 0x0f))
+	case c&0xf0 == 0x80:
+		return d.readMap(int(c & 0x0f))
+	}
+
+	switch c {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		n, err := d.readN(1 << (c - 0xcc))
+		if err != nil {
+			return nil, err
+		}
+		if n > math.MaxInt64 {
+			return n, nil
+		}
+		return int64(n), nil
+	case 0xd0:
+		n, err := d.readN(1)
+		return int64(int8(n)), err
+	case 0xd1:
+		n, err := d.readN(2)
+		return int64(int16(n)), err
+	case 0xd2:
+		n, err := d.readN(4)
+		return int64(int32(n)), err
+	case 0xd3:
+		n, err := d.readN(8)
+		return int64(n), err
+	case 0xca:
+		n, err := d.readN(4)
+		return float64(math.Float32frombits(uint32(n))), err
+	case 0xcb:
+		n, err := d.readN(8)
+		return math.Float64frombits(n), err
+	case 0xd9, 0xda, 0xdb:
+		n, err := d.readN(1 << (c - 0xd9))
+		if err != nil {
+			return nil, err
+		}
+		return d.readString(int(n))
+	case 0xc4, 0xc5, 0xc6:
+		n, err := d.readN(1 << (c - 0xc4))
+		if err != nil {
+			return nil, err
+		}
+		b, err := d.next(int(n))
+		if err != nil {
+			return nil, err
+		}
+		return append([]byte(nil), b...), nil
+	case 0xdc, 0xdd:
+		n, err := d.readN(2 << (c - 0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return d.readArray(int(n))
+	case 0xde, 0xdf:
+		n, err := d.readN(2 << (c - 0xde))
+		if err != nil {
+			return nil, err
+		}
+		return d.readMap(int(n))
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8:
+		return d.readExt(1 << (c - 0xd4))
+	case 0xc7, 0xc8, 0xc9:
+		n, err := d.readN(1 << (c - 0xc7))
+		if err != nil {
+			return nil, err
+		}
+		return d.readExt(int(n))
+	}
+	return nil, fmt.Errorf("msgpack: unsupported format byte 0x%02x", c)
+}
+
+// readExt reads an extension value with `n` bytes of data in any of the
+// fixext and ext formats. Only timestamps are supported and decoded as
+// time.Time; other extension types return an error.
+func (d *msgpackDecoder) readExt(n int) (any, error) {
+	typ, err := d.readN(1)
+	if err != nil {
+		return nil, err
+	}
+	data, err := d.next(n)
+	if err != nil {
+		return nil, err
+	}
+	if int8(typ) != timestampExt {
+		return nil, fmt.Errorf("msgpack: unsupported extension type %v", int8(typ))
+	}
+	switch n {
+	case 4:
+		return time.Unix(int64(binary.BigEndian.Uint32(data)), 0), nil
+	case 8:
+		v := binary.BigEndian.Uint64(data)
+		return time.Unix(int64(v&(1<<34-1)), int64(v>>34)), nil
+	case 12:
+		nsec := binary.BigEndian.Uint32(data)
+		return time.Unix(int64(binary.BigEndian.Uint64(data[4:])), int64(nsec)), nil
+	}
+	return nil, fmt.Errorf("msgpack: invalid timestamp of %v bytes", n)
+}
+
+func (d *msgpackDecoder) readString(n int) (string, error) {
+	b, err := d.next(n)
+	return string(b), err
+}
+
+func (d *msgpackDecoder) readArray(n int) ([]any, error) {
+	if n > len(d.buf) {
+		return nil, errShortBuffer
+	}
+	a := make([]any, n)
+	for i := range a {
+		v, err := d.decodeAny()
+		if err != nil {
+			return nil, err
+		}
+		a[i] = v
+	}
+	return a, nil
+}
+
+func (d *msgpackDecoder) readMap(n int) (any, error) {
+	if 2*n > len(d.buf) {
+		return nil, errShortBuffer
+	}
+	keys, values := make([]any, n), make([]any, n)
+	stringKeys := true
+	for i := 0; i < n; i++ {
+		k, err := d.decodeAny()
+		if err != nil {
+			return nil, err
+		}
+		v, err := d.decodeAny()
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := k.(string); !ok {
+			stringKeys = false
+		}
+		keys[i], values[i] = k, v
+	}
+
+	if stringKeys {
+		m := make(map[string]any, n)
+		for i, k := range keys {
+			m[k.(string)] = values[i]
+		}
+		return m, nil
+	}
+	m := make(map[any]any, n)
+	for i, k := range keys {
+		if k != nil && !reflect.TypeOf(k).Comparable() {
+			return nil, fmt.Errorf("msgpack: unhashable map key of type %T", k)
+		}
+		m[k] = values[i]
+	}
+	return m, nil
+}
+
+// decode decodes the next value into `v`, which must be settable.
+func (d *msgpackDecoder) decode(v reflect.Value) error {
+	val, err := d.decodeAny()
+	if err != nil {
+		return err
+	}
+	return assign(v, val)
+}
+
+// assign stores the generic decoded value `val` into `v`.
+func assign(v reflect.Value, val any) error {
+	if val == nil {
+		v.SetZero()
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Interface:
+		if v.NumMethod() != 0 {
+			return fmt.Errorf("msgpack: cannot decode into non-empty interface %v", v.Type())
+		}
+		v.Set(reflect.ValueOf(val))
+		return nil
+	case reflect.Pointer:
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return assign(v.Elem(), val)
+	}
+	if ok, err := assignUnmarshaler(v, val); ok {
+		return err
+	}
+
+	switch t := val.(type) {
+	case bool:
+		if v.Kind() == reflect.Bool {
+			v.SetBool(t)
+			return nil
+		}
+	case int64:
+		switch v.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			if v.OverflowInt(t) {
+				return fmt.Errorf("msgpack: %v overflows %v", t, v.Type())
+			}
+			v.SetInt(t)
+			return nil
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			if t < 0 || v.OverflowUint(uint64(t)) {
+				return fmt.Errorf("msgpack: %v overflows %v", t, v.Type())
+			}
+			v.SetUint(uint64(t))
+			return nil
+		case reflect.Float32, reflect.Float64:
+			v.SetFloat(float64(t))
+			return nil
+		}
+	case uint64:
+		switch v.Kind() {
+		case reflect.Uint, reflect.Uint64, reflect.Uintptr:
+			if v.OverflowUint(t) {
+				return fmt.Errorf("msgpack: %v overflows %v", t, v.Type())
+			}
+			v.SetUint(t)
+			return nil
+		case reflect.Float32, reflect.Float64:
+			v.SetFloat(float64(t))
+			return nil
+		}
+	case float64:
+		if v.Kind() == reflect.Float32 || v.Kind() == reflect.Float64 {
+			v.SetFloat(t)
+			return nil
+		}
+	case string:
+		switch {
+		case v.Kind() == reflect.String:
+			v.SetString(t)
+			return nil
+		case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8:
+			v.SetBytes([]byte(t))
+			return nil
+		}
+	case []byte:
+		switch {
+		case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8:
+			v.SetBytes(t)
+			return nil
+		case v.Kind() == reflect.Array && v.Type().Elem().Kind() == reflect.Uint8:
+			if len(t) != v.Len() {
+				return fmt.Errorf("msgpack: cannot decode %v bytes into %v", len(t), v.Type())
+			}
+			reflect.Copy(v, reflect.ValueOf(t))
+			return nil
+		case v.Kind() == reflect.String:
+			v.SetString(string(t))
+			return nil
+		}
+	case []any:
+		switch v.Kind() {
+		case reflect.Slice:
+			s := reflect.MakeSlice(v.Type(), len(t), len(t))
+			for i, e := range t {
+				if err := assign(s.Index(i), e); err != nil {
+					return err
+				}
+			}
+			v.Set(s)
+			return nil
+		case reflect.Array:
+			if len(t) != v.Len() {
+				return fmt.Errorf("msgpack: cannot decode %v elements into %v", len(t), v.Type())
+			}
+			for i, e := range t {
+				if err := assign(v.Index(i), e); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	case map[string]any:
+		switch v.Kind() {
+		case reflect.Struct:
+			return assignStruct(v, t)
+		case reflect.Map:
+			m := reflect.MakeMapWithSize(v.Type(), len(t))
+			for k, e := range t {
+				if err := assignMapEntry(m, k, e); err != nil {
+					return err
+				}
+			}
+			v.Set(m)
+			return nil
+		}
+	case map[any]any:
+		if v.Kind() == reflect.Map {
+			m := reflect.MakeMapWithSize(v.Type(), len(t))
+			for k, e := range t {
+				if err := assignMapEntry(m, k, e); err != nil {
+					return err
+				}
+			}
+			v.Set(m)
+			return nil
+		}
+	}
+	return fmt.Errorf("msgpack: cannot decode %T into %v", val, v.Type())
+}
+
+// assignUnmarshaler stores `val` into `v` if `v` is a time.Time or
+// implements encoding.BinaryUnmarshaler or encoding.TextUnmarshaler
+// and reports whether it did.
+func assignUnmarshaler(v reflect.Value, val any) (bool, error) {
+	if t, ok := val.(time.Time); ok {
+		if v.Type() != timeType {
+			return true, fmt.Errorf("msgpack: cannot decode timestamp into %v", v.Type())
+		}
+		v.Set(reflect.ValueOf(t))
+		return true, nil
+	}
+	if !v.CanAddr() {
+		return false, nil
+	}
+	switch u := v.Addr().Interface().(type) {
+	case encoding.BinaryUnmarshaler:
+		b, ok := val.([]byte)
+		if !ok {
+			return false, nil
+		}
+		if err := u.UnmarshalBinary(b); err != nil {
+			return true, fmt.Errorf("msgpack: %v: %w", v.Type(), err)
+		}
+		return true, nil
+	case encoding.TextUnmarshaler:
+		s, ok := val.(string)
+		if !ok {
+			return false, nil
+		}
+		if err := u.UnmarshalText([]byte(s)); err != nil {
+			return true, fmt.Errorf("msgpack: %v: %w", v.Type(), err)
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+func assignMapEntry(m reflect.Value, key, val any) error {
+	k := reflect.New(m.Type().Key()).Elem()
+	if err := assign(k, key); err != nil {
+		return err
+	}
+	e := reflect.New(m.Type().Elem()).Elem()
+	if err := assign(e, val); err != nil {
+		return err
+	}
+	m.SetMapIndex(k, e)
+	return nil
+}
+
+func assignStruct(v reflect.Value, m map[string]any) error {
+	fields := msgpackFields(v.Type())
+	v.SetZero()
+	for key, val := range m {
+		f, ok := findField(fields, key)
+		if !ok {
+			continue // unknown fields are ignored.
+		}
+		fv, ok := fieldByIndex(v, f.index, true)
+		if !ok {
+			continue // the field is in an unexported embedded pointer.
+		}
+		if err := assign(fv, val); err != nil {
+			return fmt.Errorf("msgpack: field %v: %w", f.name, err)
+		}
+	}
+	return nil
+}
+
+// findField looks up a field by name, preferring an exact match
+// over a case-insensitive one.
+func findField(fields []msgpackField, name string) (msgpackField, bool) {
+	for _, f := range fields {
+		if f.name == name {
+			return f, true
+		}
+	}
+	for _, f := range fields {
+		if strings.EqualFold(f.name, name) {
+			return f, true
+		}
+	}
+	return msgpackField{}, false
+}
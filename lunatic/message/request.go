@@ -0,0 +1,286 @@
+// -*- compile-command: "GOOS=wasip1 GOARCH=wasm go test ./..."; -*-
+
+package message
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gmlewis/go-lunatic/lunatic/process"
+)
+
+// replyTag is the last reply tag allocated by NextReplyTag.
+var replyTag atomic.Int64
+
+// NextReplyTag returns a new tag that is unique within the current process.
+//
+// Reply tags are negative, so processes that use positive tags for their
+// own messages never receive a reply by accident.
+func NextReplyTag() int64 {
+	return math.MinInt64 + replyTag.Add(1)
+}
+
+// RequestError is returned by Request when the call fails.
+// Use `errors.Is(err, CallTimedOut)` or `errors.Is(err, ProcessDied)`
+// to find out why.
+type RequestError struct {
+	ProcessID uint64
+	Err       error
+}
+
+func (e *RequestError) Error() string {
+	return fmt.Sprintf("message.Request to process %v: %v", e.ProcessID, e.Err)
+}
+
+func (e *RequestError) Unwrap() error { return e.Err }
+
+// Call is a request received with ReceiveRequest.
+type Call[Req any] struct {
+	// Body is the request sent by the caller.
+	Body Req
+	// ReplyTo is the ID of the calling process.
+	ReplyTo uint64
+	// ReplyTag is the tag the caller is waiting on.
+	ReplyTag int64
+}
+
+// Reply sends `resp` back to the calling process.
+//
+// There are no guarantees that the reply will be received, e.g. if the
+// caller timed out in the meantime.
+func (c *Call[Req]) Reply(resp any) error {
+	CreateData(c.ReplyTag, 0)
+	if err := EncodeData(resp, nil); err != nil {
+		return err
+	}
+	return Send(c.ReplyTo)
+}
+
+// requestEnvelope is the message sent by Request.
+type requestEnvelope[Req any] struct {
+	ReplyTo  uint64
+	ReplyTag int64
+	Body     Req
+}
+
+// Request sends `req` tagged with `tag` to the process with `processID`
+// and waits for the reply, which is deserialized into a value of type Resp.
+//
+// The callee receives the request with ReceiveRequest and answers it with
+// `Call.Reply`. A unique reply tag is allocated for every request and only
+// a message with that tag or the death of the callee ends the wait, so
+// other messages stay in the mailbox. The host still searches the mailbox
+// for the reply, unlike with `SendReceiveSkipSearch`.
+//
+// The callee is watched during the call with `process.WatchCall`, so
+// ProcessDied is returned if it fails before replying, even without a
+// timeout. Since lunatic has no monitors, the callee is linked to the
+// current process during the call, and dies if the current process fails
+// unless it traps link deaths with `process.DieWhenLinkDies(false)`.
+// Long-lived callees should trap them; ReceiveRequest ignores the
+// signals of failed callers.
+//
+// If `timeout` is greater than 0 and no reply arrives in time, CallTimedOut
+// is returned. Timeouts are rounded up to whole milliseconds. A reply that
+// arrives later is dropped by the next Request or Receive of the current
+// process, along with any resources it contains. The request must not
+// contain resources.
+//
+// Returns:
+// * nil on success with the reply.
+// * *RequestError wrapping CallTimedOut if the call timed out.
+// * *RequestError wrapping ProcessDied if the process does not exist (anymore).
+// * error if the request or the reply could not be serialized.
+func Request[Resp, Req any](processID uint64, tag int64, req Req, timeout time.Duration) (resp Resp, err error) {
+	if !process.Exists(processID) {
+		return resp, &RequestError{ProcessID: processID, Err: ProcessDied}
+	}
+
+	env := requestEnvelope[Req]{
+		ReplyTo:  process.ProcessID(),
+		ReplyTag: NextReplyTag(),
+		Body:     req,
+	}
+
+	// Receiving replaces the message in the scratch area, so this must be
+	// done before the request is created.
+	dropLateReplies()
+	CreateData(tag, 0)
+	if err := EncodeData(env, nil); err != nil {
+		return resp, err
+	}
+
+	var timeoutMillis *uint64
+	if timeout > 0 {
+		// Round up, since a timeout of 0 doesn't wait at all.
+		ms := uint64((timeout + time.Millisecond - 1) / time.Millisecond)
+		timeoutMillis = &ms
+	}
+
+	diedTag, shared, done := process.WatchCall(processID)
+	defer done()
+	if err := Send(processID); err != nil {
+		return resp, err
+	}
+
+	msg, err := Receive([]int64{env.ReplyTag, diedTag}, timeoutMillis)
+	if err != nil {
+		if errors.Is(err, CallTimedOut) {
+			addLateReply(env.ReplyTag, processID)
+		}
+		return resp, &RequestError{ProcessID: processID, Err: err}
+	}
+	if _, ok := msg.(*DataMessage); !ok {
+		// The signal is one the process asked for as well.
+		if shared {
+			pushSignal(msg)
+		}
+		return resp, &RequestError{ProcessID: processID, Err: ProcessDied}
+	}
+
+	err = DecodeData(&resp)
+	return resp, err
+}
+
+// lateReplies holds the reply tags of the requests of a process that timed
+// out, with the IDs of their callees. They are keyed by process ID since
+// all processes share the package state under the fake host.
+var (
+	lateMu      sync.Mutex
+	lateReplies = map[uint64]map[int64]uint64{}
+)
+
+// addLateReply records that the reply with `replyTag` from `processID`
+// is no longer awaited.
+func addLateReply(replyTag int64, processID uint64) {
+	lateMu.Lock()
+	defer lateMu.Unlock()
+	id := process.ProcessID()
+	if lateReplies[id] == nil {
+		lateReplies[id] = map[int64]uint64{}
+	}
+	lateReplies[id][replyTag] = processID
+}
+
+// isLateReply reports whether `tag` is the tag of a reply that is no longer
+// awaited and forgets it.
+func isLateReply(tag int64) bool {
+	lateMu.Lock()
+	defer lateMu.Unlock()
+	id := process.ProcessID()
+	if _, ok := lateReplies[id][tag]; !ok {
+		return false
+	}
+	delete(lateReplies[id], tag)
+	if len(lateReplies[id]) == 0 {
+		delete(lateReplies, id)
+	}
+	return true
+}
+
+// isLateData reports whether `msg` is a reply that is no longer awaited,
+// and drops it in that case.
+func isLateData(msg Message) bool {
+	data, ok := msg.(*DataMessage)
+	if !ok || data.Tag >= 0 || !isLateReply(data.Tag) {
+		return false
+	}
+	dropScratch()
+	return true
+}
+
+// dropScratch replaces the message in the scratch area with an empty one,
+// so that the host drops it together with its resources.
+func dropScratch() {
+	CreateData(0, 0)
+}
+
+// dropLateReplies takes the replies that are no longer awaited out of the
+// mailbox, so that they don't pile up, and forgets the ones whose callee
+// ended without replying.
+func dropLateReplies() {
+	lateMu.Lock()
+	late := lateReplies[process.ProcessID()]
+	var tags []int64
+	for tag := range late {
+		tags = append(tags, tag)
+	}
+	lateMu.Unlock()
+	if len(tags) == 0 {
+		return
+	}
+
+	// Check the callees first, so that a reply sent before they ended
+	// is still found in the mailbox.
+	var gone []int64
+	for _, tag := range tags {
+		if !process.Exists(late[tag]) {
+			gone = append(gone, tag)
+		}
+	}
+	var zero uint64
+	for {
+		msg, err := receiveMessage(tags, &zero)
+		if err != nil {
+			break
+		}
+		isLateReply(msg.(*DataMessage).Tag)
+		dropScratch()
+	}
+	for _, tag := range gone {
+		isLateReply(tag)
+	}
+}
+
+// ReceiveRequest blocks until the next request sent by Request with `tag`
+// arrives and returns it. The LinkDied signals of callers that fail during
+// a call are skipped, see Request.
+//
+// Returns:
+// * nil on success with the request.
+// * LinkDied if a link died.
+// * ProcessDied if a monitored process died.
+// * error if the request could not be deserialized.
+func ReceiveRequest[Req any](tag int64) (*Call[Req], error) {
+	var tags []int64
+	if tag != 0 {
+		tags = []int64{tag}
+	}
+
+	msg, err := Receive(tags, nil)
+	for err == nil && isWatchSignal(msg) {
+		msg, err = Receive(tags, nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+	switch sig := msg.(type) {
+	case *LinkDiedSignal:
+		return nil, fmt.Errorf("%w: link tag %v", LinkDied, sig.Tag)
+	case *ProcessDiedSignal:
+		return nil, fmt.Errorf("%w: process %v", ProcessDied, sig.ProcessID)
+	}
+	return DecodeRequest[Req]()
+}
+
+// isWatchSignal reports whether `msg` is the LinkDied signal of a caller
+// that failed while it watched the current process, see `process.IsWatchTag`.
+func isWatchSignal(msg Message) bool {
+	sig, ok := msg.(*LinkDiedSignal)
+	return ok && process.IsWatchTag(sig.Tag)
+}
+
+// DecodeRequest deserializes the request sent by Request that is currently
+// in the scratch area. It is useful when receiving requests together with
+// other messages with a single call to Receive.
+func DecodeRequest[Req any]() (*Call[Req], error) {
+	var env requestEnvelope[Req]
+	if err := DecodeData(&env); err != nil {
+		return nil, err
+	}
+	return &Call[Req]{Body: env.Body, ReplyTo: env.ReplyTo, ReplyTag: env.ReplyTag}, nil
+}
@@ -0,0 +1,215 @@
+// -*- compile-command: "GOOS=wasip1 GOARCH=wasm go test ./..."; -*-
+
+package message
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// ResourceCodecFlag is set in the codec ID of messages encoded by a
+// ResourceCodec. The IDs of all other codecs must not have it set.
+const ResourceCodecFlag byte = 0x80
+
+// Resource is implemented by pointers to values holding the ID of a host
+// resource that can be moved between processes inside a message.
+type Resource interface {
+	// PushResource moves the resource into the message in the scratch area
+	// and replaces the resource ID held by the receiver with its index
+	// inside the message.
+	PushResource() error
+	// TakeResource takes the resource out of the message in the scratch area
+	// and replaces the index held by the receiver with the new resource ID.
+	TakeResource() error
+}
+
+// TCPStream is the ID of a TCP stream resource.
+//
+// When encoded with a ResourceCodec, the stream is moved into the message.
+type TCPStream uint64
+
+// PushResource moves the TCP stream into the message in the scratch area.
+func (s *TCPStream) PushResource() error {
+	index, err := PushTCPStream(uint64(*s))
+	if err != nil {
+		return err
+	}
+	*s = TCPStream(index)
+	return nil
+}
+
+// TakeResource takes the TCP stream out of the message in the scratch area.
+func (s *TCPStream) TakeResource() error {
+	id, err := TakeTCPStream(uint64(*s))
+	if err != nil {
+		return err
+	}
+	*s = TCPStream(id)
+	return nil
+}
+
+// TLSStream is the ID of a TLS stream resource.
+//
+// When encoded with a ResourceCodec, the stream is moved into the message.
+type TLSStream uint64
+
+// PushResource moves the TLS stream into the message in the scratch area.
+func (s *TLSStream) PushResource() error {
+	index, err := PushTLSStream(uint64(*s))
+	if err != nil {
+		return err
+	}
+	*s = TLSStream(index)
+	return nil
+}
+
+// TakeResource takes the TLS stream out of the message in the scratch area.
+func (s *TLSStream) TakeResource() error {
+	id, err := TakeTLSStream(uint64(*s))
+	if err != nil {
+		return err
+	}
+	*s = TLSStream(id)
+	return nil
+}
+
+// UDPSocket is the ID of a UDP socket resource.
+//
+// When encoded with a ResourceCodec, the socket is moved into the message.
+type UDPSocket uint64
+
+// PushResource moves the UDP socket into the message in the scratch area.
+func (s *UDPSocket) PushResource() error {
+	index, err := PushUDPSocket(uint64(*s))
+	if err != nil {
+		return err
+	}
+	*s = UDPSocket(index)
+	return nil
+}
+
+// TakeResource takes the UDP socket out of the message in the scratch area.
+func (s *UDPSocket) TakeResource() error {
+	id, err := TakeUDPSocket(uint64(*s))
+	if err != nil {
+		return err
+	}
+	*s = UDPSocket(id)
+	return nil
+}
+
+// ResourceCodec wraps a Codec and moves all resources found in the encoded
+// value into the message, as described in the package documentation.
+//
+// Before encoding, every value implementing Resource (such as TCPStream,
+// TLSStream and UDPSocket fields, slice elements or map values) is pushed
+// into the message and replaced with its index, which the wrapped Codec then
+// serializes like any other integer. After decoding, the indexes are taken
+// back out of the message and replaced with the new resource IDs of the
+// receiving process.
+//
+// Since the message is modified while encoding, a ResourceCodec must only be
+// used after `CreateData`, as Mailbox and EncodeData do. Resources reachable
+// through pointers, slices or maps of the encoded value are updated in place
+// and no longer belong to the sending process once the message is sent.
+type ResourceCodec struct {
+	Codec Codec
+}
+
+// NewResourceCodec returns a ResourceCodec wrapping `c`.
+// If `c` is nil, DefaultCodec is used.
+func NewResourceCodec(c Codec) ResourceCodec {
+	if c == nil {
+		c = DefaultCodec
+	}
+	return ResourceCodec{Codec: c}
+}
+
+// ID returns the ID of the wrapped codec with ResourceCodecFlag set.
+func (c ResourceCodec) ID() byte { return c.Codec.ID() | ResourceCodecFlag }
+
+// Encode pushes the resources of `v` into the message in the scratch area
+// and encodes the result with the wrapped codec.
+func (c ResourceCodec) Encode(v any) ([]byte, error) {
+	if v == nil {
+		return c.Codec.Encode(v)
+	}
+
+	rv := reflect.New(reflect.TypeOf(v)).Elem()
+	rv.Set(reflect.ValueOf(v))
+	if err := walkResources(rv, Resource.PushResource, map[uintptr]bool{}); err != nil {
+		return nil, fmt.Errorf("message.ResourceCodec: %w", err)
+	}
+	return c.Codec.Encode(rv.Interface())
+}
+
+// Decode decodes `data` into `v` with the wrapped codec and takes the
+// resources of `v` out of the message in the scratch area.
+func (c ResourceCodec) Decode(data []byte, v any) error {
+	if err := c.Codec.Decode(data, v); err != nil {
+		return err
+	}
+	if err := walkResources(reflect.ValueOf(v), Resource.TakeResource, map[uintptr]bool{}); err != nil {
+		return fmt.Errorf("message.ResourceCodec: %w", err)
+	}
+	return nil
+}
+
+var resourceType = reflect.TypeOf((*Resource)(nil)).Elem()
+
+// walkResources calls `fn` on every Resource reachable from `v`.
+// `seen` protects against cycles through pointers.
+func walkResources(v reflect.Value, fn func(Resource) error, seen map[uintptr]bool) error {
+	if v.CanAddr() && v.Addr().Type().Implements(resourceType) {
+		return fn(v.Addr().Interface().(Resource))
+	}
+
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() || seen[v.Pointer()] {
+			return nil
+		}
+		seen[v.Pointer()] = true
+		return walkResources(v.Elem(), fn, seen)
+	case reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		// The value inside an interface is not addressable, so work on a copy.
+		e := reflect.New(v.Elem().Type()).Elem()
+		e.Set(v.Elem())
+		if err := walkResources(e, fn, seen); err != nil {
+			return err
+		}
+		if v.CanSet() {
+			v.Set(e)
+		}
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < v.NumField(); i++ {
+			if !t.Field(i).IsExported() {
+				continue
+			}
+			if err := walkResources(v.Field(i), fn, seen); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err := walkResources(v.Index(i), fn, seen); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			e := reflect.New(v.Type().Elem()).Elem()
+			e.Set(iter.Value())
+			if err := walkResources(e, fn, seen); err != nil {
+				return err
+			}
+			v.SetMapIndex(iter.Key(), e)
+		}
+	}
+	return nil
+}
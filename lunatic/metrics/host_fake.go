@@ -0,0 +1,35 @@
+// -*- compile-command: "go test ./..."; -*-
+
+//go:build !wasm
+
+package metrics
+
+import "github.com/gmlewis/go-lunatic/lunatic/internal/fakehost"
+
+func update(nameStrPtr ptr, nameStrLen size, fn func(m *fakehost.Metric)) {
+	fakehost.UpdateMetric(fakehost.String(nameStrPtr, nameStrLen), fn)
+}
+
+func counter(nameStrPtr ptr, nameStrLen size, value uint64) {
+	update(nameStrPtr, nameStrLen, func(m *fakehost.Metric) { m.Counter = value })
+}
+
+func increment_counter(nameStrPtr ptr, nameStrLen size) {
+	update(nameStrPtr, nameStrLen, func(m *fakehost.Metric) { m.Counter++ })
+}
+
+func gauge(nameStrPtr ptr, nameStrLen size, value float64) {
+	update(nameStrPtr, nameStrLen, func(m *fakehost.Metric) { m.Gauge = value })
+}
+
+func increment_gauge(nameStrPtr ptr, nameStrLen size, value float64) {
+	update(nameStrPtr, nameStrLen, func(m *fakehost.Metric) { m.Gauge += value })
+}
+
+func decrement_gauge(nameStrPtr ptr, nameStrLen size, value float64) {
+	update(nameStrPtr, nameStrLen, func(m *fakehost.Metric) { m.Gauge -= value })
+}
+
+func histogram(nameStrPtr ptr, nameStrLen size, value float64) {
+	update(nameStrPtr, nameStrLen, func(m *fakehost.Metric) { m.Histogram = append(m.Histogram, value) })
+}
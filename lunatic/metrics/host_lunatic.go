@@ -0,0 +1,29 @@
+// -*- compile-command: "GOOS=wasip1 GOARCH=wasm go test ./..."; -*-
+
+//go:build wasm
+
+package metrics
+
+//go:wasmimport lunatic::metrics counter
+//go:noescape
+func counter(nameStrPtr ptr, nameStrLen size, value uint64)
+
+//go:wasmimport lunatic::metrics increment_counter
+//go:noescape
+func increment_counter(nameStrPtr ptr, nameStrLen size)
+
+//go:wasmimport lunatic::metrics gauge
+//go:noescape
+func gauge(nameStrPtr ptr, nameStrLen size, value float64)
+
+//go:wasmimport lunatic::metrics increment_gauge
+//go:noescape
+func increment_gauge(nameStrPtr ptr, nameStrLen size, value float64)
+
+//go:wasmimport lunatic::metrics decrement_gauge
+//go:noescape
+func decrement_gauge(nameStrPtr ptr, nameStrLen size, value float64)
+
+//go:wasmimport lunatic::metrics histogram
+//go:noescape
+func histogram(nameStrPtr ptr, nameStrLen size, value float64)
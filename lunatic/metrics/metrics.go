@@ -13,10 +13,6 @@ type size = uint32
 
 func mkptr[T any](v *T) ptr { return unsafe.Pointer(v) }
 
-//go:wasmimport lunatic::metrics counter
-//go:noescape
-func counter(nameStrPtr ptr, nameStrLen size, value uint64)
-
 // Counter sets a counter.
 func Counter(name string, value uint64) (err error) {
 	defer func() {
@@ -30,10 +26,6 @@ func Counter(name string, value uint64) (err error) {
 	return nil
 }
 
-//go:wasmimport lunatic::metrics increment_counter
-//go:noescape
-func increment_counter(nameStrPtr ptr, nameStrLen size)
-
 // IncrementCounter increments a counter.
 func IncrementCounter(name string) (err error) {
 	defer func() {
@@ -47,10 +39,6 @@ func IncrementCounter(name string) (err error) {
 	return nil
 }
 
-//go:wasmimport lunatic::metrics gauge
-//go:noescape
-func gauge(nameStrPtr ptr, nameStrLen size, value float64)
-
 // Gauge sets a guage.
 func Gauge(name string, value float64) (err error) {
 	defer func() {
@@ -64,10 +52,6 @@ func Gauge(name string, value float64) (err error) {
 	return nil
 }
 
-//go:wasmimport lunatic::metrics increment_gauge
-//go:noescape
-func increment_gauge(nameStrPtr ptr, nameStrLen size, value float64)
-
 // IncrementGauge increments a gauge.
 func IncrementGauge(name string, value float64) (err error) {
 	defer func() {
@@ -81,10 +65,6 @@ func IncrementGauge(name string, value float64) (err error) {
 	return nil
 }
 
-//go:wasmimport lunatic::metrics decrement_gauge
-//go:noescape
-func decrement_gauge(nameStrPtr ptr, nameStrLen size, value float64)
-
 // DecrementGauge decrements a gauge.
 func DecrementGauge(name string, value float64) (err error) {
 	defer func() {
@@ -98,10 +78,6 @@ func DecrementGauge(name string, value float64) (err error) {
 	return nil
 }
 
-//go:wasmimport lunatic::metrics histogram
-//go:noescape
-func histogram(nameStrPtr ptr, nameStrLen size, value float64)
-
 // Histogram sets a histogram.
 func Histogram(name string, value float64) (err error) {
 	defer func() {
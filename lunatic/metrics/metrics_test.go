@@ -0,0 +1,44 @@
+// -*- compile-command: "go test ./..."; -*-
+
+package metrics_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/gmlewis/go-lunatic/lunatic/internal/fakehost"
+	"github.com/gmlewis/go-lunatic/lunatic/metrics"
+)
+
+func TestMetrics(t *testing.T) {
+	fakehost.ResetMetrics()
+
+	for _, err := range []error{
+		metrics.Counter("requests", 10),
+		metrics.IncrementCounter("requests"),
+		metrics.Gauge("load", 1.5),
+		metrics.IncrementGauge("load", 1),
+		metrics.DecrementGauge("load", 0.25),
+		metrics.Histogram("latency", 0.1),
+		metrics.Histogram("latency", 0.2),
+	} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := map[string]fakehost.Metric{
+		"requests": {Counter: 11},
+		"load":     {Gauge: 2.25},
+		"latency":  {Histogram: []float64{0.1, 0.2}},
+	}
+	if got := fakehost.Metrics(); !reflect.DeepEqual(got, want) {
+		t.Errorf("metrics = %+v, want %+v", got, want)
+	}
+}
+
+func TestEmptyName(t *testing.T) {
+	if err := metrics.IncrementCounter(""); err == nil {
+		t.Error("IncrementCounter with an empty name: want error")
+	}
+}
@@ -0,0 +1,430 @@
+// -*- compile-command: "GOOS=wasip1 GOARCH=wasm go test ./..."; -*-
+
+package networking
+
+import (
+	"errors"
+	"io"
+	"math"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// TCPConn is a net.Conn over a lunatic TCP stream.
+//
+// Like all lunatic resources, the stream belongs to the process that
+// created it. Use `message.PushTCPStream` with StreamID to hand it over to
+// another process, which can then wrap it with NewTCPConn.
+type TCPConn struct {
+	streamConn
+}
+
+var _ net.Conn = (*TCPConn)(nil)
+
+// tcpOps are the host functions of TCP streams.
+var tcpOps = &streamOps{
+	network:         "tcp",
+	read:            TCPRead,
+	write:           TCPWriteVectored,
+	writeVectored:   tcpWriteVectored,
+	drop:            DropTCPStream,
+	peerAddr:        TCPPeerAddr,
+	setReadTimeout:  SetReadTimeout,
+	setWriteTimeout: SetWriteTimeout,
+}
+
+// NewTCPConn returns a TCPConn for the TCP stream with `streamID`,
+// e.g. a stream received with `message.TakeTCPStream`.
+// The TCPConn takes ownership of the stream and drops it on Close.
+func NewTCPConn(streamID uint64) *TCPConn {
+	return &TCPConn{streamConn{id: streamID, ops: tcpOps}}
+}
+
+// Dial connects to the TCP `address` of the form "host:port".
+// The host may be an IP address or a name which is resolved with Resolve.
+// If it resolves to several addresses, they are tried in order.
+func Dial(address string) (net.Conn, error) {
+	return DialTimeout(address, 0)
+}
+
+// DialTimeout is like Dial but fails with a timeout error if the
+// connection could not be established within `timeout`.
+// A `timeout` of 0 means no timeout.
+func DialTimeout(address string, timeout time.Duration) (net.Conn, error) {
+	c, err := DialTCP(address, timeout)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// DialTCP is like DialTimeout but returns a *TCPConn.
+func DialTCP(address string, timeout time.Duration) (*TCPConn, error) {
+	infos, err := lookupAddr("tcp", address, "127.0.0.1", timeout)
+	if err != nil {
+		return nil, &net.OpError{Op: "dial", Net: "tcp", Err: err}
+	}
+	for _, info := range infos {
+		raddr := info.TCPAddr()
+		var id uint64
+		id, err = TCPConnect(info, timeoutMillis(timeout))
+		if err == nil {
+			return &TCPConn{streamConn{id: id, ops: tcpOps, dialed: true, raddr: raddr}}, nil
+		}
+		err = &net.OpError{Op: "dial", Net: "tcp", Addr: raddr, Err: netError(err)}
+	}
+	return nil, err
+}
+
+// StreamID returns the ID of the underlying TCP stream.
+func (c *TCPConn) StreamID() uint64 { return c.id }
+
+// Peek reads data into `b` without removing it from the stream, so that
+// the next Read returns it again, e.g. to sniff the protocol spoken by
+// the peer. The read deadline is applied as the peek timeout of the stream.
+func (c *TCPConn) Peek(b []byte) (int, error) {
+	if err := c.prepare(&c.readDeadline, &c.peekTimeout, SetPeekTimeout); err != nil {
+		return 0, c.opError("peek", err)
+	}
+	if len(b) == 0 {
+		return 0, nil
+	}
+
+	n, err := TCPPeek(c.id, b)
+	if err != nil {
+		return 0, c.opError("peek", err)
+	}
+	if n == 0 {
+		return 0, io.EOF
+	}
+	return n, nil
+}
+
+// streamOps are the host functions of a kind of stream.
+type streamOps struct {
+	network string
+	read    func(streamID uint64, buf []byte) (int, error)
+	write   func(streamID uint64, buf []byte) (int, error)
+	// writeVectored is optional and gathers several buffers in one call.
+	writeVectored   func(streamID uint64, bufs [][]byte) (int, error)
+	drop            func(streamID uint64) error
+	peerAddr        func(streamID uint64) (net.Addr, error)
+	setReadTimeout  func(streamID, timeoutMillis uint64) error
+	setWriteTimeout func(streamID, timeoutMillis uint64) error
+}
+
+// streamConn implements net.Conn for TCPConn and TLSConn.
+// Like the connections of the net package, it may be used by several
+// goroutines at once.
+type streamConn struct {
+	id    uint64
+	ops   *streamOps
+	laddr net.Addr
+	// dialed is set for connections made with Dial, whose local
+	// address lunatic doesn't report.
+	dialed bool
+
+	// mu guards the fields below. It is not held during reads and
+	// writes, so that e.g. Close doesn't wait for a blocked Read.
+	mu     sync.Mutex
+	raddr  net.Addr
+	closed bool
+
+	readDeadline  time.Time
+	writeDeadline time.Time
+	// readTimeout, writeTimeout and peekTimeout are the timeouts last set
+	// on the stream or 0 if they are unknown.
+	readTimeout  uint64
+	writeTimeout uint64
+	peekTimeout  uint64
+}
+
+// Read reads data from the connection. It returns io.EOF when the peer
+// closed the connection.
+func (c *streamConn) Read(b []byte) (int, error) {
+	if err := c.prepare(&c.readDeadline, &c.readTimeout, c.ops.setReadTimeout); err != nil {
+		return 0, c.opError("read", err)
+	}
+	if len(b) == 0 {
+		return 0, nil
+	}
+
+	n, err := c.ops.read(c.id, b)
+	if err != nil {
+		return 0, c.opError("read", err)
+	}
+	if n == 0 {
+		return 0, io.EOF
+	}
+	return n, nil
+}
+
+// Write writes `b` to the connection. Short writes of the host are
+// retried until all of `b` is written or an error occurs.
+func (c *streamConn) Write(b []byte) (int, error) {
+	v := net.Buffers{b}
+	n, err := c.WriteBuffers(&v)
+	return int(n), err
+}
+
+// WriteBuffers writes and consumes `v` like net.Buffers.WriteTo.
+// TCP streams gather all remaining buffers in a single host call, so
+// e.g. a header and a body can be written without copying them together.
+//
+// net.Buffers.WriteTo can only do this for the connections of the net
+// package, so call WriteBuffers directly to avoid a host call per buffer.
+func (c *streamConn) WriteBuffers(v *net.Buffers) (int64, error) {
+	n, err := writeBuffers(v, func(bufs [][]byte) (int, error) {
+		if err := c.prepare(&c.writeDeadline, &c.writeTimeout, c.ops.setWriteTimeout); err != nil {
+			return 0, err
+		}
+		if c.ops.writeVectored != nil {
+			return c.ops.writeVectored(c.id, bufs)
+		}
+		return c.ops.write(c.id, bufs[0])
+	})
+	if err != nil {
+		return n, c.opError("write", err)
+	}
+	return n, nil
+}
+
+// Close drops the stream. Clones of the stream stay open.
+func (c *streamConn) Close() error {
+	c.mu.Lock()
+	closed := c.closed
+	c.closed = true
+	c.mu.Unlock()
+	if closed {
+		return c.opError("close", net.ErrClosed)
+	}
+	if err := c.ops.drop(c.id); err != nil {
+		return c.opError("close", err)
+	}
+	return nil
+}
+
+// LocalAddr returns the local address of the connection.
+// lunatic only reports local addresses of listeners, so for accepted
+// connections it is the address of the listener. For dialed connections it
+// is the unspecified address of the peer's IP family with port 0, and for
+// connections made with NewTCPConn or NewTLSConn an empty *net.TCPAddr.
+func (c *streamConn) LocalAddr() net.Addr {
+	if raddr, ok := c.RemoteAddr().(*net.TCPAddr); c.dialed && ok && raddr.IP != nil {
+		if raddr.IP.To4() != nil {
+			return &net.TCPAddr{IP: net.IPv4zero}
+		}
+		return &net.TCPAddr{IP: net.IPv6unspecified}
+	}
+	if c.laddr == nil {
+		return &net.TCPAddr{}
+	}
+	return c.laddr
+}
+
+// RemoteAddr returns the address of the peer.
+func (c *streamConn) RemoteAddr() net.Addr {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.raddr == nil && !c.closed && c.ops.peerAddr != nil {
+		if addr, err := c.ops.peerAddr(c.id); err == nil {
+			c.raddr = addr
+		}
+	}
+	if c.raddr == nil {
+		return &net.TCPAddr{}
+	}
+	return c.raddr
+}
+
+// SetDeadline sets the read and write deadlines of the connection.
+func (c *streamConn) SetDeadline(t time.Time) error {
+	c.mu.Lock()
+	closed := c.closed
+	if !closed {
+		c.readDeadline, c.writeDeadline = t, t
+	}
+	c.mu.Unlock()
+	if closed {
+		return c.opError("set", net.ErrClosed)
+	}
+	return nil
+}
+
+// SetReadDeadline sets the deadline for future Read calls.
+// It is applied as the stream's read timeout before every read.
+func (c *streamConn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	closed := c.closed
+	if !closed {
+		c.readDeadline = t
+	}
+	c.mu.Unlock()
+	if closed {
+		return c.opError("set", net.ErrClosed)
+	}
+	return nil
+}
+
+// SetWriteDeadline sets the deadline for future Write calls.
+// It is applied as the stream's write timeout before every write.
+func (c *streamConn) SetWriteDeadline(t time.Time) error {
+	c.mu.Lock()
+	closed := c.closed
+	if !closed {
+		c.writeDeadline = t
+	}
+	c.mu.Unlock()
+	if closed {
+		return c.opError("set", net.ErrClosed)
+	}
+	return nil
+}
+
+// prepare checks that the connection is open before a read or write and
+// applies `deadline` with applyTimeout.
+func (c *streamConn) prepare(deadline *time.Time, current *uint64, set func(streamID, timeoutMillis uint64) error) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return net.ErrClosed
+	}
+	return c.applyTimeout(*deadline, current, set)
+}
+
+// applyTimeout sets the stream timeout with `set` to the time left until
+// `deadline` if it differs from `current`. c.mu must be held.
+func (c *streamConn) applyTimeout(deadline time.Time, current *uint64, set func(streamID, timeoutMillis uint64) error) error {
+	millis := uint64(math.MaxUint64)
+	if !deadline.IsZero() {
+		d := time.Until(deadline)
+		if d <= 0 {
+			return os.ErrDeadlineExceeded
+		}
+		millis = durationMillis(d)
+	}
+	if millis == *current {
+		return nil
+	}
+	if err := set(c.id, millis); err != nil {
+		return err
+	}
+	*current = millis
+	return nil
+}
+
+func (c *streamConn) opError(op string, err error) error {
+	c.mu.Lock()
+	raddr := c.raddr
+	c.mu.Unlock()
+	return &net.OpError{Op: op, Net: c.ops.network, Source: c.laddr, Addr: raddr, Err: netError(err)}
+}
+
+// TCPListener is a net.Listener over a lunatic TCP listener.
+// Like TCPConn, it can only be used by the process that created it.
+type TCPListener struct {
+	id     uint64
+	addr   net.Addr
+	closed bool
+}
+
+var _ net.Listener = (*TCPListener)(nil)
+
+// Listen binds a TCP listener to the local `address` of the form "host:port".
+// An empty host listens on all IPv4 addresses and a port of 0 lets the OS
+// choose a port, which can be queried with Addr.
+func Listen(address string) (net.Listener, error) {
+	l, err := ListenTCP(address)
+	if err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// ListenTCP is like Listen but returns a *TCPListener.
+func ListenTCP(address string) (*TCPListener, error) {
+	infos, err := lookupAddr("tcp", address, "0.0.0.0", 0)
+	if err != nil {
+		return nil, &net.OpError{Op: "listen", Net: "tcp", Err: err}
+	}
+	info := infos[0]
+
+	id, err := TCPBind(info)
+	if err != nil {
+		return nil, &net.OpError{Op: "listen", Net: "tcp", Addr: info.TCPAddr(), Err: err}
+	}
+	l := &TCPListener{id: id, addr: info.TCPAddr()}
+	if addr, err := TCPLocalAddr(id); err == nil {
+		l.addr = addr
+	}
+	return l, nil
+}
+
+// ListenerID returns the ID of the underlying TCP listener.
+func (l *TCPListener) ListenerID() uint64 { return l.id }
+
+// Accept waits for the next connection to the listener.
+func (l *TCPListener) Accept() (net.Conn, error) {
+	c, err := l.AcceptTCP()
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// AcceptTCP is like Accept but returns a *TCPConn.
+func (l *TCPListener) AcceptTCP() (*TCPConn, error) {
+	if l.closed {
+		return nil, l.opError("accept", net.ErrClosed)
+	}
+	id, raddr, err := TCPAccept(l.id)
+	if err != nil {
+		return nil, l.opError("accept", err)
+	}
+	return &TCPConn{streamConn{id: id, ops: tcpOps, laddr: l.addr, raddr: raddr}}, nil
+}
+
+// Close drops the TCP listener.
+func (l *TCPListener) Close() error {
+	if l.closed {
+		return l.opError("close", net.ErrClosed)
+	}
+	l.closed = true
+	if err := DropTCPListener(l.id); err != nil {
+		return l.opError("close", err)
+	}
+	return nil
+}
+
+// Addr returns the local address of the listener.
+func (l *TCPListener) Addr() net.Addr { return l.addr }
+
+func (l *TCPListener) opError(op string, err error) error {
+	return &net.OpError{Op: op, Net: "tcp", Addr: l.addr, Err: netError(err)}
+}
+
+// netError maps CallTimedOut to os.ErrDeadlineExceeded,
+// so that net.OpError reports it as a timeout.
+func netError(err error) error {
+	if errors.Is(err, CallTimedOut) {
+		return os.ErrDeadlineExceeded
+	}
+	return err
+}
+
+// timeoutMillis returns `timeout` in milliseconds or nil if it is 0.
+func timeoutMillis(timeout time.Duration) *uint64 {
+	if timeout <= 0 {
+		return nil
+	}
+	millis := durationMillis(timeout)
+	return &millis
+}
+
+// durationMillis returns `d` in milliseconds, rounded up so that
+// a positive duration never becomes 0.
+func durationMillis(d time.Duration) uint64 {
+	return uint64((d + time.Millisecond - 1) / time.Millisecond)
+}
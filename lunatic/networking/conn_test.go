@@ -0,0 +1,203 @@
+// -*- compile-command: "go test ./..."; -*-
+
+package networking_test
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	lerror "github.com/gmlewis/go-lunatic/lunatic/error"
+	"github.com/gmlewis/go-lunatic/lunatic/networking"
+)
+
+// pipe returns both ends of a TCP connection over the loopback interface.
+// Since the kernel completes the handshake before Accept is called,
+// both ends can be used from the current process.
+func pipe(t *testing.T) (client, server net.Conn) {
+	t.Helper()
+	l, err := networking.Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	defer l.Close()
+
+	client, err = networking.Dial(l.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	server, err = l.Accept()
+	if err != nil {
+		t.Fatalf("Accept: %v", err)
+	}
+	if got, want := client.RemoteAddr().String(), l.Addr().String(); got != want {
+		t.Errorf("client.RemoteAddr = %v, want %v", got, want)
+	}
+	if got, want := server.LocalAddr().String(), l.Addr().String(); got != want {
+		t.Errorf("server.LocalAddr = %v, want %v", got, want)
+	}
+	if got, want := client.LocalAddr().String(), "0.0.0.0:0"; got != want {
+		t.Errorf("client.LocalAddr = %v, want %v", got, want)
+	}
+	return client, server
+}
+
+func TestConn(t *testing.T) {
+	client, server := pipe(t)
+	defer server.Close()
+
+	w := bufio.NewWriter(client)
+	w.WriteString("hello\nworld\n")
+	if err := w.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	if err := client.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	r := bufio.NewReader(server)
+	if line, err := r.ReadString('\n'); err != nil || line != "hello\n" {
+		t.Errorf("ReadString = %q, %v, want hello", line, err)
+	}
+	if rest, err := io.ReadAll(r); err != nil || string(rest) != "world\n" {
+		t.Errorf("ReadAll = %q, %v, want world", rest, err)
+	}
+
+	if _, err := client.Write([]byte("x")); !errors.Is(err, net.ErrClosed) {
+		t.Errorf("Write after Close = %v, want net.ErrClosed", err)
+	}
+}
+
+func TestDeadline(t *testing.T) {
+	client, server := pipe(t)
+	defer client.Close()
+	defer server.Close()
+
+	buf := make([]byte, 8)
+	server.SetReadDeadline(time.Now().Add(20 * time.Millisecond))
+	_, err := server.Read(buf)
+	var netErr net.Error
+	if !errors.As(err, &netErr) || !netErr.Timeout() || !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("Read = %v, want timeout", err)
+	}
+
+	// A deadline in the past fails without calling the host.
+	server.SetDeadline(time.Now().Add(-time.Second))
+	if _, err := server.Read(buf); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("Read = %v, want os.ErrDeadlineExceeded", err)
+	}
+
+	server.SetReadDeadline(time.Time{})
+	client.Write([]byte("ok"))
+	if n, err := server.Read(buf); err != nil || string(buf[:n]) != "ok" {
+		t.Errorf("Read = %q, %v, want ok", buf[:n], err)
+	}
+}
+
+func TestWriteBuffers(t *testing.T) {
+	client, server := pipe(t)
+	defer server.Close()
+
+	header, body := []byte("header\n"), []byte(strings.Repeat("x", 100000))
+	v := net.Buffers{header, nil, body}
+	c := client.(*networking.TCPConn)
+	if n, err := c.WriteBuffers(&v); err != nil || n != int64(len(header)+len(body)) {
+		t.Fatalf("WriteBuffers = %v, %v, want %v", n, err, len(header)+len(body))
+	}
+	if len(v) != 0 {
+		t.Errorf("WriteBuffers left %v buffers, want 0", len(v))
+	}
+
+	bufs := net.Buffers{[]byte("a"), []byte("bc")}
+	if n, err := networking.WriteBuffers(c.StreamID(), bufs); err != nil || n != 3 {
+		t.Fatalf("networking.WriteBuffers = %v, %v, want 3", n, err)
+	}
+	if len(bufs) != 2 || string(bufs[1]) != "bc" {
+		t.Errorf("networking.WriteBuffers changed bufs to %q", bufs)
+	}
+	client.Close()
+
+	got, err := io.ReadAll(server)
+	if want := string(header) + string(body) + "abc"; err != nil || string(got) != want {
+		t.Errorf("ReadAll = %v bytes, %v, want %v bytes", len(got), err, len(want))
+	}
+}
+
+func TestPeek(t *testing.T) {
+	client, server := pipe(t)
+	defer client.Close()
+	defer server.Close()
+	c := server.(*networking.TCPConn)
+
+	client.Write([]byte("GET / HTTP/1.1\r\nHost: x\r\n"))
+	buf := make([]byte, 3)
+	if n, err := c.Peek(buf); err != nil || string(buf[:n]) != "GET" {
+		t.Fatalf("Peek = %q, %v, want GET", buf[:n], err)
+	}
+
+	line, err := networking.ReadUntil(c.StreamID(), '\n', 64)
+	if err != nil || string(line) != "GET / HTTP/1.1\r\n" {
+		t.Fatalf("ReadUntil = %q, %v, want request line", line, err)
+	}
+	if line, err := networking.ReadUntil(c.StreamID(), '\n', 4); err != networking.ErrTooLong || string(line) != "Host" {
+		t.Errorf("ReadUntil = %q, %v, want Host, ErrTooLong", line, err)
+	}
+	buf = make([]byte, 5)
+	if n, err := networking.ReadFull(c.StreamID(), buf); err != nil || string(buf[:n]) != ": x\r\n" {
+		t.Errorf("ReadFull = %q, %v, want rest of header", buf[:n], err)
+	}
+
+	// Both timeouts are reported as CallTimedOut along with partial data.
+	networking.SetReadTimeout(c.StreamID(), 20)
+	networking.SetPeekTimeout(c.StreamID(), 20)
+	client.Write([]byte("ab"))
+	if n, err := networking.ReadFull(c.StreamID(), buf); err != networking.CallTimedOut || n != 2 {
+		t.Errorf("ReadFull = %v, %v, want 2, CallTimedOut", n, err)
+	}
+	client.Write([]byte("cd"))
+	if line, err := networking.ReadUntil(c.StreamID(), '\n', 64); err != networking.CallTimedOut || string(line) != "cd" {
+		t.Errorf("ReadUntil = %q, %v, want cd, CallTimedOut", line, err)
+	}
+}
+
+func TestListenerClose(t *testing.T) {
+	l, err := networking.Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	addr := l.Addr().String()
+	if err := l.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if _, err := l.Accept(); !errors.Is(err, net.ErrClosed) {
+		t.Errorf("Accept after Close = %v, want net.ErrClosed", err)
+	}
+
+	_, err = networking.Dial(addr)
+	var opErr *net.OpError
+	if !errors.As(err, &opErr) || opErr.Op != "dial" {
+		t.Errorf("Dial to a closed listener = %v, want dial error", err)
+	}
+}
+
+func TestHostError(t *testing.T) {
+	l, err := networking.Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	defer l.Close()
+
+	_, err = networking.Listen(l.Addr().String())
+	var hostErr *lerror.Error
+	if !errors.As(err, &hostErr) {
+		t.Fatalf("Listen on a bound port = %#v, want *error.Error", err)
+	}
+	if hostErr.Op != "networking.tcp_bind" || !strings.Contains(err.Error(), "in use") {
+		t.Errorf("Listen on a bound port = %v, want tcp_bind error", err)
+	}
+}
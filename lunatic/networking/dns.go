@@ -7,6 +7,8 @@ import (
 	"fmt"
 	"math"
 	"unsafe"
+
+	lerror "github.com/gmlewis/go-lunatic/lunatic/error"
 )
 
 var (
@@ -18,10 +20,6 @@ type size = uint32
 
 func mkptr[T any](v *T) ptr { return unsafe.Pointer(v) }
 
-//go:wasmimport lunatic::networking resolve
-//go:noescape
-func resolve(nameStrPtr ptr, nameStrLen size, timeoutDuration uint64, idU64Ptr ptr) uint32
-
 // Resolve performs a DNS resolution. The returned iterator may not actually yield any values
 // depending on the outcome of any resolution performed.
 //
@@ -30,7 +28,8 @@ func resolve(nameStrPtr ptr, nameStrLen size, timeoutDuration uint64, idU64Ptr p
 //
 // Returns:
 // * nil on success with the ID of the newly created DNS iterator.
-// * error with the ID of the error.
+// * CallTimedOut if the call timed out.
+// * *lunatic/error.Error on failure.
 func Resolve(name string, timeoutMillis *uint64) (id uint64, err error) {
 	defer func() {
 		if r := recover(); r != nil {
@@ -49,7 +48,7 @@ func Resolve(name string, timeoutMillis *uint64) (id uint64, err error) {
 	case 0:
 		return id, nil
 	case 1:
-		return id, errors.New("error id")
+		return 0, lerror.New("networking.resolve", id)
 	case 9027:
 		return id, CallTimedOut
 	default:
@@ -57,10 +56,6 @@ func Resolve(name string, timeoutMillis *uint64) (id uint64, err error) {
 	}
 }
 
-//go:wasmimport lunatic::networking drop_dns_iterator
-//go:noescape
-func drop_dns_iterator(dnsIterID uint64)
-
 // DropDNSIterator drops the DNS iterator resource.
 func DropDNSIterator(dnsIterID uint64) (err error) {
 	defer func() {
@@ -73,10 +68,6 @@ func DropDNSIterator(dnsIterID uint64) (err error) {
 	return nil
 }
 
-//go:wasmimport lunatic::networking resolve_next
-//go:noescape
-func resolve_next(dnsIterID uint64, addrTypeU32Ptr, addrU8Ptr, portU16Ptr, flowInfoU32Ptr, scopeIDU32Ptr ptr) uint32
-
 // ResolveNext takes the next socket address from the DNS iterator and returns it.
 // When the iterator is exhausted, (nil, nil) is returned.
 func ResolveNext(dnsIterID uint64) (info *DNSInfo, err error) {
@@ -0,0 +1,617 @@
+// -*- compile-command: "go test ./..."; -*-
+
+//go:build !wasm
+
+package networking
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"math"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+	"unsafe"
+
+	"github.com/gmlewis/go-lunatic/lunatic/internal/fakehost"
+)
+
+// The fake networking functions are backed by the net package of the
+// test binary, so they can talk to real sockets on the loopback interface.
+
+type dnsIterator struct {
+	addrs []net.Addr
+}
+
+func newDNSIterator(addrs ...net.Addr) uint64 {
+	return fakehost.Current().AddResource(&dnsIterator{addrs: addrs})
+}
+
+// tcpStream is a TCP stream resource. Clones share the connection,
+// which is closed when the last clone is dropped.
+type tcpStream struct {
+	*sharedConn
+}
+
+type sharedConn struct {
+	mu       sync.Mutex
+	refs     int
+	conn     net.Conn
+	r        *bufio.Reader
+	timeouts [3]uint64    // read, write, peek
+	peer     *net.UDPAddr // set by udp_connect
+}
+
+func newStream(conn net.Conn) *tcpStream {
+	return &tcpStream{&sharedConn{refs: 1, conn: conn, r: bufio.NewReader(conn),
+		timeouts: [3]uint64{math.MaxUint64, math.MaxUint64, math.MaxUint64}}}
+}
+
+func (s *tcpStream) clone() *tcpStream {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.refs++
+	return &tcpStream{s.sharedConn}
+}
+
+func (s *tcpStream) Close() error {
+	s.mu.Lock()
+	s.refs--
+	last := s.refs == 0
+	s.mu.Unlock()
+	if last {
+		return s.conn.Close()
+	}
+	return nil
+}
+
+type udpSocket struct {
+	*sharedConn
+}
+
+func (s *udpSocket) clone() *udpSocket {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.refs++
+	return &udpSocket{s.sharedConn}
+}
+
+func (s *udpSocket) Close() error {
+	return (&tcpStream{s.sharedConn}).Close()
+}
+
+func (s *udpSocket) udp() *net.UDPConn {
+	return s.conn.(*net.UDPConn)
+}
+
+func (s *udpSocket) connectedTo() *net.UDPAddr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.peer
+}
+
+func writeU64(p ptr, v uint64) { *(*uint64)(p) = v }
+func writeU32(p ptr, v uint32) { *(*uint32)(p) = v }
+
+// fail stores `err` as an error resource and writes its ID to `idPtr`.
+func fail(err error, idPtr ptr) uint32 {
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		return 9027
+	}
+	writeU64(idPtr, fakehost.Current().AddError(err))
+	return 1
+}
+
+func sockaddr(addrType uint32, addrU8Ptr ptr, port, scopeID uint32) (net.IP, int, string) {
+	n := uint32(4)
+	if addrType == 6 {
+		n = 16
+	}
+	ip := net.IP(append([]byte(nil), fakehost.Bytes(addrU8Ptr, n)...))
+	var zone string
+	if scopeID != 0 {
+		if ifi, err := net.InterfaceByIndex(int(scopeID)); err == nil {
+			zone = ifi.Name
+		}
+	}
+	return ip, int(port), zone
+}
+
+func timeout(millis uint64) time.Duration {
+	if d := fakehost.Timeout(millis); d > 0 {
+		return d
+	}
+	return 0
+}
+
+// deadline applies the timeout `millis` to `setDeadline`.
+func deadline(setDeadline func(time.Time) error, millis uint64) {
+	var t time.Time
+	if d := timeout(millis); d > 0 {
+		t = time.Now().Add(d)
+	}
+	setDeadline(t)
+}
+
+func resolve(nameStrPtr ptr, nameStrLen size, timeoutDuration uint64, idU64Ptr ptr) uint32 {
+	host, port, err := net.SplitHostPort(fakehost.String(nameStrPtr, nameStrLen))
+	if err != nil {
+		return fail(err, idU64Ptr)
+	}
+	portNum, err := net.LookupPort("tcp", port)
+	if err != nil {
+		return fail(err, idU64Ptr)
+	}
+	ips, err := net.LookupIP(host)
+	if err != nil {
+		return fail(err, idU64Ptr)
+	}
+	addrs := make([]net.Addr, len(ips))
+	for i, ip := range ips {
+		addrs[i] = &net.TCPAddr{IP: ip, Port: portNum}
+	}
+	writeU64(idU64Ptr, newDNSIterator(addrs...))
+	return 0
+}
+
+func drop_dns_iterator(dnsIterID uint64) {
+	fakehost.TakeResource[*dnsIterator](fakehost.Current(), dnsIterID)
+}
+
+func resolve_next(dnsIterID uint64, addrTypeU32Ptr, addrU8Ptr, portU16Ptr, flowInfoU32Ptr, scopeIDU32Ptr ptr) uint32 {
+	it := fakehost.Resource[*dnsIterator](fakehost.Current(), dnsIterID)
+	if len(it.addrs) == 0 {
+		return 1
+	}
+	addr := it.addrs[0]
+	it.addrs = it.addrs[1:]
+
+	var ip net.IP
+	var port int
+	var zone string
+	switch a := addr.(type) {
+	case *net.TCPAddr:
+		ip, port, zone = a.IP, a.Port, a.Zone
+	case *net.UDPAddr:
+		ip, port, zone = a.IP, a.Port, a.Zone
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		writeU32(addrTypeU32Ptr, 4)
+		copy(fakehost.Bytes(addrU8Ptr, 4), ip4)
+	} else {
+		writeU32(addrTypeU32Ptr, 6)
+		copy(fakehost.Bytes(addrU8Ptr, 16), ip.To16())
+	}
+	*(*uint16)(portU16Ptr) = uint16(port)
+	writeU32(flowInfoU32Ptr, 0)
+	var scopeID uint32
+	if ifi, err := net.InterfaceByName(zone); zone != "" && err == nil {
+		scopeID = uint32(ifi.Index)
+	}
+	writeU32(scopeIDU32Ptr, scopeID)
+	return 0
+}
+
+func tcp_bind(addrType uint32, addrU8Ptr ptr, port, flowInfo, scopeID uint32, idU64Ptr ptr) uint32 {
+	ip, portNum, zone := sockaddr(addrType, addrU8Ptr, port, scopeID)
+	l, err := net.ListenTCP("tcp", &net.TCPAddr{IP: ip, Port: portNum, Zone: zone})
+	if err != nil {
+		return fail(err, idU64Ptr)
+	}
+	writeU64(idU64Ptr, fakehost.Current().AddResource(l))
+	return 0
+}
+
+func drop_tcp_listener(tcpListenerID uint64) {
+	fakehost.TakeResource[*net.TCPListener](fakehost.Current(), tcpListenerID).Close()
+}
+
+func tcp_local_addr(tcpListenerID uint64, idU64Ptr ptr) uint32 {
+	l := fakehost.Resource[*net.TCPListener](fakehost.Current(), tcpListenerID)
+	writeU64(idU64Ptr, newDNSIterator(l.Addr()))
+	return 0
+}
+
+func tcp_accept(listenerID uint64, idU64Ptr ptr, socketAddrIDPtr ptr) uint32 {
+	p := fakehost.Current()
+	l := fakehost.Resource[*net.TCPListener](p, listenerID)
+	conn, err := l.Accept()
+	if err != nil {
+		return fail(err, idU64Ptr)
+	}
+	writeU64(idU64Ptr, p.AddResource(newStream(conn)))
+	writeU64(socketAddrIDPtr, newDNSIterator(conn.RemoteAddr()))
+	return 0
+}
+
+func tcp_connect(addrType uint32, addrU8Ptr ptr, port, flowInfo, scopeID uint32, timeoutDuration uint64, idU64Ptr ptr) uint32 {
+	ip, portNum, zone := sockaddr(addrType, addrU8Ptr, port, scopeID)
+	d := net.Dialer{Timeout: timeout(timeoutDuration)}
+	conn, err := d.Dial("tcp", (&net.TCPAddr{IP: ip, Port: portNum, Zone: zone}).String())
+	if err != nil {
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			return 9027
+		}
+		return fail(err, idU64Ptr)
+	}
+	writeU64(idU64Ptr, fakehost.Current().AddResource(newStream(conn)))
+	return 0
+}
+
+func drop_tcp_stream(tcpStreamID uint64) {
+	fakehost.TakeResource[*tcpStream](fakehost.Current(), tcpStreamID).Close()
+}
+
+func clone_tcp_stream(tcpStreamID uint64) uint64 {
+	p := fakehost.Current()
+	return p.AddResource(fakehost.Resource[*tcpStream](p, tcpStreamID).clone())
+}
+
+// ciovec is the layout of an entry of a ciovec array on this platform.
+type ciovec struct {
+	buf    ptr
+	bufLen uintptr
+}
+
+func newCiovec(b []byte) ciovec {
+	return ciovec{buf: ptr(unsafe.SliceData(b)), bufLen: uintptr(len(b))}
+}
+
+func tcp_write_vectored(streamID uint64, ciovecArrayPtr ptr, ciovecArrayLen size, opaquePtr ptr) uint32 {
+	return tcp(streamID).writeVectored(ciovecArrayPtr, ciovecArrayLen, opaquePtr)
+}
+
+func tcp_read(streamID uint64, bufferPtr ptr, bufferLen size, opaquePtr ptr) uint32 {
+	return tcp(streamID).read(bufferPtr, bufferLen, opaquePtr)
+}
+
+func tcp_peek(streamID uint64, bufferPtr ptr, bufferLen size, opaquePtr ptr) uint32 {
+	return tcp(streamID).peek(bufferPtr, bufferLen, opaquePtr)
+}
+
+func tcp(streamID uint64) *sharedConn {
+	return fakehost.Resource[*tcpStream](fakehost.Current(), streamID).sharedConn
+}
+
+func (s *sharedConn) writeVectored(ciovecArrayPtr ptr, ciovecArrayLen size, opaquePtr ptr) uint32 {
+	var bufs net.Buffers
+	for _, v := range unsafe.Slice((*ciovec)(ciovecArrayPtr), ciovecArrayLen) {
+		bufs = append(bufs, fakehost.Bytes(v.buf, uint32(v.bufLen)))
+	}
+	deadline(s.conn.SetWriteDeadline, s.timeout(1))
+	n, err := bufs.WriteTo(s.conn)
+	if err != nil {
+		return fail(err, opaquePtr)
+	}
+	writeU64(opaquePtr, uint64(n))
+	return 0
+}
+
+func (s *sharedConn) read(bufferPtr ptr, bufferLen size, opaquePtr ptr) uint32 {
+	deadline(s.conn.SetReadDeadline, s.timeout(0))
+	n, err := s.r.Read(fakehost.Bytes(bufferPtr, bufferLen))
+	if err != nil && n == 0 {
+		if errors.Is(err, io.EOF) {
+			writeU64(opaquePtr, 0) // lunatic reports EOF as a 0-byte read.
+			return 0
+		}
+		return fail(err, opaquePtr)
+	}
+	writeU64(opaquePtr, uint64(n))
+	return 0
+}
+
+// peek waits for data like read, but with the peek timeout, and copies
+// the buffered data without consuming it.
+func (s *sharedConn) peek(bufferPtr ptr, bufferLen size, opaquePtr ptr) uint32 {
+	deadline(s.conn.SetReadDeadline, s.timeout(2))
+	if _, err := s.r.Peek(1); err != nil {
+		if errors.Is(err, io.EOF) {
+			writeU64(opaquePtr, 0)
+			return 0
+		}
+		return fail(err, opaquePtr)
+	}
+	buf, _ := s.r.Peek(min(s.r.Buffered(), int(bufferLen)))
+	writeU64(opaquePtr, uint64(copy(fakehost.Bytes(bufferPtr, bufferLen), buf)))
+	return 0
+}
+
+func (s *sharedConn) setTimeout(i int, duration uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.timeouts[i] = duration
+}
+
+func (s *sharedConn) timeout(i int) uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.timeouts[i]
+}
+
+func set_read_timeout(streamID, duration uint64)  { tcp(streamID).setTimeout(0, duration) }
+func get_read_timeout(streamID uint64) uint64     { return tcp(streamID).timeout(0) }
+func set_write_timeout(streamID, duration uint64) { tcp(streamID).setTimeout(1, duration) }
+func get_write_timeout(streamID uint64) uint64    { return tcp(streamID).timeout(1) }
+func set_peek_timeout(streamID, duration uint64)  { tcp(streamID).setTimeout(2, duration) }
+func get_peek_timeout(streamID uint64) uint64     { return tcp(streamID).timeout(2) }
+
+func tcp_flush(streamID uint64, errorIDPtr ptr) uint32 {
+	fakehost.Resource[*tcpStream](fakehost.Current(), streamID)
+	return 0 // writes are not buffered.
+}
+
+func tcp_peer_addr(tcpStreamID uint64, idU64Ptr ptr) uint32 {
+	s := fakehost.Resource[*tcpStream](fakehost.Current(), tcpStreamID)
+	writeU64(idU64Ptr, newDNSIterator(s.conn.RemoteAddr()))
+	return 0
+}
+
+func udp_bind(addrType uint32, addrU8Ptr ptr, port, flowInfo, scopeID uint32, idU64Ptr ptr) uint32 {
+	ip, portNum, zone := sockaddr(addrType, addrU8Ptr, port, scopeID)
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: ip, Port: portNum, Zone: zone})
+	if err != nil {
+		return fail(err, idU64Ptr)
+	}
+	writeU64(idU64Ptr, fakehost.Current().AddResource(&udpSocket{newStream(conn).sharedConn}))
+	return 0
+}
+
+func drop_udp_socket(udpSocketID uint64) {
+	fakehost.TakeResource[*udpSocket](fakehost.Current(), udpSocketID).Close()
+}
+
+func udp_local_addr(udpSocketID uint64, idU64Ptr ptr) uint32 {
+	s := fakehost.Resource[*udpSocket](fakehost.Current(), udpSocketID)
+	writeU64(idU64Ptr, newDNSIterator(s.conn.LocalAddr()))
+	return 0
+}
+
+// receiveFrom reads the next datagram, skipping datagrams that are not
+// from the peer of a connected socket.
+func (s *udpSocket) receiveFrom(b []byte) (int, *net.UDPAddr, error) {
+	deadline(s.conn.SetReadDeadline, s.timeout(0))
+	peer := s.connectedTo()
+	for {
+		n, addr, err := s.udp().ReadFromUDP(b)
+		if err != nil || peer == nil || (addr.IP.Equal(peer.IP) && addr.Port == peer.Port) {
+			return n, addr, err
+		}
+	}
+}
+
+func udp_receive(socketID uint64, bufferPtr ptr, bufferLen size, opaquePtr ptr) uint32 {
+	s := fakehost.Resource[*udpSocket](fakehost.Current(), socketID)
+	if s.connectedTo() == nil {
+		return fail(errors.New("not connected"), opaquePtr)
+	}
+	n, _, err := s.receiveFrom(fakehost.Bytes(bufferPtr, bufferLen))
+	if err != nil {
+		return fail(err, opaquePtr)
+	}
+	writeU64(opaquePtr, uint64(n))
+	return 0
+}
+
+func udp_receive_from(socketID uint64, bufferPtr ptr, bufferLen size, opaquePtr, dnsIterPtr ptr) uint32 {
+	s := fakehost.Resource[*udpSocket](fakehost.Current(), socketID)
+	n, addr, err := s.receiveFrom(fakehost.Bytes(bufferPtr, bufferLen))
+	if err != nil {
+		return fail(err, opaquePtr)
+	}
+	writeU64(opaquePtr, uint64(n))
+	writeU64(dnsIterPtr, newDNSIterator(addr))
+	return 0
+}
+
+// udp_connect only records the peer, since the socket of the net package
+// can't be connected after it was bound.
+func udp_connect(udpSocketID uint64, addrType uint32, addrU8Ptr ptr, port, flowInfo, scopeID uint32, timeoutDuration uint64, idU64Ptr ptr) uint32 {
+	s := fakehost.Resource[*udpSocket](fakehost.Current(), udpSocketID)
+	ip, portNum, zone := sockaddr(addrType, addrU8Ptr, port, scopeID)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.peer = &net.UDPAddr{IP: ip, Port: portNum, Zone: zone}
+	return 0
+}
+
+func clone_udp_socket(udpSocketID uint64) uint64 {
+	p := fakehost.Current()
+	return p.AddResource(fakehost.Resource[*udpSocket](p, udpSocketID).clone())
+}
+
+// The fake host only records the broadcast flag and TTL.
+var (
+	udpOptionsMu sync.Mutex
+	udpOptions   = map[*sharedConn][2]uint32{} // broadcast, TTL
+)
+
+func udpOption(udpSocketID uint64, i int, set func(*[2]uint32)) uint32 {
+	s := fakehost.Resource[*udpSocket](fakehost.Current(), udpSocketID)
+	udpOptionsMu.Lock()
+	defer udpOptionsMu.Unlock()
+	opts, ok := udpOptions[s.sharedConn]
+	if !ok {
+		opts[1] = 64
+	}
+	if set != nil {
+		set(&opts)
+		udpOptions[s.sharedConn] = opts
+	}
+	return opts[i]
+}
+
+func set_udp_socket_broadcast(udpSocketID uint64, broadcast uint32) {
+	udpOption(udpSocketID, 0, func(o *[2]uint32) { o[0] = broadcast })
+}
+
+func get_udp_socket_broadcast(udpSocketID uint64) int32 {
+	return int32(udpOption(udpSocketID, 0, nil))
+}
+
+func set_udp_socket_ttl(udpSocketID uint64, ttl uint32) {
+	udpOption(udpSocketID, 1, func(o *[2]uint32) { o[1] = ttl })
+}
+
+func get_udp_socket_ttl(udpSocketID uint64) uint32 {
+	return udpOption(udpSocketID, 1, nil)
+}
+
+func udp_send_to(socketID uint64, bufferPtr ptr, bufferLen size, addrType uint32, addrU8Ptr ptr, port, flowInfo, scopeID uint32, opaquePtr ptr) uint32 {
+	s := fakehost.Resource[*udpSocket](fakehost.Current(), socketID)
+	ip, portNum, zone := sockaddr(addrType, addrU8Ptr, port, scopeID)
+	deadline(s.conn.SetWriteDeadline, s.timeout(1))
+	n, err := s.udp().WriteToUDP(fakehost.Bytes(bufferPtr, bufferLen), &net.UDPAddr{IP: ip, Port: portNum, Zone: zone})
+	if err != nil {
+		return fail(err, opaquePtr)
+	}
+	writeU64(opaquePtr, uint64(n))
+	return 0
+}
+
+func udp_send(socketID uint64, bufferPtr ptr, bufferLen size, opaquePtr ptr) uint32 {
+	s := fakehost.Resource[*udpSocket](fakehost.Current(), socketID)
+	peer := s.connectedTo()
+	if peer == nil {
+		return fail(errors.New("not connected"), opaquePtr)
+	}
+	deadline(s.conn.SetWriteDeadline, s.timeout(1))
+	n, err := s.udp().WriteToUDP(fakehost.Bytes(bufferPtr, bufferLen), peer)
+	if err != nil {
+		return fail(err, opaquePtr)
+	}
+	writeU64(opaquePtr, uint64(n))
+	return 0
+}
+
+func udp_peer_addr(udpStreamID uint64, idU64Ptr ptr) uint32 {
+	s := fakehost.Resource[*udpSocket](fakehost.Current(), udpStreamID)
+	peer := s.connectedTo()
+	if peer == nil {
+		return 1 // not connected
+	}
+	writeU64(idU64Ptr, newDNSIterator(peer))
+	return 0
+}
+
+// tlsListener is a TLS listener resource.
+type tlsListener struct {
+	net.Listener
+}
+
+// tlsStream is a TLS stream resource. Like tcpStream, clones share the connection.
+type tlsStream struct {
+	*sharedConn
+}
+
+func (s *tlsStream) clone() *tlsStream {
+	return &tlsStream{(&tcpStream{s.sharedConn}).clone().sharedConn}
+}
+
+func (s *tlsStream) Close() error {
+	return (&tcpStream{s.sharedConn}).Close()
+}
+
+func tlsConn(tlsStreamID uint64) *sharedConn {
+	return fakehost.Resource[*tlsStream](fakehost.Current(), tlsStreamID).sharedConn
+}
+
+func tls_bind(addrType uint32, addrU8Ptr ptr, port, flowInfo, scopeID uint32, idU64Ptr, certsArrayPtr ptr, certsArrayLen size, keysArrayPtr ptr, keysArrayLen size) uint32 {
+	cert, err := tls.X509KeyPair(fakehost.Bytes(certsArrayPtr, certsArrayLen), fakehost.Bytes(keysArrayPtr, keysArrayLen))
+	if err != nil {
+		return fail(err, idU64Ptr)
+	}
+	ip, portNum, zone := sockaddr(addrType, addrU8Ptr, port, scopeID)
+	l, err := net.ListenTCP("tcp", &net.TCPAddr{IP: ip, Port: portNum, Zone: zone})
+	if err != nil {
+		return fail(err, idU64Ptr)
+	}
+	tl := &tlsListener{tls.NewListener(l, &tls.Config{Certificates: []tls.Certificate{cert}})}
+	writeU64(idU64Ptr, fakehost.Current().AddResource(tl))
+	return 0
+}
+
+func drop_tls_listener(tlsListenerID uint64) {
+	fakehost.TakeResource[*tlsListener](fakehost.Current(), tlsListenerID).Close()
+}
+
+func tls_local_addr(tlsListenerID uint64, idU64Ptr ptr) uint32 {
+	l := fakehost.Resource[*tlsListener](fakehost.Current(), tlsListenerID)
+	writeU64(idU64Ptr, newDNSIterator(l.Addr()))
+	return 0
+}
+
+func tls_accept(listenerID uint64, idU64Ptr ptr, socketAddrIDPtr ptr) uint32 {
+	p := fakehost.Current()
+	l := fakehost.Resource[*tlsListener](p, listenerID)
+	conn, err := l.Accept()
+	if err != nil {
+		return fail(err, idU64Ptr)
+	}
+	if err := conn.(*tls.Conn).Handshake(); err != nil {
+		conn.Close()
+		return fail(err, idU64Ptr)
+	}
+	writeU64(idU64Ptr, p.AddResource(&tlsStream{newStream(conn).sharedConn}))
+	writeU64(socketAddrIDPtr, newDNSIterator(conn.RemoteAddr()))
+	return 0
+}
+
+func tls_connect(addrStrPtr ptr, addrStrLen size, port uint32, timeoutDuration uint64, idU64Ptr, certsArrayPtr ptr, certsArrayLen size) uint32 {
+	host := string(fakehost.Bytes(addrStrPtr, addrStrLen))
+	config := &tls.Config{ServerName: host}
+	if certsArrayLen > 0 {
+		roots, err := x509.SystemCertPool()
+		if err != nil {
+			roots = x509.NewCertPool()
+		}
+		if !roots.AppendCertsFromPEM(fakehost.Bytes(certsArrayPtr, certsArrayLen)) {
+			return fail(errors.New("no valid certificates"), idU64Ptr)
+		}
+		config.RootCAs = roots
+	}
+	d := &net.Dialer{Timeout: timeout(timeoutDuration)}
+	conn, err := tls.DialWithDialer(d, "tcp", net.JoinHostPort(host, strconv.Itoa(int(port))), config)
+	if err != nil {
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			return 9027
+		}
+		return fail(err, idU64Ptr)
+	}
+	writeU64(idU64Ptr, fakehost.Current().AddResource(&tlsStream{newStream(conn).sharedConn}))
+	return 0
+}
+
+func drop_tls_stream(tlsStreamID uint64) {
+	fakehost.TakeResource[*tlsStream](fakehost.Current(), tlsStreamID).Close()
+}
+
+func clone_tls_stream(tlsStreamID uint64) uint64 {
+	p := fakehost.Current()
+	return p.AddResource(fakehost.Resource[*tlsStream](p, tlsStreamID).clone())
+}
+
+func tls_write_vectored(tlsStreamID uint64, ciovecArrayPtr ptr, ciovecArrayLen size, opaquePtr ptr) uint32 {
+	return tlsConn(tlsStreamID).writeVectored(ciovecArrayPtr, ciovecArrayLen, opaquePtr)
+}
+
+func tls_read(tlsStreamID uint64, bufferPtr ptr, bufferLen size, opaquePtr ptr) uint32 {
+	return tlsConn(tlsStreamID).read(bufferPtr, bufferLen, opaquePtr)
+}
+
+func tls_flush(tlsStreamID uint64, errorIDPtr ptr) uint32 {
+	tlsConn(tlsStreamID)
+	return 0 // writes are not buffered.
+}
+
+func set_tls_read_timeout(streamID, duration uint64)  { tlsConn(streamID).setTimeout(0, duration) }
+func get_tls_read_timeout(streamID uint64) uint64     { return tlsConn(streamID).timeout(0) }
+func set_tls_write_timeout(streamID, duration uint64) { tlsConn(streamID).setTimeout(1, duration) }
+func get_tls_write_timeout(streamID uint64) uint64    { return tlsConn(streamID).timeout(1) }
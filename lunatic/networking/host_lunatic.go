@@ -0,0 +1,213 @@
+// -*- compile-command: "GOOS=wasip1 GOARCH=wasm go test ./..."; -*-
+
+//go:build wasm
+
+package networking
+
+import "unsafe"
+
+// ciovec is the layout of an entry of a ciovec array in the 32-bit guest memory.
+type ciovec struct {
+	buf    uint32
+	bufLen uint32
+}
+
+func newCiovec(b []byte) ciovec {
+	return ciovec{buf: uint32(uintptr(unsafe.Pointer(unsafe.SliceData(b)))), bufLen: uint32(len(b))}
+}
+
+//go:wasmimport lunatic::networking resolve
+//go:noescape
+func resolve(nameStrPtr ptr, nameStrLen size, timeoutDuration uint64, idU64Ptr ptr) uint32
+
+//go:wasmimport lunatic::networking drop_dns_iterator
+//go:noescape
+func drop_dns_iterator(dnsIterID uint64)
+
+//go:wasmimport lunatic::networking resolve_next
+//go:noescape
+func resolve_next(dnsIterID uint64, addrTypeU32Ptr, addrU8Ptr, portU16Ptr, flowInfoU32Ptr, scopeIDU32Ptr ptr) uint32
+
+//go:wasmimport lunatic::networking tcp_bind
+//go:noescape
+func tcp_bind(addrType uint32, addrU8Ptr ptr, port, flowInfo, scopeID uint32, idU64Ptr ptr) uint32
+
+//go:wasmimport lunatic::networking drop_tcp_listener
+//go:noescape
+func drop_tcp_listener(tcpListenerID uint64)
+
+//go:wasmimport lunatic::networking tcp_local_addr
+//go:noescape
+func tcp_local_addr(tcpListenerID uint64, idU64Ptr ptr) uint32
+
+//go:wasmimport lunatic::networking tcp_accept
+//go:noescape
+func tcp_accept(listenerID uint64, idU64Ptr ptr, socketAddrIDPtr ptr) uint32
+
+//go:wasmimport lunatic::networking tcp_connect
+//go:noescape
+func tcp_connect(addrType uint32, addrU8Ptr ptr, port, flowInfo, scopeID uint32, timeoutDuration uint64, idU64Ptr ptr) uint32
+
+//go:wasmimport lunatic::networking drop_tcp_stream
+//go:noescape
+func drop_tcp_stream(tcpStreamID uint64)
+
+//go:wasmimport lunatic::networking clone_tcp_stream
+//go:noescape
+func clone_tcp_stream(tcpStreamID uint64) uint64
+
+//go:wasmimport lunatic::networking tcp_write_vectored
+//go:noescape
+func tcp_write_vectored(streamID uint64, ciovecArrayPtr ptr, ciovecArrayLen size, opaquePtr ptr) uint32
+
+//go:wasmimport lunatic::networking tcp_read
+//go:noescape
+func tcp_read(streamID uint64, bufferPtr ptr, bufferLen size, opaquePtr ptr) uint32
+
+//go:wasmimport lunatic::networking tcp_peek
+//go:noescape
+func tcp_peek(streamID uint64, bufferPtr ptr, bufferLen size, opaquePtr ptr) uint32
+
+//go:wasmimport lunatic::networking set_read_timeout
+//go:noescape
+func set_read_timeout(streamID, duration uint64)
+
+//go:wasmimport lunatic::networking get_read_timeout
+//go:noescape
+func get_read_timeout(streamID uint64) uint64
+
+//go:wasmimport lunatic::networking set_write_timeout
+//go:noescape
+func set_write_timeout(streamID, duration uint64)
+
+//go:wasmimport lunatic::networking get_write_timeout
+//go:noescape
+func get_write_timeout(streamID uint64) uint64
+
+//go:wasmimport lunatic::networking set_peek_timeout
+//go:noescape
+func set_peek_timeout(streamID, duration uint64)
+
+//go:wasmimport lunatic::networking get_peek_timeout
+//go:noescape
+func get_peek_timeout(streamID uint64) uint64
+
+//go:wasmimport lunatic::networking tcp_flush
+//go:noescape
+func tcp_flush(streamID uint64, errorIDPtr ptr) uint32
+
+//go:wasmimport lunatic::networking tcp_peer_addr
+//go:noescape
+func tcp_peer_addr(tcpStreamID uint64, idU64Ptr ptr) uint32
+
+//go:wasmimport lunatic::networking udp_bind
+//go:noescape
+func udp_bind(addrType uint32, addrU8Ptr ptr, port, flowInfo, scopeID uint32, idU64Ptr ptr) uint32
+
+//go:wasmimport lunatic::networking drop_udp_socket
+//go:noescape
+func drop_udp_socket(udpSocketID uint64)
+
+//go:wasmimport lunatic::networking udp_local_addr
+//go:noescape
+func udp_local_addr(udpSocketID uint64, idU64Ptr ptr) uint32
+
+//go:wasmimport lunatic::networking udp_receive
+//go:noescape
+func udp_receive(socketID uint64, bufferPtr ptr, bufferLen size, opaquePtr ptr) uint32
+
+//go:wasmimport lunatic::networking udp_receive_from
+//go:noescape
+func udp_receive_from(socketID uint64, bufferPtr ptr, bufferLen size, opaquePtr, dnsIterPtr ptr) uint32
+
+//go:wasmimport lunatic::networking udp_connect
+//go:noescape
+func udp_connect(udpSocketID uint64, addrType uint32, addrU8Ptr ptr, port, flowInfo, scopeID uint32, timeoutDuration uint64, idU64Ptr ptr) uint32
+
+//go:wasmimport lunatic::networking clone_udp_socket
+//go:noescape
+func clone_udp_socket(udpSocketID uint64) uint64
+
+//go:wasmimport lunatic::networking set_udp_socket_broadcast
+//go:noescape
+func set_udp_socket_broadcast(udpSocketID uint64, broadcast uint32)
+
+//go:wasmimport lunatic::networking get_udp_socket_broadcast
+//go:noescape
+func get_udp_socket_broadcast(udpSocketID uint64) int32
+
+//go:wasmimport lunatic::networking set_udp_socket_ttl
+//go:noescape
+func set_udp_socket_ttl(udpSocketID uint64, ttl uint32)
+
+//go:wasmimport lunatic::networking get_udp_socket_ttl
+//go:noescape
+func get_udp_socket_ttl(udpSocketID uint64) uint32
+
+//go:wasmimport lunatic::networking udp_send_to
+//go:noescape
+func udp_send_to(socketID uint64, bufferPtr ptr, bufferLen size, addrType uint32, addrU8Ptr ptr, port, flowInfo, scopeID uint32, opaquePtr ptr) uint32
+
+//go:wasmimport lunatic::networking udp_send
+//go:noescape
+func udp_send(socketID uint64, bufferPtr ptr, bufferLen size, opaquePtr ptr) uint32
+
+//go:wasmimport lunatic::networking udp_peer_addr
+//go:noescape
+func udp_peer_addr(udpStreamID uint64, idU64Ptr ptr) uint32
+
+//go:wasmimport lunatic::networking tls_bind
+//go:noescape
+func tls_bind(addrType uint32, addrU8Ptr ptr, port, flowInfo, scopeID uint32, idU64Ptr, certsArrayPtr ptr, certsArrayLen size, keysArrayPtr ptr, keysArrayLen size) uint32
+
+//go:wasmimport lunatic::networking drop_tls_listener
+//go:noescape
+func drop_tls_listener(tlsListenerID uint64)
+
+//go:wasmimport lunatic::networking tls_local_addr
+//go:noescape
+func tls_local_addr(tlsListenerID uint64, idU64Ptr ptr) uint32
+
+//go:wasmimport lunatic::networking tls_accept
+//go:noescape
+func tls_accept(listenerID uint64, idU64Ptr ptr, socketAddrIDPtr ptr) uint32
+
+//go:wasmimport lunatic::networking tls_connect
+//go:noescape
+func tls_connect(addrStrPtr ptr, addrStrLen size, port uint32, timeoutDuration uint64, idU64Ptr, certsArrayPtr ptr, certsArrayLen size) uint32
+
+//go:wasmimport lunatic::networking drop_tls_stream
+//go:noescape
+func drop_tls_stream(tlsStreamID uint64)
+
+//go:wasmimport lunatic::networking clone_tls_stream
+//go:noescape
+func clone_tls_stream(tlsStreamID uint64) uint64
+
+//go:wasmimport lunatic::networking tls_write_vectored
+//go:noescape
+func tls_write_vectored(tlsStreamID uint64, ciovecArrayPtr ptr, ciovecArrayLen size, opaquePtr ptr) uint32
+
+//go:wasmimport lunatic::networking tls_read
+//go:noescape
+func tls_read(tlsStreamID uint64, bufferPtr ptr, bufferLen size, opaquePtr ptr) uint32
+
+//go:wasmimport lunatic::networking tls_flush
+//go:noescape
+func tls_flush(tlsStreamID uint64, errorIDPtr ptr) uint32
+
+//go:wasmimport lunatic::networking set_tls_read_timeout
+//go:noescape
+func set_tls_read_timeout(tlsStreamID, duration uint64)
+
+//go:wasmimport lunatic::networking get_tls_read_timeout
+//go:noescape
+func get_tls_read_timeout(tlsStreamID uint64) uint64
+
+//go:wasmimport lunatic::networking set_tls_write_timeout
+//go:noescape
+func set_tls_write_timeout(tlsStreamID, duration uint64)
+
+//go:wasmimport lunatic::networking get_tls_write_timeout
+//go:noescape
+func get_tls_write_timeout(tlsStreamID uint64) uint64
@@ -3,7 +3,10 @@
 // Package networking provides the Go bindings to the lunatic::networking API.
 package networking
 
-import "net"
+import (
+	"net"
+	"strconv"
+)
 
 // DNSInfo represents v4 or v6 DNS address info.
 type DNSInfo struct {
@@ -14,3 +17,44 @@ type DNSInfo struct {
 	FlowInfo uint32
 	ScopeID  uint32
 }
+
+func newDNSInfo(ip net.IP, port int, zone string) DNSInfo {
+	info := DNSInfo{AddrType: 4, IP: ip.To4(), Port: uint32(port)}
+	if info.IP == nil {
+		info.AddrType, info.IP = 6, ip.To16()
+		if scopeID, err := strconv.ParseUint(zone, 10, 32); err == nil {
+			info.ScopeID = uint32(scopeID)
+		} else if ifi, err := net.InterfaceByName(zone); zone != "" && err == nil {
+			info.ScopeID = uint32(ifi.Index)
+		}
+	}
+	return info
+}
+
+func (d DNSInfo) ip() net.IP {
+	switch {
+	case len(d.IP) == 0:
+		return nil
+	case d.AddrType == 6:
+		return append(net.IP(nil), d.IP[:16]...)
+	default:
+		return net.IPv4(d.IP[0], d.IP[1], d.IP[2], d.IP[3])
+	}
+}
+
+func (d DNSInfo) zone() string {
+	if d.ScopeID == 0 {
+		return ""
+	}
+	return strconv.FormatUint(uint64(d.ScopeID), 10)
+}
+
+// TCPAddr returns the address as a *net.TCPAddr.
+func (d DNSInfo) TCPAddr() *net.TCPAddr {
+	return &net.TCPAddr{IP: d.ip(), Port: int(d.Port), Zone: d.zone()}
+}
+
+// UDPAddr returns the address as a *net.UDPAddr.
+func (d DNSInfo) UDPAddr() *net.UDPAddr {
+	return &net.UDPAddr{IP: d.ip(), Port: int(d.Port), Zone: d.zone()}
+}
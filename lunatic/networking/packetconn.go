@@ -0,0 +1,464 @@
+// -*- compile-command: "GOOS=wasip1 GOARCH=wasm go test ./..."; -*-
+
+package networking
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	"github.com/gmlewis/go-lunatic/lunatic"
+	"github.com/gmlewis/go-lunatic/lunatic/message"
+	"github.com/gmlewis/go-lunatic/lunatic/process"
+)
+
+// Tags of the messages exchanged with the reader process of a UDPConn.
+const (
+	udpReaderInitTag int64 = 0x5544_0001
+	udpReadTag       int64 = 0x5544_0002
+	udpReaderLinkTag int64 = 0x5544_0003
+)
+
+// UDPConn is a net.PacketConn over a lunatic UDP socket. If the socket
+// is connected, it also implements net.Conn like *net.UDPConn does.
+//
+// Like TCPConn, the socket belongs to the process that created it.
+// Use `message.PushUDPSocket` with SocketID to hand it over to another
+// process, which can then wrap it with NewUDPConn.
+//
+// lunatic has no timeouts for UDP sockets. Once a read deadline was set,
+// reads are therefore done by a reader process with a clone of the socket,
+// which sends the datagrams back as messages, so that a read stops waiting
+// at the deadline. A datagram that arrives after a read timed out is
+// returned by the next read. Close kills the reader process, so a UDPConn
+// with a read deadline must be closed. Sends don't wait for the peer, so
+// write deadlines only make writes fail once they have passed.
+type UDPConn struct {
+	id     uint64
+	laddr  net.Addr
+	raddr  net.Addr
+	closed bool
+
+	readDeadline  time.Time
+	writeDeadline time.Time
+
+	// reader is the ID of the reader process or 0 if none was started.
+	reader uint64
+	// readerTag is the tag of the datagrams sent by the reader process.
+	readerTag int64
+	// reading is set while the reader process waits for a datagram.
+	reading bool
+}
+
+var (
+	_ net.PacketConn = (*UDPConn)(nil)
+	_ net.Conn       = (*UDPConn)(nil)
+)
+
+// NewUDPConn returns a UDPConn for the UDP socket with `socketID`,
+// e.g. a socket received with `message.TakeUDPSocket`.
+// The UDPConn takes ownership of the socket and drops it on Close.
+func NewUDPConn(socketID uint64) *UDPConn {
+	return &UDPConn{id: socketID}
+}
+
+// ListenPacket binds a UDP socket to the local `address` of the form "host:port".
+// An empty host listens on all IPv4 addresses and a port of 0 lets the OS
+// choose a port, which can be queried with LocalAddr.
+func ListenPacket(address string) (net.PacketConn, error) {
+	c, err := ListenUDP(address)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// ListenUDP is like ListenPacket but returns a *UDPConn.
+func ListenUDP(address string) (*UDPConn, error) {
+	infos, err := lookupAddr("udp", address, "0.0.0.0", 0)
+	if err != nil {
+		return nil, &net.OpError{Op: "listen", Net: "udp", Err: err}
+	}
+	return bindUDP(infos[0])
+}
+
+// DialUDP binds a UDP socket to an OS-assigned port and connects it to
+// the remote `address` of the form "host:port".
+func DialUDP(address string) (*UDPConn, error) {
+	infos, err := lookupAddr("udp", address, "127.0.0.1", 0)
+	if err != nil {
+		return nil, &net.OpError{Op: "dial", Net: "udp", Err: err}
+	}
+	info := infos[0]
+
+	local := newDNSInfo(net.IPv4zero, 0, "")
+	if info.AddrType == 6 {
+		local = newDNSInfo(net.IPv6unspecified, 0, "")
+	}
+	c, err := bindUDP(local)
+	if err != nil {
+		return nil, err
+	}
+	if err := UDPConnect(c.id, info, nil); err != nil {
+		c.Close()
+		return nil, &net.OpError{Op: "dial", Net: "udp", Addr: info.UDPAddr(), Err: netError(err)}
+	}
+	c.raddr = info.UDPAddr()
+	return c, nil
+}
+
+func bindUDP(info DNSInfo) (*UDPConn, error) {
+	id, err := UDPBind(info)
+	if err != nil {
+		return nil, &net.OpError{Op: "listen", Net: "udp", Addr: info.UDPAddr(), Err: err}
+	}
+	return &UDPConn{id: id}, nil
+}
+
+// SocketID returns the ID of the underlying UDP socket.
+func (c *UDPConn) SocketID() uint64 { return c.id }
+
+// ReadFrom reads a datagram into `b` and returns its size and sender.
+// If `b` is too small, the rest of the datagram is discarded.
+func (c *UDPConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	if err := c.check("read", c.readDeadline); err != nil {
+		return 0, nil, err
+	}
+	if len(b) == 0 {
+		return 0, nil, nil
+	}
+
+	var n int
+	var addr net.Addr
+	var err error
+	if c.useReader() {
+		n, addr, err = c.receive(b)
+	} else {
+		n, addr, err = UDPReceiveFrom(c.id, b)
+	}
+	if err != nil {
+		return 0, nil, c.opError("read", nil, err)
+	}
+	return n, addr, nil
+}
+
+// WriteTo sends `b` as a datagram to `addr`.
+func (c *UDPConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	if err := c.check("write", c.writeDeadline); err != nil {
+		return 0, err
+	}
+	info, err := addrDNSInfo(addr)
+	if err != nil {
+		return 0, c.opError("write", addr, err)
+	}
+
+	n, err := UDPSendTo(c.id, b, info)
+	if err != nil {
+		return 0, c.opError("write", addr, err)
+	}
+	return n, nil
+}
+
+// Read reads a datagram from the peer of a connected socket.
+func (c *UDPConn) Read(b []byte) (int, error) {
+	if err := c.check("read", c.readDeadline); err != nil {
+		return 0, err
+	}
+	if len(b) == 0 {
+		return 0, nil
+	}
+
+	var n int
+	var err error
+	if c.useReader() {
+		n, _, err = c.receive(b)
+	} else {
+		n, err = UDPReceive(c.id, b)
+	}
+	if err != nil {
+		return 0, c.opError("read", nil, err)
+	}
+	return n, nil
+}
+
+// Write sends `b` as a datagram to the peer of a connected socket.
+func (c *UDPConn) Write(b []byte) (int, error) {
+	if err := c.check("write", c.writeDeadline); err != nil {
+		return 0, err
+	}
+
+	n, err := UDPSend(c.id, b)
+	if err != nil {
+		return 0, c.opError("write", nil, err)
+	}
+	return n, nil
+}
+
+// Close drops the UDP socket. Clones of the socket stay open.
+func (c *UDPConn) Close() error {
+	if c.closed {
+		return c.opError("close", nil, net.ErrClosed)
+	}
+	c.closed = true
+	if c.reader != 0 {
+		// Unlink the reader process first, so that killing it doesn't
+		// kill the current process.
+		process.Unlink(c.reader)
+		process.Kill(c.reader)
+		c.reader = 0
+	}
+	if err := DropUDPSocket(c.id); err != nil {
+		return c.opError("close", nil, err)
+	}
+	return nil
+}
+
+// LocalAddr returns the local address of the socket or an empty
+// *net.UDPAddr if it can't be queried.
+func (c *UDPConn) LocalAddr() net.Addr {
+	if c.laddr == nil && !c.closed {
+		if addr, err := UDPLocalAddr(c.id); err == nil {
+			c.laddr = addr
+		}
+	}
+	if c.laddr == nil {
+		return &net.UDPAddr{}
+	}
+	return c.laddr
+}
+
+// RemoteAddr returns the address of the peer of a connected socket
+// or an empty *net.UDPAddr if the socket is not connected.
+func (c *UDPConn) RemoteAddr() net.Addr {
+	if c.raddr == nil && !c.closed {
+		if addr, err := UDPPeerAddr(c.id); err == nil {
+			c.raddr = addr
+		}
+	}
+	if c.raddr == nil {
+		return &net.UDPAddr{}
+	}
+	return c.raddr
+}
+
+// SetDeadline sets the read and write deadlines of the socket.
+func (c *UDPConn) SetDeadline(t time.Time) error {
+	if c.closed {
+		return c.opError("set", nil, net.ErrClosed)
+	}
+	c.readDeadline, c.writeDeadline = t, t
+	return nil
+}
+
+// SetReadDeadline sets the deadline for future Read and ReadFrom calls.
+func (c *UDPConn) SetReadDeadline(t time.Time) error {
+	if c.closed {
+		return c.opError("set", nil, net.ErrClosed)
+	}
+	c.readDeadline = t
+	return nil
+}
+
+// SetWriteDeadline sets the deadline for future Write and WriteTo calls.
+func (c *UDPConn) SetWriteDeadline(t time.Time) error {
+	if c.closed {
+		return c.opError("set", nil, net.ErrClosed)
+	}
+	c.writeDeadline = t
+	return nil
+}
+
+// SetBroadcast sets the SO_BROADCAST option of the socket.
+func (c *UDPConn) SetBroadcast(on bool) error {
+	var broadcast uint32
+	if on {
+		broadcast = 1
+	}
+	if err := SetUDPSocketBroadcast(c.id, broadcast); err != nil {
+		return c.opError("set", nil, err)
+	}
+	return nil
+}
+
+// Broadcast reports whether the SO_BROADCAST option of the socket is set.
+func (c *UDPConn) Broadcast() (bool, error) {
+	broadcast, err := GetUDPSocketBroadcast(c.id)
+	if err != nil {
+		return false, c.opError("get", nil, err)
+	}
+	return broadcast != 0, nil
+}
+
+// SetTTL sets the time-to-live of the packets sent from the socket.
+func (c *UDPConn) SetTTL(ttl int) error {
+	if err := SetUDPSocketTTL(c.id, uint32(ttl)); err != nil {
+		return c.opError("set", nil, err)
+	}
+	return nil
+}
+
+// TTL returns the time-to-live of the packets sent from the socket.
+func (c *UDPConn) TTL() (int, error) {
+	ttl, err := GetUDPSocketTTL(c.id)
+	if err != nil {
+		return 0, c.opError("get", nil, err)
+	}
+	return int(ttl), nil
+}
+
+// udpReaderInit hands the clone of a socket to its reader process.
+type udpReaderInit struct {
+	Socket message.UDPSocket
+	// Owner is the ID of the process that the datagrams are sent to,
+	// tagged with Tag.
+	Owner uint64
+	Tag   int64
+}
+
+// udpDatagram is a datagram received by a reader process.
+type udpDatagram struct {
+	Data []byte
+	IP   []byte
+	Port int
+	Zone string
+	// Err is the message of the error of the read, if any.
+	Err string
+}
+
+// maxDatagramSize is the size of the largest UDP datagram.
+const maxDatagramSize = 65535
+
+// udpReader is the entry point of the reader process of a UDPConn. For every
+// udpReadTag message, it reads a datagram and sends it to the owner. The
+// datagram is read into a buffer for the largest datagram, since a read that
+// timed out is answered by a later one, maybe with a larger buffer.
+var udpReader = lunatic.RegisterFunc(func() {
+	var init udpReaderInit
+	if _, err := message.Receive([]int64{udpReaderInitTag}, nil); err != nil {
+		panic(fmt.Sprintf("networking: UDP reader: %v", err))
+	}
+	if err := message.DecodeData(&init); err != nil {
+		panic(fmt.Sprintf("networking: UDP reader: %v", err))
+	}
+
+	buf := make([]byte, maxDatagramSize)
+	for {
+		if _, err := message.Receive([]int64{udpReadTag}, nil); err != nil {
+			panic(fmt.Sprintf("networking: UDP reader: %v", err))
+		}
+
+		n, from, err := UDPReceiveFrom(uint64(init.Socket), buf)
+		d := udpDatagram{Data: buf[:n]}
+		if err != nil {
+			d.Err = err.Error()
+		} else if addr, ok := from.(*net.UDPAddr); ok {
+			d.IP, d.Port, d.Zone = addr.IP, addr.Port, addr.Zone
+		}
+		message.CreateData(init.Tag, 0)
+		if err := message.EncodeData(d, nil); err != nil {
+			panic(fmt.Sprintf("networking: UDP reader: %v", err))
+		}
+		message.Send(init.Owner)
+	}
+})
+
+// useReader reports whether reads are done by the reader process, which is
+// the case once a read deadline was set.
+func (c *UDPConn) useReader() bool {
+	return c.reader != 0 || !c.readDeadline.IsZero()
+}
+
+// startReader spawns the reader process with a clone of the socket.
+func (c *UDPConn) startReader() error {
+	clone, err := CloneUDPSocket(c.id)
+	if err != nil {
+		return err
+	}
+	id, err := lunatic.SpawnLinkFunc(udpReaderLinkTag, udpReader)
+	if err != nil {
+		DropUDPSocket(clone)
+		return err
+	}
+	pid := uint64(id)
+
+	init := udpReaderInit{Socket: message.UDPSocket(clone), Owner: process.ProcessID(), Tag: message.NextReplyTag()}
+	message.CreateData(udpReaderInitTag, 0)
+	if err := message.EncodeData(init, message.NewResourceCodec(nil)); err == nil {
+		err = message.Send(pid)
+	}
+	if err != nil {
+		process.Unlink(pid)
+		process.Kill(pid)
+		return err
+	}
+	c.reader, c.readerTag = pid, init.Tag
+	return nil
+}
+
+// receive reads a datagram with the reader process, waits for it until the
+// read deadline and copies it into `b`.
+func (c *UDPConn) receive(b []byte) (int, net.Addr, error) {
+	if c.reader == 0 {
+		if err := c.startReader(); err != nil {
+			return 0, nil, err
+		}
+	}
+	if !c.reading {
+		message.CreateData(udpReadTag, 0)
+		if err := message.Send(c.reader); err != nil {
+			return 0, nil, err
+		}
+		c.reading = true
+	}
+
+	var timeout *uint64
+	if !c.readDeadline.IsZero() {
+		d := time.Until(c.readDeadline)
+		if d <= 0 {
+			return 0, nil, os.ErrDeadlineExceeded
+		}
+		millis := durationMillis(d)
+		timeout = &millis
+	}
+	msg, err := message.Receive([]int64{c.readerTag}, timeout)
+	if errors.Is(err, message.CallTimedOut) {
+		return 0, nil, os.ErrDeadlineExceeded
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+	if _, ok := msg.(*message.DataMessage); !ok {
+		return 0, nil, fmt.Errorf("unexpected message %T from the reader process", msg)
+	}
+	c.reading = false
+
+	var d udpDatagram
+	if err := message.DecodeData(&d); err != nil {
+		return 0, nil, err
+	}
+	if d.Err != "" {
+		return 0, nil, errors.New(d.Err)
+	}
+	n := copy(b, d.Data)
+	return n, &net.UDPAddr{IP: d.IP, Port: d.Port, Zone: d.Zone}, nil
+}
+
+// check fails if the socket is closed or `deadline` has passed.
+func (c *UDPConn) check(op string, deadline time.Time) error {
+	if c.closed {
+		return c.opError(op, nil, net.ErrClosed)
+	}
+	if !deadline.IsZero() && !time.Now().Before(deadline) {
+		return c.opError(op, nil, os.ErrDeadlineExceeded)
+	}
+	return nil
+}
+
+func (c *UDPConn) opError(op string, addr net.Addr, err error) error {
+	if addr == nil {
+		addr = c.raddr
+	}
+	return &net.OpError{Op: op, Net: "udp", Source: c.laddr, Addr: addr, Err: netError(err)}
+}
@@ -0,0 +1,122 @@
+// -*- compile-command: "go test ./..."; -*-
+
+package networking_test
+
+import (
+	"errors"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gmlewis/go-lunatic/lunatic/networking"
+)
+
+func TestPacketConn(t *testing.T) {
+	server, err := networking.ListenPacket("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("ListenPacket: %v", err)
+	}
+	defer server.Close()
+
+	client, err := networking.DialUDP(server.LocalAddr().String())
+	if err != nil {
+		t.Fatalf("DialUDP: %v", err)
+	}
+	defer client.Close()
+	if got, want := client.RemoteAddr().String(), server.LocalAddr().String(); got != want {
+		t.Errorf("RemoteAddr = %v, want %v", got, want)
+	}
+
+	if _, err := client.Write([]byte("ping")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	buf := make([]byte, 16)
+	n, addr, err := server.ReadFrom(buf)
+	if err != nil || string(buf[:n]) != "ping" {
+		t.Fatalf("ReadFrom = %q, %v, want ping", buf[:n], err)
+	}
+	if _, ok := addr.(*net.UDPAddr); !ok {
+		t.Errorf("ReadFrom addr = %#v, want *net.UDPAddr", addr)
+	}
+
+	if _, err := server.WriteTo([]byte("pong"), addr); err != nil {
+		t.Fatalf("WriteTo: %v", err)
+	}
+	if n, err := client.Read(buf); err != nil || string(buf[:n]) != "pong" {
+		t.Errorf("Read = %q, %v, want pong", buf[:n], err)
+	}
+}
+
+func TestPacketConnOptions(t *testing.T) {
+	c, err := networking.ListenUDP("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("ListenUDP: %v", err)
+	}
+	defer c.Close()
+
+	if addr, ok := c.RemoteAddr().(*net.UDPAddr); !ok || addr.IP != nil || addr.Port != 0 {
+		t.Errorf("RemoteAddr = %#v, want an empty *net.UDPAddr", c.RemoteAddr())
+	}
+	if _, err := c.Write([]byte("x")); err == nil {
+		t.Error("Write on an unconnected socket: want error")
+	}
+
+	if err := c.SetBroadcast(true); err != nil {
+		t.Fatalf("SetBroadcast: %v", err)
+	}
+	if on, err := c.Broadcast(); err != nil || !on {
+		t.Errorf("Broadcast = %v, %v, want true", on, err)
+	}
+	if err := c.SetTTL(7); err != nil {
+		t.Fatalf("SetTTL: %v", err)
+	}
+	if ttl, err := c.TTL(); err != nil || ttl != 7 {
+		t.Errorf("TTL = %v, %v, want 7", ttl, err)
+	}
+
+	c.SetReadDeadline(time.Now())
+	_, _, err = c.ReadFrom(make([]byte, 1))
+	var netErr net.Error
+	if !errors.As(err, &netErr) || !netErr.Timeout() || !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("ReadFrom after the deadline = %v, want timeout", err)
+	}
+}
+
+func TestPacketConnReadDeadline(t *testing.T) {
+	server, err := networking.ListenUDP("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("ListenUDP: %v", err)
+	}
+	defer server.Close()
+	// The deadline interrupts a read that is already waiting.
+	server.SetReadDeadline(time.Now().Add(20 * time.Millisecond))
+	buf := make([]byte, 16)
+	start := time.Now()
+	_, _, err = server.ReadFrom(buf[:1])
+	if !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("ReadFrom = %v, want timeout", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("ReadFrom took %v", d)
+	}
+
+	// The next read returns the datagram the reader is waiting for,
+	// sized for its own buffer rather than the one of the timed out read.
+	client, err := networking.DialUDP(server.LocalAddr().String())
+	if err != nil {
+		t.Fatalf("DialUDP: %v", err)
+	}
+	defer client.Close()
+	if _, err := client.Write([]byte("late")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	server.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, addr, err := server.ReadFrom(buf)
+	if err != nil || string(buf[:n]) != "late" {
+		t.Fatalf("ReadFrom = %q, %v, want late", buf[:n], err)
+	}
+	if got, want := addr.(*net.UDPAddr).Port, client.LocalAddr().(*net.UDPAddr).Port; got != want {
+		t.Errorf("ReadFrom port = %v, want %v", got, want)
+	}
+}
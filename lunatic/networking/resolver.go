@@ -0,0 +1,305 @@
+// -*- compile-command: "GOOS=wasip1 GOARCH=wasm go test ./..."; -*-
+
+package networking
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LookupHost resolves `name` with Resolve and returns all of its addresses.
+// `name` is a host or a "host:port" pair; without a port, the returned
+// addresses have port 0. IP addresses are returned without calling the host.
+// A `timeout` of 0 means no timeout.
+//
+// Returns:
+// * nil on success with at least one address.
+// * *net.DNSError if the name could not be resolved or the lookup timed out.
+func LookupHost(name string, timeout time.Duration) ([]DNSInfo, error) {
+	host, port := name, 0
+	if h, service, err := net.SplitHostPort(name); err == nil {
+		if port, err = lookupPort("", service); err != nil {
+			return nil, err
+		}
+		host = h
+	}
+	return lookupHost(host, port, timeout)
+}
+
+// ResolveTCPAddr returns the address of the TCP end point `address`
+// of the form "host:port". The port may also be a service name like "http".
+func ResolveTCPAddr(address string) (*net.TCPAddr, error) {
+	info, err := resolveAddr("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	return info.TCPAddr(), nil
+}
+
+// ResolveUDPAddr returns the address of the UDP end point `address`
+// of the form "host:port". The port may also be a service name like "domain".
+func ResolveUDPAddr(address string) (*net.UDPAddr, error) {
+	info, err := resolveAddr("udp", address)
+	if err != nil {
+		return nil, err
+	}
+	return info.UDPAddr(), nil
+}
+
+// resolveAddr returns the first address of `address`.
+// If its host is empty, the address has no IP.
+func resolveAddr(network, address string) (*DNSInfo, error) {
+	host, service, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	port, err := lookupPort(network, service)
+	if err != nil {
+		return nil, err
+	}
+	if host == "" {
+		return &DNSInfo{Port: uint32(port)}, nil
+	}
+	infos, err := lookupHost(host, port, 0)
+	if err != nil {
+		return nil, err
+	}
+	return &infos[0], nil
+}
+
+// Resolver looks up names and services with the lunatic host.
+// It provides the methods of net.Resolver that lunatic supports.
+type Resolver struct {
+	// Timeout limits every lookup in addition to the deadline of its context.
+	// 0 means no timeout.
+	Timeout time.Duration
+}
+
+// DefaultResolver is a Resolver without a timeout.
+var DefaultResolver = &Resolver{}
+
+// LookupHost returns the addresses of `host` as strings.
+func (r *Resolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	ips, err := r.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	addrs := make([]string, len(ips))
+	for i, ip := range ips {
+		addrs[i] = ip.String()
+	}
+	return addrs, nil
+}
+
+// LookupIPAddr returns the IPv4 and IPv6 addresses of `host`.
+func (r *Resolver) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	timeout, err := r.timeout(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	infos, err := lookupHost(host, 0, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	ips := make([]net.IPAddr, 0, len(infos))
+	seen := map[string]bool{}
+	for _, info := range infos {
+		ip := net.IPAddr{IP: info.ip(), Zone: info.zone()}
+		if key := ip.String(); !seen[key] {
+			seen[key] = true
+			ips = append(ips, ip)
+		}
+	}
+	return ips, nil
+}
+
+// LookupIP returns the addresses of `host` for `network`,
+// which must be "ip", "ip4" or "ip6".
+func (r *Resolver) LookupIP(ctx context.Context, network, host string) ([]net.IP, error) {
+	switch network {
+	case "ip", "ip4", "ip6":
+	default:
+		return nil, net.UnknownNetworkError(network)
+	}
+	ipAddrs, err := r.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	var ips []net.IP
+	for _, ip := range ipAddrs {
+		is4 := ip.IP.To4() != nil
+		if network == "ip" || (network == "ip4") == is4 {
+			ips = append(ips, ip.IP)
+		}
+	}
+	if len(ips) == 0 {
+		return nil, &net.DNSError{Err: "no suitable address", Name: host, IsNotFound: true}
+	}
+	return ips, nil
+}
+
+// LookupPort returns the port of `service` for `network`,
+// which may be empty or one of "tcp", "tcp4", "tcp6", "udp", "udp4" and "udp6".
+// Besides port numbers, a few well-known service names are supported,
+// since lunatic has no services database.
+func (r *Resolver) LookupPort(ctx context.Context, network, service string) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	return lookupPort(network, service)
+}
+
+// timeout returns the timeout for a lookup of `host` with `ctx`.
+func (r *Resolver) timeout(ctx context.Context, host string) (time.Duration, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, &net.DNSError{Err: err.Error(), Name: host, IsTimeout: errors.Is(err, context.DeadlineExceeded)}
+	}
+	timeout := r.Timeout
+	if deadline, ok := ctx.Deadline(); ok {
+		left := time.Until(deadline)
+		if left <= 0 {
+			return 0, &net.DNSError{Err: context.DeadlineExceeded.Error(), Name: host, IsTimeout: true}
+		}
+		if timeout == 0 || left < timeout {
+			timeout = left
+		}
+	}
+	return timeout, nil
+}
+
+// services maps well-known service names to their ports.
+var services = map[string]int{
+	"echo":   7,
+	"ftp":    21,
+	"ssh":    22,
+	"telnet": 23,
+	"smtp":   25,
+	"domain": 53,
+	"http":   80,
+	"pop3":   110,
+	"ntp":    123,
+	"imap":   143,
+	"snmp":   161,
+	"ldap":   389,
+	"https":  443,
+	"imaps":  993,
+	"pop3s":  995,
+}
+
+func lookupPort(network, service string) (int, error) {
+	switch network {
+	case "", "tcp", "tcp4", "tcp6", "udp", "udp4", "udp6":
+	default:
+		return 0, net.UnknownNetworkError(network)
+	}
+	if port, err := strconv.ParseUint(service, 10, 16); err == nil {
+		return int(port), nil
+	}
+	if port, ok := services[strings.ToLower(service)]; ok {
+		return port, nil
+	}
+	return 0, &net.DNSError{Err: "unknown port", Name: network + "/" + service, IsNotFound: true}
+}
+
+// lookupHost returns the addresses of `host` with `port`.
+// IP addresses are used as is, other hosts are resolved with Resolve.
+func lookupHost(host string, port int, timeout time.Duration) ([]DNSInfo, error) {
+	ipStr, zone, _ := strings.Cut(host, "%")
+	if ip := net.ParseIP(ipStr); ip != nil {
+		return []DNSInfo{newDNSInfo(ip, port, zone)}, nil
+	}
+
+	dnsIterID, err := Resolve(net.JoinHostPort(host, strconv.Itoa(port)), timeoutMillis(timeout))
+	if err != nil {
+		return nil, &net.DNSError{Err: err.Error(), Name: host, IsTimeout: errors.Is(err, CallTimedOut)}
+	}
+	infos, err := readDNSIterator(dnsIterID)
+	if err != nil {
+		return nil, &net.DNSError{Err: err.Error(), Name: host}
+	}
+	if len(infos) == 0 {
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	return infos, nil
+}
+
+// lookupAddr returns the addresses of `address` of the form "host:port"
+// for `network`. An empty host is replaced with `defaultHost`.
+func lookupAddr(network, address, defaultHost string, timeout time.Duration) ([]DNSInfo, error) {
+	host, service, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	port, err := lookupPort(network, service)
+	if err != nil {
+		return nil, err
+	}
+	if host == "" {
+		host = defaultHost
+	}
+	return lookupHost(host, port, timeout)
+}
+
+// readDNSIterator returns all addresses of the DNS iterator with `dnsIterID`
+// and drops the iterator.
+func readDNSIterator(dnsIterID uint64) ([]DNSInfo, error) {
+	defer DropDNSIterator(dnsIterID)
+	var infos []DNSInfo
+	for {
+		info, err := ResolveNext(dnsIterID)
+		if err != nil {
+			return nil, err
+		}
+		if info == nil {
+			return infos, nil
+		}
+		infos = append(infos, *info)
+	}
+}
+
+// iterAddr returns the first address of the DNS iterator with `dnsIterID`
+// as a "tcp" or "udp" `network` address and drops the iterator.
+func iterAddr(dnsIterID uint64, network string) (net.Addr, error) {
+	infos, err := readDNSIterator(dnsIterID)
+	if err != nil {
+		return nil, err
+	}
+	if len(infos) == 0 {
+		return nil, errors.New("no address")
+	}
+	if network == "udp" {
+		return infos[0].UDPAddr(), nil
+	}
+	return infos[0].TCPAddr(), nil
+}
+
+// addrDNSInfo returns the DNSInfo of `addr`, resolving its string
+// representation unless it is a *net.UDPAddr or *net.TCPAddr.
+func addrDNSInfo(addr net.Addr) (DNSInfo, error) {
+	var ip net.IP
+	var port int
+	var zone string
+	switch a := addr.(type) {
+	case *net.UDPAddr:
+		ip, port, zone = a.IP, a.Port, a.Zone
+	case *net.TCPAddr:
+		ip, port, zone = a.IP, a.Port, a.Zone
+	default:
+		infos, err := lookupAddr("", addr.String(), "127.0.0.1", 0)
+		if err != nil {
+			return DNSInfo{}, err
+		}
+		return infos[0], nil
+	}
+	if ip == nil {
+		return DNSInfo{}, fmt.Errorf("missing IP in address %v", addr)
+	}
+	return newDNSInfo(ip, port, zone), nil
+}
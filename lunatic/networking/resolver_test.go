@@ -0,0 +1,78 @@
+// -*- compile-command: "go test ./..."; -*-
+
+package networking_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/gmlewis/go-lunatic/lunatic/networking"
+)
+
+func TestLookupHost(t *testing.T) {
+	infos, err := networking.LookupHost("localhost:https", 0)
+	if err != nil {
+		t.Fatalf("LookupHost: %v", err)
+	}
+	for _, info := range infos {
+		if addr := info.TCPAddr(); !addr.IP.IsLoopback() || addr.Port != 443 {
+			t.Errorf("LookupHost address = %v, want loopback:443", addr)
+		}
+	}
+
+	infos, err = networking.LookupHost("fe80::1%2", 0)
+	if err != nil {
+		t.Fatalf("LookupHost: %v", err)
+	}
+	if len(infos) != 1 || infos[0].AddrType != 6 || infos[0].ScopeID != 2 {
+		t.Errorf("LookupHost = %+v, want one IPv6 address with scope 2", infos)
+	}
+	if got, want := infos[0].UDPAddr().String(), "[fe80::1%2]:0"; got != want {
+		t.Errorf("UDPAddr = %v, want %v", got, want)
+	}
+
+	_, err = networking.LookupHost("localhost:nope", 0)
+	var dnsErr *net.DNSError
+	if !errors.As(err, &dnsErr) || !dnsErr.IsNotFound {
+		t.Errorf("LookupHost with unknown service = %v, want not found", err)
+	}
+}
+
+func TestResolver(t *testing.T) {
+	r := networking.DefaultResolver
+	ctx := context.Background()
+
+	addrs, err := r.LookupHost(ctx, "127.0.0.1")
+	if err != nil || len(addrs) != 1 || addrs[0] != "127.0.0.1" {
+		t.Errorf("LookupHost = %v, %v, want [127.0.0.1]", addrs, err)
+	}
+	ips, err := r.LookupIP(ctx, "ip4", "localhost")
+	if err != nil || len(ips) == 0 || ips[0].To4() == nil {
+		t.Errorf("LookupIP(ip4) = %v, %v, want IPv4 addresses", ips, err)
+	}
+	if port, err := r.LookupPort(ctx, "udp", "domain"); err != nil || port != 53 {
+		t.Errorf("LookupPort = %v, %v, want 53", port, err)
+	}
+	if _, err := r.LookupPort(ctx, "sctp", "80"); err == nil {
+		t.Error("LookupPort with unknown network: want error")
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := r.LookupIPAddr(cancelled, "localhost"); err == nil {
+		t.Error("LookupIPAddr with a cancelled context: want error")
+	}
+}
+
+func TestResolveAddr(t *testing.T) {
+	tcp, err := networking.ResolveTCPAddr(":http")
+	if err != nil || tcp.IP != nil || tcp.Port != 80 {
+		t.Errorf("ResolveTCPAddr = %v, %v, want :80", tcp, err)
+	}
+	udp, err := networking.ResolveUDPAddr("127.0.0.1:5353")
+	if err != nil || udp.String() != "127.0.0.1:5353" {
+		t.Errorf("ResolveUDPAddr = %v, %v, want 127.0.0.1:5353", udp, err)
+	}
+}
@@ -3,16 +3,16 @@
 package networking
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
+	"io"
 	"math"
-	"reflect"
-	"unsafe"
-)
+	"net"
+	"runtime"
 
-//go:wasmimport lunatic::networking tcp_bind
-//go:noescape
-func tcp_bind(addrType uint32, addrU8Ptr ptr, port, flowInfo, scopeID uint32, idU64Ptr ptr) uint32
+	lerror "github.com/gmlewis/go-lunatic/lunatic/error"
+)
 
 // TCPBind creates a new TCP listener which will be bound to the specified address.
 // The returned listener is ready to accept connections.
@@ -22,7 +22,7 @@ func tcp_bind(addrType uint32, addrU8Ptr ptr, port, flowInfo, scopeID uint32, id
 //
 // Returns:
 // * nil on success with the ID of the newly-created TCP listener.
-// * error with the error ID.
+// * *lunatic/error.Error on failure.
 func TCPBind(dnsInfo DNSInfo) (id uint64, err error) {
 	defer func() {
 		if r := recover(); r != nil {
@@ -34,15 +34,13 @@ func TCPBind(dnsInfo DNSInfo) (id uint64, err error) {
 	switch errno {
 	case 0:
 		return id, nil
+	case 1:
+		return 0, lerror.New("networking.tcp_bind", id)
 	default:
 		return id, fmt.Errorf("networking.tcp_bind unknown error: %v", errno)
 	}
 }
 
-//go:wasmimport lunatic::networking drop_tcp_listener
-//go:noescape
-func drop_tcp_listener(tcpListenerID uint64)
-
 // DropTCPListener drops the TCP listener resource.
 func DropTCPListener(tcpListenerID uint64) (err error) {
 	defer func() {
@@ -55,60 +53,53 @@ func DropTCPListener(tcpListenerID uint64) (err error) {
 	return nil
 }
 
-//go:wasmimport lunatic::networking tcp_local_addr
-//go:noescape
-func tcp_local_addr(tcpListenerID uint64, idU64Ptr ptr) uint32
-
-// TCPLocalAddr returns the local address that this listener is bound to as
-// a DNS iterator with just one element.
-func TCPLocalAddr(tcpListenerID uint64) (id uint64, err error) {
+// TCPLocalAddr returns the local address that this listener is bound to.
+func TCPLocalAddr(tcpListenerID uint64) (addr net.Addr, err error) {
 	defer func() {
 		if r := recover(); r != nil {
 			err = fmt.Errorf("networking.tcp_local_addr error: %v", r)
 		}
 	}()
 
+	var id uint64
 	errno := tcp_local_addr(tcpListenerID, mkptr(&id))
 	switch errno {
 	case 0:
-		return id, nil
+		return iterAddr(id, "tcp")
+	case 1:
+		return nil, lerror.New("networking.tcp_local_addr", id)
 	default:
-		return id, fmt.Errorf("networking.tcp_local_addr unknown error: %v", errno)
+		return nil, fmt.Errorf("networking.tcp_local_addr unknown error: %v", errno)
 	}
 }
 
-//go:wasmimport lunatic::networking tcp_accept
-//go:noescape
-func tcp_accept(listenerID uint64, idU64Ptr ptr, socketAddrIDPtr ptr) uint32
-
-// TCPAccept returns the ID of the newly-created TCP stream and the peer address
-// as a DNS iterator with just one element.
-func TCPAccept(listenerID uint64) (id, dnsIterID uint64, err error) {
+// TCPAccept returns the ID of the newly-created TCP stream and the peer address.
+func TCPAccept(listenerID uint64) (id uint64, peer net.Addr, err error) {
 	defer func() {
 		if r := recover(); r != nil {
 			err = fmt.Errorf("networking.tcp_accept error: %v", r)
 		}
 	}()
 
+	var dnsIterID uint64
 	errno := tcp_accept(listenerID, mkptr(&id), mkptr(&dnsIterID))
 	switch errno {
 	case 0:
-		return id, dnsIterID, nil
+		peer, _ = iterAddr(dnsIterID, "tcp") // the stream is usable without it.
+		return id, peer, nil
+	case 1:
+		return 0, nil, lerror.New("networking.tcp_accept", id)
 	default:
-		return id, dnsIterID, fmt.Errorf("networking.tcp_accept unknown error: %v", errno)
+		return 0, nil, fmt.Errorf("networking.tcp_accept unknown error: %v", errno)
 	}
 }
 
-//go:wasmimport lunatic::networking tcp_connect
-//go:noescape
-func tcp_connect(addrType uint32, addrU8Ptr ptr, port, flowInfo, scopeID uint32, timeoutDuration uint64, idU64Ptr ptr) uint32
-
 // TCPConnect connects to the provided dnsInfo.
 //
 // Returns:
 // * nil on success with the ID of the newly-created TCP stream.
 // * CallTimedOut if the call timed out.
-// * error with the error ID.
+// * *lunatic/error.Error on failure.
 func TCPConnect(dnsInfo DNSInfo, timeoutMillis *uint64) (id uint64, err error) {
 	defer func() {
 		if r := recover(); r != nil {
@@ -125,6 +116,8 @@ func TCPConnect(dnsInfo DNSInfo, timeoutMillis *uint64) (id uint64, err error) {
 	switch errno {
 	case 0:
 		return id, nil
+	case 1:
+		return 0, lerror.New("networking.tcp_connect", id)
 	case 9027:
 		return id, CallTimedOut
 	default:
@@ -132,10 +125,6 @@ func TCPConnect(dnsInfo DNSInfo, timeoutMillis *uint64) (id uint64, err error) {
 	}
 }
 
-//go:wasmimport lunatic::networking drop_tcp_stream
-//go:noescape
-func drop_tcp_stream(tcpStreamID uint64)
-
 // DropTCPStream drops the TCP stream resource.
 func DropTCPStream(tcpStreamID uint64) (err error) {
 	defer func() {
@@ -148,10 +137,6 @@ func DropTCPStream(tcpStreamID uint64) (err error) {
 	return nil
 }
 
-//go:wasmimport lunatic::networking clone_tcp_stream
-//go:noescape
-func clone_tcp_stream(tcpStreamID uint64) uint64
-
 // CloneTCPStream clones a TCP stream returning the ID of the clone.
 func CloneTCPStream(tcpStreamID uint64) (id uint64, err error) {
 	defer func() {
@@ -164,61 +149,215 @@ func CloneTCPStream(tcpStreamID uint64) (id uint64, err error) {
 	return id, nil
 }
 
-//go:wasmimport lunatic::networking tcp_write_vectored
-//go:noescape
-func tcp_write_vectored(streamID uint64, ciovecArrayPtr ptr, ciovecArrayLen size, opaquePtr ptr) uint32
-
 // TCPWriteVectored gathers data from the vector buffers and writes them to the stream.
-func TCPWriteVectored(streamID uint64, buf []byte) (id uint64, err error) {
+// It returns the number of bytes written, which may be less than `len(buf)`.
+//
+// Returns:
+// * nil on success with the number of bytes written.
+// * CallTimedOut if the write timeout expired.
+// * *lunatic/error.Error on failure.
+func TCPWriteVectored(streamID uint64, buf []byte) (n int, err error) {
+	return tcpWriteVectored(streamID, [][]byte{buf})
+}
+
+// WriteBuffers writes all of `bufs` to the stream without copying them
+// into a single buffer. Each host call gathers all remaining buffers and
+// short writes are retried until everything is written. `bufs` itself is
+// left unchanged.
+//
+// Returns:
+// * nil on success with the number of bytes written.
+// * CallTimedOut if the write timeout expired.
+// * io.ErrShortWrite if the host wrote nothing.
+// * *lunatic/error.Error on failure.
+func WriteBuffers(streamID uint64, bufs net.Buffers) (n int64, err error) {
+	v := append(net.Buffers(nil), bufs...)
+	return writeBuffers(&v, func(bufs [][]byte) (int, error) {
+		return tcpWriteVectored(streamID, bufs)
+	})
+}
+
+// tcpWriteVectored writes `bufs` to the stream with a single host call.
+func tcpWriteVectored(streamID uint64, bufs [][]byte) (n int, err error) {
 	defer func() {
 		if r := recover(); r != nil {
 			err = fmt.Errorf("networking.tcp_write_vectored error: %v", r)
 		}
 	}()
 
-	errno := tcp_write_vectored(streamID, mkptr(&buf[0]), size(len(buf)), mkptr(&id))
+	var opaque uint64
+	vec := make([]ciovec, len(bufs))
+	for i, buf := range bufs {
+		vec[i] = newCiovec(buf)
+	}
+	errno := tcp_write_vectored(streamID, mkptr(&vec[0]), size(len(vec)), mkptr(&opaque))
+	runtime.KeepAlive(bufs)
 	switch errno {
 	case 0:
-		return id, nil
+		return int(opaque), nil
 	case 1:
-		return id, errors.New("error id")
+		return 0, lerror.New("networking.tcp_write_vectored", opaque)
+	case 9027:
+		return 0, CallTimedOut
 	default:
-		return id, fmt.Errorf("networking.tcp_write_vectored unknown error: %v", errno)
+		return 0, fmt.Errorf("networking.tcp_write_vectored unknown error: %v", errno)
 	}
 }
 
-//go:wasmimport lunatic::networking tcp_read
-//go:noescape
-func tcp_read(streamID uint64, bufferPtr ptr, bufferLen size, opaquePtr ptr) uint32
+// writeBuffers writes and consumes `v` with `write`, which may write only
+// a prefix of the buffers it is given, until all of `v` is written.
+func writeBuffers(v *net.Buffers, write func(bufs [][]byte) (int, error)) (written int64, err error) {
+	for {
+		for len(*v) > 0 && len((*v)[0]) == 0 {
+			*v = (*v)[1:]
+		}
+		if len(*v) == 0 {
+			return written, nil
+		}
+		n, err := write(*v)
+		if err != nil {
+			return written, err
+		}
+		if n == 0 {
+			return written, io.ErrShortWrite
+		}
+		written += int64(n)
+		for n > 0 {
+			if l := len((*v)[0]); n >= l {
+				*v, n = (*v)[1:], n-l
+			} else {
+				(*v)[0], n = (*v)[0][n:], 0
+			}
+		}
+	}
+}
 
 // TCPRead reads data from the TCP stream and writes it into `buf`.
+// A count of 0 means that the peer closed the stream.
 //
-// If no data was read within the specified timeout duration, then CallTimedOut is returned.
-func TCPRead(streamID uint64, buf []byte) (id uint64, err error) {
+// Returns:
+// * nil on success with the number of bytes read.
+// * CallTimedOut if no data was read within the read timeout of the stream.
+// * *lunatic/error.Error on failure.
+func TCPRead(streamID uint64, buf []byte) (n int, err error) {
 	defer func() {
 		if r := recover(); r != nil {
 			err = fmt.Errorf("networking.tcp_read error: %v", r)
 		}
 	}()
 
-	errno := tcp_read(streamID, mkptr(&buf[0]), size(cap(buf)), mkptr(&id))
+	var opaque uint64
+	errno := tcp_read(streamID, mkptr(&buf[0]), size(len(buf)), mkptr(&opaque))
 	switch errno {
 	case 0:
-		sh := (*reflect.SliceHeader)(unsafe.Pointer(&buf[0]))
-		sh.Len = int(id) // override the buf slice's length to the returned results.
-		return id, nil
+		return int(opaque), nil
 	case 1:
-		return id, errors.New("error id")
+		return 0, lerror.New("networking.tcp_read", opaque)
 	case 9027:
-		return id, CallTimedOut
+		return 0, CallTimedOut
 	default:
-		return id, fmt.Errorf("networking.tcp_read unknown error: %v", errno)
+		return 0, fmt.Errorf("networking.tcp_read unknown error: %v", errno)
 	}
 }
 
-//go:wasmimport lunatic::networking set_read_timeout
-//go:noescape
-func set_read_timeout(streamID, duration uint64)
+// TCPPeek reads data from the TCP stream into `buf` without removing it,
+// so that the next TCPRead or TCPPeek returns the same data.
+// A count of 0 means that the peer closed the stream.
+//
+// Returns:
+// * nil on success with the number of bytes peeked.
+// * CallTimedOut if no data arrived within the peek timeout of the stream.
+// * *lunatic/error.Error on failure.
+func TCPPeek(streamID uint64, buf []byte) (n int, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("networking.tcp_peek error: %v", r)
+		}
+	}()
+
+	var opaque uint64
+	errno := tcp_peek(streamID, mkptr(&buf[0]), size(len(buf)), mkptr(&opaque))
+	switch errno {
+	case 0:
+		return int(opaque), nil
+	case 1:
+		return 0, lerror.New("networking.tcp_peek", opaque)
+	case 9027:
+		return 0, CallTimedOut
+	default:
+		return 0, fmt.Errorf("networking.tcp_peek unknown error: %v", errno)
+	}
+}
+
+// ErrTooLong is returned by ReadUntil if the delimiter is not found
+// within the maximum length.
+var ErrTooLong = errors.New("networking: delimiter not found within maximum length")
+
+// ReadFull reads exactly `len(buf)` bytes from the TCP stream.
+// Each read is subject to the read timeout of the stream.
+//
+// Returns:
+// * nil on success with `len(buf)`.
+// * CallTimedOut with the number of bytes read if the read timeout expired.
+// * io.EOF if the peer closed the stream before any byte was read.
+// * io.ErrUnexpectedEOF if the peer closed the stream after some bytes.
+// * *lunatic/error.Error on failure.
+func ReadFull(streamID uint64, buf []byte) (n int, err error) {
+	for n < len(buf) {
+		m, err := TCPRead(streamID, buf[n:])
+		if err != nil {
+			return n, err
+		}
+		if m == 0 {
+			if n == 0 {
+				return 0, io.EOF
+			}
+			return n, io.ErrUnexpectedEOF
+		}
+		n += m
+	}
+	return n, nil
+}
+
+// ReadUntil reads from the TCP stream up to and including the first
+// `delim` and returns the data. Nothing after `delim` is consumed:
+// the stream is peeked, subject to its peek timeout, and only the bytes
+// up to `delim` are read, subject to its read timeout.
+//
+// Returns:
+// * nil on success with the data ending in `delim`.
+// * CallTimedOut with the data read so far if a timeout expired.
+// * io.EOF if the peer closed the stream before any byte was read.
+// * io.ErrUnexpectedEOF if the peer closed the stream before `delim`.
+// * ErrTooLong with the first `maxLen` bytes if they don't contain `delim`.
+// * *lunatic/error.Error on failure.
+func ReadUntil(streamID uint64, delim byte, maxLen int) ([]byte, error) {
+	buf := make([]byte, maxLen)
+	var n int
+	for n < maxLen {
+		m, err := TCPPeek(streamID, buf[n:])
+		if err != nil {
+			return buf[:n], err
+		}
+		if m == 0 {
+			if n == 0 {
+				return nil, io.EOF
+			}
+			return buf[:n], io.ErrUnexpectedEOF
+		}
+		i := bytes.IndexByte(buf[n:n+m], delim)
+		if i >= 0 {
+			m = i + 1
+		}
+		// Read what was peeked, which returns the same bytes.
+		m, err = ReadFull(streamID, buf[n:n+m])
+		n += m
+		if err != nil || i >= 0 {
+			return buf[:n], err
+		}
+	}
+	return buf, ErrTooLong
+}
 
 // SetReadTimeout sets the new value for read timeout for the TCP stream.
 func SetReadTimeout(streamID, timeoutMillis uint64) (err error) {
@@ -232,10 +371,6 @@ func SetReadTimeout(streamID, timeoutMillis uint64) (err error) {
 	return nil
 }
 
-//go:wasmimport lunatic::networking get_read_timeout
-//go:noescape
-func get_read_timeout(streamID uint64) uint64
-
 // GetReadTimeout gets the read timeout for the TCP stream.
 func GetReadTimeout(streamID uint64) (timeoutMillis uint64, err error) {
 	defer func() {
@@ -248,10 +383,6 @@ func GetReadTimeout(streamID uint64) (timeoutMillis uint64, err error) {
 	return timeoutMillis, nil
 }
 
-//go:wasmimport lunatic::networking set_write_timeout
-//go:noescape
-func set_write_timeout(streamID, duration uint64)
-
 // SetWriteTimeout sets the new value for write timeout for the TCP stream.
 func SetWriteTimeout(streamID, timeoutMillis uint64) (err error) {
 	defer func() {
@@ -264,10 +395,6 @@ func SetWriteTimeout(streamID, timeoutMillis uint64) (err error) {
 	return nil
 }
 
-//go:wasmimport lunatic::networking get_write_timeout
-//go:noescape
-func get_write_timeout(streamID uint64) uint64
-
 // GetWriteTimeout gets the value for the write timeout for the TCP stream.
 func GetWriteTimeout(streamID uint64) (timeoutMillis uint64, err error) {
 	defer func() {
@@ -280,10 +407,6 @@ func GetWriteTimeout(streamID uint64) (timeoutMillis uint64, err error) {
 	return timeoutMillis, nil
 }
 
-//go:wasmimport lunatic::networking set_peek_timeout
-//go:noescape
-func set_peek_timeout(streamID, duration uint64)
-
 // SetPeekTimeout sets the new value for peek timeout for the TCP stream.
 func SetPeekTimeout(streamID, timeoutMillis uint64) (err error) {
 	defer func() {
@@ -296,10 +419,6 @@ func SetPeekTimeout(streamID, timeoutMillis uint64) (err error) {
 	return nil
 }
 
-//go:wasmimport lunatic::networking get_peek_timeout
-//go:noescape
-func get_peek_timeout(streamID uint64) uint64
-
 // GetPeekTimeout gets the value for the peek timeout for the TCP stream.
 func GetPeekTimeout(streamID uint64) (timeoutMillis uint64, err error) {
 	defer func() {
@@ -312,50 +431,47 @@ func GetPeekTimeout(streamID uint64) (timeoutMillis uint64, err error) {
 	return timeoutMillis, nil
 }
 
-//go:wasmimport lunatic::networking tcp_flush
-//go:noescape
-func tcp_flush(streamID uint64, errorIDPtr ptr) uint32
-
 // TCPFlush flushes this output stream, ensuring that all buffered contents
 // reach their destination.
-func TCPFlush(streamID uint64) (id uint64, err error) {
+//
+// Returns:
+// * nil on success.
+// * *lunatic/error.Error on failure.
+func TCPFlush(streamID uint64) (err error) {
 	defer func() {
 		if r := recover(); r != nil {
 			err = fmt.Errorf("networking.tcp_flush error: %v", r)
 		}
 	}()
 
-	errno := tcp_flush(streamID, mkptr(&id))
+	var errorID uint64
+	errno := tcp_flush(streamID, mkptr(&errorID))
 	switch errno {
 	case 0:
-		return id, nil
+		return nil
 	case 1:
-		return id, errors.New("error id")
+		return lerror.New("networking.tcp_flush", errorID)
 	default:
-		return id, fmt.Errorf("networking.tcp_flush unknown error: %v", errno)
+		return fmt.Errorf("networking.tcp_flush unknown error: %v", errno)
 	}
 }
 
-//go:wasmimport lunatic::networking tcp_peer_addr
-//go:noescape
-func tcp_peer_addr(tcpStreamID uint64, idU64Ptr ptr) uint32
-
-// TCPPeerAddr returns the remote address this TCP socket is connected to, bound to a DNS
-// iterator with just one element.
-func TCPPeerAddr(tcpStreamID uint64) (id uint64, err error) {
+// TCPPeerAddr returns the remote address this TCP socket is connected to.
+func TCPPeerAddr(tcpStreamID uint64) (addr net.Addr, err error) {
 	defer func() {
 		if r := recover(); r != nil {
 			err = fmt.Errorf("networking.tcp_peer_addr error: %v", r)
 		}
 	}()
 
+	var id uint64
 	errno := tcp_peer_addr(tcpStreamID, mkptr(&id))
 	switch errno {
 	case 0:
-		return id, nil
+		return iterAddr(id, "tcp")
 	case 1:
-		return id, errors.New("error id")
+		return nil, lerror.New("networking.tcp_peer_addr", id)
 	default:
-		return id, fmt.Errorf("networking.tcp_peer_addr unknown error: %v", errno)
+		return nil, fmt.Errorf("networking.tcp_peer_addr unknown error: %v", errno)
 	}
 }
@@ -0,0 +1,291 @@
+// -*- compile-command: "GOOS=wasip1 GOARCH=wasm go test ./..."; -*-
+
+package networking
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"runtime"
+	"unsafe"
+
+	lerror "github.com/gmlewis/go-lunatic/lunatic/error"
+)
+
+// TLSBind creates a new TLS listener which will be bound to the specified address.
+// `certs` and `keys` are the PEM-encoded certificate chain and private key
+// presented to clients.
+//
+// Binding with a port number of 0 will request that the OS assigns a port to this listener.
+// The port allocated can be queried via the `TLSLocalAddr` method.
+//
+// Returns:
+// * nil on success with the ID of the newly-created TLS listener.
+// * *lunatic/error.Error on failure.
+func TLSBind(dnsInfo DNSInfo, certs, keys []byte) (id uint64, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("networking.tls_bind error: %v", r)
+		}
+	}()
+
+	errno := tls_bind(dnsInfo.AddrType, mkptr(&dnsInfo.IP[0]), dnsInfo.Port, dnsInfo.FlowInfo, dnsInfo.ScopeID, mkptr(&id),
+		mkptr(unsafe.SliceData(certs)), size(len(certs)), mkptr(unsafe.SliceData(keys)), size(len(keys)))
+	runtime.KeepAlive(certs)
+	runtime.KeepAlive(keys)
+	switch errno {
+	case 0:
+		return id, nil
+	case 1:
+		return 0, lerror.New("networking.tls_bind", id)
+	default:
+		return 0, fmt.Errorf("networking.tls_bind unknown error: %v", errno)
+	}
+}
+
+// DropTLSListener drops the TLS listener resource.
+func DropTLSListener(tlsListenerID uint64) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("networking.drop_tls_listener error: %v", r)
+		}
+	}()
+
+	drop_tls_listener(tlsListenerID)
+	return nil
+}
+
+// TLSLocalAddr returns the local address that this listener is bound to.
+func TLSLocalAddr(tlsListenerID uint64) (addr net.Addr, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("networking.tls_local_addr error: %v", r)
+		}
+	}()
+
+	var id uint64
+	errno := tls_local_addr(tlsListenerID, mkptr(&id))
+	switch errno {
+	case 0:
+		return iterAddr(id, "tcp")
+	case 1:
+		return nil, lerror.New("networking.tls_local_addr", id)
+	default:
+		return nil, fmt.Errorf("networking.tls_local_addr unknown error: %v", errno)
+	}
+}
+
+// TLSAccept returns the ID of the newly-created TLS stream and the peer address
+// once the TLS handshake with the peer has completed.
+func TLSAccept(listenerID uint64) (id uint64, peer net.Addr, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("networking.tls_accept error: %v", r)
+		}
+	}()
+
+	var dnsIterID uint64
+	errno := tls_accept(listenerID, mkptr(&id), mkptr(&dnsIterID))
+	switch errno {
+	case 0:
+		peer, _ = iterAddr(dnsIterID, "tcp") // the stream is usable without it.
+		return id, peer, nil
+	case 1:
+		return 0, nil, lerror.New("networking.tls_accept", id)
+	default:
+		return 0, nil, fmt.Errorf("networking.tls_accept unknown error: %v", errno)
+	}
+}
+
+// TLSConnect connects to `host` on `port` and performs a TLS handshake,
+// verifying that the server's certificate is valid for `host`.
+// `certs` are optional PEM-encoded root certificates that are trusted
+// in addition to the host's roots.
+//
+// Returns:
+// * nil on success with the ID of the newly-created TLS stream.
+// * CallTimedOut if the call timed out.
+// * *lunatic/error.Error on failure.
+func TLSConnect(host string, port uint32, timeoutMillis *uint64, certs []byte) (id uint64, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("networking.tls_connect error: %v", r)
+		}
+	}()
+
+	td := uint64(math.MaxUint64)
+	if timeoutMillis != nil {
+		td = *timeoutMillis
+	}
+
+	hostBytes := []byte(host)
+	errno := tls_connect(mkptr(unsafe.SliceData(hostBytes)), size(len(hostBytes)), port, td, mkptr(&id),
+		mkptr(unsafe.SliceData(certs)), size(len(certs)))
+	runtime.KeepAlive(hostBytes)
+	runtime.KeepAlive(certs)
+	switch errno {
+	case 0:
+		return id, nil
+	case 1:
+		return 0, lerror.New("networking.tls_connect", id)
+	case 9027:
+		return 0, CallTimedOut
+	default:
+		return 0, fmt.Errorf("networking.tls_connect unknown error: %v", errno)
+	}
+}
+
+// DropTLSStream drops the TLS stream resource.
+func DropTLSStream(tlsStreamID uint64) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("networking.drop_tls_stream error: %v", r)
+		}
+	}()
+
+	drop_tls_stream(tlsStreamID)
+	return nil
+}
+
+// CloneTLSStream clones a TLS stream returning the ID of the clone.
+func CloneTLSStream(tlsStreamID uint64) (id uint64, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("networking.clone_tls_stream error: %v", r)
+		}
+	}()
+
+	id = clone_tls_stream(tlsStreamID)
+	return id, nil
+}
+
+// TLSWriteVectored gathers data from the vector buffers and writes them to the stream.
+// It returns the number of bytes written, which may be less than `len(buf)`.
+//
+// Returns:
+// * nil on success with the number of bytes written.
+// * CallTimedOut if the write timeout expired.
+// * *lunatic/error.Error on failure.
+func TLSWriteVectored(tlsStreamID uint64, buf []byte) (n int, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("networking.tls_write_vectored error: %v", r)
+		}
+	}()
+
+	var opaque uint64
+	vec := []ciovec{newCiovec(buf)}
+	errno := tls_write_vectored(tlsStreamID, mkptr(&vec[0]), size(len(vec)), mkptr(&opaque))
+	runtime.KeepAlive(buf)
+	switch errno {
+	case 0:
+		return int(opaque), nil
+	case 1:
+		return 0, lerror.New("networking.tls_write_vectored", opaque)
+	case 9027:
+		return 0, CallTimedOut
+	default:
+		return 0, fmt.Errorf("networking.tls_write_vectored unknown error: %v", errno)
+	}
+}
+
+// TLSRead reads data from the TLS stream and writes it into `buf`.
+// A count of 0 means that the peer closed the stream.
+//
+// Returns:
+// * nil on success with the number of bytes read.
+// * CallTimedOut if no data was read within the read timeout of the stream.
+// * *lunatic/error.Error on failure.
+func TLSRead(tlsStreamID uint64, buf []byte) (n int, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("networking.tls_read error: %v", r)
+		}
+	}()
+
+	var opaque uint64
+	errno := tls_read(tlsStreamID, mkptr(&buf[0]), size(len(buf)), mkptr(&opaque))
+	switch errno {
+	case 0:
+		return int(opaque), nil
+	case 1:
+		return 0, lerror.New("networking.tls_read", opaque)
+	case 9027:
+		return 0, CallTimedOut
+	default:
+		return 0, fmt.Errorf("networking.tls_read unknown error: %v", errno)
+	}
+}
+
+// TLSFlush flushes this output stream, ensuring that all buffered contents
+// reach their destination.
+//
+// Returns:
+// * nil on success.
+// * *lunatic/error.Error on failure.
+func TLSFlush(tlsStreamID uint64) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("networking.tls_flush error: %v", r)
+		}
+	}()
+
+	var errorID uint64
+	errno := tls_flush(tlsStreamID, mkptr(&errorID))
+	switch errno {
+	case 0:
+		return nil
+	case 1:
+		return lerror.New("networking.tls_flush", errorID)
+	default:
+		return fmt.Errorf("networking.tls_flush unknown error: %v", errno)
+	}
+}
+
+// SetTLSReadTimeout sets the new value for read timeout for the TLS stream.
+func SetTLSReadTimeout(tlsStreamID, timeoutMillis uint64) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("networking.set_tls_read_timeout error: %v", r)
+		}
+	}()
+
+	set_tls_read_timeout(tlsStreamID, timeoutMillis)
+	return nil
+}
+
+// GetTLSReadTimeout gets the read timeout for the TLS stream.
+func GetTLSReadTimeout(tlsStreamID uint64) (timeoutMillis uint64, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("networking.get_tls_read_timeout error: %v", r)
+		}
+	}()
+
+	timeoutMillis = get_tls_read_timeout(tlsStreamID)
+	return timeoutMillis, nil
+}
+
+// SetTLSWriteTimeout sets the new value for write timeout for the TLS stream.
+func SetTLSWriteTimeout(tlsStreamID, timeoutMillis uint64) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("networking.set_tls_write_timeout error: %v", r)
+		}
+	}()
+
+	set_tls_write_timeout(tlsStreamID, timeoutMillis)
+	return nil
+}
+
+// GetTLSWriteTimeout gets the value for the write timeout for the TLS stream.
+func GetTLSWriteTimeout(tlsStreamID uint64) (timeoutMillis uint64, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("networking.get_tls_write_timeout error: %v", r)
+		}
+	}()
+
+	timeoutMillis = get_tls_write_timeout(tlsStreamID)
+	return timeoutMillis, nil
+}
@@ -0,0 +1,144 @@
+// -*- compile-command: "GOOS=wasip1 GOARCH=wasm go test ./..."; -*-
+
+package networking
+
+import (
+	"net"
+	"time"
+)
+
+// TLSConn is a net.Conn over a lunatic TLS stream. The TLS handshake has
+// completed when DialTLS or Accept return it.
+//
+// Like TCPConn, the stream belongs to the process that created it.
+type TLSConn struct {
+	streamConn
+}
+
+var _ net.Conn = (*TLSConn)(nil)
+
+// tlsOps are the host functions of TLS streams. lunatic can't report the
+// peer address of a TLS stream, so it is only known if the stream was
+// accepted or dialed by IP address.
+var tlsOps = &streamOps{
+	network:         "tcp",
+	read:            TLSRead,
+	write:           TLSWriteVectored,
+	drop:            DropTLSStream,
+	setReadTimeout:  SetTLSReadTimeout,
+	setWriteTimeout: SetTLSWriteTimeout,
+}
+
+// NewTLSConn returns a TLSConn for the TLS stream with `streamID`.
+// The TLSConn takes ownership of the stream and drops it on Close.
+func NewTLSConn(streamID uint64) *TLSConn {
+	return &TLSConn{streamConn{id: streamID, ops: tlsOps}}
+}
+
+// DialTLS connects to the TLS server at `address` of the form "host:port"
+// and verifies its certificate for the host. `rootCerts` are optional
+// PEM-encoded root certificates trusted in addition to those of the host,
+// e.g. for servers with self-signed certificates.
+// A `timeout` of 0 means no timeout.
+func DialTLS(address string, timeout time.Duration, rootCerts []byte) (*TLSConn, error) {
+	host, service, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, &net.OpError{Op: "dial", Net: "tcp", Err: err}
+	}
+	port, err := lookupPort("tcp", service)
+	if err != nil {
+		return nil, &net.OpError{Op: "dial", Net: "tcp", Err: err}
+	}
+	if host == "" {
+		host = "127.0.0.1"
+	}
+
+	var raddr net.Addr
+	if ip := net.ParseIP(host); ip != nil {
+		raddr = &net.TCPAddr{IP: ip, Port: port}
+	}
+	id, err := TLSConnect(host, uint32(port), timeoutMillis(timeout), rootCerts)
+	if err != nil {
+		return nil, &net.OpError{Op: "dial", Net: "tcp", Addr: raddr, Err: netError(err)}
+	}
+	return &TLSConn{streamConn{id: id, ops: tlsOps, dialed: true, raddr: raddr}}, nil
+}
+
+// StreamID returns the ID of the underlying TLS stream.
+func (c *TLSConn) StreamID() uint64 { return c.id }
+
+// TLSListener is a net.Listener over a lunatic TLS listener.
+// Like TCPListener, it can only be used by the process that created it.
+type TLSListener struct {
+	id     uint64
+	addr   net.Addr
+	closed bool
+}
+
+var _ net.Listener = (*TLSListener)(nil)
+
+// ListenTLS binds a TLS listener to the local `address` of the form
+// "host:port". `cert` and `key` are the PEM-encoded certificate chain and
+// private key of the server. As with Listen, an empty host listens on all
+// IPv4 addresses and a port of 0 lets the OS choose a port.
+func ListenTLS(address string, cert, key []byte) (*TLSListener, error) {
+	infos, err := lookupAddr("tcp", address, "0.0.0.0", 0)
+	if err != nil {
+		return nil, &net.OpError{Op: "listen", Net: "tcp", Err: err}
+	}
+	info := infos[0]
+
+	id, err := TLSBind(info, cert, key)
+	if err != nil {
+		return nil, &net.OpError{Op: "listen", Net: "tcp", Addr: info.TCPAddr(), Err: err}
+	}
+	l := &TLSListener{id: id, addr: info.TCPAddr()}
+	if addr, err := TLSLocalAddr(id); err == nil {
+		l.addr = addr
+	}
+	return l, nil
+}
+
+// ListenerID returns the ID of the underlying TLS listener.
+func (l *TLSListener) ListenerID() uint64 { return l.id }
+
+// Accept waits for the next connection to the listener and completes
+// its TLS handshake.
+func (l *TLSListener) Accept() (net.Conn, error) {
+	c, err := l.AcceptTLS()
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// AcceptTLS is like Accept but returns a *TLSConn.
+func (l *TLSListener) AcceptTLS() (*TLSConn, error) {
+	if l.closed {
+		return nil, l.opError("accept", net.ErrClosed)
+	}
+	id, raddr, err := TLSAccept(l.id)
+	if err != nil {
+		return nil, l.opError("accept", err)
+	}
+	return &TLSConn{streamConn{id: id, ops: tlsOps, laddr: l.addr, raddr: raddr}}, nil
+}
+
+// Close drops the TLS listener.
+func (l *TLSListener) Close() error {
+	if l.closed {
+		return l.opError("close", net.ErrClosed)
+	}
+	l.closed = true
+	if err := DropTLSListener(l.id); err != nil {
+		return l.opError("close", err)
+	}
+	return nil
+}
+
+// Addr returns the local address of the listener.
+func (l *TLSListener) Addr() net.Addr { return l.addr }
+
+func (l *TLSListener) opError(op string, err error) error {
+	return &net.OpError{Op: op, Net: "tcp", Addr: l.addr, Err: netError(err)}
+}
@@ -0,0 +1,143 @@
+// -*- compile-command: "go test ./..."; -*-
+
+package networking_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/gmlewis/go-lunatic/lunatic/networking"
+)
+
+// selfSigned returns a PEM-encoded certificate for 127.0.0.1 and its key.
+func selfSigned(t *testing.T) (cert, key []byte) {
+	t.Helper()
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &priv.PublicKey, priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+// The TLS handshakes block until both sides take part, so the peers of the
+// lunatic connections in these tests use crypto/tls in plain goroutines.
+
+func TestTLSListener(t *testing.T) {
+	cert, key := selfSigned(t)
+	l, err := networking.ListenTLS("127.0.0.1:0", cert, key)
+	if err != nil {
+		t.Fatalf("ListenTLS: %v", err)
+	}
+	defer l.Close()
+
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(cert)
+	reply := make(chan string, 1)
+	go func() {
+		c, err := tls.Dial("tcp", l.Addr().String(), &tls.Config{RootCAs: roots})
+		if err != nil {
+			reply <- err.Error()
+			return
+		}
+		defer c.Close()
+		c.Write([]byte("ping"))
+		b, _ := io.ReadAll(c)
+		reply <- string(b)
+	}()
+
+	c, err := l.Accept()
+	if err != nil {
+		t.Fatalf("Accept: %v", err)
+	}
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(c, buf); err != nil || string(buf) != "ping" {
+		t.Errorf("Read = %q, %v, want ping", buf, err)
+	}
+	c.Write([]byte("pong"))
+	c.Close()
+	if got := <-reply; got != "pong" {
+		t.Errorf("client got %q, want pong", got)
+	}
+}
+
+func TestDialTLS(t *testing.T) {
+	cert, key := selfSigned(t)
+	pair, err := tls.X509KeyPair(cert, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{pair}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				io.Copy(c, c)
+			}()
+		}
+	}()
+
+	if _, err := networking.DialTLS(l.Addr().String(), time.Second, nil); err == nil {
+		t.Error("DialTLS without the root certificate: want error")
+	}
+
+	c, err := networking.DialTLS(l.Addr().String(), time.Second, cert)
+	if err != nil {
+		t.Fatalf("DialTLS: %v", err)
+	}
+	defer c.Close()
+	if got, want := c.RemoteAddr().String(), l.Addr().String(); got != want {
+		t.Errorf("RemoteAddr = %v, want %v", got, want)
+	}
+	if _, err := c.Write([]byte("echo")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(c, buf); err != nil || string(buf) != "echo" {
+		t.Errorf("Read = %q, %v, want echo", buf, err)
+	}
+
+	c.SetReadDeadline(time.Now().Add(20 * time.Millisecond))
+	var netErr net.Error
+	if _, err := c.Read(buf); !errors.As(err, &netErr) || !netErr.Timeout() {
+		t.Errorf("Read after the deadline = %v, want timeout", err)
+	}
+}
@@ -4,23 +4,20 @@ package lunatic
 
 import (
 	"errors"
+	"fmt"
 	"unsafe"
 
 	"github.com/gmlewis/go-lunatic/lunatic/process"
 )
 
+var (
+	FuncNotRegistered = errors.New("function not registered with lunatic.RegisterFunc")
+)
+
 type size = uint32
 type errno = uint32
 type uintptr32 = uint32
 
-//go:wasmimport wasi_snapshot_preview1 args_get
-//go:noescape
-func args_get(argv, argvBuf unsafe.Pointer) errno
-
-//go:wasmimport wasi_snapshot_preview1 args_sizes_get
-//go:noescape
-func args_sizes_get(argc, argvBufLen unsafe.Pointer) errno
-
 // Args returns the arguments that were passed to the Process' main (aka "_start") function.
 func Args() ([]string, error) {
 	// From: https://tip.golang.org/src/runtime/os_wasip1.go
@@ -51,17 +48,73 @@ func Args() ([]string, error) {
 	return argslice, nil
 }
 
+// bootstrapFuncName is the name of the exported entry point that every
+// process spawned with SpawnFunc starts in.
+const bootstrapFuncName = "__lunatic_bootstrap"
+
+// funcTable holds the functions that may be spawned with SpawnFunc.
+// A spawned process is a fresh instance of the same module, so the table
+// is rebuilt identically in the child as long as all functions are
+// registered during package initialization.
+var funcTable []func()
+
+// RegisterFunc adds `fn` to the function table and returns it unchanged
+// so that it can be used in a package-level variable declaration:
+//
+//	var child = lunatic.RegisterFunc(func() { ... })
+//
+// RegisterFunc must only be called during package initialization
+// (in a package-level variable or an `init` function) so that the
+// table index of `fn` is the same in every process of the module.
+func RegisterFunc(fn func()) func() {
+	funcTable = append(funcTable, fn)
+	return fn
+}
+
+// funcIndex returns the index of `fn` in the function table or -1 if it
+// is not found. Functions are compared by their closure pointer.
+func funcIndex(fn func()) int32 {
+	want := *(*unsafe.Pointer)(unsafe.Pointer(&fn))
+	for i, f := range funcTable {
+		if *(*unsafe.Pointer)(unsafe.Pointer(&f)) == want {
+			return int32(i)
+		}
+	}
+	return -1
+}
+
+// bootstrap is the entry point of all processes spawned with SpawnFunc.
+// The host calls it with the function table index of the function to run.
+//
+//go:wasmexport __lunatic_bootstrap
+func bootstrap(index int32) {
+	if index < 0 || int(index) >= len(funcTable) {
+		panic(fmt.Sprintf("lunatic.bootstrap: invalid function index %v (table size %v)", index, len(funcTable)))
+	}
+	funcTable[index]()
+}
+
 // SpawnFunc is a helper to spawn a new function in Go.
+//
+// `fn` must have been previously added to the function table with RegisterFunc.
+// The new process runs `fn` in its own instance of the module, so it cannot
+// share memory with the caller; use messages to communicate with it.
+//
+// Returns:
+// * nil on success with the ID of the newly-created process.
+// * FuncNotRegistered if `fn` is not in the function table.
+// * any error returned by process.Spawn.
 func SpawnFunc(fn func()) (processID uint32, err error) {
-	funcName := "__lunatic_bootstrap"
+	return SpawnLinkFunc(0, fn)
+}
 
-	processID, err = process.Spawn(0, -1, -1, funcName, nil)
-	if err != nil {
-		return processID, err
+// SpawnLinkFunc is like SpawnFunc but if `link` is not 0, it links the child
+// and the current process with `link` as the link-tag. See `process.Spawn`.
+func SpawnLinkFunc(link int64, fn func()) (processID uint32, err error) {
+	index := funcIndex(fn)
+	if index < 0 {
+		return 0, FuncNotRegistered
 	}
 
-	// TODO: finish this.
-	// nodeID := distributed.NodeID()
-	// message.Send()
-	return processID, nil
+	return process.Spawn(link, -1, -1, bootstrapFuncName, []any{index})
 }
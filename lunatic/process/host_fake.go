@@ -0,0 +1,127 @@
+// -*- compile-command: "go test ./..."; -*-
+
+//go:build !wasm
+
+package process
+
+import (
+	"time"
+
+	"github.com/gmlewis/go-lunatic/lunatic/internal/fakehost"
+)
+
+func compile_module(moduleDataPtr ptr, moduleDataLen size, idPtr ptr) int32 {
+	*(*uint64)(idPtr) = fakehost.Current().AddError(fakehost.CompileModuleError)
+	return 1
+}
+
+func drop_module(moduleID uint64) {
+	panic("fakehost: module not found")
+}
+
+func create_config() int64 {
+	return int64(fakehost.Current().AddResource(&fakehost.Config{}))
+}
+
+func drop_config(configID uint64) {
+	fakehost.TakeResource[*fakehost.Config](fakehost.Current(), configID)
+}
+
+func config(configID uint64) *fakehost.Config {
+	return fakehost.Resource[*fakehost.Config](fakehost.Current(), configID)
+}
+
+func boolToU32(v bool) uint32 {
+	if v {
+		return 1
+	}
+	return 0
+}
+
+func config_set_max_memory(configID, maxMemory uint64) { config(configID).MaxMemory = maxMemory }
+func config_get_max_memory(configID uint64) uint64     { return config(configID).MaxMemory }
+func config_set_max_fuel(configID, maxFuel uint64)     { config(configID).MaxFuel = maxFuel }
+func config_get_max_fuel(configID uint64) uint64       { return config(configID).MaxFuel }
+
+func config_can_compile_modules(configID uint64) uint32 {
+	return boolToU32(config(configID).CanCompileModules)
+}
+
+func config_set_can_compile_modules(configID uint64, can uint32) {
+	config(configID).CanCompileModules = can != 0
+}
+
+func config_can_create_configs(configID uint64) uint32 {
+	return boolToU32(config(configID).CanCreateConfigs)
+}
+
+func config_set_can_create_configs(configID uint64, can uint32) {
+	config(configID).CanCreateConfigs = can != 0
+}
+
+func config_can_spawn_processes(configID uint64) int32 {
+	return int32(boolToU32(config(configID).CanSpawnProcesses))
+}
+
+func config_set_can_spawn_processes(configID uint64, can uint32) {
+	config(configID).CanSpawnProcesses = can != 0
+}
+
+func spawn(link, configID, moduleID int64, funcStrPtr ptr, funcStrLen size,
+	paramsPtr ptr, paramsLen size, idPtr ptr) uint32 {
+	if configID != -1 {
+		config(uint64(configID))
+	}
+	if moduleID != -1 {
+		return 2
+	}
+
+	params := fakehost.DecodeParams(fakehost.Bytes(paramsPtr, paramsLen))
+	p, err := fakehost.Spawn(link, fakehost.String(funcStrPtr, funcStrLen), params)
+	if err != nil {
+		panic(err)
+	}
+	*(*uint64)(idPtr) = p.ID
+	return 0
+}
+
+func sleep_ms(millis uint64) {
+	fakehost.Sleep(time.Duration(millis) * time.Millisecond)
+}
+
+func die_when_link_dies(trap uint32) {
+	fakehost.Current().SetDieWhenLinkDies(trap != 0)
+}
+
+func process_id() uint64 {
+	return fakehost.Current().ID
+}
+
+func link(tag int64, processID uint64) {
+	p := fakehost.Current()
+	if other, ok := fakehost.Lookup(processID); ok {
+		p.Link(tag, other)
+	}
+}
+
+func unlink(processID uint64) {
+	p := fakehost.Current()
+	if other, ok := fakehost.Lookup(processID); ok {
+		p.Unlink(other)
+	}
+}
+
+func kill(processID uint64) {
+	fakehost.Current()
+	if other, ok := fakehost.Lookup(processID); ok {
+		other.Kill()
+	}
+}
+
+func exists(processID uint64) int32 {
+	fakehost.Current()
+	if _, ok := fakehost.Lookup(processID); ok {
+		return 1
+	}
+	return 0
+}
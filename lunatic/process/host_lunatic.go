@@ -0,0 +1,94 @@
+// -*- compile-command: "GOOS=wasip1 GOARCH=wasm go test ./..."; -*-
+
+//go:build wasm
+
+package process
+
+//go:wasmimport lunatic::process compile_module
+//go:noescape
+func compile_module(moduleDataPtr ptr, moduleDataLen size, idPtr ptr) int32
+
+//go:wasmimport lunatic::process drop_module
+//go:noescape
+func drop_module(moduleID uint64)
+
+//go:wasmimport lunatic::process create_config
+//go:noescape
+func create_config() int64
+
+//go:wasmimport lunatic::process drop_config
+//go:noescape
+func drop_config(configID uint64)
+
+//go:wasmimport lunatic::process config_set_max_memory
+//go:noescape
+func config_set_max_memory(configID, maxMemory uint64)
+
+//go:wasmimport lunatic::process config_get_max_memory
+//go:noescape
+func config_get_max_memory(configID uint64) uint64
+
+//go:wasmimport lunatic::process config_set_max_fuel
+//go:noescape
+func config_set_max_fuel(configID, maxFuel uint64)
+
+//go:wasmimport lunatic::process config_get_max_fuel
+//go:noescape
+func config_get_max_fuel(configID uint64) uint64
+
+//go:wasmimport lunatic::process config_can_compile_modules
+//go:noescape
+func config_can_compile_modules(configID uint64) uint32
+
+//go:wasmimport lunatic::process config_set_can_compile_modules
+//go:noescape
+func config_set_can_compile_modules(configID uint64, can uint32)
+
+//go:wasmimport lunatic::process config_can_create_configs
+//go:noescape
+func config_can_create_configs(configID uint64) uint32
+
+//go:wasmimport lunatic::process config_set_can_create_configs
+//go:noescape
+func config_set_can_create_configs(configID uint64, can uint32)
+
+//go:wasmimport lunatic::process config_can_spawn_processes
+//go:noescape
+func config_can_spawn_processes(configID uint64) int32
+
+//go:wasmimport lunatic::process config_set_can_spawn_processes
+//go:noescape
+func config_set_can_spawn_processes(configID uint64, can uint32)
+
+//go:wasmimport lunatic::process spawn
+//go:noescape
+func spawn(link, configID, moduleID int64, funcStrPtr ptr, funcStrLen size,
+	paramsPtr ptr, paramsLen size, idPtr ptr) uint32
+
+//go:wasmimport lunatic::process sleep_ms
+//go:noescape
+func sleep_ms(millis uint64)
+
+//go:wasmimport lunatic::process die_when_link_dies
+//go:noescape
+func die_when_link_dies(trap uint32)
+
+//go:wasmimport lunatic::process process_id
+//go:noescape
+func process_id() uint64
+
+//go:wasmimport lunatic::process link
+//go:noescape
+func link(tag int64, processID uint64)
+
+//go:wasmimport lunatic::process unlink
+//go:noescape
+func unlink(processID uint64)
+
+//go:wasmimport lunatic::process kill
+//go:noescape
+func kill(processID uint64)
+
+//go:wasmimport lunatic::process exists
+//go:noescape
+func exists(processID uint64) int32
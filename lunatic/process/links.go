@@ -0,0 +1,177 @@
+// -*- compile-command: "GOOS=wasip1 GOARCH=wasm go test ./..."; -*-
+
+package process
+
+import "sync"
+
+// The host can't report the links of a process or whether it traps their
+// deaths, so both are tracked here. This lets monitors be emulated with
+// links while a process still dies when a link made with Link fails,
+// unless it called DieWhenLinkDies(false).
+
+// linkInfo is a link of the current process to another process.
+type linkInfo struct {
+	tag     int64 // the link-tag known to the host.
+	linked  bool  // made with Link or Spawn.
+	monitor bool  // made with Monitor.
+	calls   int   // the number of calls waiting on it, see WatchCall.
+}
+
+// linkState is the state of the links of a process.
+type linkState struct {
+	links map[uint64]*linkInfo // process ID => link
+	// trapLinks is set by DieWhenLinkDies(false).
+	trapLinks bool
+	// hostTraps is the setting last passed to the host.
+	hostTraps bool
+}
+
+// firstMonitorTag is the first link-tag used to emulate monitors.
+const firstMonitorTag int64 = 0x4d4f_0000_0000
+
+var (
+	linksMu        sync.Mutex
+	lastMonitorTag = firstMonitorTag
+	// linkStates is keyed by process ID since all processes share
+	// the package state under the fake host.
+	linkStates = map[uint64]*linkState{}
+)
+
+// nextMonitorTag returns a new link-tag for an emulated monitor.
+// linksMu must be held.
+func nextMonitorTag() int64 {
+	lastMonitorTag++
+	return lastMonitorTag
+}
+
+// currentLinks returns the link state of the current process.
+// linksMu must be held.
+func currentLinks() *linkState {
+	id := process_id()
+	s := linkStates[id]
+	if s == nil {
+		s = &linkState{links: map[uint64]*linkInfo{}}
+		linkStates[id] = s
+	}
+	return s
+}
+
+// update tells the host to trap link deaths if the process traps them
+// itself or watches a process with a monitor or a call, and forgets the
+// state once it is empty. linksMu must be held.
+func (s *linkState) update() {
+	trap := s.trapLinks
+	for _, l := range s.links {
+		trap = trap || l.monitor || l.calls > 0
+	}
+	if trap != s.hostTraps {
+		s.hostTraps = trap
+		if trap {
+			die_when_link_dies(0)
+		} else {
+			die_when_link_dies(1)
+		}
+	}
+	if len(s.links) == 0 && !s.hostTraps {
+		delete(linkStates, process_id())
+	}
+}
+
+// TrapsLinks reports whether the current process called
+// DieWhenLinkDies(false).
+func TrapsLinks() bool {
+	linksMu.Lock()
+	defer linksMu.Unlock()
+	return currentLinks().trapLinks
+}
+
+// LinkDied is called by `message.Receive` when a LinkDied signal with `tag`
+// is received, and forgets the link. It returns the ID of the process
+// that died and whether it was linked with Link or Spawn, or monitored.
+func LinkDied(tag int64) (processID uint64, linked, monitored bool) {
+	linksMu.Lock()
+	defer linksMu.Unlock()
+	s := currentLinks()
+	for id, l := range s.links {
+		if l.tag == tag {
+			delete(s.links, id)
+			s.update()
+			return id, l.linked, l.monitor
+		}
+	}
+	return 0, false, false
+}
+
+// WatchCall is used by `message.Request` to watch `processID` while it waits
+// for its reply. Its failure is reported with a LinkDied signal with `tag`.
+// `shared` reports whether that signal is also one the process asked for
+// with Link or Monitor, so it must be handed on. `done` stops watching.
+func WatchCall(processID uint64) (tag int64, shared bool, done func()) {
+	linksMu.Lock()
+	defer linksMu.Unlock()
+	s := currentLinks()
+	l := s.links[processID]
+	if l == nil {
+		l = &linkInfo{}
+		s.links[processID] = l
+	}
+	tag, shared = s.watch(processID, l)
+	return tag, shared, func() {
+		linksMu.Lock()
+		defer linksMu.Unlock()
+		s := currentLinks()
+		if s.links[processID] == l {
+			s.unwatch(processID, l)
+		}
+		s.update()
+	}
+}
+
+// IsWatchTag reports whether `tag` is a link-tag used by Monitor or
+// WatchCall. A process that traps link deaths receives LinkDied signals
+// with such tags when a process that monitors or calls it fails, which
+// it can ignore.
+func IsWatchTag(tag int64) bool {
+	return tag > firstMonitorTag
+}
+
+// addLink records a link to `processID` with `tag` made with Link or Spawn.
+func addLink(tag int64, processID uint64) {
+	linksMu.Lock()
+	defer linksMu.Unlock()
+	s := currentLinks()
+	l := s.links[processID]
+	if l == nil {
+		l = &linkInfo{}
+		s.links[processID] = l
+	}
+	l.tag, l.linked = tag, true
+}
+
+// removeLink unlinks `processID`. If it is monitored, the link is kept with a new link-tag for the monitor.
+func removeLink(processID uint64) {
+	linksMu.Lock()
+	defer linksMu.Unlock()
+	s := currentLinks()
+	l := s.links[processID]
+	switch {
+	case l != nil && l.monitor:
+		l.linked = false
+		l.tag = nextMonitorTag()
+		link(l.tag, processID)
+		return
+	default:
+		delete(s.links, processID)
+	}
+	s.update()
+	unlink(processID)
+}
+
+// setTrapLinks records the setting of DieWhenLinkDies.
+func setTrapLinks(trap bool) {
+	linksMu.Lock()
+	defer linksMu.Unlock()
+	s := currentLinks()
+	s.trapLinks = trap
+	s.update()
+}
@@ -0,0 +1,54 @@
+// -*- compile-command: "GOOS=wasip1 GOARCH=wasm go test ./..."; -*-
+
+package process
+
+import "fmt"
+
+// Monitor starts monitoring `processID`. When the monitored process fails,
+// a `ProcessDied` signal with its ID is put into this process' mailbox
+// and is returned as a *message.ProcessDiedSignal by `message.Receive`.
+// The current process never dies because of it.
+//
+// WARNING: lunatic has no monitors, so Monitor links to the process.
+// Links are bidirectional, so the monitored process DIES IF THE CURRENT
+// PROCESS FAILS, unless it called `DieWhenLinkDies(false)` itself.
+// Only monitor processes that trap link deaths or that may die with the
+// current process.
+//
+// The other limitations of the link are:
+//   - Only failures of the monitored process are reported, since the host
+//     doesn't notify links of normal exits.
+//   - The host traps the deaths of all links of the current process while it
+//     monitors any process. `message.Receive` then makes the process panic on
+//     the death of a process linked with `Link` or `Spawn`, unless it called
+//     `DieWhenLinkDies(false)`, so it still dies with its links, though only
+//     once it receives a message.
+//
+// Returns:
+// * Error if process ID doesn't exist.
+func Monitor(processID uint64) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("process.monitor error: %v", r)
+		}
+	}()
+
+	startMonitor(processID)
+	return nil
+}
+
+// Demonitor stops monitoring `processID`. A link to it made with `Link`
+// is kept.
+//
+// Returns:
+// * Error if process ID doesn't exist.
+func Demonitor(processID uint64) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("process.demonitor error: %v", r)
+		}
+	}()
+
+	stopMonitor(processID)
+	return nil
+}
@@ -0,0 +1,67 @@
+// -*- compile-command: "GOOS=wasip1 GOARCH=wasm go test ./..."; -*-
+
+package process
+
+func startMonitor(processID uint64) {
+	if exists(processID) == 0 {
+		panic("process does not exist")
+	}
+
+	linksMu.Lock()
+	defer linksMu.Unlock()
+	s := currentLinks()
+	l := s.links[processID]
+	if l == nil {
+		l = &linkInfo{tag: nextMonitorTag()}
+		s.links[processID] = l
+	}
+	watched := l.linked || l.calls > 0
+	l.monitor = true
+	// Trap link deaths before linking, so that the process can't die
+	// because of the monitor.
+	s.update()
+	if !watched {
+		link(l.tag, processID)
+	}
+}
+
+func stopMonitor(processID uint64) {
+	linksMu.Lock()
+	defer linksMu.Unlock()
+	s := currentLinks()
+	l := s.links[processID]
+	if l == nil || !l.monitor {
+		return
+	}
+	l.monitor = false
+	if !l.linked && l.calls == 0 {
+		delete(s.links, processID)
+		unlink(processID)
+	}
+	s.update()
+}
+
+// watch watches `processID` for a call with the link `l`, linking to it
+// unless it is linked already. linksMu must be held.
+func (s *linkState) watch(processID uint64, l *linkInfo) (tag int64, shared bool) {
+	shared = l.linked || l.monitor
+	watched := shared || l.calls > 0
+	if !watched {
+		l.tag = nextMonitorTag()
+	}
+	l.calls++
+	s.update()
+	if !watched {
+		link(l.tag, processID)
+	}
+	return l.tag, shared
+}
+
+// unwatch undoes watch. linksMu must be held.
+func (s *linkState) unwatch(processID uint64, l *linkInfo) {
+	l.calls--
+	if !l.linked && !l.monitor && l.calls == 0 {
+		delete(s.links, processID)
+		unlink(processID)
+	}
+}
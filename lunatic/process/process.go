@@ -4,9 +4,9 @@
 package process
 
 import (
+	"encoding/binary"
 	"errors"
 	"fmt"
-	"log"
 	"unsafe"
 )
 
@@ -22,10 +22,6 @@ type size = uint32
 
 func mkptr[T any](v *T) ptr { return unsafe.Pointer(v) }
 
-//go:wasmimport lunatic::process compile_module
-//go:noescape
-func compile_module(moduleDataPtr ptr, moduleDataLen size, idPtr ptr) int32
-
 // CompileModule compiles a new WebAssembly module.
 //
 // The `Spawn` function can be used to spawn new processes from the module.
@@ -37,7 +33,9 @@ func compile_module(moduleDataPtr ptr, moduleDataLen size, idPtr ptr) int32
 // * a wrapped wrror ID
 func CompileModule(moduleData string) (id uint32, err error) {
 	moduleDataBytes := []byte(moduleData)
-	errno := compile_module(mkptr(&moduleDataBytes[0]), size(len(moduleData)), mkptr(&id))
+	var moduleID uint64
+	errno := compile_module(mkptr(&moduleDataBytes[0]), size(len(moduleData)), mkptr(&moduleID))
+	id = uint32(moduleID)
 	switch errno {
 	case 0:
 		return id, nil
@@ -50,10 +48,6 @@ func CompileModule(moduleData string) (id uint32, err error) {
 	}
 }
 
-//go:wasmimport lunatic::process drop_module
-//go:noescape
-func drop_module(moduleID uint64)
-
 // DropModule drops the module from resources.
 //
 // Errors:
@@ -69,10 +63,6 @@ func DropModule(moduleID uint64) (err error) {
 	return nil
 }
 
-//go:wasmimport lunatic::process create_config
-//go:noescape
-func create_config() int64
-
 // CreateConfig creates a new configuration with all permissions denied.
 //
 // There is no memory or fuel limit set on the newly-created configuration.
@@ -89,10 +79,6 @@ func CreateConfig() (id int64, err error) {
 	}
 }
 
-//go:wasmimport lunatic::process drop_config
-//go:noescape
-func drop_config(configID uint64)
-
 // DropConfig drops the configuration from resources.
 //
 // Returns:
@@ -108,10 +94,6 @@ func DropConfig(configID uint64) (err error) {
 	return nil
 }
 
-//go:wasmimport lunatic::process config_set_max_memory
-//go:noescape
-func config_set_max_memory(configID, maxMemory uint64)
-
 // ConfigSetMaxMemory sets the memory limit on a configuration.
 //
 // Returns:
@@ -127,10 +109,6 @@ func ConfigSetMaxMemory(configID, maxMemory uint64) (err error) {
 	return nil
 }
 
-//go:wasmimport lunatic::process config_get_max_memory
-//go:noescape
-func config_get_max_memory(configID uint64) uint64
-
 // ConfigGetMaxMemory returns the memory limit of a configuration.
 //
 // Returns:
@@ -146,10 +124,6 @@ func ConfigGetMaxMemory(configID uint64) (maxMemory uint64, err error) {
 	return n, nil
 }
 
-//go:wasmimport lunatic::process config_set_max_fuel
-//go:noescape
-func config_set_max_fuel(configID, maxFuel uint64)
-
 // ConfigSetMaxFuel sets the fuel limit on a configuration.
 //
 // A value of 0 indicates no fuel limit.
@@ -167,10 +141,6 @@ func ConfigSetMaxFuel(configID, maxFuel uint64) (err error) {
 	return nil
 }
 
-//go:wasmimport lunatic::process config_get_max_fuel
-//go:noescape
-func config_get_max_fuel(configID uint64) uint64
-
 // ConfigGetMaxFuel returns the fuel limit of a configuration.
 //
 // A value of 0 indicates no fuel limit.
@@ -188,10 +158,6 @@ func ConfigGetMaxFuel(configID uint64) (maxFuel uint64, err error) {
 	return n, nil
 }
 
-//go:wasmimport lunatic::process config_can_compile_modules
-//go:noescape
-func config_can_compile_modules(configID uint64) uint32
-
 // ConfigCanCompileModules returns whether processes spawned from this
 // configuration can compile Wasm modules.
 //
@@ -208,10 +174,6 @@ func ConfigCanCompileModules(configID uint64) (ok bool, err error) {
 	return n == 1, nil
 }
 
-//go:wasmimport lunatic::process config_set_can_compile_modules
-//go:noescape
-func config_set_can_compile_modules(configID uint64, can uint32)
-
 // ConfigSetCanCompileModules sets whether processes spawned from this
 // configuration will be able to compile Wasm modules.
 //
@@ -232,10 +194,6 @@ func ConfigSetCanCompileModules(configID uint64, ok bool) (err error) {
 	return nil
 }
 
-//go:wasmimport lunatic::process config_can_create_configs
-//go:noescape
-func config_can_create_configs(configID uint64) uint32
-
 // ConfigCanCreateConfigs returns whether processes spawned from this
 // configuration can create other configurations.
 //
@@ -252,10 +210,6 @@ func ConfigCanCreateConfigs(configID uint64) (ok bool, err error) {
 	return n == 1, nil
 }
 
-//go:wasmimport lunatic::process config_set_can_create_configs
-//go:noescape
-func config_set_can_create_configs(configID uint64, can uint32)
-
 // ConfigSetCanCreateConfigs sets whether processes spawned from this
 // configuration will be able to create other configurations.
 //
@@ -276,10 +230,6 @@ func ConfigSetCanCreateConfigs(configID uint64, ok bool) (err error) {
 	return nil
 }
 
-//go:wasmimport lunatic::process config_can_spawn_processes
-//go:noescape
-func config_can_spawn_processes(configID uint64) int32
-
 // ConfigCanSpawnProcesses returns whether processes spawned from this
 // configuration can spawn sub-processes.
 //
@@ -296,10 +246,6 @@ func ConfigCanSpawnProcesses(configID uint64) (ok bool, err error) {
 	return n == 1, nil
 }
 
-//go:wasmimport lunatic::process config_set_can_spawn_processes
-//go:noescape
-func config_set_can_spawn_processes(configID uint64, can uint32)
-
 // ConfigSetCanSpawnProcesses sets whether processes spawned from this
 // configuration will be able to spawn sub-processes
 //
@@ -320,11 +266,6 @@ func ConfigSetCanSpawnProcesses(configID uint64, ok bool) (err error) {
 	return nil
 }
 
-//go:wasmimport lunatic::process spawn
-//go:noescape
-func spawn(link, configID, moduleID int64, funcStrPtr ptr, funcStrLen size,
-	paramsPtr ptr, paramsLen size, idPtr ptr) uint32
-
 // Spawn spawns a new process using the passed-in function inside a module as the entry point.
 //
 // If `link` is not 0, it will link the child and parent processes. The value of `link` will
@@ -352,56 +293,41 @@ func Spawn(link, configID, moduleID int64, funcStr string, params []any) (id uin
 		}
 	}()
 
-	paramsBytes := make([]byte, 18*len(params))
-	copyBytes := func(index int, v uint64) {
-		log.Printf("copyBytes(index=%v, v=%v)", index, v)
-		src := unsafe.Slice((*byte)(unsafe.Pointer(&v)), 17)
-		log.Printf("copyBytes: src=%T=%v", src, src)
-		for i := 0; i < 17; i++ {
-			log.Printf("copyBytes: paramsBytes[%v]=src[%v]", index*18+i, i)
-			paramsBytes[index*18+i] = src[i]
-		}
-		log.Printf("leaving copyBytes(index=%v, v=%v)", index, v)
-	}
-
+	// Each param is encoded as a value type byte followed by a
+	// 128-bit little-endian value.
+	paramsBytes := make([]byte, 17*len(params))
 	for i, param := range params {
-		log.Printf("Spawn: i=%v, param=%T=%v", i, param, param)
-		i32func := func(v uint64) {
-			paramsBytes[i*18] = 0x7F // i32
-			copyBytes(i, v)
-		}
-		i64func := func(v uint64) {
-			paramsBytes[i*18] = 0x7E // i64
-			copyBytes(i, v)
-		}
-
+		var v uint64
+		valueType := byte(0x7F) // i32
 		switch t := param.(type) {
 		case int8:
-			i32func(uint64(t))
+			v = uint64(t)
 		case int16:
-			i32func(uint64(t))
+			v = uint64(t)
 		case int:
-			i32func(uint64(t))
+			v = uint64(t)
 		case int32:
-			i32func(uint64(t))
+			v = uint64(t)
 		case uint8:
-			i32func(uint64(t))
+			v = uint64(t)
 		case uint16:
-			i32func(uint64(t))
+			v = uint64(t)
 		case uint:
-			i32func(uint64(t))
+			v = uint64(t)
 		case uint32:
-			i32func(uint64(t))
+			v = uint64(t)
 		case int64:
-			i64func(uint64(t))
+			v, valueType = uint64(t), 0x7E // i64
 		case uint64:
-			i64func(uint64(t))
+			v, valueType = t, 0x7E
 		case uintptr:
-			i64func(uint64(t))
+			v, valueType = uint64(t), 0x7E
 		// case i128, u128:  // https://github.com/golang/go/issues/9455#issuecomment-74165846
 		default:
 			return id, fmt.Errorf("params[%v] = %T, expected integer", i, param)
 		}
+		paramsBytes[i*17] = valueType
+		binary.LittleEndian.PutUint64(paramsBytes[i*17+1:], v)
 	}
 
 	funcStrBytes := []byte(funcStr)
@@ -410,11 +336,14 @@ func Spawn(link, configID, moduleID int64, funcStr string, params []any) (id uin
 		paramsBytesPtr = mkptr(&paramsBytes[0])
 	}
 
-	log.Printf("Spawn calling spawn(%v,%v,%v,%v,%v,%v,%v,%v)", link, configID, moduleID, mkptr(&funcStrBytes[0]), size(len(funcStr)), paramsBytesPtr, size(len(paramsBytes)), mkptr(&id))
-	errno := spawn(link, configID, moduleID, mkptr(&funcStrBytes[0]), size(len(funcStr)), paramsBytesPtr, size(len(paramsBytes)), mkptr(&id))
-	log.Printf("spawn errno=%v, id=%v", errno, id)
+	var processID uint64
+	errno := spawn(link, configID, moduleID, mkptr(&funcStrBytes[0]), size(len(funcStr)), paramsBytesPtr, size(len(paramsBytes)), mkptr(&processID))
+	id = uint32(processID)
 	switch errno {
 	case 0:
+		if link != 0 {
+			addLink(link, processID)
+		}
 		return id, nil
 	case 1:
 		return id, NodeDoesNotExist
@@ -431,14 +360,9 @@ func Spawn(link, configID, moduleID int64, funcStr string, params []any) (id uin
 //
 // Returns:
 // * Error if config ID doesn't exist.
-//
-//go:wasmimport lunatic::process sleep_ms
-//go:noescape
-func SleepMS(millis uint64)
-
-//go:wasmimport lunatic::process die_when_link_dies
-//go:noescape
-func die_when_link_dies(trap uint32)
+func SleepMS(millis uint64) {
+	sleep_ms(millis)
+}
 
 // DieWhenLinkDies defines what happens to this process if one of the linked processes
 // notifies us that it died.
@@ -447,23 +371,19 @@ func die_when_link_dies(trap uint32)
 // this process' mailbox.
 //
 // The default behavior for a newly-spawned process is to die.
+//
+// While the process monitors other processes, the host always turns the
+// signals into messages, since monitors are emulated with links (see Monitor).
+// If `die` is true, the process then dies in `message.Receive` when it
+// receives the signal of a link made with Link or Spawn.
 func DieWhenLinkDies(die bool) {
-	var trap uint32
-	if die {
-		trap = 1
-	}
-	die_when_link_dies(trap)
+	setTrapLinks(!die)
 }
 
 // ProcessID returns the ID of the process currently running.
-//
-//go:wasmimport lunatic::process process_id
-//go:noescape
-func ProcessID() uint64
-
-//go:wasmimport lunatic::process link
-//go:noescape
-func link(tag int64, processID uint64)
+func ProcessID() uint64 {
+	return process_id()
+}
 
 // Link links the current process to `processID`. This is not an atomic operation. Either of
 // the two processes could fail before processing the `Link` signal and may not notify the other.
@@ -478,13 +398,10 @@ func Link(tag int64, processID uint64) (err error) {
 	}()
 
 	link(tag, processID)
+	addLink(tag, processID)
 	return nil
 }
 
-//go:wasmimport lunatic::process unlink
-//go:noescape
-func unlink(processID uint64)
-
 // Unlink unlinks the current process from `processID`. This is not an atomic operation.
 //
 // Returns:
@@ -496,14 +413,10 @@ func Unlink(processID uint64) (err error) {
 		}
 	}()
 
-	unlink(processID)
+	removeLink(processID)
 	return nil
 }
 
-//go:wasmimport lunatic::process kill
-//go:noescape
-func kill(processID uint64)
-
 // Kill sends a kill signal to `processID`.
 //
 // Returns:
@@ -519,10 +432,6 @@ func Kill(processID uint64) (err error) {
 	return nil
 }
 
-//go:wasmimport lunatic::process exists
-//go:noescape
-func exists(processID uint64) int32
-
 // Exists returns whether the `processID` exists.
 //
 // Returns:
@@ -0,0 +1,230 @@
+// -*- compile-command: "go test ./..."; -*-
+
+package process_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/gmlewis/go-lunatic/lunatic/internal/fakehost"
+	"github.com/gmlewis/go-lunatic/lunatic/message"
+	"github.com/gmlewis/go-lunatic/lunatic/process"
+)
+
+const (
+	replyTag int64 = 1
+	linkTag  int64 = 2
+)
+
+func init() {
+	// "echo" sends its params back to the process ID in params[0].
+	fakehost.RegisterEntry("echo", func(params []uint64) {
+		message.CreateData(replyTag, 0)
+		message.EncodeData(params[1:], nil)
+		message.Send(params[0])
+	})
+	fakehost.RegisterEntry("fail", func(params []uint64) {
+		panic("fail")
+	})
+	fakehost.RegisterEntry("block", func(params []uint64) {
+		message.Receive(nil, nil)
+	})
+	fakehost.RegisterEntry("failOnMessage", func(params []uint64) {
+		message.Receive(nil, nil)
+		panic("fail")
+	})
+	// "linkAndMonitor" links to a child that fails once it is told to, and
+	// monitors the process params[0], so it should still die with the child.
+	fakehost.RegisterEntry("linkAndMonitor", func(params []uint64) {
+		child, _ := process.Spawn(linkTag, -1, -1, "failOnMessage", nil)
+		process.Monitor(params[0])
+		message.Receive(nil, nil)
+		message.CreateData(1, 0)
+		message.Send(uint64(child))
+		message.Receive(nil, nil)
+		message.Receive(nil, nil)
+	})
+}
+
+// receiveSignals receives `n` messages and returns them by type.
+func receiveSignals(t *testing.T, n int) (linkDied *message.LinkDiedSignal, processDied *message.ProcessDiedSignal) {
+	t.Helper()
+	timeout := uint64(5000)
+	for i := 0; i < n; i++ {
+		msg, err := message.Receive(nil, &timeout)
+		if err != nil {
+			t.Fatalf("Receive: %v", err)
+		}
+		switch sig := msg.(type) {
+		case *message.LinkDiedSignal:
+			linkDied = sig
+		case *message.ProcessDiedSignal:
+			processDied = sig
+		default:
+			t.Fatalf("Receive = %#v, want a signal", msg)
+		}
+	}
+	return linkDied, processDied
+}
+
+func TestSpawnParams(t *testing.T) {
+	_, err := process.Spawn(0, -1, -1, "echo", []any{process.ProcessID(), int32(-1), uint64(1 << 40), uint8(7)})
+	if err != nil {
+		t.Fatalf("Spawn: %v", err)
+	}
+
+	if _, err := message.Receive([]int64{replyTag}, nil); err != nil {
+		t.Fatalf("Receive: %v", err)
+	}
+	var got []uint64
+	if err := message.DecodeData(&got); err != nil {
+		t.Fatalf("DecodeData: %v", err)
+	}
+	want := []uint64{0xffff_ffff_ffff_ffff, 1 << 40, 7}
+	if len(got) != len(want) {
+		t.Fatalf("params = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("params[%v] = %#x, want %#x", i, got[i], want[i])
+		}
+	}
+}
+
+func TestSpawnErrors(t *testing.T) {
+	if _, err := process.Spawn(0, -1, -1, "echo", []any{"not an integer"}); err == nil {
+		t.Error("Spawn with a string param: want error")
+	}
+	if _, err := process.Spawn(0, -1, 1, "echo", nil); !errors.Is(err, process.ModuleDoesNotExist) {
+		t.Errorf("Spawn with unknown module = %v, want ModuleDoesNotExist", err)
+	}
+	if _, err := process.Spawn(0, 12345, -1, "echo", nil); err == nil {
+		t.Error("Spawn with unknown config: want error")
+	}
+	if _, err := process.Spawn(0, -1, -1, "does-not-exist", nil); err == nil {
+		t.Error("Spawn of unknown function: want error")
+	}
+}
+
+func TestLinkDied(t *testing.T) {
+	process.DieWhenLinkDies(false)
+	defer process.DieWhenLinkDies(true)
+
+	if _, err := process.Spawn(linkTag, -1, -1, "fail", nil); err != nil {
+		t.Fatalf("Spawn: %v", err)
+	}
+	timeout := uint64(5000)
+	msg, err := message.Receive([]int64{linkTag}, &timeout)
+	if err != nil {
+		t.Fatalf("Receive: %v", err)
+	}
+	if sig, ok := msg.(*message.LinkDiedSignal); !ok || sig.Tag != linkTag {
+		t.Errorf("Receive = %#v, want LinkDiedSignal with tag %v", msg, linkTag)
+	}
+}
+
+func TestKillAndExists(t *testing.T) {
+	id, err := process.Spawn(0, -1, -1, "block", nil)
+	if err != nil {
+		t.Fatalf("Spawn: %v", err)
+	}
+	if !process.Exists(uint64(id)) {
+		t.Fatal("Exists = false before Kill")
+	}
+
+	if err := process.Monitor(uint64(id)); err != nil {
+		t.Fatalf("Monitor: %v", err)
+	}
+	defer process.DieWhenLinkDies(true)
+	if err := process.Kill(uint64(id)); err != nil {
+		t.Fatalf("Kill: %v", err)
+	}
+
+	timeout := uint64(5000)
+	msg, err := message.Receive(nil, &timeout)
+	if err != nil {
+		t.Fatalf("Receive: %v", err)
+	}
+	if sig, ok := msg.(*message.ProcessDiedSignal); !ok || sig.ProcessID != uint64(id) {
+		t.Errorf("Receive = %#v, want ProcessDiedSignal for %v", msg, id)
+	}
+	if process.Exists(uint64(id)) {
+		t.Error("Exists = true after the process died")
+	}
+}
+
+func TestConfig(t *testing.T) {
+	id, err := process.CreateConfig()
+	if err != nil {
+		t.Fatalf("CreateConfig: %v", err)
+	}
+	config := uint64(id)
+
+	if err := process.ConfigSetMaxMemory(config, 1<<20); err != nil {
+		t.Fatalf("ConfigSetMaxMemory: %v", err)
+	}
+	if n, err := process.ConfigGetMaxMemory(config); err != nil || n != 1<<20 {
+		t.Errorf("ConfigGetMaxMemory = %v, %v, want %v", n, err, 1<<20)
+	}
+	if err := process.ConfigSetCanSpawnProcesses(config, true); err != nil {
+		t.Fatalf("ConfigSetCanSpawnProcesses: %v", err)
+	}
+	if ok, err := process.ConfigCanSpawnProcesses(config); err != nil || !ok {
+		t.Errorf("ConfigCanSpawnProcesses = %v, %v, want true", ok, err)
+	}
+
+	if err := process.DropConfig(config); err != nil {
+		t.Fatalf("DropConfig: %v", err)
+	}
+	if _, err := process.ConfigGetMaxMemory(config); err == nil {
+		t.Error("ConfigGetMaxMemory after DropConfig: want error")
+	}
+}
+
+func TestMonitorLinked(t *testing.T) {
+	process.DieWhenLinkDies(false)
+	defer process.DieWhenLinkDies(true)
+
+	id, err := process.Spawn(0, -1, -1, "failOnMessage", nil)
+	if err != nil {
+		t.Fatalf("Spawn: %v", err)
+	}
+	pid := uint64(id)
+	process.Link(linkTag, pid)
+	// Demonitor keeps the link.
+	process.Monitor(pid)
+	process.Demonitor(pid)
+	process.Monitor(pid)
+
+	message.CreateData(1, 0)
+	message.Send(pid)
+	linkDied, processDied := receiveSignals(t, 2)
+	if linkDied == nil || linkDied.Tag != linkTag {
+		t.Errorf("LinkDiedSignal = %#v, want tag %v", linkDied, linkTag)
+	}
+	if processDied == nil || processDied.ProcessID != pid {
+		t.Errorf("ProcessDiedSignal = %#v, want process %v", processDied, pid)
+	}
+}
+
+func TestMonitorKeepsLinksFatal(t *testing.T) {
+	blocker, err := process.Spawn(0, -1, -1, "block", nil)
+	if err != nil {
+		t.Fatalf("Spawn: %v", err)
+	}
+	defer process.Kill(uint64(blocker))
+	id, err := process.Spawn(0, -1, -1, "linkAndMonitor", []any{uint64(blocker)})
+	if err != nil {
+		t.Fatalf("Spawn: %v", err)
+	}
+	process.Monitor(uint64(id))
+	defer process.DieWhenLinkDies(true)
+	message.CreateData(1, 0)
+	message.Send(uint64(id))
+
+	// The process dies with its failing child although it monitors another
+	// process and never called DieWhenLinkDies(false).
+	if _, processDied := receiveSignals(t, 1); processDied == nil || processDied.ProcessID != uint64(id) {
+		t.Errorf("ProcessDiedSignal = %#v, want process %v", processDied, id)
+	}
+}
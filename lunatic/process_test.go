@@ -0,0 +1,62 @@
+// -*- compile-command: "go test ./..."; -*-
+
+package lunatic_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/gmlewis/go-lunatic/lunatic"
+	"github.com/gmlewis/go-lunatic/lunatic/message"
+	"github.com/gmlewis/go-lunatic/lunatic/process"
+)
+
+var hello = lunatic.RegisterFunc(func() {
+	call, err := message.ReceiveRequest[string](1)
+	if err != nil {
+		panic(err)
+	}
+	call.Reply("hello, " + call.Body)
+})
+
+func TestSpawnFunc(t *testing.T) {
+	pid, err := lunatic.SpawnFunc(hello)
+	if err != nil {
+		t.Fatalf("SpawnFunc: %v", err)
+	}
+	got, err := message.Request[string](uint64(pid), 1, "world", 0)
+	if err != nil {
+		t.Fatalf("Request: %v", err)
+	}
+	if want := "hello, world"; got != want {
+		t.Errorf("Request = %q, want %q", got, want)
+	}
+}
+
+func TestSpawnFuncNotRegistered(t *testing.T) {
+	if _, err := lunatic.SpawnFunc(func() {}); !errors.Is(err, lunatic.FuncNotRegistered) {
+		t.Errorf("SpawnFunc = %v, want FuncNotRegistered", err)
+	}
+}
+
+func TestSpawnLinkFunc(t *testing.T) {
+	process.DieWhenLinkDies(false)
+	defer process.DieWhenLinkDies(true)
+
+	// hello fails when its request is not a string.
+	pid, err := lunatic.SpawnLinkFunc(2, hello)
+	if err != nil {
+		t.Fatalf("SpawnLinkFunc: %v", err)
+	}
+	message.CreateData(1, 0)
+	message.EncodeData(42, nil)
+	message.Send(uint64(pid))
+
+	msg, err := message.Receive([]int64{2}, nil)
+	if err != nil {
+		t.Fatalf("Receive: %v", err)
+	}
+	if _, ok := msg.(*message.LinkDiedSignal); !ok {
+		t.Errorf("Receive = %#v, want LinkDiedSignal", msg)
+	}
+}
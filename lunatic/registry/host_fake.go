@@ -0,0 +1,35 @@
+// -*- compile-command: "go test ./..."; -*-
+
+//go:build !wasm
+
+package registry
+
+import "github.com/gmlewis/go-lunatic/lunatic/internal/fakehost"
+
+func put(nameStrPtr ptr, nameStrLen size, nodeID, processID uint64) {
+	fakehost.RegistryPut(fakehost.String(nameStrPtr, nameStrLen), nodeID, processID)
+}
+
+func get(nameStrPtr ptr, nameStrLen size, nodeIDPtr, processIDPtr ptr) uint32 {
+	nodeID, processID, ok := fakehost.RegistryGet(fakehost.String(nameStrPtr, nameStrLen))
+	if !ok {
+		return 1
+	}
+	*(*uint64)(nodeIDPtr) = nodeID
+	*(*uint64)(processIDPtr) = processID
+	return 0
+}
+
+func get_or_put_later(nameStrPtr ptr, nameStrLen size, nodeIDPtr, processIDPtr ptr) uint32 {
+	nodeID, processID, ok := fakehost.RegistryGetOrPutLater(fakehost.String(nameStrPtr, nameStrLen))
+	if !ok {
+		return 1
+	}
+	*(*uint64)(nodeIDPtr) = nodeID
+	*(*uint64)(processIDPtr) = processID
+	return 0
+}
+
+func remove(nameStrPtr ptr, nameStrLen size) {
+	fakehost.RegistryRemove(fakehost.String(nameStrPtr, nameStrLen))
+}
@@ -0,0 +1,21 @@
+// -*- compile-command: "GOOS=wasip1 GOARCH=wasm go test ./..."; -*-
+
+//go:build wasm
+
+package registry
+
+//go:wasmimport lunatic::registry put
+//go:noescape
+func put(nameStrPtr ptr, nameStrLen size, nodeID, processID uint64)
+
+//go:wasmimport lunatic::registry get
+//go:noescape
+func get(nameStrPtr ptr, nameStrLen size, nodeIDPtr, processIDPtr ptr) uint32
+
+//go:wasmimport lunatic::registry get_or_put_later
+//go:noescape
+func get_or_put_later(nameStrPtr ptr, nameStrLen size, nodeIDPtr, processIDPtr ptr) uint32
+
+//go:wasmimport lunatic::registry remove
+//go:noescape
+func remove(nameStrPtr ptr, nameStrLen size)
@@ -6,6 +6,9 @@ package registry
 import (
 	"fmt"
 	"unsafe"
+
+	"github.com/gmlewis/go-lunatic/lunatic/distributed"
+	"github.com/gmlewis/go-lunatic/lunatic/process"
 )
 
 type ptr = unsafe.Pointer
@@ -13,10 +16,6 @@ type size = uint32
 
 func mkptr[T any](v *T) ptr { return unsafe.Pointer(v) }
 
-//go:wasmimport lunatic::registry put
-//go:noescape
-func put(nameStrPtr ptr, nameStrLen size, nodeID, processID uint64)
-
 // Put registers process with `processID` under `name`.
 func Put(name string, nodeID, processID uint64) (err error) {
 	defer func() {
@@ -25,29 +24,48 @@ func Put(name string, nodeID, processID uint64) (err error) {
 		}
 	}()
 
-	put(mkptr(&name), size(len(name)), nodeID, processID)
+	nameBytes := []byte(name)
+	put(mkptr(&nameBytes[0]), size(len(name)), nodeID, processID)
 	return nil
 }
 
-//go:wasmimport lunatic::registry get
-//go:noescape
-func get(nameStrPtr ptr, nameStrLen size, nodeID, processID uint64) uint32
-
-// Get looks up process under `name` and returns if it was found.
-func Get(name string, nodeID, processID uint64) (ok bool, err error) {
+// Get looks up the process registered under `name`.
+//
+// Returns:
+// * true with the node ID and process ID if the process was found.
+// * false if no process is registered under `name`.
+func Get(name string) (nodeID, processID uint64, ok bool, err error) {
 	defer func() {
 		if r := recover(); r != nil {
 			err = fmt.Errorf("registry.get error: %v", r)
 		}
 	}()
 
-	n := get(mkptr(&name), size(len(name)), nodeID, processID)
-	return n == 0, nil
+	nameBytes := []byte(name)
+	n := get(mkptr(&nameBytes[0]), size(len(name)), mkptr(&nodeID), mkptr(&processID))
+	return nodeID, processID, n == 0, nil
 }
 
-//go:wasmimport lunatic::registry remove
-//go:noescape
-func remove(nameStrPtr ptr, nameStrLen size)
+// GetOrPutLater looks up the process registered under `name` like Get.
+// If none is registered, the registry stays locked for all other processes
+// until the current process calls Put or Remove, or exits. This lets a
+// single process spawn and register a process for `name` without racing
+// with others that do the same.
+//
+// Returns:
+// * true with the node ID and process ID if the process was found.
+// * false if no process is registered under `name`. Put or Remove must follow.
+func GetOrPutLater(name string) (nodeID, processID uint64, ok bool, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("registry.get_or_put_later error: %v", r)
+		}
+	}()
+
+	nameBytes := []byte(name)
+	n := get_or_put_later(mkptr(&nameBytes[0]), size(len(name)), mkptr(&nodeID), mkptr(&processID))
+	return nodeID, processID, n == 0, nil
+}
 
 // Remove removes the process under `name` if it exists.
 func Remove(name string) (err error) {
@@ -57,6 +75,45 @@ func Remove(name string) (err error) {
 		}
 	}()
 
-	remove(mkptr(&name), size(len(name)))
+	nameBytes := []byte(name)
+	remove(mkptr(&nameBytes[0]), size(len(name)))
 	return nil
 }
+
+// GetOrSpawn returns the ID of the process registered under `name`. If none
+// is registered or it no longer exists, it spawns one with `spawn` and
+// registers it on the current node. Processes calling GetOrSpawn at the same time get the same
+// process, except while a registered process that died is replaced.
+//
+// Returns:
+// * nil with the process ID on success.
+// * error if the registry fails or `spawn` returns an error.
+func GetOrSpawn(name string, spawn func() (processID uint64, err error)) (uint64, error) {
+	for {
+		_, processID, ok, err := GetOrPutLater(name)
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			if process.Exists(processID) {
+				return processID, nil
+			}
+			if err := Remove(name); err != nil {
+				return 0, err
+			}
+			continue
+		}
+
+		processID, err = spawn()
+		if err != nil {
+			Remove(name)
+			return 0, err
+		}
+		if err := Put(name, distributed.NodeID(), processID); err != nil {
+			process.Kill(processID)
+			Remove(name)
+			return 0, err
+		}
+		return processID, nil
+	}
+}
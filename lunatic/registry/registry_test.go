@@ -0,0 +1,114 @@
+// -*- compile-command: "go test ./..."; -*-
+
+package registry_test
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gmlewis/go-lunatic/lunatic/internal/fakehost"
+	"github.com/gmlewis/go-lunatic/lunatic/message"
+	"github.com/gmlewis/go-lunatic/lunatic/process"
+	"github.com/gmlewis/go-lunatic/lunatic/registry"
+)
+
+func init() {
+	fakehost.RegisterEntry("block", func(params []uint64) {
+		message.Receive(nil, nil)
+	})
+}
+
+func TestRegistry(t *testing.T) {
+	if err := registry.Put("server", 1, 42); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	nodeID, processID, ok, err := registry.Get("server")
+	if err != nil || !ok {
+		t.Fatalf("Get = %v, %v, want found", ok, err)
+	}
+	if nodeID != 1 || processID != 42 {
+		t.Errorf("Get = node %v, process %v, want node 1, process 42", nodeID, processID)
+	}
+
+	if err := registry.Remove("server"); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	if _, _, ok, err := registry.Get("server"); err != nil || ok {
+		t.Errorf("Get after Remove = %v, %v, want not found", ok, err)
+	}
+}
+
+func TestGetOrPutLater(t *testing.T) {
+	if _, _, ok, err := registry.GetOrPutLater("lazy"); err != nil || ok {
+		t.Fatalf("GetOrPutLater = %v, %v, want not found", ok, err)
+	}
+	// Other processes wait until the name is put.
+	done := make(chan uint64)
+	go func() {
+		_, processID, _, _ := registry.Get("lazy")
+		done <- processID
+	}()
+	select {
+	case <-done:
+		t.Fatal("Get of another process did not wait for Put")
+	case <-time.After(20 * time.Millisecond):
+	}
+	if err := registry.Put("lazy", 1, 7); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if processID := <-done; processID != 7 {
+		t.Errorf("Get of another process = %v, want 7", processID)
+	}
+
+	if _, processID, ok, err := registry.GetOrPutLater("lazy"); err != nil || !ok || processID != 7 {
+		t.Errorf("GetOrPutLater = %v, %v, %v, want 7", processID, ok, err)
+	}
+	registry.Remove("lazy")
+}
+
+func TestGetOrSpawn(t *testing.T) {
+	var spawned atomic.Int32
+	spawn := func() (uint64, error) {
+		spawned.Add(1)
+		time.Sleep(10 * time.Millisecond)
+		id, err := process.Spawn(0, -1, -1, "block", nil)
+		return uint64(id), err
+	}
+
+	// Processes asking at the same time share a single process.
+	var wg sync.WaitGroup
+	pids := make([]uint64, 5)
+	for i := range pids {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			pids[i], _ = registry.GetOrSpawn("shared", spawn)
+		}()
+	}
+	wg.Wait()
+	for _, pid := range pids {
+		if pid == 0 || pid != pids[0] {
+			t.Fatalf("GetOrSpawn = %v, want the same process", pids)
+		}
+	}
+	if n := spawned.Load(); n != 1 {
+		t.Errorf("spawned %v processes, want 1", n)
+	}
+	if node, pid, ok, err := registry.Get("shared"); err != nil || !ok || node != fakehost.NodeID || pid != pids[0] {
+		t.Errorf("Get = %v, %v, %v, %v, want node %v and process %v", node, pid, ok, err, fakehost.NodeID, pids[0])
+	}
+
+	// A process that died is replaced.
+	process.Kill(pids[0])
+	for process.Exists(pids[0]) {
+		time.Sleep(time.Millisecond)
+	}
+	pid, err := registry.GetOrSpawn("shared", spawn)
+	if err != nil || pid == pids[0] {
+		t.Errorf("GetOrSpawn after Kill = %v, %v, want a new process", pid, err)
+	}
+	process.Kill(pid)
+	registry.Remove("shared")
+}
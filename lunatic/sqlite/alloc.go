@@ -0,0 +1,39 @@
+// -*- compile-command: "GOOS=wasip1 GOARCH=wasm go test ./..."; -*-
+
+package sqlite
+
+import "sync"
+
+// guestPtr is an address in the guest memory as seen by the host.
+type guestPtr = uint32
+
+// The host returns variable-length data, like rows and error messages,
+// by calling the exported `lunatic_alloc` function of the guest to get a
+// buffer, writing the data into it and returning its address. The length
+// is written to the `opaquePtr` argument of the host function.
+//
+// Buffers are kept in allocations until they are claimed, so that the
+// garbage collector doesn't free them in between.
+var (
+	allocMu     sync.Mutex
+	allocations = map[guestPtr][]byte{}
+)
+
+// claim returns the buffer of length `n` allocated by the host at `p`.
+// Empty data returns nil, but its allocation, if any, is still released.
+func claim(p guestPtr, n size) []byte {
+	allocMu.Lock()
+	defer allocMu.Unlock()
+	buf, ok := allocations[p]
+	if !ok && n == 0 {
+		return nil
+	}
+	if !ok || uint32(len(buf)) < n {
+		panic("sqlite: host returned an unknown buffer")
+	}
+	delete(allocations, p)
+	if n == 0 {
+		return nil
+	}
+	return buf[:n]
+}
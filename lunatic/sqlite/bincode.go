@@ -0,0 +1,159 @@
+// -*- compile-command: "GOOS=wasip1 GOARCH=wasm go test ./..."; -*-
+
+package sqlite
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// encoder and decoder implement the bincode encoding of the bind data,
+// values, column names and errors exchanged with the host.
+//
+// Values are encoded as the variants of the SqliteValue enum of the host:
+// Null, Blob, Text, Real and Integer. Bound values use the BindValue enum
+// instead: Null, Blob, Text, Double, Int and Int64.
+type encoder struct {
+	buf []byte
+}
+
+func (e *encoder) u8(v byte)    { e.buf = append(e.buf, v) }
+func (e *encoder) u32(v uint32) { e.buf = binary.LittleEndian.AppendUint32(e.buf, v) }
+func (e *encoder) u64(v uint64) { e.buf = binary.LittleEndian.AppendUint64(e.buf, v) }
+
+func (e *encoder) bytes(b []byte) {
+	e.u64(uint64(len(b)))
+	e.buf = append(e.buf, b...)
+}
+
+func (e *encoder) value(v any) {
+	switch v := v.(type) {
+	case nil:
+		e.u32(0)
+	case []byte:
+		e.u32(1)
+		e.bytes(v)
+	case string:
+		e.u32(2)
+		e.bytes([]byte(v))
+	case float64:
+		e.u32(3)
+		e.u64(math.Float64bits(v))
+	case int64:
+		e.u32(4)
+		e.u64(uint64(v))
+	default:
+		panic(fmt.Sprintf("sqlite: unsupported value type %T", v))
+	}
+}
+
+// bindValue encodes `v` as a BindValue. Integers are always bound as
+// Int64, since the Int variant only holds 32 bits.
+func (e *encoder) bindValue(v any) {
+	if v, ok := v.(int64); ok {
+		e.u32(5)
+		e.u64(uint64(v))
+		return
+	}
+	e.value(v)
+}
+
+type decoder struct {
+	buf []byte
+}
+
+func (d *decoder) next(n int) []byte {
+	if len(d.buf) < n {
+		panic("sqlite: bincode data is truncated")
+	}
+	b := d.buf[:n]
+	d.buf = d.buf[n:]
+	return b
+}
+
+func (d *decoder) u8() byte    { return d.next(1)[0] }
+func (d *decoder) u32() uint32 { return binary.LittleEndian.Uint32(d.next(4)) }
+func (d *decoder) u64() uint64 { return binary.LittleEndian.Uint64(d.next(8)) }
+
+func (d *decoder) bytes() []byte {
+	return append([]byte(nil), d.next(int(d.u64()))...)
+}
+
+func (d *decoder) value() any {
+	switch d.u32() {
+	case 0:
+		return nil
+	case 1:
+		return d.bytes()
+	case 2:
+		return string(d.bytes())
+	case 3:
+		return math.Float64frombits(d.u64())
+	case 4:
+		return int64(d.u64())
+	default:
+		panic("sqlite: invalid SqliteValue")
+	}
+}
+
+func (d *decoder) bindValue() any {
+	switch d.u32() {
+	case 0:
+		return nil
+	case 1:
+		return d.bytes()
+	case 2:
+		return string(d.bytes())
+	case 3:
+		return math.Float64frombits(d.u64())
+	case 4:
+		return int64(int32(d.u32()))
+	case 5:
+		return int64(d.u64())
+	default:
+		panic("sqlite: invalid BindValue")
+	}
+}
+
+// DecodeValue decodes a value returned by ReadColumn into nil, int64,
+// float64, string or []byte.
+func DecodeValue(data []byte) (v any, err error) {
+	err = decode(data, func(d *decoder) { v = d.value() })
+	return v, err
+}
+
+// DecodeValues decodes a row returned by ReadRow into values like DecodeValue.
+func DecodeValues(data []byte) (values []any, err error) {
+	err = decode(data, func(d *decoder) {
+		values = make([]any, d.u64())
+		for i := range values {
+			values[i] = d.value()
+		}
+	})
+	return values, err
+}
+
+// DecodeNames decodes the column names returned by ColumnNames.
+func DecodeNames(data []byte) (names []string, err error) {
+	err = decode(data, func(d *decoder) {
+		names = make([]string, d.u64())
+		for i := range names {
+			names[i] = string(d.bytes())
+		}
+	})
+	return names, err
+}
+
+// decode runs `f` on the bincode `data` of the host, turning a panic on
+// malformed data into an error.
+func decode(data []byte, f func(d *decoder)) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("sqlite: decode error: %v", r)
+		}
+	}()
+
+	f(&decoder{buf: data})
+	return nil
+}
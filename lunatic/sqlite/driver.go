@@ -0,0 +1,279 @@
+// -*- compile-command: "GOOS=wasip1 GOARCH=wasm go test ./..."; -*-
+
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// DriverName is the name under which Driver is registered with database/sql.
+const DriverName = "lunatic-sqlite"
+
+func init() {
+	sql.Register(DriverName, Driver{})
+}
+
+// Driver is a database/sql driver for the SQLite databases of the lunatic
+// host. The data source name is the path of the database, e.g.
+//
+//	db, err := sql.Open("lunatic-sqlite", "app.db")
+//
+// Like all lunatic resources, the connections belong to the process that
+// opened them, so a *sql.DB must not be shared between processes.
+// Every connection to ":memory:" opens a new database; call
+// db.SetMaxOpenConns(1) to keep using the same one.
+//
+// lunatic has no host function to close a SQLite connection, so closing a
+// connection doesn't release it: it stays open until the process exits.
+// Call db.SetConnMaxLifetime(0), db.SetConnMaxIdleTime(0) and keep
+// db.SetMaxIdleConns at least as high as db.SetMaxOpenConns, so that
+// database/sql doesn't close and reopen connections while the process runs.
+//
+// Parameters are bound by position (`?`, `?NNN`) or by name with
+// sql.Named, whose name is bound with a `:` prefix. Booleans are stored
+// as integers and times as RFC 3339 text.
+type Driver struct{}
+
+var _ driver.Driver = Driver{}
+
+// Open opens a connection to the database at `name`.
+func (Driver) Open(name string) (driver.Conn, error) {
+	id, err := Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &sqlConn{id: id}, nil
+}
+
+type sqlConn struct {
+	id uint64
+}
+
+var (
+	_ driver.ConnBeginTx       = (*sqlConn)(nil)
+	_ driver.ExecerContext     = (*sqlConn)(nil)
+	_ driver.NamedValueChecker = (*sqlConn)(nil)
+)
+
+func (c *sqlConn) Prepare(query string) (driver.Stmt, error) {
+	id, err := QueryPrepare(c.id, query)
+	if err != nil {
+		return nil, c.lastError(err)
+	}
+	return &sqlStmt{conn: c, id: id}, nil
+}
+
+// Close can't release the connection, since lunatic has no host function to
+// close a SQLite connection. It stays open until the process exits, see Driver.
+func (c *sqlConn) Close() error { return nil }
+
+func (c *sqlConn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *sqlConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if opts.ReadOnly {
+		return nil, errors.New("sqlite: read-only transactions are not supported")
+	}
+	if level := sql.IsolationLevel(opts.Isolation); level != sql.LevelDefault && level != sql.LevelSerializable {
+		return nil, fmt.Errorf("sqlite: isolation level %v is not supported", level)
+	}
+	if err := c.exec("BEGIN"); err != nil {
+		return nil, err
+	}
+	return sqlTx{c}, nil
+}
+
+// ExecContext runs queries without arguments with Execute, so that they
+// may contain several statements, e.g. to create a schema.
+func (c *sqlConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if len(args) > 0 {
+		return nil, driver.ErrSkip
+	}
+	if err := c.exec(query); err != nil {
+		return nil, err
+	}
+	return c.result()
+}
+
+// CheckNamedValue converts the argument to one of the types of SQLite.
+func (c *sqlConn) CheckNamedValue(nv *driver.NamedValue) error {
+	v, err := convertValue(nv.Value)
+	if err != nil {
+		return err
+	}
+	nv.Value = v
+	return nil
+}
+
+func (c *sqlConn) exec(query string) error {
+	if err := Execute(c.id, query); err != nil {
+		return c.lastError(err)
+	}
+	return nil
+}
+
+func (c *sqlConn) result() (driver.Result, error) {
+	n, err := Changes(c.id)
+	if err != nil {
+		return nil, err
+	}
+	return sqlResult{conn: c, changes: int64(n)}, nil
+}
+
+// lastInsertID queries the rowid of the last inserted row of the
+// connection, since the host doesn't report it.
+func (c *sqlConn) lastInsertID() (int64, error) {
+	rows, err := Query(c.id, "SELECT last_insert_rowid()")
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	var id int64
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return 0, err
+		}
+		return 0, errors.New("sqlite: last_insert_rowid returned no row")
+	}
+	if err := rows.Scan(&id); err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+func (c *sqlConn) lastError(err error) error { return lastError(c.id, err) }
+
+// sqlResult is the number of rows changed by a statement.
+type sqlResult struct {
+	conn    *sqlConn
+	changes int64
+}
+
+// LastInsertId queries the rowid of the last inserted row of the connection
+// when it is called, so it must be called before the next insert.
+func (r sqlResult) LastInsertId() (int64, error) { return r.conn.lastInsertID() }
+func (r sqlResult) RowsAffected() (int64, error) { return r.changes, nil }
+
+type sqlTx struct {
+	conn *sqlConn
+}
+
+func (t sqlTx) Commit() error   { return t.conn.exec("COMMIT") }
+func (t sqlTx) Rollback() error { return t.conn.exec("ROLLBACK") }
+
+type sqlStmt struct {
+	conn *sqlConn
+	id   uint64
+}
+
+var (
+	_ driver.StmtExecContext  = (*sqlStmt)(nil)
+	_ driver.StmtQueryContext = (*sqlStmt)(nil)
+)
+
+func (s *sqlStmt) Close() error { return Finalize(s.id) }
+
+// NumInput returns -1, since the host doesn't report the number of parameters.
+func (s *sqlStmt) NumInput() int { return -1 }
+
+func (s *sqlStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.ExecContext(context.Background(), namedValues(args))
+}
+
+func (s *sqlStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	if err := s.start(args); err != nil {
+		return nil, err
+	}
+	for {
+		status, err := s.step()
+		if err != nil {
+			return nil, err
+		}
+		if status == SQLiteDone {
+			return s.conn.result()
+		}
+	}
+}
+
+func (s *sqlStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.QueryContext(context.Background(), namedValues(args))
+}
+
+func (s *sqlStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	if err := s.start(args); err != nil {
+		return nil, err
+	}
+	// The columns of a statement are only known after the first step.
+	status, err := s.step()
+	if err != nil {
+		return nil, err
+	}
+	columns, err := columnNames(s.id)
+	if err != nil {
+		return nil, err
+	}
+	return &sqlRows{stmt: s, columns: columns, status: status}, nil
+}
+
+// start resets the statement and binds `args`.
+func (s *sqlStmt) start(args []driver.NamedValue) error {
+	if err := StatementReset(s.id); err != nil {
+		return err
+	}
+	return bind(s.id, args)
+}
+
+func (s *sqlStmt) step() (uint32, error) { return step(s.conn.id, s.id) }
+
+type sqlRows struct {
+	stmt    *sqlStmt
+	columns []string
+	// status is the result of the last step and read is set once
+	// its row has been returned by Next.
+	status uint32
+	read   bool
+}
+
+func (r *sqlRows) Columns() []string { return r.columns }
+
+// Close resets the statement, so that it doesn't keep the database locked.
+func (r *sqlRows) Close() error { return StatementReset(r.stmt.id) }
+
+func (r *sqlRows) Next(dest []driver.Value) error {
+	if r.read {
+		status, err := r.stmt.step()
+		if err != nil {
+			return err
+		}
+		r.status, r.read = status, false
+	}
+	if r.status != SQLiteRow {
+		return io.EOF
+	}
+	r.read = true
+
+	values, err := rowValues(r.stmt.id)
+	if err != nil {
+		return err
+	}
+	for i := range dest {
+		if i < len(values) {
+			dest[i] = values[i]
+		}
+	}
+	return nil
+}
+
+func namedValues(args []driver.Value) []driver.NamedValue {
+	nvs := make([]driver.NamedValue, len(args))
+	for i, v := range args {
+		nvs[i] = driver.NamedValue{Ordinal: i + 1, Value: v}
+	}
+	return nvs
+}
@@ -0,0 +1,147 @@
+// -*- compile-command: "go test ./..."; -*-
+
+package sqlite_test
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gmlewis/go-lunatic/lunatic/sqlite"
+)
+
+func openDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open(sqlite.DriverName, ":memory:")
+	if err != nil {
+		t.Fatalf("sql.Open: %v", err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	if _, err := db.Exec(`
+		CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT, score REAL, admin INTEGER, avatar BLOB, created TEXT);
+		INSERT INTO users (name, score) VALUES ('ann', 1.5);
+	`); err != nil {
+		t.Fatalf("Exec: %v", err)
+	}
+	return db
+}
+
+func TestDriverQuery(t *testing.T) {
+	db := openDB(t)
+
+	st, err := db.Prepare("INSERT INTO users (name, score, admin, avatar, created) VALUES (?, ?, ?, ?, ?)")
+	if err != nil {
+		t.Fatalf("Prepare: %v", err)
+	}
+	defer st.Close()
+	created := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	for i, name := range []string{"bob", "eve"} {
+		res, err := st.Exec(name, 2, true, []byte{1, 2}, created)
+		if err != nil {
+			t.Fatalf("Exec: %v", err)
+		}
+		if n, err := res.RowsAffected(); err != nil || n != 1 {
+			t.Errorf("RowsAffected = %v, %v, want 1", n, err)
+		}
+		if id, err := res.LastInsertId(); err != nil || id != int64(i+2) {
+			t.Errorf("LastInsertId = %v, %v, want %v", id, err, i+2)
+		}
+	}
+
+	// Integers wider than 32 bits are bound as Int64.
+	var big int64
+	if err := db.QueryRow("SELECT ?", int64(1)<<40).Scan(&big); err != nil || big != 1<<40 {
+		t.Errorf("SELECT ? = %v, %v, want %v", big, err, int64(1)<<40)
+	}
+
+	var name, createdText string
+	var admin bool
+	var avatar []byte
+	if err := db.QueryRow("SELECT name, admin, avatar, created FROM users WHERE id = :id", sql.Named("id", 3)).
+		Scan(&name, &admin, &avatar, &createdText); err != nil {
+		t.Fatalf("QueryRow: %v", err)
+	}
+	if name != "eve" || !admin || string(avatar) != "\x01\x02" || createdText != "2024-01-02T03:04:05Z" {
+		t.Errorf("QueryRow = %v, %v, %v, %v", name, admin, avatar, createdText)
+	}
+
+	rows, err := db.Query("SELECT name, score, avatar FROM users WHERE score >= ? ORDER BY name DESC", 1)
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	defer rows.Close()
+	if cols, _ := rows.Columns(); strings.Join(cols, ",") != "name,score,avatar" {
+		t.Errorf("Columns = %v", cols)
+	}
+	var got []string
+	for rows.Next() {
+		var score float64
+		var avatar sql.RawBytes
+		if err := rows.Scan(&name, &score, &avatar); err != nil {
+			t.Fatalf("Scan: %v", err)
+		}
+		got = append(got, name)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatalf("Next: %v", err)
+	}
+	if strings.Join(got, ",") != "eve,bob,ann" {
+		t.Errorf("Query returned %v, want eve,bob,ann", got)
+	}
+}
+
+func TestDriverTx(t *testing.T) {
+	db := openDB(t)
+	count := func() (n int) {
+		t.Helper()
+		if err := db.QueryRow("SELECT COUNT(*) FROM users").Scan(&n); err != nil {
+			t.Fatalf("QueryRow: %v", err)
+		}
+		return n
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+	if _, err := tx.Exec("INSERT INTO users (name) VALUES (?)", "bob"); err != nil {
+		t.Fatalf("Exec: %v", err)
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Fatalf("Rollback: %v", err)
+	}
+	if n := count(); n != 1 {
+		t.Errorf("count after Rollback = %v, want 1", n)
+	}
+
+	tx, err = db.Begin()
+	if err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+	if _, err := tx.Exec("DELETE FROM users WHERE name = ?", "ann"); err != nil {
+		t.Fatalf("Exec: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit: %v", err)
+	}
+	if n := count(); n != 0 {
+		t.Errorf("count after Commit = %v, want 0", n)
+	}
+}
+
+func TestDriverError(t *testing.T) {
+	db := openDB(t)
+
+	_, err := db.Query("SELECT * FROM missing WHERE id = ?", 1)
+	var sqliteErr *sqlite.Error
+	if !errors.As(err, &sqliteErr) || !strings.Contains(sqliteErr.Message, "no such table") {
+		t.Errorf("Query on a missing table = %v, want *sqlite.Error", err)
+	}
+	if _, err := db.Exec("INSERT INTO nowhere VALUES (1)"); !errors.As(err, &sqliteErr) {
+		t.Errorf("Exec on a missing table = %v, want *sqlite.Error", err)
+	}
+}
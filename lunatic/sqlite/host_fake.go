@@ -0,0 +1,175 @@
+// -*- compile-command: "go test ./..."; -*-
+
+//go:build !wasm
+
+package sqlite
+
+import (
+	"errors"
+
+	"github.com/gmlewis/go-lunatic/lunatic/internal/fakehost"
+)
+
+// statement is a prepared statement of the fake host.
+type statement struct {
+	conn    *fakehost.SQLiteConn
+	stmt    *fakehost.SQLStatement
+	params  map[any]fakehost.Value
+	columns []string
+	rows    [][]fakehost.Value
+	row     int // index of the current row + 1; 0 before the first step.
+	ran     bool
+}
+
+var lastAlloc guestPtr
+
+// alloc stores `data` like lunatic_alloc does on wasm and writes its length to `opaquePtr`.
+// Since native pointers don't fit into a guestPtr, the buffer is identified by a counter.
+func alloc(data []byte, opaquePtr ptr) guestPtr {
+	allocMu.Lock()
+	defer allocMu.Unlock()
+	lastAlloc++
+	allocations[lastAlloc] = append(data, 0)
+	*(*size)(opaquePtr) = size(len(data))
+	return lastAlloc
+}
+
+func conn(connID uint64) *fakehost.SQLiteConn {
+	return fakehost.Resource[*fakehost.SQLiteConn](fakehost.Current(), connID)
+}
+
+func stmt(statementID uint64) *statement {
+	return fakehost.Resource[*statement](fakehost.Current(), statementID)
+}
+
+func open(pathStrPtr ptr, pathStrLen size, connectionIDPtr ptr) uint64 {
+	c := fakehost.OpenSQLite(fakehost.String(pathStrPtr, pathStrLen))
+	*(*uint64)(connectionIDPtr) = fakehost.Current().AddResource(c)
+	return 0
+}
+
+func query_prepare(connID uint64, queryStrPtr ptr, queryStrLen size) uint64 {
+	c := conn(connID)
+	stmts, err := fakehost.ParseSQL(fakehost.String(queryStrPtr, queryStrLen))
+	if err == nil && len(stmts) == 0 {
+		err = errors.New("not an SQL statement")
+	}
+	if err != nil {
+		c.LastError = err.Error()
+		panic(err) // the host traps.
+	}
+	return fakehost.Current().AddResource(&statement{conn: c, stmt: stmts[0], params: map[any]fakehost.Value{}})
+}
+
+func execute(connID uint64, execStrPtr ptr, execStrLen size) uint32 {
+	if err := conn(connID).Execute(fakehost.String(execStrPtr, execStrLen)); err != nil {
+		return 1
+	}
+	return 0
+}
+
+func bind_value(statementID uint64, bindDataPtr ptr, bindDataLen size) {
+	s := stmt(statementID)
+	d := &decoder{buf: fakehost.Bytes(bindDataPtr, bindDataLen)}
+	n := d.u64()
+	for i := uint64(0); i < n; i++ {
+		var key any
+		switch d.u32() {
+		case 0: // BindKey::None
+			key = int(i + 1)
+		case 1: // BindKey::Numeric
+			key = int(d.u64())
+		case 2: // BindKey::String
+			key = string(d.bytes())
+		default:
+			panic("fakehost: invalid BindKey")
+		}
+		s.params[key] = d.bindValue()
+	}
+}
+
+func sqlite3_changes(connID uint64) uint32 {
+	return conn(connID).Changes
+}
+
+func statement_reset(statementID uint64) {
+	s := stmt(statementID)
+	s.rows, s.row, s.ran = nil, 0, false
+	s.params = map[any]fakehost.Value{}
+}
+
+func sqlite3_step(statementID uint64) uint32 {
+	s := stmt(statementID)
+	if !s.ran {
+		columns, rows, err := s.conn.Run(s.stmt, s.params)
+		if err != nil {
+			return 1 // SQLITE_ERROR
+		}
+		s.columns, s.rows, s.ran = columns, rows, true
+	}
+	if s.row < len(s.rows) {
+		s.row++
+		return fakehost.SQLiteRow
+	}
+	return fakehost.SQLiteDone
+}
+
+func sqlite3_finalize(statementID uint64) {
+	fakehost.TakeResource[*statement](fakehost.Current(), statementID)
+}
+
+func column_count(statementID uint64) uint32 {
+	return uint32(len(stmt(statementID).columns))
+}
+
+func last_error(connID uint64, opaquePtr ptr) guestPtr {
+	var e encoder
+	msg := conn(connID).LastError
+	if msg == "" {
+		e.u8(0) // code: None
+		e.u8(0) // message: None
+	} else {
+		e.u8(1)
+		e.u32(1) // SQLITE_ERROR
+		e.u8(1)
+		e.bytes([]byte(msg))
+	}
+	return alloc(e.buf, opaquePtr)
+}
+
+func current(s *statement) []fakehost.Value {
+	if s.row == 0 || s.row > len(s.rows) {
+		panic(errors.New("fakehost: no current row"))
+	}
+	return s.rows[s.row-1]
+}
+
+func read_column(statementID uint64, colIdx uint32, opaquePtr ptr) guestPtr {
+	var e encoder
+	e.value(current(stmt(statementID))[colIdx])
+	return alloc(e.buf, opaquePtr)
+}
+
+func read_row(statementID uint64, opaquePtr ptr) guestPtr {
+	var e encoder
+	row := current(stmt(statementID))
+	e.u64(uint64(len(row)))
+	for _, v := range row {
+		e.value(v)
+	}
+	return alloc(e.buf, opaquePtr)
+}
+
+func column_name(statementID uint64, columnIdx uint32, opaquePtr ptr) guestPtr {
+	return alloc([]byte(stmt(statementID).columns[columnIdx]), opaquePtr)
+}
+
+func column_names(statementID uint64, opaquePtr ptr) guestPtr {
+	var e encoder
+	columns := stmt(statementID).columns
+	e.u64(uint64(len(columns)))
+	for _, c := range columns {
+		e.bytes([]byte(c))
+	}
+	return alloc(e.buf, opaquePtr)
+}
@@ -0,0 +1,75 @@
+// -*- compile-command: "GOOS=wasip1 GOARCH=wasm go test ./..."; -*-
+
+//go:build wasm
+
+package sqlite
+
+import "unsafe"
+
+// lunatic_alloc allocates a buffer of `n` bytes for the host.
+//
+//go:wasmexport lunatic_alloc
+func lunatic_alloc(n uint32) guestPtr {
+	buf := make([]byte, max(n, 1))
+	p := guestPtr(uintptr(unsafe.Pointer(&buf[0])))
+	allocMu.Lock()
+	allocations[p] = buf
+	allocMu.Unlock()
+	return p
+}
+
+//go:wasmimport lunatic::sqlite open
+//go:noescape
+func open(pathStrPtr ptr, pathStrLen size, connectionIDPtr ptr) uint64
+
+//go:wasmimport lunatic::sqlite query_prepare
+//go:noescape
+func query_prepare(connID uint64, queryStrPtr ptr, queryStrLen size) uint64
+
+//go:wasmimport lunatic::sqlite execute
+//go:noescape
+func execute(connID uint64, execStrPtr ptr, execStrLen size) uint32
+
+//go:wasmimport lunatic::sqlite bind_value
+//go:noescape
+func bind_value(statementID uint64, bindDataPtr ptr, bindDataLen size)
+
+//go:wasmimport lunatic::sqlite sqlite3_changes
+//go:noescape
+func sqlite3_changes(connID uint64) uint32
+
+//go:wasmimport lunatic::sqlite statement_reset
+//go:noescape
+func statement_reset(statementID uint64)
+
+//go:wasmimport lunatic::sqlite sqlite3_step
+//go:noescape
+func sqlite3_step(statementID uint64) uint32
+
+//go:wasmimport lunatic::sqlite sqlite3_finalize
+//go:noescape
+func sqlite3_finalize(statementID uint64)
+
+//go:wasmimport lunatic::sqlite column_count
+//go:noescape
+func column_count(statementID uint64) uint32
+
+//go:wasmimport lunatic::sqlite last_error
+//go:noescape
+func last_error(connID uint64, opaquePtr ptr) guestPtr
+
+//go:wasmimport lunatic::sqlite read_column
+//go:noescape
+func read_column(statementID uint64, colIdx uint32, opaquePtr ptr) guestPtr
+
+//go:wasmimport lunatic::sqlite read_row
+//go:noescape
+func read_row(statementID uint64, opaquePtr ptr) guestPtr
+
+//go:wasmimport lunatic::sqlite column_name
+//go:noescape
+func column_name(statementID uint64, columnIdx uint32, opaquePtr ptr) guestPtr
+
+//go:wasmimport lunatic::sqlite column_names
+//go:noescape
+func column_names(statementID uint64, opaquePtr ptr) guestPtr
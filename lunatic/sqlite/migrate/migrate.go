@@ -0,0 +1,359 @@
+// -*- compile-command: "GOOS=wasip1 GOARCH=wasm go test ./..."; -*-
+
+// Package migrate applies versioned schema migrations to lunatic SQLite
+// databases.
+//
+// Migrations are loaded from SQL files with FromFS or written as Go funcs,
+// and applied in the order of their versions:
+//
+//	//go:embed migrations
+//	var migrations embed.FS
+//
+//	func main() {
+//		conn, err := sqlite.OpenConn("app.db")
+//		...
+//		ms, err := migrate.FromFS(migrations, "migrations")
+//		...
+//		m, err := migrate.New(conn, ms...)
+//		...
+//		if _, err := m.Up(); err != nil { ... }
+//	}
+//
+// The applied versions are recorded in the table DefaultTable, which is
+// updated in the same transaction as the migration itself, so a failing
+// migration leaves neither its changes nor its version behind.
+package migrate
+
+import (
+	"fmt"
+	"io/fs"
+	"math"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gmlewis/go-lunatic/lunatic/sqlite"
+)
+
+// DefaultTable is the name of the table recording the applied versions.
+const DefaultTable = "schema_migrations"
+
+// Latest is the target version of Migrate that applies all migrations.
+const Latest = math.MaxInt64
+
+// Migration is a schema change with a unique, positive version.
+type Migration struct {
+	Version int64
+	Name    string
+	// Up applies the migration. Down reverts it and may be nil if the
+	// migration can't be reverted.
+	Up   func(tx *sqlite.Tx) error
+	Down func(tx *sqlite.Tx) error
+}
+
+// SQL returns a migration func that runs the statements in `sql`.
+func SQL(sql string) func(tx *sqlite.Tx) error {
+	return func(tx *sqlite.Tx) error { return tx.Execute(sql) }
+}
+
+// FromFS loads the migrations in the directory `dir` of `fsys`.
+//
+// A migration consists of the file "<version>_<name>.up.sql" and,
+// optionally, "<version>_<name>.down.sql", e.g. "0001_create_users.up.sql".
+// Other files are ignored.
+func FromFS(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int64]*Migration{}
+	for _, e := range entries {
+		base, up := strings.CutSuffix(e.Name(), ".up.sql")
+		if !up {
+			var down bool
+			if base, down = strings.CutSuffix(e.Name(), ".down.sql"); !down {
+				continue
+			}
+		}
+		if e.IsDir() {
+			continue
+		}
+		v, name, ok := strings.Cut(base, "_")
+		version, err := strconv.ParseInt(v, 10, 64)
+		if !ok || err != nil || version <= 0 {
+			return nil, fmt.Errorf("migrate: %v: name is not of the form <version>_<name>", e.Name())
+		}
+		data, err := fs.ReadFile(fsys, path.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		m := byVersion[version]
+		if m == nil {
+			m = &Migration{Version: version, Name: name}
+			byVersion[version] = m
+		} else if m.Name != name {
+			return nil, fmt.Errorf("migrate: version %v is used by %q and %q", version, m.Name, name)
+		}
+		if up {
+			m.Up = SQL(string(data))
+		} else {
+			m.Down = SQL(string(data))
+		}
+	}
+
+	ms := make([]Migration, 0, len(byVersion))
+	for version, m := range byVersion {
+		if m.Up == nil {
+			return nil, fmt.Errorf("migrate: version %v has no .up.sql file", version)
+		}
+		ms = append(ms, *m)
+	}
+	sort.Slice(ms, func(i, j int) bool { return ms[i].Version < ms[j].Version })
+	return ms, nil
+}
+
+// Migrator applies migrations to a connection.
+type Migrator struct {
+	conn       *sqlite.Conn
+	migrations []Migration
+	// Table is the name of the table recording the applied versions.
+	Table string
+}
+
+// New returns a Migrator applying `migrations` to `conn`. Use
+// sqlite.NewConn for a connection opened with sqlite.Open.
+func New(conn *sqlite.Conn, migrations ...Migration) (*Migrator, error) {
+	ms := append([]Migration(nil), migrations...)
+	sort.Slice(ms, func(i, j int) bool { return ms[i].Version < ms[j].Version })
+	for i, m := range ms {
+		switch {
+		case m.Version <= 0:
+			return nil, fmt.Errorf("migrate: %q has version %v, want a positive version", m.Name, m.Version)
+		case m.Up == nil:
+			return nil, fmt.Errorf("migrate: version %v has no Up func", m.Version)
+		case i > 0 && ms[i-1].Version == m.Version:
+			return nil, fmt.Errorf("migrate: version %v is used by %q and %q", m.Version, ms[i-1].Name, m.Name)
+		}
+	}
+	return &Migrator{conn: conn, migrations: ms, Table: DefaultTable}, nil
+}
+
+// Direction is the direction of a Step.
+type Direction int
+
+const (
+	DirectionUp   Direction = iota // the migration is applied.
+	DirectionDown                  // the migration is reverted.
+)
+
+func (d Direction) String() string {
+	if d == DirectionDown {
+		return "down"
+	}
+	return "up"
+}
+
+// Step is the application or reversion of a migration.
+type Step struct {
+	Migration
+	Direction Direction
+}
+
+func (s Step) String() string {
+	return fmt.Sprintf("%v %v_%v", s.Direction, s.Version, s.Name)
+}
+
+// Status is a migration and whether it has been applied.
+type Status struct {
+	Migration
+	Applied bool
+}
+
+// Status lists all migrations in order of their versions.
+func (m *Migrator) Status() ([]Status, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+	statuses := make([]Status, len(m.migrations))
+	for i, mig := range m.migrations {
+		statuses[i] = Status{Migration: mig, Applied: applied[mig.Version]}
+	}
+	return statuses, nil
+}
+
+// Plan returns the steps Migrate would take to reach `target` without
+// running them or changing the database, e.g. for a dry run: the pending migrations up to `target` in
+// ascending order followed by the applied migrations above `target`
+// in descending order.
+//
+// Returns:
+// * nil on success with the steps, which may be empty.
+// * error if an applied migration above `target` is unknown or has no Down func.
+func (m *Migrator) Plan(target int64) ([]Step, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	var steps []Step
+	for _, mig := range m.migrations {
+		if mig.Version <= target && !applied[mig.Version] {
+			steps = append(steps, Step{Migration: mig, Direction: DirectionUp})
+		}
+	}
+
+	var down []int64
+	for version := range applied {
+		if version > target {
+			down = append(down, version)
+		}
+	}
+	sort.Slice(down, func(i, j int) bool { return down[i] > down[j] })
+	for _, version := range down {
+		step, err := m.downStep(version)
+		if err != nil {
+			return nil, err
+		}
+		steps = append(steps, step)
+	}
+	return steps, nil
+}
+
+// Migrate applies or reverts migrations until exactly those up to
+// `target` are applied. Each step runs in its own transaction.
+//
+// Returns:
+// * nil on success with the steps taken.
+// * error with the steps taken before a step failed.
+func (m *Migrator) Migrate(target int64) ([]Step, error) {
+	steps, err := m.Plan(target)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.createTable(); err != nil {
+		return nil, err
+	}
+	for i, step := range steps {
+		if err := m.run(step); err != nil {
+			return steps[:i], fmt.Errorf("migrate: %v: %w", step, err)
+		}
+	}
+	return steps, nil
+}
+
+// Up applies all pending migrations.
+func (m *Migrator) Up() ([]Step, error) { return m.Migrate(Latest) }
+
+// Down reverts the latest applied migration, if any.
+func (m *Migrator) Down() ([]Step, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+	var latest int64
+	for version := range applied {
+		latest = max(latest, version)
+	}
+	if latest == 0 {
+		return nil, nil
+	}
+
+	step, err := m.downStep(latest)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.createTable(); err != nil {
+		return nil, err
+	}
+	if err := m.run(step); err != nil {
+		return nil, fmt.Errorf("migrate: %v: %w", step, err)
+	}
+	return []Step{step}, nil
+}
+
+// downStep returns the step reverting the applied `version`.
+func (m *Migrator) downStep(version int64) (Step, error) {
+	i := sort.Search(len(m.migrations), func(i int) bool { return m.migrations[i].Version >= version })
+	if i == len(m.migrations) || m.migrations[i].Version != version {
+		return Step{}, fmt.Errorf("migrate: applied version %v is unknown", version)
+	}
+	mig := m.migrations[i]
+	if mig.Down == nil {
+		return Step{}, fmt.Errorf("migrate: version %v (%v) can't be reverted", version, mig.Name)
+	}
+	return Step{Migration: mig, Direction: DirectionDown}, nil
+}
+
+func (m *Migrator) run(step Step) error {
+	return m.conn.Tx(func(tx *sqlite.Tx) error {
+		if step.Direction == DirectionDown {
+			if err := step.Down(tx); err != nil {
+				return err
+			}
+			_, err := tx.Exec("DELETE FROM "+quote(m.Table)+" WHERE version = ?", step.Version)
+			return err
+		}
+		if err := step.Up(tx); err != nil {
+			return err
+		}
+		_, err := tx.Exec("INSERT INTO "+quote(m.Table)+" (version, name, applied_at) VALUES (?, ?, ?)",
+			step.Version, step.Name, time.Now().UTC())
+		return err
+	})
+}
+
+// createTable creates the metadata table if needed.
+func (m *Migrator) createTable() error {
+	if err := m.conn.Execute("CREATE TABLE IF NOT EXISTS " + quote(m.Table) +
+		" (version INTEGER PRIMARY KEY, name TEXT, applied_at TEXT)"); err != nil {
+		return fmt.Errorf("migrate: %w", err)
+	}
+	return nil
+}
+
+// applied returns the applied versions without changing the database.
+// None are applied if the metadata table doesn't exist yet.
+func (m *Migrator) applied() (map[int64]bool, error) {
+	applied := map[int64]bool{}
+	exists, err := m.conn.Query("SELECT name FROM sqlite_master WHERE type = 'table' AND name = ?", m.Table)
+	if err != nil {
+		return nil, fmt.Errorf("migrate: %w", err)
+	}
+	found := exists.Next()
+	err = exists.Err()
+	exists.Close()
+	if err != nil {
+		return nil, fmt.Errorf("migrate: %w", err)
+	}
+	if !found {
+		return applied, nil
+	}
+
+	rows, err := m.conn.Query("SELECT version FROM " + quote(m.Table))
+	if err != nil {
+		return nil, fmt.Errorf("migrate: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var version int64
+		if err := rows.Scan(&version); err != nil {
+			return nil, fmt.Errorf("migrate: %w", err)
+		}
+		applied[version] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("migrate: %w", err)
+	}
+	return applied, nil
+}
+
+// quote quotes `name` as an SQL identifier.
+func quote(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
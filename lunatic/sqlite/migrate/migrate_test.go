@@ -0,0 +1,188 @@
+// -*- compile-command: "go test ./..."; -*-
+
+package migrate_test
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/gmlewis/go-lunatic/lunatic/sqlite"
+	"github.com/gmlewis/go-lunatic/lunatic/sqlite/migrate"
+)
+
+var files = fstest.MapFS{
+	"migrations/0001_users.up.sql":   {Data: []byte("CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT)")},
+	"migrations/0001_users.down.sql": {Data: []byte("DROP TABLE users")},
+	"migrations/0002_seed.up.sql":    {Data: []byte("INSERT INTO users (name) VALUES ('ann'); INSERT INTO users (name) VALUES ('bob')")},
+	"migrations/0002_seed.down.sql":  {Data: []byte("DELETE FROM users")},
+	"migrations/README.md":           {Data: []byte("ignored")},
+}
+
+func newMigrator(t *testing.T, extra ...migrate.Migration) (*sqlite.Conn, *migrate.Migrator) {
+	t.Helper()
+	conn, err := sqlite.OpenConn(":memory:")
+	if err != nil {
+		t.Fatalf("OpenConn: %v", err)
+	}
+	ms, err := migrate.FromFS(files, "migrations")
+	if err != nil {
+		t.Fatalf("FromFS: %v", err)
+	}
+	m, err := migrate.New(conn, append(ms, extra...)...)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	return conn, m
+}
+
+func steps(s []migrate.Step) string {
+	names := make([]string, len(s))
+	for i, step := range s {
+		names[i] = step.String()
+	}
+	return strings.Join(names, ", ")
+}
+
+func TestMigrate(t *testing.T) {
+	conn, m := newMigrator(t, migrate.Migration{
+		Version: 3,
+		Name:    "email",
+		Up: func(tx *sqlite.Tx) error {
+			return tx.Execute("CREATE TABLE emails (user INTEGER, email TEXT)")
+		},
+	})
+
+	plan, err := m.Plan(migrate.Latest)
+	if err != nil {
+		t.Fatalf("Plan: %v", err)
+	}
+	if got, want := steps(plan), "up 1_users, up 2_seed, up 3_email"; got != want {
+		t.Errorf("Plan = %v, want %v", got, want)
+	}
+	if _, err := conn.Query("SELECT * FROM users"); err == nil {
+		t.Error("Plan created the users table")
+	}
+	if _, err := conn.Query("SELECT * FROM " + migrate.DefaultTable); err == nil {
+		t.Error("Plan created the metadata table")
+	}
+
+	if done, err := m.Migrate(2); err != nil || steps(done) != "up 1_users, up 2_seed" {
+		t.Fatalf("Migrate(2) = %v, %v", steps(done), err)
+	}
+	statuses, err := m.Status()
+	if err != nil {
+		t.Fatalf("Status: %v", err)
+	}
+	var status []string
+	for _, s := range statuses {
+		status = append(status, fmt.Sprintf("%v:%v", s.Version, s.Applied))
+	}
+	if got, want := strings.Join(status, " "), "1:true 2:true 3:false"; got != want {
+		t.Errorf("Status = %v, want %v", got, want)
+	}
+
+	if done, err := m.Up(); err != nil || steps(done) != "up 3_email" {
+		t.Fatalf("Up = %v, %v", steps(done), err)
+	}
+	if done, err := m.Up(); err != nil || len(done) != 0 {
+		t.Errorf("second Up = %v, %v, want no steps", steps(done), err)
+	}
+
+	// Version 3 has no Down func.
+	if _, err := m.Down(); err == nil || !strings.Contains(err.Error(), "can't be reverted") {
+		t.Errorf("Down = %v, want error", err)
+	}
+	if _, err := m.Migrate(0); err == nil {
+		t.Error("Migrate(0) past an irreversible migration: want error")
+	}
+}
+
+func TestMigrateTable(t *testing.T) {
+	conn, m := newMigrator(t)
+	m.Table = `my "migrations"`
+	if done, err := m.Up(); err != nil || steps(done) != "up 1_users, up 2_seed" {
+		t.Fatalf("Up = %v, %v", steps(done), err)
+	}
+	var n int
+	rows, err := conn.Query(`SELECT COUNT(*) FROM "my ""migrations"""`)
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	defer rows.Close()
+	if !rows.Next() || rows.Scan(&n) != nil || n != 2 {
+		t.Errorf("applied versions = %v, %v, want 2", n, rows.Err())
+	}
+}
+
+func TestMigrateDown(t *testing.T) {
+	conn, m := newMigrator(t)
+	if _, err := m.Up(); err != nil {
+		t.Fatalf("Up: %v", err)
+	}
+
+	if done, err := m.Down(); err != nil || steps(done) != "down 2_seed" {
+		t.Fatalf("Down = %v, %v", steps(done), err)
+	}
+	rows, err := conn.Query("SELECT COUNT(*) FROM users")
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	var n int
+	if !rows.Next() || rows.Scan(&n) != nil || n != 0 {
+		t.Errorf("count after Down = %v, %v, want 0", n, rows.Err())
+	}
+	rows.Close()
+
+	if done, err := m.Migrate(0); err != nil || steps(done) != "down 1_users" {
+		t.Fatalf("Migrate(0) = %v, %v", steps(done), err)
+	}
+	if done, err := m.Down(); err != nil || len(done) != 0 {
+		t.Errorf("Down with nothing applied = %v, %v", steps(done), err)
+	}
+}
+
+func TestMigrateFailure(t *testing.T) {
+	errFail := errors.New("fail")
+	conn, m := newMigrator(t, migrate.Migration{
+		Version: 3,
+		Name:    "broken",
+		Up: func(tx *sqlite.Tx) error {
+			tx.Execute("CREATE TABLE half (id INTEGER)")
+			return errFail
+		},
+	})
+
+	done, err := m.Up()
+	if !errors.Is(err, errFail) || steps(done) != "up 1_users, up 2_seed" {
+		t.Fatalf("Up = %v, %v, want errFail after 2 steps", steps(done), err)
+	}
+	if _, err := conn.Query("SELECT * FROM half"); err == nil {
+		t.Error("the failed migration was not rolled back")
+	}
+	if statuses, err := m.Status(); err != nil || statuses[2].Applied {
+		t.Errorf("Status = %+v, %v, want version 3 pending", statuses, err)
+	}
+}
+
+func TestInvalidMigrations(t *testing.T) {
+	for name, fsys := range map[string]fstest.MapFS{
+		"bad name":  {"m/users.up.sql": {}},
+		"down only": {"m/0001_users.down.sql": {}},
+		"conflict":  {"m/0001_a.up.sql": {}, "m/0001_b.up.sql": {}},
+	} {
+		if _, err := migrate.FromFS(fsys, "m"); err == nil {
+			t.Errorf("FromFS with %v: want error", name)
+		}
+	}
+
+	up := migrate.SQL("SELECT 1")
+	if _, err := migrate.New(nil, migrate.Migration{Version: 1, Up: up}, migrate.Migration{Version: 1, Up: up}); err == nil {
+		t.Error("New with duplicate versions: want error")
+	}
+	if _, err := migrate.New(nil, migrate.Migration{Version: 0, Up: up}); err == nil {
+		t.Error("New with version 0: want error")
+	}
+}
@@ -0,0 +1,488 @@
+// -*- compile-command: "GOOS=wasip1 GOARCH=wasm go test ./..."; -*-
+
+package sqlite
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Rows is the result of a query. It decodes the rows of the host into Go
+// values, much like sql.Rows:
+//
+//	rows, err := sqlite.Query(connID, "SELECT id, name FROM users WHERE id > ?", 10)
+//	if err != nil { ... }
+//	defer rows.Close()
+//	for rows.Next() {
+//		var u struct {
+//			ID   int64
+//			Name string
+//		}
+//		if err := rows.Scan(&u); err != nil { ... }
+//	}
+//	if err := rows.Err(); err != nil { ... }
+type Rows struct {
+	connID      uint64
+	statementID uint64
+	columns     []string
+	values      []any
+	// status is the result of the last step and read is set once
+	// its row has been returned by Next.
+	status uint32
+	read   bool
+	err    error
+	closed bool
+	// owned is set if the statement was prepared for the rows.
+	owned bool
+	// pending are the encoded rows left to return if the rows were
+	// read by a Server, in which case there is no statement.
+	pending [][]byte
+	remote  bool
+}
+
+// Query prepares `query`, binds `args` and returns its rows, which must
+// be closed to finalize the statement.
+//
+// Args are bound by position, or by name with a `:` prefix if they are
+// sql.NamedArg values. They are converted like the arguments of
+// database/sql: booleans are bound as integers and times as RFC 3339 text.
+func Query(connID uint64, query string, args ...any) (*Rows, error) {
+	nvs, err := convertArgs(args)
+	if err != nil {
+		return nil, err
+	}
+	statementID, err := QueryPrepare(connID, query)
+	if err != nil {
+		return nil, lastError(connID, err)
+	}
+	r := &Rows{connID: connID, statementID: statementID, owned: true}
+	if err := r.start(nvs); err != nil {
+		Finalize(statementID)
+		return nil, err
+	}
+	return r, nil
+}
+
+// convertArgs converts `args` like Query.
+func convertArgs(args []any) ([]driver.NamedValue, error) {
+	nvs := make([]driver.NamedValue, len(args))
+	for i, arg := range args {
+		nvs[i] = driver.NamedValue{Ordinal: i + 1, Value: arg}
+		if na, ok := arg.(sql.NamedArg); ok {
+			nvs[i].Name, nvs[i].Value = na.Name, na.Value
+		}
+		v, err := convertValue(nvs[i].Value)
+		if err != nil {
+			return nil, fmt.Errorf("sqlite: argument %v: %w", i+1, err)
+		}
+		nvs[i].Value = v
+	}
+	return nvs, nil
+}
+
+// start binds `args` and steps to the first row, after which the columns are known.
+func (r *Rows) start(args []driver.NamedValue) error {
+	if err := bind(r.statementID, args); err != nil {
+		return err
+	}
+	status, err := step(r.connID, r.statementID)
+	if err != nil {
+		return err
+	}
+	r.status = status
+	r.columns, err = columnNames(r.statementID)
+	return err
+}
+
+// Columns returns the names of the columns.
+func (r *Rows) Columns() []string { return r.columns }
+
+// Next advances to the next row and reports whether there is one.
+// Once it returns false, Err reports whether an error occurred and
+// there are no current values.
+func (r *Rows) Next() bool {
+	r.values = nil
+	if r.closed || r.err != nil {
+		return false
+	}
+	if r.remote {
+		if len(r.pending) == 0 {
+			return false
+		}
+		r.values, r.err = DecodeValues(r.pending[0])
+		r.pending = r.pending[1:]
+		if r.err != nil {
+			r.values = nil
+			return false
+		}
+		return true
+	}
+	if r.read {
+		r.status, r.err = step(r.connID, r.statementID)
+		if r.err != nil {
+			return false
+		}
+	}
+	if r.status != SQLiteRow {
+		return false
+	}
+	r.read = true
+	r.values, r.err = rowValues(r.statementID)
+	if r.err != nil {
+		r.values = nil
+		return false
+	}
+	return true
+}
+
+// Err returns the error that ended the iteration, if any.
+func (r *Rows) Err() error { return r.err }
+
+// Close finalizes the statement, or resets it if it belongs to a Stmt.
+// It is safe to call Close more than once.
+func (r *Rows) Close() error {
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+	if r.remote {
+		r.pending = nil
+		return nil
+	}
+	if !r.owned {
+		return StatementReset(r.statementID)
+	}
+	return Finalize(r.statementID)
+}
+
+// Values returns the values of the current row: nil, int64, float64,
+// string or []byte.
+func (r *Rows) Values() []any { return r.values }
+
+// Scan copies the columns of the current row into `dest`.
+//
+// Each element of `dest` is a pointer to one of the following or a
+// pointer to a pointer to one of them, which is set to nil for NULL:
+// a signed or unsigned integer, float, bool, string, []byte, time.Time,
+// any, or a type implementing sql.Scanner.
+//
+// If `dest` is a single pointer to any other struct, the columns are
+// assigned to its exported fields instead. A field matches the column
+// named in its `sqlite` tag, or otherwise its name ignoring case;
+// a tag of "-" skips the field. Every column must have a field.
+func (r *Rows) Scan(dest ...any) error {
+	if r.values == nil {
+		return errors.New("sqlite: Scan called without a current row")
+	}
+	return scan(r.columns, r.values, dest)
+}
+
+// scan implements Rows.Scan for the row `values` with `columns`.
+func scan(columns []string, values []any, dest []any) error {
+	if len(dest) == 1 && isStructDest(dest[0]) {
+		return scanStruct(columns, values, reflect.ValueOf(dest[0]).Elem())
+	}
+	if len(dest) != len(values) {
+		return fmt.Errorf("sqlite: Scan expected %v destinations, got %v", len(values), len(dest))
+	}
+	for i, d := range dest {
+		if err := assign(d, values[i]); err != nil {
+			return fmt.Errorf("sqlite: Scan column %q: %w", column(columns, i), err)
+		}
+	}
+	return nil
+}
+
+func column(columns []string, i int) string {
+	if i < len(columns) {
+		return columns[i]
+	}
+	return strconv.Itoa(i)
+}
+
+// isStructDest reports whether `dest` is a pointer to a struct that is
+// scanned field by field.
+func isStructDest(dest any) bool {
+	switch dest.(type) {
+	case sql.Scanner, *time.Time:
+		return false
+	}
+	t := reflect.TypeOf(dest)
+	return t != nil && t.Kind() == reflect.Pointer && t.Elem().Kind() == reflect.Struct
+}
+
+func scanStruct(columns []string, values []any, v reflect.Value) error {
+	fields := map[string]int{}
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := f.Tag.Get("sqlite")
+		if !f.IsExported() || name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields[strings.ToLower(name)] = i
+	}
+
+	for i, value := range values {
+		name := column(columns, i)
+		fi, ok := fields[strings.ToLower(name)]
+		if !ok {
+			return fmt.Errorf("sqlite: Scan column %q: no field in %v", name, t)
+		}
+		if err := assign(v.Field(fi).Addr().Interface(), value); err != nil {
+			return fmt.Errorf("sqlite: Scan column %q: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// assign stores the SQLite value `src` in the pointer `dest`.
+func assign(dest, src any) error {
+	switch d := dest.(type) {
+	case sql.Scanner:
+		return d.Scan(src)
+	case *any:
+		if b, ok := src.([]byte); ok {
+			src = append([]byte(nil), b...)
+		}
+		*d = src
+		return nil
+	case *[]byte:
+		switch s := src.(type) {
+		case nil:
+			*d = nil
+		case []byte:
+			*d = append([]byte(nil), s...)
+		case string:
+			*d = []byte(s)
+		default:
+			return fmt.Errorf("cannot convert %T to []byte", src)
+		}
+		return nil
+	case *time.Time:
+		switch s := src.(type) {
+		case string:
+			t, err := time.Parse(time.RFC3339Nano, s)
+			if err != nil {
+				return err
+			}
+			*d = t
+		case int64:
+			*d = time.Unix(s, 0).UTC()
+		default:
+			return fmt.Errorf("cannot convert %T to time.Time", src)
+		}
+		return nil
+	}
+
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Pointer || v.IsNil() {
+		return fmt.Errorf("destination %T is not a non-nil pointer", dest)
+	}
+	v = v.Elem()
+	if v.Kind() == reflect.Pointer {
+		if src == nil {
+			v.Set(reflect.Zero(v.Type()))
+			return nil
+		}
+		p := reflect.New(v.Type().Elem())
+		if err := assign(p.Interface(), src); err != nil {
+			return err
+		}
+		v.Set(p)
+		return nil
+	}
+	if src == nil {
+		return fmt.Errorf("cannot store NULL in %v", v.Type())
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		switch s := src.(type) {
+		case string:
+			v.SetString(s)
+		case []byte:
+			v.SetString(string(s))
+		case int64:
+			v.SetString(strconv.FormatInt(s, 10))
+		case float64:
+			v.SetString(strconv.FormatFloat(s, 'g', -1, 64))
+		}
+		return nil
+	case reflect.Bool:
+		switch s := src.(type) {
+		case int64:
+			v.SetBool(s != 0)
+			return nil
+		case string:
+			b, err := strconv.ParseBool(s)
+			if err != nil {
+				return err
+			}
+			v.SetBool(b)
+			return nil
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := toInt64(src)
+		if err != nil {
+			return err
+		}
+		if v.OverflowInt(n) {
+			return fmt.Errorf("value %v overflows %v", n, v.Type())
+		}
+		v.SetInt(n)
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		n, err := toInt64(src)
+		if err != nil {
+			return err
+		}
+		if n < 0 || v.OverflowUint(uint64(n)) {
+			return fmt.Errorf("value %v overflows %v", n, v.Type())
+		}
+		v.SetUint(uint64(n))
+		return nil
+	case reflect.Float32, reflect.Float64:
+		switch s := src.(type) {
+		case float64:
+			v.SetFloat(s)
+			return nil
+		case int64:
+			v.SetFloat(float64(s))
+			return nil
+		case string:
+			f, err := strconv.ParseFloat(s, v.Type().Bits())
+			if err != nil {
+				return err
+			}
+			v.SetFloat(f)
+			return nil
+		}
+	}
+	return fmt.Errorf("cannot convert %T to %v", src, v.Type())
+}
+
+func toInt64(src any) (int64, error) {
+	switch s := src.(type) {
+	case int64:
+		return s, nil
+	case float64:
+		if s != float64(int64(s)) {
+			return 0, fmt.Errorf("value %v is not an integer", s)
+		}
+		return int64(s), nil
+	case string:
+		return strconv.ParseInt(s, 10, 64)
+	}
+	return 0, fmt.Errorf("cannot convert %T to an integer", src)
+}
+
+// convertValue converts an argument to one of the types of SQLite.
+func convertValue(v any) (any, error) {
+	v, err := driver.DefaultParameterConverter.ConvertValue(v)
+	if err != nil {
+		return nil, err
+	}
+	switch v := v.(type) {
+	case bool:
+		if v {
+			return int64(1), nil
+		}
+		return int64(0), nil
+	case time.Time:
+		return v.Format(time.RFC3339Nano), nil
+	}
+	return v, nil
+}
+
+// bind binds the converted `args` to the statement.
+func bind(statementID uint64, args []driver.NamedValue) error {
+	if len(args) == 0 {
+		return nil
+	}
+	return BindValue(statementID, encodeArgs(args))
+}
+
+// encodeArgs encodes the converted `args` as the bind list of BindValue.
+func encodeArgs(args []driver.NamedValue) []byte {
+	var e encoder
+	e.u64(uint64(len(args)))
+	for _, arg := range args {
+		if arg.Name != "" {
+			e.u32(2) // BindKey::String
+			e.bytes([]byte(":" + arg.Name))
+		} else {
+			e.u32(1) // BindKey::Numeric
+			e.u64(uint64(arg.Ordinal))
+		}
+		e.bindValue(arg.Value)
+	}
+	return e.buf
+}
+
+// step steps the statement and returns SQLiteRow or SQLiteDone.
+func step(connID, statementID uint64) (uint32, error) {
+	status, err := Step(statementID)
+	if err != nil {
+		return 0, err
+	}
+	if status != SQLiteRow && status != SQLiteDone {
+		return 0, lastError(connID, fmt.Errorf("sqlite: step failed with code %v", status))
+	}
+	return status, nil
+}
+
+func columnNames(statementID uint64) ([]string, error) {
+	data, err := ColumnNames(statementID)
+	if err != nil {
+		return nil, err
+	}
+	return DecodeNames(data)
+}
+
+func rowValues(statementID uint64) ([]any, error) {
+	data, err := ReadRow(statementID)
+	if err != nil {
+		return nil, err
+	}
+	return DecodeValues(data)
+}
+
+// Error is an error reported by SQLite.
+type Error struct {
+	Code    uint32 // the SQLite result code or 0 if unknown.
+	Message string
+}
+
+func (e *Error) Error() string { return "sqlite: " + e.Message }
+
+// lastError returns the last error of the connection as an *Error,
+// or `err` if the host doesn't report one.
+func lastError(connID uint64, err error) error {
+	data, lerr := LastError(connID)
+	if lerr != nil {
+		return err
+	}
+	e := &Error{}
+	var ok bool
+	if decode(data, func(d *decoder) {
+		if d.u8() == 1 {
+			e.Code = d.u32()
+		}
+		if d.u8() == 1 {
+			e.Message, ok = string(d.bytes()), true
+		}
+	}) != nil || !ok {
+		return err
+	}
+	return e
+}
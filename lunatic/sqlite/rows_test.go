@@ -0,0 +1,147 @@
+// -*- compile-command: "go test ./..."; -*-
+
+package sqlite_test
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gmlewis/go-lunatic/lunatic/sqlite"
+)
+
+func openUsers(t *testing.T) uint64 {
+	t.Helper()
+	conn, err := sqlite.Open(":memory:")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if err := sqlite.Execute(conn, `
+		CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT, score REAL, avatar BLOB, created TEXT);
+		INSERT INTO users (name, score, avatar, created) VALUES
+			('ann', 1.5, x'0102', '2024-01-02T03:04:05Z'),
+			('bob', NULL, NULL, NULL);
+	`); err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	return conn
+}
+
+func TestRowsScan(t *testing.T) {
+	conn := openUsers(t)
+
+	rows, err := sqlite.Query(conn, "SELECT id, name, score, avatar, created FROM users WHERE id >= ? ORDER BY id", 1)
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	defer rows.Close()
+	if got := strings.Join(rows.Columns(), ","); got != "id,name,score,avatar,created" {
+		t.Errorf("Columns = %v", got)
+	}
+
+	if !rows.Next() {
+		t.Fatalf("Next = false, %v, want a row", rows.Err())
+	}
+	var id uint8
+	var name string
+	var score float32
+	var avatar []byte
+	var created time.Time
+	if err := rows.Scan(&id, &name, &score, &avatar, &created); err != nil {
+		t.Fatalf("Scan: %v", err)
+	}
+	if id != 1 || name != "ann" || score != 1.5 || string(avatar) != "\x01\x02" || !created.Equal(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)) {
+		t.Errorf("Scan = %v, %v, %v, %v, %v", id, name, score, avatar, created)
+	}
+
+	if !rows.Next() {
+		t.Fatalf("Next = false, %v, want a row", rows.Err())
+	}
+	var nullScore *float64
+	var nullCreated sql.NullString
+	var anyAvatar any = "x"
+	if err := rows.Scan(&id, &name, &nullScore, &anyAvatar, &nullCreated); err != nil {
+		t.Fatalf("Scan: %v", err)
+	}
+	if id != 2 || nullScore != nil || anyAvatar != nil || nullCreated.Valid {
+		t.Errorf("Scan = %v, %v, %v, %v", id, nullScore, anyAvatar, nullCreated)
+	}
+	if err := rows.Scan(&id, &name, &score, &avatar, &created); err == nil {
+		t.Error("Scan of NULL into float32: want error")
+	}
+
+	if rows.Next() || rows.Err() != nil {
+		t.Errorf("Next = true or %v, want the end", rows.Err())
+	}
+	if rows.Values() != nil || rows.Scan(&id, &name, &score, &avatar, &created) == nil {
+		t.Errorf("Values after the end = %v, want nil and a Scan error", rows.Values())
+	}
+}
+
+func TestRowsScanStruct(t *testing.T) {
+	conn := openUsers(t)
+
+	rows, err := sqlite.Query(conn, "SELECT id, name, score FROM users WHERE name = :name", sql.Named("name", "bob"))
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	defer rows.Close()
+
+	var user struct {
+		ID       int
+		Nickname string `sqlite:"name"`
+		Score    *float64
+		Ignored  string `sqlite:"-"`
+	}
+	if !rows.Next() {
+		t.Fatalf("Next = false, %v, want a row", rows.Err())
+	}
+	if err := rows.Scan(&user); err != nil {
+		t.Fatalf("Scan: %v", err)
+	}
+	if user.ID != 2 || user.Nickname != "bob" || user.Score != nil {
+		t.Errorf("Scan = %+v", user)
+	}
+
+	var partial struct{ ID int }
+	if err := rows.Scan(&partial); err == nil || !strings.Contains(err.Error(), `"name"`) {
+		t.Errorf("Scan into a struct without a name field = %v, want error", err)
+	}
+}
+
+func TestDecodeValues(t *testing.T) {
+	conn := openUsers(t)
+
+	st, err := sqlite.QueryPrepare(conn, "SELECT name, score FROM users")
+	if err != nil {
+		t.Fatalf("QueryPrepare: %v", err)
+	}
+	defer sqlite.Finalize(st)
+	if status, err := sqlite.Step(st); err != nil || status != sqlite.SQLiteRow {
+		t.Fatalf("Step = %v, %v, want SQLiteRow", status, err)
+	}
+
+	data, err := sqlite.ColumnNames(st)
+	if err != nil {
+		t.Fatalf("ColumnNames: %v", err)
+	}
+	if names, err := sqlite.DecodeNames(data); err != nil || strings.Join(names, ",") != "name,score" {
+		t.Errorf("DecodeNames = %v, %v", names, err)
+	}
+	if data, err = sqlite.ReadRow(st); err != nil {
+		t.Fatalf("ReadRow: %v", err)
+	}
+	if values, err := sqlite.DecodeValues(data); err != nil || len(values) != 2 || values[0] != "ann" || values[1] != 1.5 {
+		t.Errorf("DecodeValues = %v, %v", values, err)
+	}
+	if data, err = sqlite.ReadColumn(st, 1); err != nil {
+		t.Fatalf("ReadColumn: %v", err)
+	}
+	if v, err := sqlite.DecodeValue(data); err != nil || v != 1.5 {
+		t.Errorf("DecodeValue = %v, %v, want 1.5", v, err)
+	}
+	if _, err := sqlite.DecodeValues(data[:3]); err == nil {
+		t.Error("DecodeValues of truncated data: want error")
+	}
+}
@@ -0,0 +1,421 @@
+// -*- compile-command: "GOOS=wasip1 GOARCH=wasm go test ./..."; -*-
+
+package sqlite
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gmlewis/go-lunatic/lunatic"
+	"github.com/gmlewis/go-lunatic/lunatic/message"
+	"github.com/gmlewis/go-lunatic/lunatic/process"
+	"github.com/gmlewis/go-lunatic/lunatic/registry"
+)
+
+// Tags of the messages exchanged between a Server, its process and its workers.
+const (
+	queryTag      int64 = 0x5351_0001
+	execTag       int64 = 0x5351_0002
+	readyTag      int64 = 0x5351_0003
+	workerLinkTag int64 = 0x5351_0004
+)
+
+// Server gives all processes access to the same database, whose
+// connections can otherwise only be used by the process that opened them.
+//
+// The connections are owned by a server process, which is registered in the
+// lunatic registry and spawned by Start or by the first request of any
+// process if it is not running. It hands every request to a worker process
+// with its own connection and the worker replies to the caller directly:
+//
+//   - Exec and ExecBatch are run one at a time by a single writer, so writes
+//     never compete for the database lock.
+//   - Query is run by the next idle process of a pool of readers, so reads
+//     run concurrently with each other and with writes. Requests wait in the
+//     server process while all readers are busy.
+//
+// Readers only see committed changes, so a journal mode that lets them read
+// while the writer writes, e.g. "PRAGMA journal_mode=WAL", should be set
+// for the database.
+type Server struct {
+	// Timeout limits the time a request waits for its reply.
+	// 0 means no timeout, but a request still fails with
+	// message.ProcessDied if the server process dies, which it does
+	// together with its workers.
+	Timeout time.Duration
+
+	name    string
+	path    string
+	readers int
+
+	entry, writerEntry, readerEntry func()
+}
+
+// NewServer returns a Server for the database at `path` whose process is
+// registered under `name`, with a pool of `readers` reader processes.
+// If `readers` is 0, or `path` is ":memory:" as every connection to it
+// opens a new database, queries are run by the writer as well.
+//
+// NewServer registers the entry points of the processes with
+// `lunatic.RegisterFunc`, so it must only be called during package
+// initialization.
+func NewServer(name, path string, readers int) *Server {
+	if path == ":memory:" {
+		readers = 0
+	}
+	s := &Server{name: "lunatic/sqlite.Server/" + name, path: path, readers: max(readers, 0)}
+	s.entry = lunatic.RegisterFunc(s.run)
+	s.writerEntry = lunatic.RegisterFunc(func() { s.runWorker(false) })
+	s.readerEntry = lunatic.RegisterFunc(func() { s.runWorker(true) })
+	return s
+}
+
+// Statement is a query with its arguments, run by ExecBatch.
+type Statement struct {
+	Query string
+	Args  []any
+}
+
+// encodedStatement is a query with its arguments encoded as the bind list of BindValue.
+type encodedStatement struct {
+	Query string
+	Args  []byte
+}
+
+func newStatement(query string, args []any) (encodedStatement, error) {
+	nvs, err := convertArgs(args)
+	if err != nil {
+		return encodedStatement{}, err
+	}
+	st := encodedStatement{Query: query}
+	if len(nvs) > 0 {
+		st.Args = encodeArgs(nvs)
+	}
+	return st, nil
+}
+
+// reply is the reply to a request. Rows are encoded like the result of ReadRow.
+type reply struct {
+	Columns      []string
+	Rows         [][]byte
+	RowsAffected []int64
+	Err          *Error
+}
+
+// job is a request that the server process hands to a worker.
+type job struct {
+	Call message.Call[[]encodedStatement]
+	// Server is the ID of the server process, which a reader notifies
+	// once it is idle again.
+	Server uint64
+}
+
+// Start spawns the server process unless it is already running. Requests
+// start the server themselves, so calling Start is only needed to report
+// spawn errors early.
+func (s *Server) Start() error {
+	_, err := s.server()
+	return err
+}
+
+// server returns the ID of the server process, spawning it if needed.
+func (s *Server) server() (uint64, error) {
+	return registry.GetOrSpawn(s.name, func() (uint64, error) {
+		id, err := lunatic.SpawnFunc(s.entry)
+		if err != nil {
+			return 0, fmt.Errorf("sqlite: spawn server process: %w", err)
+		}
+		return uint64(id), nil
+	})
+}
+
+// Query runs `query` with `args` like the package function Query and
+// returns all of its rows, which are read before Query returns.
+// The query must not change the database, since it is run by a reader.
+//
+// Returns:
+// * nil on success with the rows.
+// * *Error if the query fails.
+// * *message.RequestError if the request fails or times out.
+func (s *Server) Query(query string, args ...any) (*Rows, error) {
+	st, err := newStatement(query, args)
+	if err != nil {
+		return nil, err
+	}
+	r, err := s.request(queryTag, []encodedStatement{st})
+	if err != nil {
+		return nil, err
+	}
+	return &Rows{columns: r.Columns, pending: r.Rows, remote: true}, nil
+}
+
+// Exec runs `query` with `args` like Conn.Exec.
+//
+// Returns:
+// * nil on success with the result.
+// * *Error if the statement fails.
+// * *message.RequestError if the request fails or times out.
+func (s *Server) Exec(query string, args ...any) (Result, error) {
+	st, err := newStatement(query, args)
+	if err != nil {
+		return Result{}, err
+	}
+	r, err := s.request(execTag, []encodedStatement{st})
+	if err != nil {
+		return Result{}, err
+	}
+	if len(r.RowsAffected) == 0 {
+		return Result{}, errors.New("sqlite: no result in the reply of the server")
+	}
+	return Result{RowsAffected: r.RowsAffected[0]}, nil
+}
+
+// ExecBatch runs `stmts` in a single transaction, so either all or none
+// of their changes are committed.
+//
+// Returns:
+// * nil on success with the result of every statement.
+// * *Error if a statement fails, after the transaction was rolled back.
+// * *message.RequestError if the request fails or times out.
+func (s *Server) ExecBatch(stmts ...Statement) ([]Result, error) {
+	sts := make([]encodedStatement, len(stmts))
+	for i, st := range stmts {
+		var err error
+		if sts[i], err = newStatement(st.Query, st.Args); err != nil {
+			return nil, fmt.Errorf("sqlite: statement %v: %w", i+1, err)
+		}
+	}
+	r, err := s.request(execTag, sts)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]Result, len(r.RowsAffected))
+	for i, n := range r.RowsAffected {
+		results[i].RowsAffected = n
+	}
+	return results, nil
+}
+
+// request sends `stmts` to the server process and waits for the reply.
+func (s *Server) request(tag int64, stmts []encodedStatement) (reply, error) {
+	pid, err := s.server()
+	if err != nil {
+		return reply{}, err
+	}
+	r, err := message.Request[reply](pid, tag, stmts, s.Timeout)
+	if err != nil {
+		return reply{}, err
+	}
+	if r.Err != nil {
+		return reply{}, r.Err
+	}
+	return r, nil
+}
+
+// run is the entry point of the server process.
+func (s *Server) run() {
+	// Callers are linked to the server process during requests, see
+	// `message.Request`. Trap link deaths so that a failing caller doesn't
+	// take down the server and its workers.
+	process.DieWhenLinkDies(false)
+
+	id, err := lunatic.SpawnLinkFunc(workerLinkTag, s.writerEntry)
+	if err != nil {
+		panic(fmt.Sprintf("sqlite: spawn writer: %v", err))
+	}
+	writer := uint64(id)
+	idle := make([]uint64, 0, s.readers)
+	for i := 0; i < s.readers; i++ {
+		id, err := lunatic.SpawnLinkFunc(workerLinkTag, s.readerEntry)
+		if err != nil {
+			panic(fmt.Sprintf("sqlite: spawn reader: %v", err))
+		}
+		idle = append(idle, uint64(id))
+	}
+
+	// queued are the queries waiting for an idle reader.
+	var queued []*message.Call[[]encodedStatement]
+	for {
+		msg, err := message.Receive(nil, nil)
+		if err != nil {
+			panic(fmt.Sprintf("sqlite: server receive: %v", err))
+		}
+		if sig, ok := msg.(*message.LinkDiedSignal); ok && !process.IsWatchTag(sig.Tag) {
+			// A worker failed. Die with the other workers, like without trapping.
+			panic(fmt.Sprintf("sqlite: server worker with link-tag %v died", sig.Tag))
+		}
+		data, ok := msg.(*message.DataMessage)
+		if !ok {
+			continue
+		}
+
+		switch data.Tag {
+		case queryTag, execTag:
+			call, err := message.DecodeRequest[[]encodedStatement]()
+			if err != nil {
+				continue
+			}
+			switch {
+			case data.Tag == execTag || s.readers == 0:
+				if err := handOver(writer, data.Tag, call); err != nil {
+					replyError(call, err)
+				}
+			case len(idle) > 0:
+				// The reader stays idle if it didn't get the call.
+				if err := handOver(idle[len(idle)-1], data.Tag, call); err != nil {
+					replyError(call, err)
+				} else {
+					idle = idle[:len(idle)-1]
+				}
+			default:
+				queued = append(queued, call)
+			}
+		case readyTag:
+			var reader uint64
+			if err := message.DecodeData(&reader); err != nil {
+				continue
+			}
+			for len(queued) > 0 {
+				call := queued[0]
+				queued = queued[1:]
+				if err := handOver(reader, queryTag, call); err != nil {
+					replyError(call, err)
+					continue
+				}
+				reader = 0
+				break
+			}
+			if reader != 0 {
+				idle = append(idle, reader)
+			}
+		}
+	}
+}
+
+// handOver sends the request `call` with `tag` to the worker `pid`.
+func handOver(pid uint64, tag int64, call *message.Call[[]encodedStatement]) error {
+	message.CreateData(tag, 0)
+	if err := message.EncodeData(job{Call: *call, Server: process.ProcessID()}, nil); err != nil {
+		return err
+	}
+	return message.Send(pid)
+}
+
+// replyError replies to `call` with the error of handing it over, so that
+// the caller doesn't wait for a reply that never comes.
+func replyError(call *message.Call[[]encodedStatement], err error) {
+	call.Reply(reply{Err: &Error{Message: "hand over request: " + err.Error()}})
+}
+
+// runWorker is the entry point of the writer and reader processes.
+func (s *Server) runWorker(reader bool) {
+	conn, err := OpenConn(s.path)
+	if err != nil {
+		panic(fmt.Sprintf("sqlite: server worker: %v", err))
+	}
+
+	// server is the ID of the server process, known from the first job.
+	var server uint64
+	tags := []int64{queryTag, execTag}
+	for {
+		msg, err := message.Receive(tags, nil)
+		if err != nil {
+			panic(fmt.Sprintf("sqlite: server worker receive: %v", err))
+		}
+		data, ok := msg.(*message.DataMessage)
+		if !ok {
+			continue
+		}
+
+		var j job
+		if err := message.DecodeData(&j); err == nil {
+			server = j.Server
+			var r reply
+			if err := conn.serve(data.Tag, j.Call.Body, &r); err != nil {
+				r = reply{Err: toError(err)}
+			}
+			j.Call.Reply(r)
+		}
+		if reader && server != 0 {
+			message.CreateData(readyTag, 0)
+			if err := message.EncodeData(process.ProcessID(), nil); err == nil {
+				message.Send(server)
+			}
+		}
+	}
+}
+
+// serve runs the statements of a request with `tag` and stores their outcome in `r`.
+func (c *Conn) serve(tag int64, stmts []encodedStatement, r *reply) error {
+	switch {
+	case len(stmts) == 0:
+		return errors.New("sqlite: no statement")
+	case tag == queryTag:
+		return c.run(stmts[0], r, true)
+	case len(stmts) == 1:
+		return c.run(stmts[0], r, false)
+	}
+	return c.Tx(func(tx *Tx) error {
+		for _, st := range stmts {
+			if err := tx.run(st, r, false); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// run runs `st` to completion, appending the number of changed rows to `r`
+// and, if `rows` is set, its columns and rows.
+func (c *Conn) run(st encodedStatement, r *reply, rows bool) error {
+	statementID, err := QueryPrepare(c.id, st.Query)
+	if err != nil {
+		return lastError(c.id, err)
+	}
+	defer Finalize(statementID)
+	if len(st.Args) > 0 {
+		if err := BindValue(statementID, st.Args); err != nil {
+			return lastError(c.id, err)
+		}
+	}
+
+	for {
+		status, err := step(c.id, statementID)
+		if err != nil {
+			return err
+		}
+		if rows && r.Columns == nil {
+			if r.Columns, err = columnNames(statementID); err != nil {
+				return err
+			}
+		}
+		if status == SQLiteDone {
+			break
+		}
+		if rows {
+			row, err := ReadRow(statementID)
+			if err != nil {
+				return err
+			}
+			r.Rows = append(r.Rows, row)
+		}
+	}
+
+	n, err := c.Changes()
+	if err != nil {
+		return err
+	}
+	r.RowsAffected = append(r.RowsAffected, int64(n))
+	return nil
+}
+
+// toError converts `err` to an *Error that can be sent in a reply.
+func toError(err error) *Error {
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+	return &Error{Message: strings.TrimPrefix(err.Error(), "sqlite: ")}
+}
@@ -0,0 +1,206 @@
+// -*- compile-command: "go test ./..."; -*-
+
+package sqlite_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gmlewis/go-lunatic/lunatic"
+	"github.com/gmlewis/go-lunatic/lunatic/message"
+	"github.com/gmlewis/go-lunatic/lunatic/process"
+	"github.com/gmlewis/go-lunatic/lunatic/registry"
+	"github.com/gmlewis/go-lunatic/lunatic/sqlite"
+)
+
+var (
+	server        = sqlite.NewServer("test", "server_test.db", 1)
+	memServer     = sqlite.NewServer("memory", ":memory:", 2)
+	restartServer = sqlite.NewServer("restart", ":memory:", 0)
+	callerServer  = sqlite.NewServer("caller", ":memory:", 0)
+)
+
+// callerServerID is the server process that stuckCaller calls.
+var callerServerID uint64
+
+// stuckCaller waits for the reply to a request that the server ignores.
+var stuckCaller = lunatic.RegisterFunc(func() {
+	message.Request[int](callerServerID, 99, 0, 0)
+})
+
+// visitor records the visit of the name it receives with server and
+// replies with the number of visits so far.
+var visitor = lunatic.RegisterFunc(func() {
+	call, err := message.ReceiveRequest[string](1)
+	if err != nil {
+		panic(err)
+	}
+	if _, err := server.Exec("INSERT INTO visits (name, at) VALUES (?, ?)", call.Body, time.Now()); err != nil {
+		call.Reply(-1)
+		return
+	}
+	rows, err := server.Query("SELECT COUNT(*) FROM visits")
+	var n int
+	if err != nil || !rows.Next() || rows.Scan(&n) != nil {
+		n = -1
+	}
+	call.Reply(n)
+})
+
+func TestServer(t *testing.T) {
+	if err := server.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if _, err := server.Exec("DROP TABLE IF EXISTS visits"); err != nil {
+		t.Fatalf("Exec: %v", err)
+	}
+	if _, err := server.Exec("CREATE TABLE visits (id INTEGER PRIMARY KEY, name TEXT, at TEXT, data BLOB)"); err != nil {
+		t.Fatalf("Exec: %v", err)
+	}
+
+	// Processes that can't share a connection all use the same database.
+	const visitors = 5
+	for i := 0; i < visitors; i++ {
+		pid, err := lunatic.SpawnFunc(visitor)
+		if err != nil {
+			t.Fatalf("SpawnFunc: %v", err)
+		}
+		n, err := message.Request[int](uint64(pid), 1, fmt.Sprintf("v%v", i), 5*time.Second)
+		if err != nil || n != i+1 {
+			t.Errorf("visitor %v saw %v visits, %v, want %v", i, n, err, i+1)
+		}
+	}
+
+	res, err := server.Exec("UPDATE visits SET data = ? WHERE name = ?", []byte{1, 2}, "v0")
+	if err != nil || res.RowsAffected != 1 {
+		t.Fatalf("Exec = %+v, %v, want 1 row", res, err)
+	}
+	rows, err := server.Query("SELECT id, name, at, data FROM visits WHERE id <= ?", 2)
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	defer rows.Close()
+	if got := fmt.Sprint(rows.Columns()); got != "[id name at data]" {
+		t.Errorf("Columns = %v", got)
+	}
+	var visits []string
+	for rows.Next() {
+		var v struct {
+			ID   int64
+			Name string
+			At   time.Time
+			Data []byte
+		}
+		if err := rows.Scan(&v); err != nil {
+			t.Fatalf("Scan: %v", err)
+		}
+		if v.At.IsZero() {
+			t.Errorf("visit %v has no time", v.ID)
+		}
+		visits = append(visits, fmt.Sprintf("%v:%v:%v", v.ID, v.Name, v.Data))
+	}
+	if got, want := fmt.Sprint(visits), "[1:v0:[1 2] 2:v1:[]]"; got != want || rows.Err() != nil {
+		t.Errorf("visits = %v, %v, want %v", got, rows.Err(), want)
+	}
+	if rows.Values() != nil {
+		t.Errorf("Values after the end = %v, want nil", rows.Values())
+	}
+}
+
+func TestServerErrors(t *testing.T) {
+	if _, err := memServer.Exec("DROP TABLE IF EXISTS items"); err != nil {
+		t.Fatalf("Exec: %v", err)
+	}
+	if _, err := memServer.Exec("CREATE TABLE items (name TEXT)"); err != nil {
+		t.Fatalf("Exec: %v", err)
+	}
+
+	// The second statement fails, so the first is rolled back.
+	_, err := memServer.ExecBatch(
+		sqlite.Statement{Query: "INSERT INTO items (name) VALUES (?)", Args: []any{"a"}},
+		sqlite.Statement{Query: "INSERT INTO missing VALUES (1)"},
+	)
+	var sqliteErr *sqlite.Error
+	if !errors.As(err, &sqliteErr) {
+		t.Errorf("ExecBatch = %v, want *sqlite.Error", err)
+	}
+	results, err := memServer.ExecBatch(
+		sqlite.Statement{Query: "INSERT INTO items (name) VALUES (?)", Args: []any{"b"}},
+		sqlite.Statement{Query: "INSERT INTO items (name) VALUES (?)", Args: []any{"c"}},
+	)
+	if err != nil || len(results) != 2 {
+		t.Fatalf("ExecBatch = %+v, %v, want 2 results", results, err)
+	}
+
+	// With ":memory:", queries are run by the writer, which sees the table.
+	rows, err := memServer.Query("SELECT name FROM items")
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	var names []string
+	for rows.Next() {
+		var name string
+		rows.Scan(&name)
+		names = append(names, name)
+	}
+	if got := fmt.Sprint(names); got != "[b c]" {
+		t.Errorf("names = %v, want [b c]", got)
+	}
+
+	if _, err := memServer.Query("SELEKT 1"); !errors.As(err, &sqliteErr) {
+		t.Errorf("Query of invalid SQL = %v, want *sqlite.Error", err)
+	}
+	if _, err := memServer.Exec("SELECT ?", struct{}{}); err == nil {
+		t.Error("Exec with a struct argument: want error")
+	}
+}
+
+func TestServerRestart(t *testing.T) {
+	if err := restartServer.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	_, pid, ok, err := registry.Get("lunatic/sqlite.Server/restart")
+	if err != nil || !ok {
+		t.Fatalf("registry.Get = %v, %v, want the server process", ok, err)
+	}
+	process.Kill(pid)
+	for process.Exists(pid) {
+		process.SleepMS(1)
+	}
+
+	// The next request replaces the dead server process.
+	if _, err := restartServer.Exec("CREATE TABLE items (name TEXT)"); err != nil {
+		t.Fatalf("Exec after the server died: %v", err)
+	}
+	if _, newPID, ok, err := registry.Get("lunatic/sqlite.Server/restart"); err != nil || !ok || newPID == pid {
+		t.Errorf("registry.Get = %v, %v, %v, want a new server process", newPID, ok, err)
+	}
+}
+
+func TestServerCallerKilled(t *testing.T) {
+	if err := callerServer.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	_, pid, ok, err := registry.Get("lunatic/sqlite.Server/caller")
+	if err != nil || !ok {
+		t.Fatalf("registry.Get = %v, %v, want the server process", ok, err)
+	}
+	callerServerID = pid
+	caller, err := lunatic.SpawnFunc(stuckCaller)
+	if err != nil {
+		t.Fatalf("SpawnFunc: %v", err)
+	}
+	process.SleepMS(20)
+
+	// The caller is linked to the server while it waits for the reply.
+	process.Kill(uint64(caller))
+	process.SleepMS(20)
+	if !process.Exists(pid) {
+		t.Fatal("server process died with the caller")
+	}
+	if _, err := callerServer.Exec("CREATE TABLE IF NOT EXISTS items (name TEXT)"); err != nil {
+		t.Errorf("Exec after the caller was killed: %v", err)
+	}
+}
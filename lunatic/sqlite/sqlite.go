@@ -14,10 +14,6 @@ type size = uint32
 
 func mkptr[T any](v *T) ptr { return unsafe.Pointer(v) }
 
-//go:wasmimport lunatic::sqlite open
-//go:noescape
-func open(pathStrPtr ptr, pathStrLen size, connectionIDPtr ptr) uint64
-
 // Open opens a sqlite connection.
 func Open(path string) (connectionID uint64, err error) {
 	defer func() {
@@ -26,7 +22,8 @@ func Open(path string) (connectionID uint64, err error) {
 		}
 	}()
 
-	errno := open(mkptr(&path), size(len(path)), mkptr(&connectionID))
+	pathBytes := []byte(path)
+	errno := open(mkptr(&pathBytes[0]), size(len(path)), mkptr(&connectionID))
 	switch errno {
 	case 0:
 		return connectionID, nil
@@ -37,10 +34,6 @@ func Open(path string) (connectionID uint64, err error) {
 	}
 }
 
-//go:wasmimport lunatic::sqlite execute
-//go:noescape
-func execute(connID uint64, execStrPtr ptr, execStrLen size) uint32
-
 // Execute executes a sqlite query.
 func Execute(connID uint64, exec string) (err error) {
 	defer func() {
@@ -49,7 +42,8 @@ func Execute(connID uint64, exec string) (err error) {
 		}
 	}()
 
-	errno := execute(connID, mkptr(&exec), size(len(exec)))
+	execBytes := []byte(exec)
+	errno := execute(connID, mkptr(&execBytes[0]), size(len(exec)))
 	switch errno {
 	case 0:
 		return nil
@@ -60,9 +54,19 @@ func Execute(connID uint64, exec string) (err error) {
 	}
 }
 
-//go:wasmimport lunatic::sqlite bind_value
-//go:noescape
-func bind_value(statementID uint64, bindDataPtr ptr, bindDataLen size)
+// QueryPrepare prepares the first statement of `query` and returns the
+// ID of the prepared statement, which must be released with Finalize.
+func QueryPrepare(connID uint64, query string) (statementID uint64, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("sqlite.query_prepare error: %v", r)
+		}
+	}()
+
+	queryBytes := []byte(query)
+	statementID = query_prepare(connID, mkptr(unsafe.SliceData(queryBytes)), size(len(query)))
+	return statementID, nil
+}
 
 // BindValue binds a value.
 func BindValue(statementID uint64, bindData []byte) (err error) {
@@ -76,10 +80,6 @@ func BindValue(statementID uint64, bindData []byte) (err error) {
 	return nil
 }
 
-//go:wasmimport lunatic::sqlite sqlite3_changes
-//go:noescape
-func sqlite3_changes(connID uint64) uint32
-
 // Changes returns the sqlite change count.
 func Changes(connID uint64) (changeCount uint32, err error) {
 	defer func() {
@@ -92,10 +92,6 @@ func Changes(connID uint64) (changeCount uint32, err error) {
 	return n, nil
 }
 
-//go:wasmimport lunatic::sqlite statement_reset
-//go:noescape
-func statement_reset(statementID uint64)
-
 // StatementReset resets a sqlite statement.
 func StatementReset(statementID uint64) (err error) {
 	defer func() {
@@ -108,9 +104,11 @@ func StatementReset(statementID uint64) (err error) {
 	return nil
 }
 
-//go:wasmimport lunatic::sqlite sqlite3_step
-//go:noescape
-func sqlite3_step(statementID uint64) uint32
+// Status codes returned by Step.
+const (
+	SQLiteRow  = 100 // SQLITE_ROW: a row is available.
+	SQLiteDone = 101 // SQLITE_DONE: the statement has finished.
+)
 
 // Step returns SQLITE_DONE or SQLITE_ROW depending on whether
 // there's more data available or not.
@@ -125,10 +123,6 @@ func Step(statementID uint64) (status uint32, err error) {
 	return status, nil
 }
 
-//go:wasmimport lunatic::sqlite sqlite3_finalize
-//go:noescape
-func sqlite3_finalize(statementID uint64)
-
 // Finalize
 func Finalize(statementID uint64) (err error) {
 	defer func() {
@@ -141,10 +135,6 @@ func Finalize(statementID uint64) (err error) {
 	return nil
 }
 
-//go:wasmimport lunatic::sqlite column_count
-//go:noescape
-func column_count(statementID uint64) uint32
-
 // ColumnCount returns the column count.
 func ColumnCount(statementID uint64) (count uint32, err error) {
 	defer func() {
@@ -157,83 +147,71 @@ func ColumnCount(statementID uint64) (count uint32, err error) {
 	return count, nil
 }
 
-//go:wasmimport lunatic::sqlite last_error
-//go:noescape
-func last_error(connID uint64, opaquePtr ptr) uint32
-
-// LastError returns the last error message in the provided buffer
-func LastError(connID uint64, buf []byte) (err error) {
+// LastError returns the last error of the connection `connID`,
+// encoded by the host with bincode.
+func LastError(connID uint64) (data []byte, err error) {
 	defer func() {
 		if r := recover(); r != nil {
 			err = fmt.Errorf("sqlite.last_error error: %v", r)
 		}
 	}()
 
-	last_error(connID, mkptr(&buf[0]))
-	return nil
+	var n size
+	p := last_error(connID, mkptr(&n))
+	return claim(p, n), nil
 }
 
-//go:wasmimport lunatic::sqlite read_column
-//go:noescape
-func read_column(statementID uint64, colIdx uint32, opaquePtr ptr) uint32
-
-// ReadColumn reads a column at the given index.
-func ReadColumn(statementID uint64, colIdx uint32, buf []byte) (n uint32, err error) {
+// ReadColumn reads the column at `colIdx` of the current row,
+// encoded by the host with bincode.
+func ReadColumn(statementID uint64, colIdx uint32) (data []byte, err error) {
 	defer func() {
 		if r := recover(); r != nil {
 			err = fmt.Errorf("sqlite.read_column error: %v", r)
 		}
 	}()
 
-	n = read_column(statementID, colIdx, mkptr(&buf[0]))
-	return n, nil
+	var n size
+	p := read_column(statementID, colIdx, mkptr(&n))
+	return claim(p, n), nil
 }
 
-//go:wasmimport lunatic::sqlite read_row
-//go:noescape
-func read_row(statementID uint64, opaquePtr ptr) uint32
-
-// ReadRow reads a row starting at colIdx 0.
-func ReadRow(statementID uint64, buf []byte) (n uint32, err error) {
+// ReadRow reads all the columns of the current row,
+// encoded by the host with bincode.
+func ReadRow(statementID uint64) (data []byte, err error) {
 	defer func() {
 		if r := recover(); r != nil {
 			err = fmt.Errorf("sqlite.read_row error: %v", r)
 		}
 	}()
 
-	n = read_row(statementID, mkptr(&buf[0]))
-	return n, nil
+	var n size
+	p := read_row(statementID, mkptr(&n))
+	return claim(p, n), nil
 }
 
-//go:wasmimport lunatic::sqlite column_name
-//go:noescape
-func column_name(statementID uint64, columnIdx uint32, opaquePtr ptr) uint32
-
-// ColumnName returns the column name at the columnIdx.
-func ColumnName(statementID uint64, columnIdx uint32, buf []byte) (n uint32, err error) {
+// ColumnName returns the name of the column at `columnIdx`.
+func ColumnName(statementID uint64, columnIdx uint32) (name string, err error) {
 	defer func() {
 		if r := recover(); r != nil {
 			err = fmt.Errorf("sqlite.column_name error: %v", r)
 		}
 	}()
 
-	n = column_name(statementID, columnIdx, mkptr(&buf[0]))
-	return n, nil
+	var n size
+	p := column_name(statementID, columnIdx, mkptr(&n))
+	return string(claim(p, n)), nil
 }
 
-//go:wasmimport lunatic::sqlite column_names
-//go:noescape
-func column_names(statementID uint64, opaquePtr ptr) uint32
-
-// ColumnNames returns the columns names.
-// TODO: Are these a vector of zero-terminated strings?
-func ColumnNames(statementID uint64, buf []byte) (n uint32, err error) {
+// ColumnNames returns the names of all the columns,
+// encoded by the host with bincode.
+func ColumnNames(statementID uint64) (data []byte, err error) {
 	defer func() {
 		if r := recover(); r != nil {
-			err = fmt.Errorf("sqlite.column_name error: %v", r)
+			err = fmt.Errorf("sqlite.column_names error: %v", r)
 		}
 	}()
 
-	n = column_names(statementID, mkptr(&buf[0]))
-	return n, nil
+	var n size
+	p := column_names(statementID, mkptr(&n))
+	return claim(p, n), nil
 }
@@ -0,0 +1,58 @@
+// -*- compile-command: "go test ./..."; -*-
+
+package sqlite_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/gmlewis/go-lunatic/lunatic/sqlite"
+)
+
+func TestExecute(t *testing.T) {
+	conn, err := sqlite.Open(":memory:")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+
+	if err := sqlite.Execute(conn, `
+		CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT);
+		INSERT INTO users (name) VALUES ('ann'), ('bob');
+	`); err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if n, err := sqlite.Changes(conn); err != nil || n != 2 {
+		t.Errorf("Changes = %v, %v, want 2", n, err)
+	}
+
+	if err := sqlite.Execute(conn, "UPDATE users SET name = 'eve' WHERE id = 2"); err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if n, err := sqlite.Changes(conn); err != nil || n != 1 {
+		t.Errorf("Changes = %v, %v, want 1", n, err)
+	}
+}
+
+func TestLastError(t *testing.T) {
+	conn, err := sqlite.Open(":memory:")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+
+	if err := sqlite.Execute(conn, "SELECT * FROM missing"); err == nil {
+		t.Fatal("Execute on a missing table: want error")
+	}
+	data, err := sqlite.LastError(conn)
+	if err != nil {
+		t.Fatalf("LastError: %v", err)
+	}
+	if !bytes.Contains(data, []byte("no such table: missing")) {
+		t.Errorf("LastError = %q, want it to contain the message", data)
+	}
+}
+
+func TestUnknownConnection(t *testing.T) {
+	if err := sqlite.Execute(12345, "SELECT 1"); err == nil {
+		t.Error("Execute on an unknown connection: want error")
+	}
+}
@@ -0,0 +1,209 @@
+// -*- compile-command: "GOOS=wasip1 GOARCH=wasm go test ./..."; -*-
+
+package sqlite
+
+import "errors"
+
+// Conn is a connection to a SQLite database of the host.
+//
+// Like all lunatic resources, it belongs to the process that opened it.
+type Conn struct {
+	id uint64
+	// depth is the number of transactions and savepoints opened by Tx.
+	depth int
+}
+
+// OpenConn opens a connection to the database at `path`, e.g. ":memory:".
+func OpenConn(path string) (*Conn, error) {
+	id, err := Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Conn{id: id}, nil
+}
+
+// NewConn returns a Conn for the connection with `connID` returned by Open.
+func NewConn(connID uint64) *Conn { return &Conn{id: connID} }
+
+// ID returns the ID of the connection.
+func (c *Conn) ID() uint64 { return c.id }
+
+// Execute runs the statements in `sql`, which may not have parameters.
+//
+// Returns:
+// * nil on success.
+// * *Error if a statement fails.
+func (c *Conn) Execute(sql string) error {
+	if err := Execute(c.id, sql); err != nil {
+		return lastError(c.id, err)
+	}
+	return nil
+}
+
+// Changes returns the number of rows changed by the last INSERT, UPDATE
+// or DELETE statement.
+func (c *Conn) Changes() (int, error) {
+	n, err := Changes(c.id)
+	return int(n), err
+}
+
+// Exec prepares `query`, runs it with `args` and finalizes it.
+func (c *Conn) Exec(query string, args ...any) (Result, error) {
+	st, err := c.Prepare(query)
+	if err != nil {
+		return Result{}, err
+	}
+	defer st.Close()
+	return st.Exec(args...)
+}
+
+// Query is like the package function Query on this connection.
+func (c *Conn) Query(query string, args ...any) (*Rows, error) {
+	return Query(c.id, query, args...)
+}
+
+// Prepare prepares the first statement of `query`. Its parameters are
+// bound with Bind, which keeps them apart from the SQL text.
+//
+// Returns:
+// * nil on success with the prepared statement, which must be closed.
+// * *Error if the statement can't be prepared.
+func (c *Conn) Prepare(query string) (*Stmt, error) {
+	id, err := QueryPrepare(c.id, query)
+	if err != nil {
+		return nil, lastError(c.id, err)
+	}
+	return &Stmt{conn: c, id: id}, nil
+}
+
+// Stmt is a prepared statement. It can be run any number of times,
+// either step by step with Bind, Step, Scan and Reset, or with Exec and Query.
+type Stmt struct {
+	conn *Conn
+	id   uint64
+	// columns are the column names, known after the first step.
+	columns []string
+	row     bool
+	closed  bool
+}
+
+// ID returns the ID of the statement.
+func (s *Stmt) ID() uint64 { return s.id }
+
+// Bind binds `args` to the parameters of the statement.
+//
+// Args are bound by position, or by name with a `:` prefix if they are
+// sql.NamedArg values. Integers, floats, strings, []byte and nil are bound
+// as the corresponding SQLite types, booleans as integers, times as
+// RFC 3339 text, and driver.Valuer implementations by their value.
+func (s *Stmt) Bind(args ...any) error {
+	if s.closed {
+		return errClosed
+	}
+	nvs, err := convertArgs(args)
+	if err != nil {
+		return err
+	}
+	return bind(s.id, nvs)
+}
+
+// Step runs the statement up to the next row and reports whether
+// there is one, which can then be read with Scan.
+func (s *Stmt) Step() (bool, error) {
+	if s.closed {
+		return false, errClosed
+	}
+	s.row = false
+	status, err := step(s.conn.id, s.id)
+	if err != nil {
+		return false, err
+	}
+	if s.columns == nil {
+		if s.columns, err = columnNames(s.id); err != nil {
+			return false, err
+		}
+	}
+	s.row = status == SQLiteRow
+	return s.row, nil
+}
+
+// Columns returns the names of the columns, which are known once Step
+// has been called.
+func (s *Stmt) Columns() []string { return s.columns }
+
+// Scan copies the columns of the current row into `dest` like Rows.Scan.
+func (s *Stmt) Scan(dest ...any) error {
+	if !s.row {
+		return errors.New("sqlite: Scan called without a current row")
+	}
+	values, err := rowValues(s.id)
+	if err != nil {
+		return err
+	}
+	return scan(s.columns, values, dest)
+}
+
+// Reset resets the statement, so that it can be run again with new
+// arguments.
+func (s *Stmt) Reset() error {
+	if s.closed {
+		return errClosed
+	}
+	s.row = false
+	return StatementReset(s.id)
+}
+
+// Result is the outcome of a statement run with Exec.
+type Result struct {
+	// RowsAffected is the number of rows changed by an INSERT, UPDATE
+	// or DELETE statement, as reported by Changes.
+	RowsAffected int64
+}
+
+// Exec resets the statement, binds `args` and runs the statement to completion.
+func (s *Stmt) Exec(args ...any) (Result, error) {
+	if err := s.Reset(); err != nil {
+		return Result{}, err
+	}
+	if err := s.Bind(args...); err != nil {
+		return Result{}, err
+	}
+	for {
+		row, err := s.Step()
+		if err != nil {
+			return Result{}, err
+		}
+		if !row {
+			n, err := s.conn.Changes()
+			return Result{RowsAffected: int64(n)}, err
+		}
+	}
+}
+
+// Query resets the statement, binds `args` and returns its rows.
+// Closing the rows resets the statement, which stays open.
+func (s *Stmt) Query(args ...any) (*Rows, error) {
+	if err := s.Reset(); err != nil {
+		return nil, err
+	}
+	nvs, err := convertArgs(args)
+	if err != nil {
+		return nil, err
+	}
+	r := &Rows{connID: s.conn.id, statementID: s.id}
+	if err := r.start(nvs); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Close finalizes the statement. It is safe to call Close more than once.
+func (s *Stmt) Close() error {
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	return Finalize(s.id)
+}
+
+var errClosed = errors.New("sqlite: statement is closed")
@@ -0,0 +1,110 @@
+// -*- compile-command: "go test ./..."; -*-
+
+package sqlite_test
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/gmlewis/go-lunatic/lunatic/sqlite"
+)
+
+func TestStmt(t *testing.T) {
+	conn, err := sqlite.OpenConn(":memory:")
+	if err != nil {
+		t.Fatalf("OpenConn: %v", err)
+	}
+	if err := conn.Execute("CREATE TABLE notes (id INTEGER PRIMARY KEY, body TEXT, score REAL, data BLOB)"); err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+
+	insert, err := conn.Prepare("INSERT INTO notes (body, score, data) VALUES (?, ?, ?)")
+	if err != nil {
+		t.Fatalf("Prepare: %v", err)
+	}
+	defer insert.Close()
+	// Parameters are never interpreted as SQL.
+	evil := "x'); DROP TABLE notes; --"
+	if res, err := insert.Exec(evil, 2, []byte{0}); err != nil || res.RowsAffected != 1 {
+		t.Fatalf("Exec = %+v, %v, want 1 row", res, err)
+	}
+	if res, err := insert.Exec("plain", 0.5, nil); err != nil || res.RowsAffected != 1 {
+		t.Fatalf("Exec = %+v, %v, want 1 row", res, err)
+	}
+
+	sel, err := conn.Prepare("SELECT body, score, data FROM notes WHERE id = :id")
+	if err != nil {
+		t.Fatalf("Prepare: %v", err)
+	}
+	defer sel.Close()
+	if err := sel.Bind(sql.Named("id", 1)); err != nil {
+		t.Fatalf("Bind: %v", err)
+	}
+	if row, err := sel.Step(); err != nil || !row {
+		t.Fatalf("Step = %v, %v, want a row", row, err)
+	}
+	var body string
+	var score float64
+	var data []byte
+	if err := sel.Scan(&body, &score, &data); err != nil {
+		t.Fatalf("Scan: %v", err)
+	}
+	if body != evil || score != 2 || len(data) != 1 {
+		t.Errorf("Scan = %q, %v, %v", body, score, data)
+	}
+	if row, err := sel.Step(); err != nil || row {
+		t.Errorf("Step = %v, %v, want the end", row, err)
+	}
+	if err := sel.Scan(&body, &score, &data); err == nil {
+		t.Error("Scan after the last row: want error")
+	}
+
+	if err := sel.Reset(); err != nil {
+		t.Fatalf("Reset: %v", err)
+	}
+	rows, err := sel.Query(sql.Named("id", 2))
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	if !rows.Next() {
+		t.Fatalf("Next = false, %v, want a row", rows.Err())
+	}
+	var note struct {
+		Body  string
+		Score float64
+		Data  *[]byte
+	}
+	if err := rows.Scan(&note); err != nil || note.Body != "plain" || note.Score != 0.5 || note.Data != nil {
+		t.Errorf("Scan = %+v, %v", note, err)
+	}
+	rows.Close()
+
+	if err := sel.Close(); err != nil {
+		t.Errorf("Close: %v", err)
+	}
+	if err := sel.Bind(1); err == nil {
+		t.Error("Bind after Close: want error")
+	}
+}
+
+func TestPrepareError(t *testing.T) {
+	conn, err := sqlite.OpenConn(":memory:")
+	if err != nil {
+		t.Fatalf("OpenConn: %v", err)
+	}
+	_, err = conn.Prepare("SELEKT 1")
+	var sqliteErr *sqlite.Error
+	if !errors.As(err, &sqliteErr) {
+		t.Errorf("Prepare of invalid SQL = %v, want *sqlite.Error", err)
+	}
+
+	st, err := conn.Prepare("SELECT 1")
+	if err != nil {
+		t.Fatalf("Prepare: %v", err)
+	}
+	defer st.Close()
+	if err := st.Bind(struct{}{}); err == nil {
+		t.Error("Bind of a struct: want error")
+	}
+}
@@ -0,0 +1,82 @@
+// -*- compile-command: "GOOS=wasip1 GOARCH=wasm go test ./..."; -*-
+
+package sqlite
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Tx is the connection inside a transaction started by Conn.Tx.
+// Calling Tx on it opens a nested savepoint.
+type Tx struct {
+	*Conn
+}
+
+// Tx runs `fn` in a transaction, which is committed if `fn` returns nil
+// and rolled back if it returns an error or panics.
+//
+// Calls nested in `fn`, on the Tx or on the Conn, use a savepoint instead,
+// so that only their own changes are rolled back on failure while the
+// enclosing transaction continues.
+//
+// Returns:
+// * nil if the changes of `fn` were committed or released.
+// * the error of `fn`, joined with the error of the rollback if it fails.
+// * *Error if beginning or committing the transaction fails.
+//
+// If `fn` panics, the panic continues after the rollback. If the rollback
+// fails, the panic continues with a *RollbackPanic holding both the value
+// of the panic and the error of the rollback.
+func (c *Conn) Tx(fn func(tx *Tx) error) error {
+	begin, commit, rollback := "BEGIN", "COMMIT", "ROLLBACK"
+	if c.depth > 0 {
+		name := fmt.Sprintf("tx_%v", c.depth)
+		begin, commit = "SAVEPOINT "+name, "RELEASE "+name
+		// ROLLBACK TO keeps the savepoint, so it is released as well.
+		rollback = "ROLLBACK TO " + name + "; RELEASE " + name
+	}
+
+	if err := c.Execute(begin); err != nil {
+		return err
+	}
+	c.depth++
+	defer func() {
+		c.depth--
+		if r := recover(); r != nil {
+			if err := c.Execute(rollback); err != nil {
+				panic(&RollbackPanic{Value: r, Err: err})
+			}
+			panic(r)
+		}
+	}()
+
+	if err := fn(&Tx{c}); err != nil {
+		if rerr := c.Execute(rollback); rerr != nil {
+			return errors.Join(err, rerr)
+		}
+		return err
+	}
+	if err := c.Execute(commit); err != nil {
+		if rerr := c.Execute(rollback); rerr != nil {
+			return errors.Join(err, rerr)
+		}
+		return err
+	}
+	return nil
+}
+
+// RollbackPanic is the value of the panic that continues from Conn.Tx when
+// the rollback after a panic of its function fails.
+type RollbackPanic struct {
+	// Value is the value of the original panic.
+	Value any
+	// Err is the error of the rollback.
+	Err error
+}
+
+func (e *RollbackPanic) Error() string {
+	return fmt.Sprintf("sqlite: rollback after panic %v: %v", e.Value, e.Err)
+}
+
+func (e *RollbackPanic) Unwrap() error { return e.Err }
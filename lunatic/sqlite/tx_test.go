@@ -0,0 +1,141 @@
+// -*- compile-command: "go test ./..."; -*-
+
+package sqlite_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/gmlewis/go-lunatic/lunatic/sqlite"
+)
+
+func openItems(t *testing.T) *sqlite.Conn {
+	t.Helper()
+	conn, err := sqlite.OpenConn(":memory:")
+	if err != nil {
+		t.Fatalf("OpenConn: %v", err)
+	}
+	if err := conn.Execute("CREATE TABLE items (name TEXT)"); err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	return conn
+}
+
+func countItems(t *testing.T, conn *sqlite.Conn) (n int) {
+	t.Helper()
+	rows, err := conn.Query("SELECT COUNT(*) FROM items")
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	defer rows.Close()
+	if !rows.Next() || rows.Scan(&n) != nil {
+		t.Fatalf("Scan: %v", rows.Err())
+	}
+	return n
+}
+
+func TestTx(t *testing.T) {
+	conn := openItems(t)
+
+	err := conn.Tx(func(tx *sqlite.Tx) error {
+		for _, name := range []string{"a", "b", "c"} {
+			if _, err := tx.Exec("INSERT INTO items (name) VALUES (?)", name); err != nil {
+				return err
+			}
+		}
+		res, err := tx.Exec("DELETE FROM items WHERE name != ?", "a")
+		if err == nil && res.RowsAffected != 2 {
+			t.Errorf("RowsAffected = %v, want 2", res.RowsAffected)
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatalf("Tx: %v", err)
+	}
+	if n := countItems(t, conn); n != 1 {
+		t.Errorf("count after commit = %v, want 1", n)
+	}
+
+	errFail := errors.New("fail")
+	err = conn.Tx(func(tx *sqlite.Tx) error {
+		tx.Exec("INSERT INTO items (name) VALUES ('x')")
+		return errFail
+	})
+	if !errors.Is(err, errFail) {
+		t.Errorf("Tx = %v, want errFail", err)
+	}
+	if n := countItems(t, conn); n != 1 {
+		t.Errorf("count after rollback = %v, want 1", n)
+	}
+
+	err = conn.Tx(func(tx *sqlite.Tx) error {
+		_, err := tx.Exec("INSERT INTO missing VALUES (1)")
+		return err
+	})
+	var sqliteErr *sqlite.Error
+	if !errors.As(err, &sqliteErr) {
+		t.Errorf("Tx = %v, want *sqlite.Error", err)
+	}
+}
+
+func TestTxSavepoint(t *testing.T) {
+	conn := openItems(t)
+
+	err := conn.Tx(func(tx *sqlite.Tx) error {
+		tx.Exec("INSERT INTO items (name) VALUES ('outer')")
+		if err := tx.Tx(func(tx *sqlite.Tx) error {
+			tx.Exec("INSERT INTO items (name) VALUES ('inner')")
+			return errors.New("undo inner")
+		}); err == nil {
+			t.Error("nested Tx: want error")
+		}
+		if n := countItems(t, tx.Conn); n != 1 {
+			t.Errorf("count after nested rollback = %v, want 1", n)
+		}
+		return tx.Tx(func(tx *sqlite.Tx) error {
+			_, err := tx.Exec("INSERT INTO items (name) VALUES ('kept')")
+			return err
+		})
+	})
+	if err != nil {
+		t.Fatalf("Tx: %v", err)
+	}
+	if n := countItems(t, conn); n != 2 {
+		t.Errorf("count = %v, want 2", n)
+	}
+
+	func() {
+		defer func() {
+			if r := recover(); r != "boom" {
+				t.Errorf("recover = %v, want boom", r)
+			}
+		}()
+		conn.Tx(func(tx *sqlite.Tx) error {
+			tx.Exec("INSERT INTO items (name) VALUES ('lost')")
+			panic("boom")
+		})
+	}()
+	if n := countItems(t, conn); n != 2 {
+		t.Errorf("count after panic = %v, want 2", n)
+	}
+	// The connection is no longer in a transaction.
+	if err := conn.Execute("BEGIN; COMMIT"); err != nil {
+		t.Errorf("Execute: %v", err)
+	}
+}
+
+func TestTxPanicRollbackError(t *testing.T) {
+	conn := openItems(t)
+	defer func() {
+		r, ok := recover().(*sqlite.RollbackPanic)
+		var sqlErr *sqlite.Error
+		if !ok || r.Value != "boom" || !errors.As(r, &sqlErr) {
+			t.Errorf("recover = %#v, want RollbackPanic of boom with the rollback error", r)
+		}
+	}()
+	conn.Tx(func(tx *sqlite.Tx) error {
+		// Ending the transaction makes the rollback fail.
+		tx.Execute("COMMIT")
+		panic("boom")
+	})
+}
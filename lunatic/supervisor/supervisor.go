@@ -0,0 +1,266 @@
+// -*- compile-command: "GOOS=wasip1 GOARCH=wasm go test ./..."; -*-
+
+// Package supervisor provides Erlang-style supervisors that restart
+// linked child processes when they die.
+//
+// A Supervisor starts its children in order, links to each of them and
+// turns the death of a linked child into a message with
+// `process.DieWhenLinkDies(false)`. It then restarts the children
+// according to its Strategy, up to MaxRestarts times within Period.
+//
+// The supervisor runs in the process that calls Run, so it is usually
+// given a process of its own:
+//
+//	var sup = lunatic.RegisterFunc(func() {
+//		s := supervisor.New(supervisor.OneForOne,
+//			supervisor.ChildSpec{Name: "db", Start: startDB},
+//			supervisor.ChildSpec{Name: "web", Start: startWeb},
+//		)
+//		if err := s.Run(); err != nil {
+//			log.Fatal(err)
+//		}
+//	})
+package supervisor
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gmlewis/go-lunatic/lunatic/message"
+	"github.com/gmlewis/go-lunatic/lunatic/process"
+)
+
+var (
+	TooManyRestarts = errors.New("too many restarts")
+)
+
+// Strategy defines which children are restarted when one of them dies.
+type Strategy int
+
+const (
+	// OneForOne restarts only the child that died.
+	OneForOne Strategy = iota
+	// OneForAll terminates all other children and restarts all of them.
+	OneForAll
+	// RestForOne terminates the children started after the one that died
+	// and restarts them together with it.
+	RestForOne
+)
+
+func (s Strategy) String() string {
+	switch s {
+	case OneForOne:
+		return "OneForOne"
+	case OneForAll:
+		return "OneForAll"
+	case RestForOne:
+		return "RestForOne"
+	default:
+		return fmt.Sprintf("Strategy(%d)", int(s))
+	}
+}
+
+// Default restart intensity of a new Supervisor.
+const (
+	DefaultMaxRestarts = 3
+	DefaultPeriod      = 5 * time.Second
+)
+
+// firstLinkTag is the first link-tag used for children. Every child start
+// gets a new tag so that signals from terminated children can be ignored.
+const firstLinkTag int64 = 0x5355_0000_0000
+
+// ChildSpec describes a child process.
+type ChildSpec struct {
+	// Name identifies the child in errors.
+	Name string
+	// Start spawns the child process linked to the current process with
+	// `link` as the link-tag and returns its ID, e.g. with
+	// `lunatic.SpawnLinkFunc`. Spawning and linking at once ensures that
+	// the supervisor notices a child that dies right away.
+	Start func(link int64) (processID uint64, err error)
+}
+
+type child struct {
+	spec      ChildSpec
+	processID uint64
+	tag       int64 // 0 if not running
+}
+
+// Supervisor starts and restarts a list of children.
+type Supervisor struct {
+	// Strategy defines which children are restarted when one dies.
+	Strategy Strategy
+	// MaxRestarts is the maximum number of restarts allowed within Period.
+	// If it is exceeded, the supervisor terminates all its children and
+	// Run returns TooManyRestarts.
+	MaxRestarts int
+	// Period is the time window for MaxRestarts.
+	Period time.Duration
+
+	children []*child
+	nextTag  int64
+	restarts []time.Time
+	started  bool
+}
+
+// New returns a Supervisor for `children` using `strategy` and the
+// default restart intensity.
+func New(strategy Strategy, children ...ChildSpec) *Supervisor {
+	s := &Supervisor{
+		Strategy:    strategy,
+		MaxRestarts: DefaultMaxRestarts,
+		Period:      DefaultPeriod,
+		nextTag:     firstLinkTag,
+	}
+	for _, spec := range children {
+		s.children = append(s.children, &child{spec: spec})
+	}
+	return s
+}
+
+// Children returns the process IDs of the children in start order.
+// The ID of a child that is not running is 0. Since normal exits are not
+// signaled to links, children that exited normally are found with
+// `process.Exists`.
+func (s *Supervisor) Children() []uint64 {
+	ids := make([]uint64, len(s.children))
+	for i, c := range s.children {
+		if c.tag != 0 && process.Exists(c.processID) {
+			ids[i] = c.processID
+		}
+	}
+	return ids
+}
+
+// Start makes the current process trap link deaths and starts all the
+// children in order. If a child fails to start, the children started so
+// far are terminated and the error is returned.
+func (s *Supervisor) Start() error {
+	if s.started {
+		return errors.New("supervisor: already started")
+	}
+	process.DieWhenLinkDies(false)
+
+	for i, c := range s.children {
+		if err := s.startChild(c); err != nil {
+			s.terminate(s.children[:i])
+			return err
+		}
+	}
+	s.started = true
+	return nil
+}
+
+// Run starts the children if Start was not called yet and then supervises
+// them until the restart intensity is exceeded.
+//
+// Returns:
+// * TooManyRestarts if the children were restarted more than MaxRestarts
+// times within Period. All children are terminated in this case.
+// * error if a child could not be (re)started or the mailbox failed.
+func (s *Supervisor) Run() error {
+	if !s.started {
+		if err := s.Start(); err != nil {
+			return err
+		}
+	}
+
+	for {
+		tags := make([]int64, 0, len(s.children))
+		for _, c := range s.children {
+			if c.tag != 0 {
+				tags = append(tags, c.tag)
+			}
+		}
+		if len(tags) == 0 {
+			return nil // nothing to supervise.
+		}
+
+		msg, err := message.Receive(tags, nil)
+		if err != nil {
+			return fmt.Errorf("supervisor: receive: %w", err)
+		}
+		sig, ok := msg.(*message.LinkDiedSignal)
+		if !ok {
+			continue // not a signal.
+		}
+
+		index := s.childIndex(sig.Tag)
+		if index < 0 {
+			continue // signal from a child terminated by the supervisor.
+		}
+		s.children[index].tag = 0
+
+		if err := s.handleExit(index); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *Supervisor) childIndex(tag int64) int {
+	for i, c := range s.children {
+		if c.tag == tag {
+			return i
+		}
+	}
+	return -1
+}
+
+// handleExit restarts children after the child at `index` died.
+func (s *Supervisor) handleExit(index int) error {
+	now := time.Now()
+	s.restarts = append(s.restarts, now)
+	for len(s.restarts) > 0 && now.Sub(s.restarts[0]) > s.Period {
+		s.restarts = s.restarts[1:]
+	}
+	if len(s.restarts) > s.MaxRestarts {
+		s.terminate(s.children)
+		return fmt.Errorf("supervisor: child %q: %w", s.children[index].spec.Name, TooManyRestarts)
+	}
+
+	var restart []*child
+	switch s.Strategy {
+	case OneForOne:
+		restart = s.children[index : index+1]
+	case OneForAll:
+		restart = s.children
+	case RestForOne:
+		restart = s.children[index:]
+	default:
+		return fmt.Errorf("supervisor: unknown strategy %v", s.Strategy)
+	}
+
+	s.terminate(restart)
+	for _, c := range restart {
+		if err := s.startChild(c); err != nil {
+			s.terminate(s.children)
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Supervisor) startChild(c *child) error {
+	s.nextTag++
+	id, err := c.spec.Start(s.nextTag)
+	if err != nil {
+		return fmt.Errorf("supervisor: start child %q: %w", c.spec.Name, err)
+	}
+	c.processID, c.tag = id, s.nextTag
+	return nil
+}
+
+// terminate unlinks and kills the running children in reverse start order.
+func (s *Supervisor) terminate(children []*child) {
+	for i := len(children) - 1; i >= 0; i-- {
+		c := children[i]
+		if c.tag == 0 {
+			continue
+		}
+		process.Unlink(c.processID)
+		process.Kill(c.processID)
+		c.tag = 0
+	}
+}
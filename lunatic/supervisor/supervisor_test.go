@@ -0,0 +1,171 @@
+// -*- compile-command: "go test ./..."; -*-
+
+package supervisor_test
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gmlewis/go-lunatic/lunatic"
+	"github.com/gmlewis/go-lunatic/lunatic/process"
+	"github.com/gmlewis/go-lunatic/lunatic/supervisor"
+)
+
+// The fake host runs all processes in the same address space,
+// so the children can count their starts in a package variable.
+var starts atomic.Int32
+
+// crasher panics right away, which the supervisor notices since it is
+// linked to it as it is spawned.
+var crasher = lunatic.RegisterFunc(func() {
+	starts.Add(1)
+	panic("crash")
+})
+
+var sleeper = lunatic.RegisterFunc(func() {
+	starts.Add(1)
+	process.SleepMS(60_000)
+})
+
+// first counts its own starts to tell them apart from the other children.
+var firstStarts atomic.Int32
+
+var first = lunatic.RegisterFunc(func() {
+	firstStarts.Add(1)
+	process.SleepMS(60_000)
+})
+
+// flaky crashes on its first start only.
+var flakyStarts atomic.Int32
+
+var flaky = lunatic.RegisterFunc(func() {
+	if flakyStarts.Add(1) == 1 {
+		panic("first start")
+	}
+	process.SleepMS(60_000)
+})
+
+// ticker crashes after 100ms.
+var ticker = lunatic.RegisterFunc(func() {
+	process.SleepMS(100)
+	panic("tick")
+})
+
+var exiter = lunatic.RegisterFunc(func() {})
+
+func start(fn func()) func(int64) (uint64, error) {
+	return func(link int64) (uint64, error) {
+		pid, err := lunatic.SpawnLinkFunc(link, fn)
+		return uint64(pid), err
+	}
+}
+
+func TestTooManyRestarts(t *testing.T) {
+	starts.Store(0)
+	s := supervisor.New(supervisor.OneForOne, supervisor.ChildSpec{Name: "crasher", Start: start(crasher)})
+	s.MaxRestarts = 2
+	s.Period = time.Minute
+	defer process.DieWhenLinkDies(true)
+
+	if err := s.Run(); !errors.Is(err, supervisor.TooManyRestarts) {
+		t.Fatalf("Run = %v, want TooManyRestarts", err)
+	}
+	if n := starts.Load(); n != 3 {
+		t.Errorf("starts = %v, want 3", n)
+	}
+}
+
+func TestOneForAll(t *testing.T) {
+	starts.Store(0)
+	s := supervisor.New(supervisor.OneForAll,
+		supervisor.ChildSpec{Name: "sleeper", Start: start(sleeper)},
+		supervisor.ChildSpec{Name: "crasher", Start: start(crasher)},
+	)
+	s.MaxRestarts = 1
+	s.Period = time.Minute
+	defer process.DieWhenLinkDies(true)
+
+	if err := s.Run(); !errors.Is(err, supervisor.TooManyRestarts) {
+		t.Fatalf("Run = %v, want TooManyRestarts", err)
+	}
+	// Both children are started twice, and the sleeper is killed each time.
+	if n := starts.Load(); n != 4 {
+		t.Errorf("starts = %v, want 4", n)
+	}
+	for _, id := range s.Children() {
+		if id != 0 {
+			t.Errorf("child %v still running after Run", id)
+		}
+	}
+}
+
+func TestRestForOne(t *testing.T) {
+	starts.Store(0)
+	firstStarts.Store(0)
+	s := supervisor.New(supervisor.RestForOne,
+		supervisor.ChildSpec{Name: "first", Start: start(first)},
+		supervisor.ChildSpec{Name: "crasher", Start: start(crasher)},
+		supervisor.ChildSpec{Name: "sleeper", Start: start(sleeper)},
+	)
+	s.MaxRestarts = 1
+	s.Period = time.Minute
+	defer process.DieWhenLinkDies(true)
+
+	if err := s.Run(); !errors.Is(err, supervisor.TooManyRestarts) {
+		t.Fatalf("Run = %v, want TooManyRestarts", err)
+	}
+	// Only the children from the crasher on are restarted.
+	if n := firstStarts.Load(); n != 1 {
+		t.Errorf("first starts = %v, want 1", n)
+	}
+	if n := starts.Load(); n != 4 {
+		t.Errorf("starts = %v, want 4", n)
+	}
+}
+
+func TestRestart(t *testing.T) {
+	flakyStarts.Store(0)
+	s := supervisor.New(supervisor.OneForOne,
+		supervisor.ChildSpec{Name: "flaky", Start: start(flaky)},
+		supervisor.ChildSpec{Name: "ticker", Start: start(ticker)},
+	)
+	s.MaxRestarts = 1
+	s.Period = time.Minute
+	defer process.DieWhenLinkDies(true)
+
+	// The restart of flaky succeeds, so only the crash of the ticker
+	// exceeds the restart intensity.
+	began := time.Now()
+	if err := s.Run(); !errors.Is(err, supervisor.TooManyRestarts) {
+		t.Fatalf("Run = %v, want TooManyRestarts", err)
+	}
+	if d := time.Since(began); d < 100*time.Millisecond {
+		t.Errorf("Run returned after %v, want the ticker to crash after 100ms", d)
+	}
+	if n := flakyStarts.Load(); n != 2 {
+		t.Errorf("flaky starts = %v, want 2", n)
+	}
+}
+
+func TestNormalExit(t *testing.T) {
+	s := supervisor.New(supervisor.OneForOne,
+		supervisor.ChildSpec{Name: "exiter", Start: start(exiter)},
+		supervisor.ChildSpec{Name: "sleeper", Start: start(sleeper)},
+	)
+	defer process.DieWhenLinkDies(true)
+	if err := s.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	process.SleepMS(20)
+
+	ids := s.Children()
+	defer func() {
+		process.Unlink(ids[1])
+		process.Kill(ids[1])
+	}()
+	if ids[0] != 0 || ids[1] == 0 {
+		t.Errorf("Children = %v, want [0 <sleeper>]", ids)
+	}
+}
@@ -0,0 +1,22 @@
+// -*- compile-command: "go test ./..."; -*-
+
+//go:build !wasm
+
+package timer
+
+import (
+	"time"
+
+	"github.com/gmlewis/go-lunatic/lunatic/internal/fakehost"
+)
+
+func send_after(processID uint64, delayMillis uint64) uint64 {
+	return fakehost.Current().SendAfter(processID, time.Duration(delayMillis)*time.Millisecond)
+}
+
+func cancel_timer(timerID uint64) uint32 {
+	if fakehost.CancelTimer(timerID) {
+		return 1
+	}
+	return 0
+}
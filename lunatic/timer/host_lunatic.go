@@ -0,0 +1,13 @@
+// -*- compile-command: "GOOS=wasip1 GOARCH=wasm go test ./..."; -*-
+
+//go:build wasm
+
+package timer
+
+//go:wasmimport lunatic::timer send_after
+//go:noescape
+func send_after(processID uint64, delayMillis uint64) uint64
+
+//go:wasmimport lunatic::timer cancel_timer
+//go:noescape
+func cancel_timer(timerID uint64) uint32
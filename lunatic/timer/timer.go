@@ -5,10 +5,6 @@ package timer
 
 import "fmt"
 
-//go:wasmimport lunatic::timer send_after
-//go:noescape
-func send_after(processID uint64, delayMillis uint64) uint64
-
 // SendAfter sends the message to a process after a delay.
 //
 // There are no guarantees that the message will be received.
@@ -27,10 +23,6 @@ func SendAfter(processID uint64, delayMillis uint64) (id uint64, err error) {
 	return id, nil
 }
 
-//go:wasmimport lunatic::timer cancel_timer
-//go:noescape
-func cancel_timer(timerID uint64) uint32
-
 // CancelTimer cancels the specified timer.
 //
 // Returns:
@@ -0,0 +1,44 @@
+// -*- compile-command: "go test ./..."; -*-
+
+package timer_test
+
+import (
+	"testing"
+
+	"github.com/gmlewis/go-lunatic/lunatic/message"
+	"github.com/gmlewis/go-lunatic/lunatic/process"
+	"github.com/gmlewis/go-lunatic/lunatic/timer"
+)
+
+func TestSendAfter(t *testing.T) {
+	mailbox := message.NewMailbox[string](1, nil)
+
+	message.CreateData(mailbox.Tag(), 0)
+	message.EncodeData("tick", nil)
+	if _, err := timer.SendAfter(process.ProcessID(), 10); err != nil {
+		t.Fatalf("SendAfter: %v", err)
+	}
+	if got, err := mailbox.Receive(); err != nil || got != "tick" {
+		t.Errorf("Receive = %q, %v, want tick", got, err)
+	}
+}
+
+func TestCancelTimer(t *testing.T) {
+	message.CreateData(2, 0)
+	id, err := timer.SendAfter(process.ProcessID(), 60_000)
+	if err != nil {
+		t.Fatalf("SendAfter: %v", err)
+	}
+	if !timer.CancelTimer(id) {
+		t.Error("CancelTimer = false, want true")
+	}
+	if timer.CancelTimer(id) {
+		t.Error("second CancelTimer = true, want false")
+	}
+}
+
+func TestSendAfterWithoutMessage(t *testing.T) {
+	if _, err := timer.SendAfter(process.ProcessID(), 10); err == nil {
+		t.Error("SendAfter without a message: want error")
+	}
+}
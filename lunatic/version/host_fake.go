@@ -0,0 +1,11 @@
+// -*- compile-command: "go test ./..."; -*-
+
+//go:build !wasm
+
+package version
+
+import "github.com/gmlewis/go-lunatic/lunatic/internal/fakehost"
+
+func major() uint32 { return fakehost.Version[0] }
+func minor() uint32 { return fakehost.Version[1] }
+func patch() uint32 { return fakehost.Version[2] }
@@ -0,0 +1,17 @@
+// -*- compile-command: "GOOS=wasip1 GOARCH=wasm go test ./..."; -*-
+
+//go:build wasm
+
+package version
+
+//go:wasmimport lunatic::version major
+//go:noescape
+func major() uint32
+
+//go:wasmimport lunatic::version minor
+//go:noescape
+func minor() uint32
+
+//go:wasmimport lunatic::version patch
+//go:noescape
+func patch() uint32
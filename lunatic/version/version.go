@@ -4,19 +4,16 @@
 package version
 
 // Major returns the major version number.
-//
-//go:wasmimport lunatic::version major
-//go:noescape
-func Major() uint32
+func Major() uint32 {
+	return major()
+}
 
 // Minor returns the minor version number.
-//
-//go:wasmimport lunatic::version minor
-//go:noescape
-func Minor() uint32
+func Minor() uint32 {
+	return minor()
+}
 
 // Patch returns the patch version number.
-//
-//go:wasmimport lunatic::version patch
-//go:noescape
-func Patch() uint32
+func Patch() uint32 {
+	return patch()
+}
@@ -0,0 +1,26 @@
+// -*- compile-command: "go test ./..."; -*-
+
+//go:build !wasm
+
+package wasi
+
+import "github.com/gmlewis/go-lunatic/lunatic/internal/fakehost"
+
+func config(configID uint64) *fakehost.Config {
+	return fakehost.Resource[*fakehost.Config](fakehost.Current(), configID)
+}
+
+func config_add_environment_variable(configID uint64, keyPtr ptr, keyLen size, valuePtr ptr, valueLen size) {
+	c := config(configID)
+	c.Env = append(c.Env, fakehost.String(keyPtr, keyLen)+"="+fakehost.String(valuePtr, valueLen))
+}
+
+func config_add_command_line_argument(configID uint64, argumentPtr ptr, argumentLen size) {
+	c := config(configID)
+	c.Args = append(c.Args, fakehost.String(argumentPtr, argumentLen))
+}
+
+func config_preopen_dir(configID uint64, dirPtr ptr, dirLen size) {
+	c := config(configID)
+	c.PreopenedDirs = append(c.PreopenedDirs, fakehost.String(dirPtr, dirLen))
+}
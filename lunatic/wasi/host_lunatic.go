@@ -0,0 +1,17 @@
+// -*- compile-command: "GOOS=wasip1 GOARCH=wasm go test ./..."; -*-
+
+//go:build wasm
+
+package wasi
+
+//go:wasmimport lunatic::wasi config_add_environment_variable
+//go:noescape
+func config_add_environment_variable(configID uint64, keyPtr ptr, keyLen size, valuePtr ptr, valueLen size)
+
+//go:wasmimport lunatic::wasi config_add_command_line_argument
+//go:noescape
+func config_add_command_line_argument(configID uint64, argumentPtr ptr, argumentLen size)
+
+//go:wasmimport lunatic::wasi config_preopen_dir
+//go:noescape
+func config_preopen_dir(configID uint64, dirPtr ptr, dirLen size)
@@ -13,10 +13,6 @@ type size = uint32
 
 func mkptr[T any](v *T) ptr { return unsafe.Pointer(v) }
 
-//go:wasmimport lunatic::wasi config_add_environment_variable
-//go:noescape
-func config_add_environment_variable(configID uint64, keyPtr ptr, keyLen size, valuePtr ptr, valueLen size)
-
 // ConfigAddEnvironmentVariable adds an environment variable to a configuration.
 //
 // Returns:
@@ -29,14 +25,10 @@ func ConfigAddEnvironmentVariable(configID uint64, key, value string) (err error
 		}
 	}()
 
-	config_add_environment_variable(configID, mkptr(&key), size(len(key)), mkptr(&value), size(len(value)))
+	config_add_environment_variable(configID, mkptr(unsafe.StringData(key)), size(len(key)), mkptr(unsafe.StringData(value)), size(len(value)))
 	return nil
 }
 
-//go:wasmimport lunatic::wasi config_add_command_line_argument
-//go:noescape
-func config_add_command_line_argument(configID uint64, argumentPtr ptr, argumentLen size)
-
 // ConfigAddCommandLineArgument adds a command line argument to a configuration.
 //
 // Returns:
@@ -49,14 +41,10 @@ func ConfigAddCommandLineArgument(configID uint64, argument string) (err error)
 		}
 	}()
 
-	config_add_command_line_argument(configID, mkptr(&argument), size(len(argument)))
+	config_add_command_line_argument(configID, mkptr(unsafe.StringData(argument)), size(len(argument)))
 	return nil
 }
 
-//go:wasmimport lunatic::wasi config_preopen_dir
-//go:noescape
-func config_preopen_dir(configID uint64, dirPtr ptr, dirLen size)
-
 // ConfigPreopenDir marks a directory as pre-opened in the configuration.
 //
 // Returns:
@@ -69,6 +57,6 @@ func ConfigPreopenDir(configID uint64, dir string) (err error) {
 		}
 	}()
 
-	config_preopen_dir(configID, mkptr(&dir), size(len(dir)))
+	config_preopen_dir(configID, mkptr(unsafe.StringData(dir)), size(len(dir)))
 	return nil
 }